@@ -10,8 +10,10 @@ import (
 
 	"owl-engine/pkg/client/database"
 	"owl-engine/pkg/client/influxdb"
+	"owl-engine/pkg/client/prometheus"
 	"owl-engine/pkg/client/redis"
 	"owl-engine/pkg/config"
+	influxDto "owl-engine/pkg/dao/influxdb"
 	"owl-engine/pkg/service/v0/calculate"
 	"owl-engine/pkg/util/signals"
 	"owl-engine/pkg/xlogs"
@@ -72,9 +74,13 @@ func setup(conf *config.ServerRunOptions) {
 		xlogs.WithLoggerEncoder()).Build()
 
 	// 数据库
-	database.Setup(conf.MySQLOptions)
+	database.Setup(conf.MySQLOptions, conf.ServerOptions.Timezone)
 	influxdb.Setup(conf.InfluxDBOptions)
 	redis.Setup(conf.RedisOptions)
+	prometheus.Setup(conf.PrometheusOptions)
+
+	// 查询结果缓存
+	influxDto.QueryCache.Setup(conf.CacheOptions)
 }
 
 func taskGoroutine(stopCh <-chan struct{}, wg *sync.WaitGroup) {
@@ -83,11 +89,12 @@ func taskGoroutine(stopCh <-chan struct{}, wg *sync.WaitGroup) {
 	// 	这个约定有助于确保你的程序在组合和扩展时可以扩展
 	// 	我们如何确保 goroutine 能够被停止，可以根据 goroutine 的类型和用途而有所不同,
 	// 	但是它 们所有这些都是建立在完成 channel传递的基础上的
-	wg.Add(3)
+	wg.Add(4)
 
-	go calculate.Math(stopCh, wg)   // 数学规则
-	go calculate.Logger(stopCh, wg) // 日志规则
-	go calculate.Warn(stopCh, wg)   // 提醒
+	go calculate.Math(stopCh, wg)      // 数学规则
+	go calculate.Logger(stopCh, wg)    // 日志规则
+	go calculate.Composite(stopCh, wg) // 组合规则
+	go calculate.Warn(stopCh, wg)      // 提醒
 }
 
 func run(stopCh <-chan struct{}) error {
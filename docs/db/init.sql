@@ -7,17 +7,33 @@ CREATE TABLE `engine_tbl_rules`
 (
     `id`                  bigint(11) NOT NULL AUTO_INCREMENT COMMENT '主键',
     `name`                varchar(255) DEFAULT NULL COMMENT '规则唯一名称',
-    `calculate_type`      tinyint(1) NOT NULL COMMENT '计算类型:1-最大值; 2-最小值; 3-环比; 4-TopN; 5-BottomN',
+    `calculate_type`      tinyint(1) NOT NULL COMMENT '计算类型:1-最大值; 2-最小值; 3-环比; 4-TopN(N 个点大于阈值); 5-BottomN(N 个点小于阈值); 6-平均值; 7-无数据检测; 8-预测上升至阈值; 9-预测下降至阈值',
     `express`             tinytext COMMENT '计算表达式',
     `metric_list`         tinytext     NOT NULL COMMENT '指标名集',
     `threshold`           float        DEFAULT '0' COMMENT '阈值, 可为零值',
     `unit`                varchar(16)  DEFAULT NULL COMMENT '单位',
     `time_window`         varchar(255) DEFAULT NULL COMMENT '时间窗口, 默认都以 分钟 作为单位',
     `duration`            int(11) DEFAULT NULL COMMENT '持续时长或次数; 如果为时长, 其单位为: 分钟',
+    `interval`            varchar(16)  DEFAULT NULL COMMENT 'TopN/BottomN 对齐数据点的时间间隔, 如: 1m',
+    `fill`                varchar(16)  DEFAULT NULL COMMENT 'TopN/BottomN 对齐时缺失点的填充方式: null, none, previous, linear 或数值',
+    `match_count`         int(11) DEFAULT '0' COMMENT 'TopN/BottomN 需越过阈值的点数(N), 0 表示全部',
+    `point_count`         int(11) DEFAULT '0' COMMENT 'TopN/BottomN 参与计算的最近的点数(M), 0 表示全部',
     `origin`              varchar(64)  NOT NULL COMMENT '来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip',
     `business_type`       varchar(64)  NOT NULL COMMENT '产品名: 来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip',
     `category`            tinyint(1) DEFAULT NULL COMMENT '指标类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控',
     `extension_condition` varchar(255) DEFAULT NULL COMMENT '扩展条件',
+    `filters`             text COMMENT '标签过滤条件, json 格式, 如: {"logic":"AND","conditions":[{"tag":"host","operator":"=","value":"a"}]}',
+    `group_by`            varchar(255) DEFAULT NULL COMMENT '分组的标签, 每个标签集单独计算并告警, 多个值以 '','' 分隔',
+    `nodata`              varchar(16)  DEFAULT 'ok' COMMENT '查询无数据时的处理策略: alert-告警; keep-保持之前的状态; ok-视为正常',
+    `absent_for`          varchar(16)  DEFAULT NULL COMMENT '无数据检测规则: 持续该时长没有数据点即告警, 如: 10m',
+    `timezone`            varchar(64)  DEFAULT NULL COMMENT '规则的时区, 如: Asia/Shanghai; 为空时使用服务的时区',
+    `datasource`          varchar(32)  DEFAULT NULL COMMENT '规则的数据源: influxdb(默认), prometheus, mysql',
+    `datasource_id`       int(11) DEFAULT '0' COMMENT '引用的数据源 ID(engine_tbl_datasources), 0 表示使用配置文件中的数据源',
+    `baseline`            text COMMENT '动态基线阈值, json 格式, 如: {"mode":"stddev","days":7,"k":3}',
+    `horizon`             varchar(16)  DEFAULT NULL COMMENT '预测规则: 向前预测的时长, 如: 6h',
+    `forecast_method`     varchar(16)  DEFAULT NULL COMMENT '预测规则: 拟合方法, linear-线性回归; holt-Holt 双指数平滑',
+    `levels`              text COMMENT '多级阈值, json 格式, 如: [{"threshold":90,"level":3},{"express":"[A] > 95","level":4}]',
+    `labels`              text COMMENT '规则标签, json 格式, 标签值可以引用序列的标签, 如: {"env":"prod","instance":"{{ .Tags.host }}"}',
     `level`               tinyint(1) NOT NULL DEFAULT '3' COMMENT '告警级别:0-Not classified; 1-Information; 2-Warning; 3-critical; 4-Disaster',
     `creator`             varchar(32)  DEFAULT NULL COMMENT '规则创建者,用户的钉钉userid',
     `updater`             varchar(32)  DEFAULT NULL COMMENT '规则更新人,用户的钉钉userid',
@@ -44,6 +60,7 @@ CREATE TABLE `engine_tbl_alert`
     `alert_id`      varchar(40)  NOT NULL COMMENT '告警事件id',
     `name`          varchar(128) NOT NULL COMMENT '告警名称, 对应规则的名称',
     `item`          varchar(128) NOT NULL COMMENT '告警项, 对应规则的表达式',
+    `labels`        text COMMENT '告警标签, json 格式',
     `origin`        varchar(128) NOT NULL COMMENT '告警源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip',
     `type`          varchar(128) NOT NULL COMMENT '告警子类型,前端-异常、crash/业务-业务域/应用-异常、服务、JVM/组件-db、mq、redis/基础-网络、k8s、物理机、虚拟机',
     `category`      tinyint(1) NOT NULL COMMENT '告警类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控',
@@ -74,19 +91,22 @@ CREATE TABLE `engine_tbl_logger_rules`
 (
     `id`            bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '自增长主键',
     `name`          varchar(255) NOT NULL COMMENT '规则名称',
-    `source`        varchar(16)  NOT NULL DEFAULT 'es' COMMENT '日志数据源',
+    `source`        varchar(16)  NOT NULL DEFAULT 'es' COMMENT '日志数据源: es, loki',
     `address`       varchar(255)          DEFAULT NULL COMMENT '对于es等数据源,会需要连接地址,多个地址以 , 分隔',
     `username`      varchar(32)           DEFAULT NULL COMMENT '对于esc等数据源，其认证的用户名',
     `password`      varchar(32)           DEFAULT NULL COMMENT '对于es等数据源, 其需要认证的密码',
+    `datasource_id` int(11)               DEFAULT '0' COMMENT '引用的数据源 ID(engine_tbl_datasources), 不为 0 时忽略 address、username 及 password',
     `index`         varchar(128)          DEFAULT NULL COMMENT '对于 es 等数据源的索引, 支持模糊匹配',
     `message_field` varchar(32)  NOT NULL COMMENT '告警消息的具体内容',
-    `sql`           json         NOT NULL COMMENT 'es的查询语句',
+    `sql`           text         NOT NULL COMMENT 'es的查询语句(json) 或 loki 的 LogQL',
+    `time_window`   varchar(16)           DEFAULT NULL COMMENT 'loki 统计日志条数及拉取日志的时间窗口, 如: 5m',
     `threshold`     float(11, 0
 ) DEFAULT '1' COMMENT '阈值',
     `origin`             varchar(64)         NOT NULL COMMENT '来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip',
     `business_type`      varchar(64)         NOT NULL COMMENT '产品名: 来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip',
     `category`           tinyint(1)          NOT NULL COMMENT '指标类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控',
     `level`              tinyint(1)          NOT NULL DEFAULT '3' COMMENT '告警级别: 0 -- Not classified; 1 --- Information; 2 --- Warning; 3 --- critical; 4 --- Disaster',
+    `labels`             text COMMENT '规则标签, json 格式, 如: {"env":"prod"}',
     `creator`            varchar(32)         NOT NULL COMMENT '规则创建者, 用户钉钉的 userid',
     `updater`            varchar(32)                  DEFAULT NULL COMMENT '规则创建者, 用户钉钉的 userid',
     `responsible_people` varchar(255)        NOT NULL COMMENT '告警时间的处理人, 用户钉钉的 userid',
@@ -101,4 +121,84 @@ CREATE TABLE `engine_tbl_logger_rules`
     PRIMARY KEY (`id`),
     UNIQUE KEY `uk_name` (`name`) USING BTREE
 ) ENGINE = InnoDB
-  DEFAULT CHARSET = utf8mb4 COMMENT ='日志规则记录表'
\ No newline at end of file
+  DEFAULT CHARSET = utf8mb4 COMMENT ='日志规则记录表'
+
+-- 创建 组合规则表
+DROP TABLE IF EXISTS `engine_tbl_composite_rules`;
+CREATE TABLE `engine_tbl_composite_rules`
+(
+    `id`                 bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '自增长主键',
+    `name`               varchar(255) NOT NULL COMMENT '规则唯一名称',
+    `express`            tinytext     NOT NULL COMMENT '组合表达式, 以 [math:ID]、[logger:ID] 引用规则的告警状态, 如: [math:12] && [logger:3]',
+    `match_on`           varchar(255)          DEFAULT NULL COMMENT '按标签匹配被引用规则的序列, 如: origin, 多个值以 '','' 分隔',
+    `silent`             tinyint(1)            DEFAULT '2' COMMENT '被引用的规则是否静默通知, 1 --- yes; 2 --- no',
+    `silence_filters`    text COMMENT '静默的标签过滤条件, json 格式, 只静默标签匹配的告警; 为空时静默被引用规则的全部告警',
+    `template`           text COMMENT '告警内容的模板, 为空时使用默认模板',
+    `level`              tinyint(1)   NOT NULL DEFAULT '3' COMMENT '告警级别: 0 -- Not classified; 1 --- Information; 2 --- Warning; 3 --- critical; 4 --- Disaster',
+    `creator`            varchar(32)  NOT NULL COMMENT '规则创建者, 用户钉钉的 userid',
+    `updater`            varchar(32)           DEFAULT NULL COMMENT '规则更新人, 用户钉钉的 userid',
+    `responsible_people` varchar(255) NOT NULL COMMENT '告警事件处理人',
+    `crontab`            varchar(32)  NOT NULL DEFAULT '* * * * *' COMMENT '每条规则的定时任务执行表达式',
+    `switch`             tinyint(1)            DEFAULT '1' COMMENT '是否启用, 1 --- on; 2 --- off',
+    `inuse`              tinyint(1)            DEFAULT '2' COMMENT '是否删除, 1 --- yes; 2 --- no',
+    `group_ip`           varchar(255) NOT NULL COMMENT '告警时间接收者的组id, 多个值以 '','' 分隔',
+    `web_hooks`          tinytext COMMENT '告警的 hook 地址,多个值以 '','' 分隔',
+    `description`        tinytext COMMENT '规则描述',
+    `created_at`         datetime(6)           DEFAULT CURRENT_TIMESTAMP(6) COMMENT '记录创建时间',
+    `updated_at`         datetime(6)           DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP(6) COMMENT '记录更新时间',
+    `deleted_at`         datetime(6)           DEFAULT NULL COMMENT '记录删除时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_name` (`name`) USING BTREE
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='组合规则表'
+
+-- 创建 指标值表, 规则的数据源为 mysql 时使用
+DROP TABLE IF EXISTS `engine_tbl_metric`;
+CREATE TABLE `engine_tbl_metric`
+(
+    `id`         int(11)      NOT NULL AUTO_INCREMENT COMMENT '自增长主键',
+    `metric`     varchar(128) NOT NULL COMMENT '指标名',
+    `origin`     varchar(128) NOT NULL COMMENT '来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip',
+    `type`       varchar(128) NOT NULL COMMENT '类型,前端-异常、crash/业务-业务域/应用-异常、服务、JVM/组件-db、mq、redis/基础-网络、k8s、物理机、虚拟机',
+    `category`   int(2)       NOT NULL COMMENT '指标类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控',
+    `value`      double                DEFAULT NULL COMMENT '指标值',
+    `time`       timestamp    NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '时间戳',
+    `creator`    varchar(128) NOT NULL COMMENT '创建人,apiRobot/dbRobot/mqRobot',
+    `extension`  text COMMENT '扩展字段, 指标的标签, json 格式, 如: {"host": "10.0.0.1"}',
+    `created_at` timestamp    NOT NULL DEFAULT CURRENT_TIMESTAMP COMMENT '记录创建时间',
+    PRIMARY KEY (`id`),
+    KEY `idx_metric_time` (`metric`, `origin`, `type`, `category`, `time`) USING BTREE,
+    KEY `idx_time` (`time`) USING BTREE
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='指标值表'
+
+-- 创建 数据源表, 规则以 datasource_id 引用
+DROP TABLE IF EXISTS `engine_tbl_datasources`;
+CREATE TABLE `engine_tbl_datasources`
+(
+    `id`               bigint(20) unsigned NOT NULL AUTO_INCREMENT COMMENT '自增长主键',
+    `name`             varchar(255) NOT NULL COMMENT '数据源唯一名称',
+    `type`             varchar(16)  NOT NULL COMMENT '数据源类型: influxdb, prometheus, elasticsearch, loki',
+    `version`          int(11)               DEFAULT '0' COMMENT '数据源的版本, influxdb: 1 -- 1.x(InfluxQL), 2 -- 2.x(Flux)',
+    `endpoints`        varchar(1024) NOT NULL COMMENT '连接地址, 多个地址以 '','' 分隔',
+    `username`         varchar(64)           DEFAULT NULL COMMENT '认证的用户名',
+    `password`         varchar(255)          DEFAULT NULL COMMENT '认证的密码',
+    `token`            varchar(255)          DEFAULT NULL COMMENT '认证的 token, 如: InfluxDB 2.x 的 API Token',
+    `org`              varchar(64)           DEFAULT NULL COMMENT 'InfluxDB 2.x 的组织; loki 的租户(X-Scope-OrgID)',
+    `database`         varchar(64)           DEFAULT NULL COMMENT 'InfluxDB 1.x 的数据库',
+    `retention_policy` varchar(64)           DEFAULT NULL COMMENT 'InfluxDB 1.x 的保留策略',
+    `bucket`           varchar(128)          DEFAULT NULL COMMENT 'InfluxDB 2.x 的 bucket, 为空时使用 database/retention_policy',
+    `tls_skip_verify`  tinyint(1)            DEFAULT '2' COMMENT '是否跳过证书校验, 1 --- yes; 2 --- no',
+    `tls_ca`           text COMMENT '校验服务端证书的 CA 证书, PEM 格式',
+    `proxy`            varchar(255)          DEFAULT NULL COMMENT 'HTTP 代理地址, 如: http://127.0.0.1:3128',
+    `timeout`          int(11)               DEFAULT '30' COMMENT '单次请求的超时时间, 单位: 秒',
+    `description`      varchar(255)          DEFAULT NULL COMMENT '描述',
+    `creator`          varchar(32)  NOT NULL COMMENT '创建者, 用户钉钉的 userid',
+    `updater`          varchar(32)           DEFAULT NULL COMMENT '更新者, 用户钉钉的 userid',
+    `created_at`       datetime(6)           DEFAULT CURRENT_TIMESTAMP(6) COMMENT '记录创建时间',
+    `updated_at`       datetime(6)           DEFAULT NULL ON UPDATE CURRENT_TIMESTAMP(6) COMMENT '记录更新时间',
+    `deleted_at`       datetime(6)           DEFAULT NULL COMMENT '记录删除时间',
+    PRIMARY KEY (`id`),
+    UNIQUE KEY `uk_name` (`name`) USING BTREE
+) ENGINE = InnoDB
+  DEFAULT CHARSET = utf8mb4 COMMENT ='数据源表'
@@ -2,4 +2,8 @@ USE `owl`;
 
 DROP TABLE IF EXISTS `engine_tbl_rules`;
 
-DROP TABLE IF EXISTS `engine_tbl_alert`;
\ No newline at end of file
+DROP TABLE IF EXISTS `engine_tbl_alert`;
+
+DROP TABLE IF EXISTS `engine_tbl_composite_rules`;
+
+DROP TABLE IF EXISTS `engine_tbl_datasources`;
@@ -0,0 +1,47 @@
+package alert
+
+import (
+	"owl-engine/pkg/model/apiModel"
+	alertSrv "owl-engine/pkg/service/v0/alert"
+	"owl-engine/pkg/util/resp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type alert struct{}
+
+var Alert = new(alert)
+
+// QueryAlert 查询告警事件
+func (a *alert) QueryAlert(ctx *gin.Context) {
+	var condition apiModel.AlertCondition
+
+	var result = struct {
+		Page  int64            `json:"page"`
+		Size  int64            `json:"size"`
+		Total int64            `json:"total"`
+		Data  []apiModel.Alert `json:"data"`
+	}{
+		Data: make([]apiModel.Alert, 0),
+	}
+
+	err := ctx.ShouldBindWith(&condition, binding.Query)
+	if err == nil {
+		record, count, err := alertSrv.AlertSrv.QueryAlert(&condition)
+		if err == nil {
+			result.Page = condition.Page
+			result.Size = condition.Size
+			result.Total = count
+			result.Data = *record
+
+			resp.SuccessJsonResp(ctx, "0", "ok", result)
+			return
+		}
+
+		resp.ErrorResp(ctx, "1", err.Error())
+		return
+	}
+
+	resp.ErrorResp(ctx, "1", err.Error())
+}
@@ -0,0 +1,145 @@
+package datasource
+
+import (
+	"strings"
+
+	"owl-engine/pkg/model/apiModel"
+	datasourceSrv "owl-engine/pkg/service/v0/datasource"
+	"owl-engine/pkg/util"
+	"owl-engine/pkg/util/resp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type datasource struct{}
+
+var Datasource = new(datasource)
+
+// CheckDatasource 数据源校验, 并以提交的配置检查连通性及认证
+func (d *datasource) CheckDatasource(ctx *gin.Context) {
+	var ds = new(apiModel.Datasource)
+
+	if err := ctx.ShouldBindJSON(ds); err == nil {
+		if result, err := datasourceSrv.DatasourceSrv.CheckConnection(ctx.Request.Context(), ds); err == nil {
+			resp.SuccessJsonResp(ctx, "0", "ok", result)
+		} else {
+			resp.ErrorResp(ctx, "1", err.Error())
+		}
+	} else {
+		resp.ErrorResp(ctx, "1", err.Error())
+	}
+
+	return
+}
+
+// AddDatasource 添加数据源
+func (d *datasource) AddDatasource(ctx *gin.Context) {
+	var ds = new(apiModel.Datasource)
+
+	if err := ctx.ShouldBindJSON(ds); err == nil {
+		if err := datasourceSrv.DatasourceSrv.AddDatasource(ds); err == nil {
+			resp.SuccessResp(ctx, "0", "add datasource ok")
+		} else {
+			resp.ErrorResp(ctx, "1", err.Error())
+		}
+	} else {
+		resp.ErrorResp(ctx, "1", err.Error())
+	}
+
+	return
+}
+
+// QueryDatasource 查询数据源
+func (d *datasource) QueryDatasource(ctx *gin.Context) {
+	var condition = new(apiModel.DatasourceCondition)
+	var result = struct {
+		Page  int64                 `json:"page"`
+		Size  int64                 `json:"size"`
+		Total int64                 `json:"total"`
+		Data  []apiModel.Datasource `json:"data"`
+	}{
+		Data: make([]apiModel.Datasource, 0),
+	}
+
+	var err error
+	err = ctx.ShouldBindWith(condition, binding.Query)
+	if err == nil {
+		data, count, err := datasourceSrv.DatasourceSrv.QueryDatasource(condition)
+		if err == nil {
+			result.Page = condition.Page
+			result.Size = condition.Size
+			result.Total = count
+			result.Data = *data
+		}
+	}
+
+	if err == nil {
+		resp.SuccessJsonResp(ctx, "0", "query datasources success", result)
+	} else {
+		resp.SuccessJsonResp(ctx, "1", err.Error(), result)
+	}
+
+	return
+}
+
+// UpdateDatasource 更新数据源
+func (d *datasource) UpdateDatasource(ctx *gin.Context) {
+	var ds = new(apiModel.Datasource)
+
+	if err := ctx.ShouldBindJSON(ds); err == nil {
+		if err := datasourceSrv.DatasourceSrv.UpdateDatasource(ds); err == nil {
+			resp.SuccessResp(ctx, "0", "the datasource update success")
+		} else {
+			resp.ErrorResp(ctx, "1", "the datasource update error: "+err.Error())
+		}
+	} else {
+		resp.ErrorResp(ctx, "1", "the param deserialization json error: "+err.Error())
+	}
+
+	return
+}
+
+// DeleteDatasource 删除数据源, 支持以多个 id 批量删除
+func (d *datasource) DeleteDatasource(ctx *gin.Context) {
+	idStr := ctx.QueryArray("id")
+	if len(idStr) == 0 {
+		resp.ErrorResp(ctx, "1", "the id value must be specified")
+		ctx.Abort()
+		return
+	}
+
+	var ids = make([]int, 0)
+	for _, id := range idStr {
+		ids = append(ids, util.StringToInt(id))
+	}
+
+	updater := ctx.Query("updater")
+	if strings.Compare(updater, "") == 0 {
+		resp.ErrorResp(ctx, "1", "the updater value must be specified")
+		ctx.Abort()
+		return
+	}
+
+	if err := datasourceSrv.DatasourceSrv.DeleteDatasource(updater, ids); err == nil {
+		resp.SuccessResp(ctx, "0", "ok")
+	} else {
+		resp.ErrorResp(ctx, "1", err.Error())
+	}
+}
+
+// Health 检查已保存的数据源的连通性及认证
+func (d *datasource) Health(ctx *gin.Context) {
+	id := util.StringToInt(ctx.Param("id"))
+	if id <= 0 {
+		resp.ErrorResp(ctx, "1", "the datasource id should be a positive integer")
+		ctx.Abort()
+		return
+	}
+
+	if result, err := datasourceSrv.DatasourceSrv.Health(ctx.Request.Context(), uint(id)); err == nil {
+		resp.SuccessJsonResp(ctx, "0", "ok", result)
+	} else {
+		resp.ErrorResp(ctx, "1", err.Error())
+	}
+}
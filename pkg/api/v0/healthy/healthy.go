@@ -3,6 +3,8 @@ package healthy
 import (
 	"net/http"
 
+	influxDto "owl-engine/pkg/dao/influxdb"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,10 +23,13 @@ func Pong(ctx *gin.Context) {
 // 系统资源消耗的统计
 func Status(ctx *gin.Context) {
 	// TODO: 统计系统运行的资源消耗
+	var data = make(map[string]interface{})
+	data["query_cache"] = influxDto.QueryCache.Stats() // 查询结果缓存的命中统计
+
 	ctx.JSON(http.StatusOK, gin.H{
 		"status":  true,
 		"errCode": 0,
 		"errMsg":  "ok",
-		"data":    make(map[string]interface{}, 0),
+		"data":    data,
 	})
 }
@@ -0,0 +1,59 @@
+package metric
+
+import (
+	"io/ioutil"
+	"net/http"
+
+	"owl-engine/pkg/model/apiModel"
+	metricSrv "owl-engine/pkg/service/v0/metric"
+	"owl-engine/pkg/util/resp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+type metric struct{}
+
+var Metric = new(metric)
+
+// Push 上报指标值
+// Content-Type 为 text/plain 时请求体为 InfluxDB line protocol, 否则为 json 格式的指标值数组
+func (m *metric) Push(ctx *gin.Context) {
+	var condition = new(apiModel.MetricPushCondition)
+	if err := ctx.ShouldBindQuery(condition); err != nil {
+		resp.ErrorResp(ctx, "1", err.Error())
+		return
+	}
+
+	// 解析前限制请求体的大小, 指标值数量的上限在解析后才能校验
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, metricSrv.MaxBodyBytes)
+
+	var points = make([]apiModel.MetricPoint, 0)
+	switch ctx.ContentType() {
+	case binding.MIMEPlain:
+		body, err := ioutil.ReadAll(ctx.Request.Body)
+		if err == nil {
+			points, err = metricSrv.ParseLines(body, condition.Precision)
+		}
+		if err != nil {
+			resp.ErrorResp(ctx, "1", err.Error())
+			return
+		}
+	default:
+		if err := ctx.ShouldBindJSON(&points); err != nil {
+			resp.ErrorResp(ctx, "1", err.Error())
+			return
+		}
+	}
+
+	// 部分写入时, 返回已写入及失败的数量, 调用方只需重新上报失败的部分
+	if result, err := metricSrv.MetricSrv.Push(ctx.Request.Context(), condition, points); err == nil {
+		resp.SuccessJsonResp(ctx, "0", "ok", result)
+	} else if result != nil {
+		resp.ErrorJsonResp(ctx, "1", err.Error(), result)
+	} else {
+		resp.ErrorResp(ctx, "1", err.Error())
+	}
+
+	return
+}
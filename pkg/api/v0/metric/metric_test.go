@@ -0,0 +1,43 @@
+package metric
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metricSrv "owl-engine/pkg/service/v0/metric"
+	"owl-engine/pkg/util/resp"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPushBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var router = gin.New()
+	router.POST("/metric/push", Metric.Push)
+
+	var line = []byte("cpu,origin=web,type=host,category=5 value=1\n")
+	var cases = []struct {
+		contentType string
+		body        []byte
+	}{
+		{contentType: "text/plain", body: bytes.Repeat(line, metricSrv.MaxBodyBytes/len(line)+1)},
+		{contentType: "application/json", body: append([]byte(`[{"metric": "`), bytes.Repeat([]byte("x"), metricSrv.MaxBodyBytes)...)},
+	}
+
+	for _, c := range cases {
+		var w = httptest.NewRecorder()
+		var req = httptest.NewRequest(http.MethodPost, "/metric/push", bytes.NewReader(c.body))
+		req.Header.Set("Content-Type", c.contentType)
+		router.ServeHTTP(w, req)
+
+		var result resp.ResultResp
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		if w.Code != http.StatusBadRequest || result.Status || !strings.Contains(result.Message, "too large") {
+			t.Errorf("%s: push of %d bytes = %d %+v, want request body too large", c.contentType, len(c.body), w.Code, result)
+		}
+	}
+}
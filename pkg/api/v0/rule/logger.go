@@ -184,3 +184,13 @@ func (l *loggerRule) EnableOrDisableRule(ctx *gin.Context) {
 
 	return
 }
+
+// Evaluate 以真实的日志数据源立即计算一次规则, 不写入告警记录也不发送通知
+func (l *loggerRule) Evaluate(ctx *gin.Context) {
+	id := util.StringToInt(ctx.Param("id"))
+	if result, err := ruleSrv.LoggerRuleSrv.Evaluate(ctx.Request.Context(), id); err == nil {
+		resp.SuccessJsonResp(ctx, "0", "ok", result)
+	} else {
+		resp.ErrorResp(ctx, "1", err.Error())
+	}
+}
@@ -30,6 +30,11 @@ func (r *rule) CheckRule(ctx *gin.Context) {
 	}
 }
 
+// CalculateTypes 已注册的计算类型
+func (r *rule) CalculateTypes(ctx *gin.Context) {
+	resp.SuccessJsonResp(ctx, "0", "ok", ruleSrv.MathRuleSrv.CalculateTypes())
+}
+
 // AddRule 规则添加
 func (r *rule) AddRule(ctx *gin.Context) {
 	var rs apiModel.MathRule
@@ -174,3 +179,43 @@ func (r *rule) EnableOrDisableRule(ctx *gin.Context) {
 
 	return
 }
+
+// Backtest 以历史数据回测规则
+func (r *rule) Backtest(ctx *gin.Context) {
+	var request apiModel.BacktestRequest
+
+	if err := ctx.ShouldBindJSON(&request); err == nil {
+		if result, err := ruleSrv.MathRuleSrv.Backtest(ctx.Request.Context(), &request); err == nil {
+			resp.SuccessJsonResp(ctx, "0", "ok", result)
+		} else {
+			resp.ErrorResp(ctx, "1", err.Error())
+		}
+	} else {
+		resp.ErrorResp(ctx, "1", err.Error())
+	}
+}
+
+// Evaluate 以真实的数据源立即计算一次规则, 不写入告警记录也不发送通知
+func (r *rule) Evaluate(ctx *gin.Context) {
+	id := util.StringToInt(ctx.Param("id"))
+	if result, err := ruleSrv.MathRuleSrv.Evaluate(ctx.Request.Context(), id); err == nil {
+		resp.SuccessJsonResp(ctx, "0", "ok", result)
+	} else {
+		resp.ErrorResp(ctx, "1", err.Error())
+	}
+}
+
+// MigrateFilters 将规则旧版的扩展条件迁移为结构化的过滤条件并保存, 返回已迁移及无法迁移的规则
+func (r *rule) MigrateFilters(ctx *gin.Context) {
+	updater, ok := ctx.GetQuery("updater")
+	if !ok || strings.Compare(updater, "") == 0 {
+		resp.ErrorResp(ctx, "1", "the updater value of the rule must be specified")
+		return
+	}
+
+	if result, err := ruleSrv.MathRuleSrv.MigrateFilters(updater); err == nil {
+		resp.SuccessJsonResp(ctx, "0", "ok", result)
+	} else {
+		resp.ErrorResp(ctx, "1", err.Error())
+	}
+}
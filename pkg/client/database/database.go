@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"net/url"
 	"owl-engine/pkg/config"
 	"owl-engine/pkg/xlogs"
 
@@ -12,9 +13,10 @@ import (
 
 var DB *gorm.DB
 
-func Setup(conf *config.MySQLOptions) {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		conf.Username, conf.Password, conf.Host, conf.Port, conf.DBName)
+// Setup 初始化数据库连接, 时间字段以服务的时区 timezone 进行读写
+func Setup(conf *config.MySQLOptions, timezone string) {
+	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=%s",
+		conf.Username, conf.Password, conf.Host, conf.Port, conf.DBName, url.QueryEscape(timezone))
 
 	var err error
 	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{
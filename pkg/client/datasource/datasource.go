@@ -0,0 +1,220 @@
+package datasource
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/lib/flux"
+	"owl-engine/pkg/lib/loki"
+	"owl-engine/pkg/lib/prometheus"
+	"owl-engine/pkg/model/dbModel"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// 数据源的类型
+const (
+	TypeInfluxDB      = "influxdb"
+	TypePrometheus    = "prometheus"
+	TypeElasticsearch = "elasticsearch"
+	TypeLoki          = "loki"
+)
+
+// Types 支持的数据源类型
+var Types = []string{TypeInfluxDB, TypePrometheus, TypeElasticsearch, TypeLoki}
+
+// 未配置超时时间时, 单次请求的超时时间
+const defaultTimeout = 30 * time.Second
+
+// Connection 依据数据源记录创建的客户端, 按数据源的类型(及版本)只初始化其中一个
+type Connection struct {
+	Record     dbModel.Datasource
+	Influx     client.Client         // InfluxDB 1.x
+	Flux       *flux.Client          // InfluxDB 2.x
+	Prometheus *prometheus.Client    // Prometheus
+	ES         *elasticsearch.Client // Elasticsearch
+	Loki       *loki.Client          // Grafana Loki
+
+	transport *http.Transport
+}
+
+// NewConnection 依据数据源记录创建客户端, 连接地址、TLS 及代理的配置错误时返回错误, 不检查连通性
+func NewConnection(record *dbModel.Datasource) (*Connection, error) {
+	var endpoints = Endpoints(record.Endpoints)
+	if len(endpoints) == 0 {
+		return nil, errors.New("the endpoints of datasource cannot be empty")
+	}
+	for _, endpoint := range endpoints {
+		if u, err := url.Parse(endpoint); err != nil || strings.Compare(u.Scheme, "") == 0 || strings.Compare(u.Host, "") == 0 {
+			return nil, fmt.Errorf("the endpoint {%s} of datasource is incorrect, example: http://127.0.0.1:8086", endpoint)
+		}
+	}
+
+	transport, err := newTransport(record)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeout = time.Duration(record.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	var conn = &Connection{Record: *record, transport: transport}
+	switch record.Type {
+	case TypeInfluxDB:
+		if record.Version == 2 {
+			conn.Flux = flux.NewClient(endpoints[0], record.Org, record.Token, timeout)
+			conn.Flux.HTTP.Transport = transport
+			break
+		}
+
+		conn.Influx, err = client.NewHTTPClient(client.HTTPConfig{
+			Addr:      endpoints[0],
+			Username:  record.Username,
+			Password:  record.Password,
+			Timeout:   timeout,
+			TLSConfig: transport.TLSClientConfig,
+			Proxy:     transport.Proxy,
+		})
+	case TypePrometheus:
+		conn.Prometheus = prometheus.NewClient(endpoints[0], record.Username, record.Password, timeout)
+		conn.Prometheus.HTTP.Transport = transport
+	case TypeElasticsearch:
+		transport.ResponseHeaderTimeout = timeout
+		conn.ES, err = elasticsearch.NewClient(elasticsearch.Config{
+			Addresses:  endpoints,
+			Username:   record.Username,
+			Password:   record.Password,
+			MaxRetries: 3,
+			Transport:  transport,
+		})
+	case TypeLoki:
+		conn.Loki = loki.NewClient(endpoints[0], record.Username, record.Password, timeout)
+		conn.Loki.OrgID = record.Org
+		conn.Loki.HTTP.Transport = transport
+	default:
+		return nil, errors.New("the type of datasource must be one of " + strings.Join(Types, ", "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating the %s client error: %s", record.Type, err.Error())
+	}
+
+	return conn, nil
+}
+
+// Endpoints 拆分以 ',' 分隔的连接地址, 忽略空白的地址
+func Endpoints(value string) []string {
+	var endpoints = make([]string, 0)
+	for _, endpoint := range strings.Split(value, ",") {
+		if endpoint = strings.TrimSpace(endpoint); strings.Compare(endpoint, "") != 0 {
+			endpoints = append(endpoints, strings.TrimRight(endpoint, "/"))
+		}
+	}
+	return endpoints
+}
+
+// 数据源的 HTTP 传输层: TLS 校验、CA 证书及代理
+func newTransport(record *dbModel.Datasource) (*http.Transport, error) {
+	var tlsConfig = &tls.Config{MinVersion: tls.VersionTLS11, InsecureSkipVerify: record.TLSSkipVerify == 1}
+	if strings.Compare(strings.TrimSpace(record.TLSCA), "") != 0 {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(record.TLSCA)) {
+			return nil, errors.New("the tls_ca of datasource is not a valid PEM certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	var transport = &http.Transport{
+		MaxIdleConnsPerHost: 10,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+		}).DialContext,
+		TLSClientConfig: tlsConfig,
+	}
+
+	if strings.Compare(record.Proxy, "") != 0 {
+		proxyUrl, err := url.Parse(record.Proxy)
+		if err != nil || strings.Compare(proxyUrl.Host, "") == 0 {
+			return nil, fmt.Errorf("the proxy {%s} of datasource is incorrect, example: http://127.0.0.1:3128", record.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	return transport, nil
+}
+
+// Bucket InfluxDB 2.x 查询的 bucket, 未配置时使用 database/retention_policy(DBRP 映射)
+func (c *Connection) Bucket() string {
+	if strings.Compare(c.Record.Bucket, "") != 0 {
+		return c.Record.Bucket
+	}
+	if strings.Compare(c.Record.RetentionPolicy, "") != 0 {
+		return c.Record.Database + "/" + c.Record.RetentionPolicy
+	}
+	return c.Record.Database
+}
+
+// Health 检查数据源的连通性及认证, 执行一次代价最小的查询
+func (c *Connection) Health(ctx context.Context) error {
+	switch {
+	case c.Influx != nil:
+		// client 不支持 context, 在单独的 goroutine 中执行查询; 通道带缓冲, 超时返回后 goroutine 也能正常退出
+		var ch = make(chan error, 1)
+		go func() {
+			response, err := c.Influx.Query(client.NewQuery("SHOW DATABASES", "", ""))
+			if err == nil {
+				err = response.Error()
+			}
+			ch <- err
+		}()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-ch:
+			return err
+		}
+	case c.Flux != nil:
+		_, err := c.Flux.Query(ctx, "buckets() |> limit(n: 1)")
+		return err
+	case c.Prometheus != nil:
+		_, err := c.Prometheus.Query(ctx, "1", time.Now())
+		return err
+	case c.ES != nil:
+		response, err := c.ES.Cluster.Health(c.ES.Cluster.Health.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		if response.IsError() {
+			body, _ := ioutil.ReadAll(response.Body)
+			return fmt.Errorf("elasticsearch cluster health error, status code: %d, %s", response.StatusCode, string(body))
+		}
+		return nil
+	case c.Loki != nil:
+		_, err := c.Loki.Labels(ctx, time.Now().Add(-5*time.Minute), time.Now())
+		return err
+	default:
+		return errors.New("the client of datasource is not initialized")
+	}
+}
+
+// Close 释放客户端的空闲连接
+func (c *Connection) Close() {
+	if c.Influx != nil {
+		_ = c.Influx.Close()
+	}
+	c.transport.CloseIdleConnections()
+}
@@ -0,0 +1,38 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"owl-engine/pkg/model/dbModel"
+)
+
+func TestHealthInfluxContext(t *testing.T) {
+	var release = make(chan struct{})
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	conn, err := NewConnection(&dbModel.Datasource{Type: TypeInfluxDB, Version: 1, Endpoints: server.URL, Database: "test", Timeout: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var start = time.Now()
+	if err := conn.Health(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Health() = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Health() returned after %s, want it bounded by ctx", elapsed)
+	}
+}
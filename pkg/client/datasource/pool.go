@@ -0,0 +1,107 @@
+package datasource
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	datasourceDto "owl-engine/pkg/dao/mysql/datasource"
+	"owl-engine/pkg/lib/singleflight"
+)
+
+// 连接缓存的有效期, 过期后重新读取数据源记录, 使其他实例对数据源的修改生效
+const connectionTTL = time.Minute
+
+// 读取数据源记录, 测试时替换
+var selectById = datasourceDto.DatasourceDto.SelectById
+
+type pooled struct {
+	conn     *Connection
+	loadedAt time.Time
+}
+
+// 数据源的连接池, key 为数据源 ID
+// mu 只保护 conns 及 versions, 数据源记录的查询及客户端的创建在锁外进行, 相同 ID 的并发加载由 loads 合并
+var pool = struct {
+	mu       sync.Mutex
+	conns    map[uint]*pooled
+	versions map[uint]uint64 // 每次 Invalidate 递增, 加载期间数据源被修改时不缓存加载的结果
+	loads    singleflight.Group
+}{conns: make(map[uint]*pooled), versions: make(map[uint]uint64)}
+
+// Get 获取数据源的连接, 未缓存或缓存过期时依据数据源记录重新创建
+// 数据源记录未变更(updated_at 相同)时继续使用原来的连接
+func Get(id uint) (*Connection, error) {
+	pool.mu.Lock()
+	cached, ok := pool.conns[id]
+	pool.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < connectionTTL {
+		return cached.conn, nil
+	}
+
+	conn, err, _ := pool.loads.Do(strconv.FormatUint(uint64(id), 10), func() (interface{}, error) {
+		return load(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return conn.(*Connection), nil
+}
+
+// 读取数据源记录并创建连接, 替换缓存中的旧连接
+func load(id uint) (*Connection, error) {
+	pool.mu.Lock()
+	version := pool.versions[id]
+	pool.mu.Unlock()
+
+	record, err := selectById(id)
+	if err != nil {
+		pool.mu.Lock()
+		if cached, ok := pool.conns[id]; ok {
+			cached.conn.Close()
+			delete(pool.conns, id)
+		}
+		pool.mu.Unlock()
+		return nil, fmt.Errorf("query the datasource [%d] error: %s", id, err.Error())
+	}
+
+	pool.mu.Lock()
+	if cached, ok := pool.conns[id]; ok && cached.conn.Record.UpdatedAt.Equal(record.UpdatedAt) {
+		cached.loadedAt = time.Now()
+		pool.mu.Unlock()
+		return cached.conn, nil
+	}
+	pool.mu.Unlock()
+
+	conn, err := NewConnection(record)
+	if err != nil {
+		return nil, fmt.Errorf("the datasource [%d] %s", id, err.Error())
+	}
+
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	// 加载期间数据源被更新或删除, 本次的连接只供当前调用使用, 下次使用时重新加载
+	if pool.versions[id] != version {
+		return conn, nil
+	}
+
+	if cached, ok := pool.conns[id]; ok {
+		cached.conn.Close()
+	}
+	pool.conns[id] = &pooled{conn: conn, loadedAt: time.Now()}
+	return conn, nil
+}
+
+// Invalidate 数据源更新或删除后移除缓存的连接, 下次使用时重新创建
+func Invalidate(id uint) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.versions[id]++
+	if cached, ok := pool.conns[id]; ok {
+		cached.conn.Close()
+		delete(pool.conns, id)
+	}
+}
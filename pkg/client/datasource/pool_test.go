@@ -0,0 +1,179 @@
+package datasource
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"owl-engine/pkg/model/dbModel"
+)
+
+// 以内存中的记录替换数据源的查询, block 不为空时查询等待其关闭
+type fakeRecords struct {
+	mu      sync.Mutex
+	records map[uint]*dbModel.Datasource
+	block   map[uint]chan struct{}
+	queries int32
+}
+
+func (f *fakeRecords) selectById(id uint) (*dbModel.Datasource, error) {
+	atomic.AddInt32(&f.queries, 1)
+
+	f.mu.Lock()
+	block := f.block[id]
+	f.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	record, ok := f.records[id]
+	if !ok {
+		return nil, errors.New("record not found")
+	}
+	var copied = *record
+	return &copied, nil
+}
+
+func (f *fakeRecords) set(id uint, updatedAt time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records[id] = &dbModel.Datasource{ID: id, Type: TypePrometheus, Endpoints: "http://127.0.0.1:9090", UpdatedAt: updatedAt}
+}
+
+func setupPool(t *testing.T) *fakeRecords {
+	var fake = &fakeRecords{records: make(map[uint]*dbModel.Datasource), block: make(map[uint]chan struct{})}
+	var original = selectById
+	selectById = fake.selectById
+
+	t.Cleanup(func() {
+		selectById = original
+		pool.mu.Lock()
+		pool.conns = make(map[uint]*pooled)
+		pool.versions = make(map[uint]uint64)
+		pool.mu.Unlock()
+	})
+	return fake
+}
+
+// 使缓存的连接过期, 下次使用时重新读取数据源记录
+func expire(id uint) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if cached, ok := pool.conns[id]; ok {
+		cached.loadedAt = time.Now().Add(-connectionTTL)
+	}
+}
+
+func TestPoolGet(t *testing.T) {
+	fake := setupPool(t)
+	var updatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake.set(1, updatedAt)
+
+	first, err := Get(1)
+	if err != nil {
+		t.Fatalf("Get error: %s", err.Error())
+	}
+	if conn, _ := Get(1); conn != first || fake.queries != 1 {
+		t.Errorf("cached connection not reused, queries = %d", fake.queries)
+	}
+
+	// 过期后记录未变更, 继续使用原来的连接
+	expire(1)
+	if conn, _ := Get(1); conn != first || fake.queries != 2 {
+		t.Errorf("unchanged record should keep the connection, queries = %d", fake.queries)
+	}
+
+	// 过期后记录已变更, 创建新的连接
+	fake.set(1, updatedAt.Add(time.Second))
+	expire(1)
+	if conn, _ := Get(1); conn == first {
+		t.Errorf("changed record should create a new connection")
+	}
+
+	// 记录不存在时移除缓存的连接
+	fake.mu.Lock()
+	delete(fake.records, 1)
+	fake.mu.Unlock()
+	expire(1)
+	if _, err := Get(1); err == nil {
+		t.Errorf("Get of a missing datasource should fail")
+	}
+	if _, ok := pool.conns[1]; ok {
+		t.Errorf("the connection of a missing datasource should be removed")
+	}
+}
+
+func TestPoolGetConcurrent(t *testing.T) {
+	fake := setupPool(t)
+	fake.set(1, time.Now())
+	fake.set(2, time.Now())
+
+	// 数据源 1 的查询阻塞期间, 相同 ID 的并发调用合并为一次查询, 其他数据源的获取不受影响
+	var release = make(chan struct{})
+	fake.block[1] = release
+
+	var wg sync.WaitGroup
+	var conns = make([]*Connection, 5)
+	for i := range conns {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			conns[i], _ = Get(1)
+		}(i)
+	}
+
+	var done = make(chan struct{})
+	go func() {
+		_, _ = Get(2)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Get(2) blocked by the lookup of datasource 1")
+	}
+
+	// 等待并发调用进入查询后放行
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for _, conn := range conns {
+		if conn == nil || conn != conns[0] {
+			t.Fatalf("concurrent Get returned different connections")
+		}
+	}
+	if queries := atomic.LoadInt32(&fake.queries); queries != 2 {
+		t.Errorf("queries = %d, want 2", queries)
+	}
+}
+
+func TestPoolInvalidateDuringLoad(t *testing.T) {
+	fake := setupPool(t)
+	fake.set(1, time.Now())
+
+	var release = make(chan struct{})
+	fake.block[1] = release
+
+	var done = make(chan *Connection)
+	go func() {
+		conn, _ := Get(1)
+		done <- conn
+	}()
+
+	// 加载期间数据源被修改, 加载的连接不进入缓存
+	time.Sleep(50 * time.Millisecond)
+	Invalidate(1)
+	close(release)
+
+	if conn := <-done; conn == nil {
+		t.Fatalf("Get should still return the loaded connection")
+	}
+	if _, ok := pool.conns[1]; ok {
+		t.Errorf("the connection loaded before Invalidate should not be cached")
+	}
+}
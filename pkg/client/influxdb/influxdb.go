@@ -1,16 +1,33 @@
 package influxdb
 
 import (
-	"owl-engine/pkg/xlogs"
+	"time"
 
 	"owl-engine/pkg/config"
+	"owl-engine/pkg/lib/flux"
+	"owl-engine/pkg/xlogs"
 
 	client "github.com/influxdata/influxdb1-client/v2"
 )
 
 var InfluxDBClient *client.Client
 
+// FluxClient InfluxDB 2.x 的客户端, 配置的 version 为 2 时初始化
+var FluxClient *flux.Client
+
 func Setup(conf *config.InfluxDBOptions) {
+	if conf.Version == 2 {
+		// 配置文件中的 timeout 为不带单位的秒数
+		timeout := conf.Timeout
+		if timeout > 0 && timeout < time.Second {
+			timeout *= time.Second
+		}
+
+		FluxClient = flux.NewClient(conf.Address, conf.Org, conf.Token, timeout)
+		xlogs.Info("InfluxDB 2.x client initialize success")
+		return
+	}
+
 	cli, err := client.NewHTTPClient(client.HTTPConfig{
 		Addr:     conf.Address,
 		Username: conf.Username,
@@ -0,0 +1,21 @@
+package prometheus
+
+import (
+	"strings"
+	"time"
+
+	"owl-engine/pkg/config"
+	"owl-engine/pkg/lib/prometheus"
+	"owl-engine/pkg/xlogs"
+)
+
+var PrometheusClient *prometheus.Client
+
+func Setup(conf *config.PrometheusOptions) {
+	PrometheusClient = prometheus.NewClient(conf.Address, conf.Username, conf.Password, time.Duration(conf.Timeout)*time.Second)
+	if strings.Compare(conf.Address, "") == 0 {
+		xlogs.Info("Prometheus address is not configured, rules with datasource prometheus cannot be calculated")
+		return
+	}
+	xlogs.Info("Prometheus client initialize success")
+}
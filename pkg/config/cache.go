@@ -0,0 +1,16 @@
+package config
+
+// CacheOptions 查询结果缓存的配置
+type CacheOptions struct {
+	Enable  bool   `json:"enable" yaml:"enable"`
+	Backend string `json:"backend" yaml:"backend"` // 缓存的存储: memory -- 进程内; redis -- 多实例共享
+	TTL     int    `json:"ttl" yaml:"ttl"`         // 缓存的有效期, 同时作为对齐的时间桶大小, 单位: 秒
+}
+
+func NewCacheOptions() *CacheOptions {
+	return &CacheOptions{
+		Enable:  true,
+		Backend: "memory",
+		TTL:     30,
+	}
+}
@@ -16,22 +16,26 @@ var (
 )
 
 type ServerRunOptions struct {
-	ServerOptions   *ServerOptions   `mapstructure:"app"`
-	MySQLOptions    *MySQLOptions    `mapstructure:"mysql"`
-	RedisOptions    *RedisOptions    `mapstructure:"redis"`
-	InfluxDBOptions *InfluxDBOptions `mapstructure:"influxdb"`
-	LoggerOptions   *LoggerOptions   `mapstructure:"log"`
-	EventOptions    *EventOptions    `mapstructure:"event"`
+	ServerOptions     *ServerOptions     `mapstructure:"app"`
+	MySQLOptions      *MySQLOptions      `mapstructure:"mysql"`
+	RedisOptions      *RedisOptions      `mapstructure:"redis"`
+	InfluxDBOptions   *InfluxDBOptions   `mapstructure:"influxdb"`
+	LoggerOptions     *LoggerOptions     `mapstructure:"log"`
+	EventOptions      *EventOptions      `mapstructure:"event"`
+	CacheOptions      *CacheOptions      `mapstructure:"cache"`
+	PrometheusOptions *PrometheusOptions `mapstructure:"prometheus"`
 }
 
 func newConfig() *ServerRunOptions {
 	return &ServerRunOptions{
-		ServerOptions:   NewServerOptions(),
-		MySQLOptions:    NewMySQLOptions(),
-		RedisOptions:    NewRedisOptions(),
-		InfluxDBOptions: NewInfluxDBOptions(),
-		LoggerOptions:   NewLoggerOptions(),
-		EventOptions:    NewEventOptions(),
+		ServerOptions:     NewServerOptions(),
+		MySQLOptions:      NewMySQLOptions(),
+		RedisOptions:      NewRedisOptions(),
+		InfluxDBOptions:   NewInfluxDBOptions(),
+		LoggerOptions:     NewLoggerOptions(),
+		EventOptions:      NewEventOptions(),
+		CacheOptions:      NewCacheOptions(),
+		PrometheusOptions: NewPrometheusOptions(),
 	}
 }
 
@@ -58,6 +62,10 @@ func LoadFromApollo() error {
 	conf.ServerOptions.Secret = appSecret
 	conf.ServerOptions.EnableProxy = enableProxy
 	conf.ServerOptions.Proxy = proxy
+	if timezone := client.GetValue("engine.timezone"); strings.Compare(timezone, "") != 0 {
+		conf.ServerOptions.Timezone = timezone
+	}
+	conf.ServerOptions.EvaluateTimeout = client.GetIntValue("engine.evaluate.timeout", 30)
 
 	// db配置
 	dbHost := client.GetValue("engine.db.host")
@@ -94,6 +102,13 @@ func LoadFromApollo() error {
 	conf.InfluxDBOptions.RetentionPolicy = influxRetentionPolicy
 	conf.InfluxDBOptions.Timeout = time.Duration(influxTimeout) * time.Second
 	conf.InfluxDBOptions.MetisUrl = metisUrl
+	conf.InfluxDBOptions.Version = client.GetIntValue("engine.influxdb.version", 1)
+	conf.InfluxDBOptions.Org = client.GetValue("engine.influxdb.org")
+	conf.InfluxDBOptions.Bucket = client.GetValue("engine.influxdb.bucket")
+	conf.InfluxDBOptions.Token = client.GetValue("engine.influxdb.token")
+	if anomalyBackend := client.GetValue("engine.anomaly.backend"); strings.Compare(anomalyBackend, "") != 0 {
+		conf.InfluxDBOptions.AnomalyBackend = anomalyBackend
+	}
 
 	// redis配置
 	redisMode := client.GetValue("engine.redis.mode")
@@ -154,6 +169,19 @@ func LoadFromApollo() error {
 		conf.EventOptions.Hooks = append(conf.EventOptions.Hooks, strings.Split(alertHooks, ",")...)
 	}
 
+	// 查询结果缓存配置
+	conf.CacheOptions.Enable = client.GetBoolValue("engine.cache.enable", true)
+	if cacheBackend := client.GetValue("engine.cache.backend"); strings.Compare(cacheBackend, "") != 0 {
+		conf.CacheOptions.Backend = cacheBackend
+	}
+	conf.CacheOptions.TTL = client.GetIntValue("engine.cache.ttl", 30)
+
+	// prometheus 数据源配置
+	conf.PrometheusOptions.Address = client.GetValue("engine.prometheus.addr")
+	conf.PrometheusOptions.Username = client.GetValue("engine.prometheus.username")
+	conf.PrometheusOptions.Password = client.GetValue("engine.prometheus.password")
+	conf.PrometheusOptions.Timeout = client.GetIntValue("engine.prometheus.timeout", 30)
+
 	sharedConfig = conf
 	return nil
 }
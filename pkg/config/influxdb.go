@@ -2,29 +2,40 @@ package config
 
 import (
 	"owl-engine/pkg/util/reflectutils"
+	"strings"
 	"time"
 
 	"github.com/spf13/pflag"
 )
 
 type InfluxDBOptions struct {
+	AnomalyBackend  string        `json:"anomaly_backend" yaml:"anomalyBackend"` // 异常检测的后端: native -- 内置检测(默认); metis -- 外部 Metis 服务
 	MetisUrl        string        `json:"metis_url" yaml:"metisUrl"`
+	Version         int           `json:"version" yaml:"version"` // 客户端的类型: 1 -- InfluxDB 1.x, 以 InfluxQL 查询(默认); 2 -- InfluxDB 2.x, 以 Flux 查询
 	Address         string        `json:"address" yaml:"address"`
 	Username        string        `json:"username" yaml:"username"`
 	Password        string        `json:"password" yaml:"password"`
 	Database        string        `json:"database" yaml:"database"`
 	RetentionPolicy string        `json:"retention_policy" yaml:"retentionPolicy"`
+	Org             string        `json:"org" yaml:"org"`       // InfluxDB 2.x 的组织
+	Bucket          string        `json:"bucket" yaml:"bucket"` // InfluxDB 2.x 的 bucket, 为空时使用 database/retentionPolicy
+	Token           string        `json:"token" yaml:"token"`   // InfluxDB 2.x 的 API Token
 	Timeout         time.Duration `json:"timeout" yaml:"timeout"`
 }
 
 func NewInfluxDBOptions() *InfluxDBOptions {
 	return &InfluxDBOptions{
+		AnomalyBackend:  "native",
 		MetisUrl:        "",
+		Version:         1,
 		Address:         "",
 		Username:        "",
 		Password:        "",
 		Database:        "",
 		RetentionPolicy: "",
+		Org:             "",
+		Bucket:          "",
+		Token:           "",
 		Timeout:         time.Duration(10) * time.Second,
 	}
 }
@@ -35,6 +46,17 @@ func (i *InfluxDBOptions) Validate() []error {
 	return errors
 }
 
+// FluxBucket InfluxDB 2.x 查询的 bucket, 未配置时以 database/retentionPolicy 映射到 bucket
+func (i *InfluxDBOptions) FluxBucket() string {
+	if strings.Compare(i.Bucket, "") != 0 {
+		return i.Bucket
+	}
+	if strings.Compare(i.RetentionPolicy, "") == 0 {
+		return i.Database
+	}
+	return i.Database + "/" + i.RetentionPolicy
+}
+
 func (i *InfluxDBOptions) ApplyTo(options *InfluxDBOptions) {
 	reflectutils.Override(options, i)
 }
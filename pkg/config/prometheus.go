@@ -0,0 +1,18 @@
+package config
+
+// PrometheusOptions Prometheus 数据源的配置, 规则的 datasource 为 prometheus 时使用
+type PrometheusOptions struct {
+	Address  string `json:"address" yaml:"address"` // Prometheus HTTP API 的地址, 如: http://127.0.0.1:9090
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	Timeout  int    `json:"timeout" yaml:"timeout"` // 单次查询的超时时间, 单位: 秒
+}
+
+func NewPrometheusOptions() *PrometheusOptions {
+	return &PrometheusOptions{
+		Address:  "",
+		Username: "",
+		Password: "",
+		Timeout:  30,
+	}
+}
@@ -2,27 +2,35 @@ package config
 
 import (
 	"fmt"
+	"time"
+
+	"owl-engine/pkg/model/constParam"
+	"owl-engine/pkg/util"
 
 	"github.com/spf13/pflag"
 )
 
 type ServerOptions struct {
-	Mode        string `json:"mode,omitempty" yaml:"mode"`
-	Bind        string `json:"bind,omitempty" yaml:"bind"`
-	Port        int    `json:"port" yaml:"port"`
-	Secret      string `json:"secret" yaml:"secret"`
-	EnableProxy bool   `json:"enable_proxy" yaml:"enableProxy"`
-	Proxy       string `json:"proxy" yaml:"proxy"`
+	Mode            string `json:"mode,omitempty" yaml:"mode"`
+	Bind            string `json:"bind,omitempty" yaml:"bind"`
+	Port            int    `json:"port" yaml:"port"`
+	Secret          string `json:"secret" yaml:"secret"`
+	EnableProxy     bool   `json:"enable_proxy" yaml:"enableProxy"`
+	Proxy           string `json:"proxy" yaml:"proxy"`
+	Timezone        string `json:"timezone" yaml:"timezone"`                // 服务的时区, 用于查询、时间窗口、定时任务及告警时间
+	EvaluateTimeout int    `json:"evaluate_timeout" yaml:"evaluateTimeout"` // 单条规则每次计算的超时时间, 单位: 秒
 }
 
 func NewServerOptions() *ServerOptions {
 	return &ServerOptions{
-		Mode:        "dev",
-		Bind:        "0.0.0.0",
-		Port:        9530,
-		Secret:      "",
-		EnableProxy: false,
-		Proxy:       "",
+		Mode:            "dev",
+		Bind:            "0.0.0.0",
+		Port:            9530,
+		Secret:          "",
+		EnableProxy:     false,
+		Proxy:           "",
+		Timezone:        constParam.DefaultTimezone,
+		EvaluateTimeout: 30,
 	}
 }
 
@@ -33,6 +41,14 @@ func (s *ServerOptions) Validate() []error {
 		errors = append(errors, fmt.Errorf("secure port must be between 0 and 65535"))
 	}
 
+	if _, err := util.LoadLocation(s.Timezone); err != nil {
+		errors = append(errors, fmt.Errorf("timezone %s is incorrect, %s", s.Timezone, err.Error()))
+	}
+
+	if s.EvaluateTimeout < 0 {
+		errors = append(errors, fmt.Errorf("evaluate timeout must be greater than or equal to 0"))
+	}
+
 	return errors
 }
 
@@ -40,4 +56,24 @@ func (s *ServerOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.Bind, "bind-address", "0.0.0.0", "server bind address")
 	fs.IntVar(&s.Port, "secure-port", 9530, "secure port number")
 	fs.StringVar(&s.Mode, "server-mode", "dev", "Specify deployment mode. eg: dev,test,prod")
+	fs.IntVar(&s.EvaluateTimeout, "evaluate-timeout", 30, "Specify the timeout in seconds for each rule evaluation")
+	fs.StringVar(&s.Timezone, "timezone", constParam.DefaultTimezone, "Specify server timezone. eg: Asia/Shanghai,UTC")
+}
+
+// Location 服务的时区, 时区不合法时使用本地时区
+func (s *ServerOptions) Location() *time.Location {
+	if loc, err := util.LoadLocation(s.Timezone); err == nil {
+		return loc
+	}
+
+	return time.Local
+}
+
+// Deadline 单条规则每次计算的超时时间, 未配置时为 30 秒
+func (s *ServerOptions) Deadline() time.Duration {
+	if s.EvaluateTimeout <= 0 {
+		return 30 * time.Second
+	}
+
+	return time.Duration(s.EvaluateTimeout) * time.Second
 }
@@ -0,0 +1,226 @@
+package influxdb
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redisInit "owl-engine/pkg/client/redis"
+	"owl-engine/pkg/config"
+	"owl-engine/pkg/lib/flux"
+	"owl-engine/pkg/lib/singleflight"
+	"owl-engine/pkg/xlogs"
+
+	"github.com/gomodule/redigo/redis"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// 查询结果缓存在 redis 中的 key 前缀
+const cacheKeyPrefix = "owl-engine:query:"
+
+// CacheStats 查询结果缓存的统计
+type CacheStats struct {
+	Enable  bool   `json:"enable"`
+	Backend string `json:"backend"`
+	Hits    uint64 `json:"hits"`   // 命中缓存的次数
+	Misses  uint64 `json:"misses"` // 未命中缓存, 实际查询 InfluxDB 的次数
+	Shared  uint64 `json:"shared"` // 与相同的并发查询合并, 共享查询结果的次数
+	Size    int    `json:"size"`   // 进程内缓存的条目数
+}
+
+// 缓存的查询结果
+type cacheEntry struct {
+	series   []Series
+	expireAt time.Time
+}
+
+// 查询结果缓存: 多条规则在同一时刻查询相同的指标及时间窗口时, 只查询一次 InfluxDB
+// 以规范化后的查询语句及对齐的时间桶作为 key, 时间桶大小即为缓存的有效期
+type queryCache struct {
+	enable  bool
+	backend string
+	ttl     time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]cacheEntry
+	purgedAt  time.Time
+	flight    singleflight.Group
+	hits      uint64
+	misses    uint64
+	shared    uint64
+	setupOnce sync.Once
+}
+
+var QueryCache = &queryCache{entries: make(map[string]cacheEntry)}
+
+// Setup 依据配置初始化缓存, 未初始化时不缓存
+func (c *queryCache) Setup(conf *config.CacheOptions) {
+	c.setupOnce.Do(func() {
+		if conf == nil || !conf.Enable || conf.TTL <= 0 {
+			xlogs.Info("query cache is disabled")
+			return
+		}
+
+		c.enable = true
+		c.backend = strings.ToLower(conf.Backend)
+		if strings.Compare(c.backend, "redis") != 0 {
+			c.backend = "memory"
+		}
+		c.ttl = time.Duration(conf.TTL) * time.Second
+
+		xlogs.Infof("query cache is enabled, backend = %s, ttl = %s", c.backend, c.ttl.String())
+	})
+}
+
+// Query 带缓存的查询, 未启用缓存时直接查询 InfluxDB
+// 相同的并发查询只执行一次, 其余的查询等待并共享结果; 查询出错时不缓存
+func (c *queryCache) Query(ctx context.Context, cmd, database, retentionPolicy string, chunk int, cli client.Client) ([]Series, error) {
+	return c.QuerySource(ctx, "", cmd, database, retentionPolicy, chunk, cli)
+}
+
+// QuerySource 带缓存的查询, source 标识查询的集群(如: 数据源的 ID), 不同集群的相同查询分别缓存
+func (c *queryCache) QuerySource(ctx context.Context, source, cmd, database, retentionPolicy string, chunk int, cli client.Client) ([]Series, error) {
+	return c.load(ctx, source, cmd, database, retentionPolicy, func() ([]Series, error) {
+		return Metric.Query(ctx, cmd, database, retentionPolicy, chunk, cli)
+	})
+}
+
+// QueryFlux 带缓存的 Flux 查询, 用于 InfluxDB 2.x, 缓存的行为与 Query 相同
+func (c *queryCache) QueryFlux(ctx context.Context, query, bucket string, cli *flux.Client) ([]Series, error) {
+	return c.QueryFluxSource(ctx, "", query, bucket, cli)
+}
+
+// QueryFluxSource 带缓存的 Flux 查询, source 的含义与 QuerySource 相同
+func (c *queryCache) QueryFluxSource(ctx context.Context, source, query, bucket string, cli *flux.Client) ([]Series, error) {
+	return c.load(ctx, source, query, bucket, "", func() ([]Series, error) {
+		return Metric.QueryFlux(ctx, query, cli)
+	})
+}
+
+// 以查询语句及查询的库加载查询结果, 未命中缓存时以 query 查询; query 使用调用方的 ctx
+// 等待其他调用的结果时 ctx 结束即返回; 共享的结果为执行者的超时或取消错误, 而调用方的 ctx 仍有效时, 重新加载
+func (c *queryCache) load(ctx context.Context, source, cmd, database, retentionPolicy string, query func() ([]Series, error)) ([]Series, error) {
+	if !c.enable {
+		return query()
+	}
+
+	key := c.key(source, cmd, database, retentionPolicy, time.Now())
+	for {
+		if series, ok := c.get(key); ok {
+			atomic.AddUint64(&c.hits, 1)
+			return series, nil
+		}
+
+		v, err, shared := c.flight.DoContext(ctx, key, func() (interface{}, error) {
+			atomic.AddUint64(&c.misses, 1)
+
+			series, err := query()
+			if err == nil {
+				c.set(key, series)
+			}
+			return series, err
+		})
+		if shared {
+			atomic.AddUint64(&c.shared, 1)
+			if err != nil && ctx.Err() == nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+				continue
+			}
+		}
+
+		if err != nil {
+			return make([]Series, 0), err
+		}
+		return v.([]Series), nil
+	}
+}
+
+// Stats 缓存的统计
+func (c *queryCache) Stats() CacheStats {
+	c.mu.Lock()
+	size := len(c.entries)
+	c.mu.Unlock()
+
+	return CacheStats{
+		Enable:  c.enable,
+		Backend: c.backend,
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Shared:  atomic.LoadUint64(&c.shared),
+		Size:    size,
+	}
+}
+
+// 缓存的 key: 集群 + 规范化的查询语句(合并多余的空白) + 数据库 + 保留策略 + 对齐的时间桶
+func (c *queryCache) key(source, cmd, database, retentionPolicy string, now time.Time) string {
+	bucket := now.Truncate(c.ttl).Unix()
+	raw := strings.Join([]string{source, strings.Join(strings.Fields(cmd), " "), database, retentionPolicy, strconv.FormatInt(bucket, 10)}, "|")
+
+	sum := sha1.Sum([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *queryCache) get(key string) ([]Series, bool) {
+	if strings.Compare(c.backend, "redis") == 0 {
+		data, err := redisInit.RedisClient.Bytes(func(conn redis.Conn) (interface{}, error) {
+			return conn.Do("GET", cacheKeyPrefix+key)
+		})
+		if err != nil {
+			if err != redis.ErrNil {
+				xlogs.Errorf("get query cache from redis error: %s", err.Error())
+			}
+			return nil, false
+		}
+
+		var series []Series
+		if err := json.Unmarshal(data, &series); err != nil {
+			return nil, false
+		}
+		return series, true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expireAt) {
+		return nil, false
+	}
+	return entry.series, true
+}
+
+func (c *queryCache) set(key string, series []Series) {
+	if strings.Compare(c.backend, "redis") == 0 {
+		data, _ := json.Marshal(series)
+		_, err := redisInit.RedisClient.Execute(func(conn redis.Conn) (interface{}, error) {
+			return conn.Do("SET", cacheKeyPrefix+key, data, "PX", c.ttl.Milliseconds())
+		})
+		if err != nil {
+			xlogs.Errorf("set query cache to redis error: %s", err.Error())
+		}
+		return
+	}
+
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = cacheEntry{series: series, expireAt: now.Add(c.ttl)}
+
+	// 每个有效期清理一次过期的条目
+	if now.Sub(c.purgedAt) >= c.ttl {
+		for k, entry := range c.entries {
+			if now.After(entry.expireAt) {
+				delete(c.entries, k)
+			}
+		}
+		c.purgedAt = now
+	}
+}
@@ -0,0 +1,62 @@
+package influxdb
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheLoadContext(t *testing.T) {
+	var c = &queryCache{enable: true, backend: "memory", ttl: time.Hour, entries: make(map[string]cacheEntry)}
+
+	// 执行者的 ctx 先超时, 等待者的 ctx 仍有效时重新加载, 而不是共享执行者的超时错误
+	var started = make(chan struct{})
+	var queries int32
+	var leader = make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		_, err := c.load(ctx, "", "SELECT 1", "db", "", func() ([]Series, error) {
+			atomic.AddInt32(&queries, 1)
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		leader <- err
+	}()
+	<-started
+
+	series, err := c.load(context.Background(), "", "SELECT 1", "db", "", func() ([]Series, error) {
+		atomic.AddInt32(&queries, 1)
+		return []Series{{Tags: map[string]string{"host": "a"}}}, nil
+	})
+	if err != nil || len(series) != 1 || series[0].Tags["host"] != "a" {
+		t.Errorf("waiter load = %v %v, want the reloaded series", series, err)
+	}
+	if err := <-leader; err != context.DeadlineExceeded {
+		t.Errorf("leader error = %v, want deadline exceeded", err)
+	}
+	if got := atomic.LoadInt32(&queries); got != 2 {
+		t.Errorf("queries = %d, want 2", got)
+	}
+
+	// 等待者自身的 ctx 结束时立即返回
+	var release = make(chan struct{})
+	started = make(chan struct{})
+	go func() {
+		_, _ = c.load(context.Background(), "", "SELECT 2", "db", "", func() ([]Series, error) {
+			close(started)
+			<-release
+			return []Series{}, nil
+		})
+	}()
+	<-started
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.load(ctx, "", "SELECT 2", "db", "", func() ([]Series, error) { return []Series{}, nil }); err != context.DeadlineExceeded {
+		t.Errorf("waiter error = %v, want deadline exceeded", err)
+	}
+}
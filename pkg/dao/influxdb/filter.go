@@ -0,0 +1,408 @@
+package influxdb
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"owl-engine/pkg/model/apiModel"
+)
+
+// QuoteIdent 转义标识符(measurement、标签名), 以双引号包裹
+func QuoteIdent(name string) string {
+	return "\"" + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(name) + "\""
+}
+
+// QuoteString 转义字符串常量, 以单引号包裹
+func QuoteString(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// QuoteRegex 转义正则表达式, 以 / 包裹; 已转义的字符保持不变
+func QuoteRegex(pattern string) string {
+	var builder strings.Builder
+	builder.WriteString("/")
+
+	var runes = []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case runes[i] == '\\' && i+1 < len(runes):
+			builder.WriteRune(runes[i])
+			builder.WriteRune(runes[i+1])
+			i++
+		case runes[i] == '/':
+			builder.WriteString(`\/`)
+		default:
+			builder.WriteRune(runes[i])
+		}
+	}
+
+	builder.WriteString("/")
+	return builder.String()
+}
+
+// Where 生成指标查询的基础条件: category、origin、type 以及标签过滤条件
+func Where(category int8, origin, businessType string, filters *apiModel.FilterGroup) (string, error) {
+	var where = fmt.Sprintf("category = '%d' AND origin = %s AND type = %s", category, QuoteString(origin), QuoteString(businessType))
+
+	condition, err := Compile(filters)
+	if err != nil {
+		return "", err
+	}
+	if strings.Compare(condition, "") != 0 {
+		where += " AND (" + condition + ")"
+	}
+
+	return where, nil
+}
+
+// Compile 将标签过滤条件编译为 InfluxQL 的条件表达式, 过滤条件为空时返回空字符串
+func Compile(group *apiModel.FilterGroup) (string, error) {
+	if group == nil {
+		return "", nil
+	}
+
+	var logic string
+	switch strings.ToUpper(group.Logic) {
+	case "", "AND":
+		logic = " AND "
+	case "OR":
+		logic = " OR "
+	default:
+		return "", errors.New("the logic of filters must be AND or OR, but got " + group.Logic)
+	}
+
+	var parts = make([]string, 0, len(group.Conditions)+len(group.Groups))
+	for _, condition := range group.Conditions {
+		if strings.Compare(strings.TrimSpace(condition.Tag), "") == 0 {
+			return "", errors.New("the tag of filters cannot be empty")
+		}
+
+		switch condition.Operator {
+		case "=", "!=":
+			parts = append(parts, QuoteIdent(condition.Tag)+" "+condition.Operator+" "+QuoteString(condition.Value))
+		case "=~", "!~":
+			if _, err := regexp.Compile(condition.Value); err != nil {
+				return "", fmt.Errorf("the regular expression {%s} of tag {%s} is incorrect: %s", condition.Value, condition.Tag, err.Error())
+			}
+			parts = append(parts, QuoteIdent(condition.Tag)+" "+condition.Operator+" "+QuoteRegex(condition.Value))
+		default:
+			return "", errors.New("the operator of filters must be one of =, !=, =~, !~, but got " + condition.Operator)
+		}
+	}
+
+	for i := range group.Groups {
+		sub, err := Compile(&group.Groups[i])
+		if err != nil {
+			return "", err
+		}
+		if strings.Compare(sub, "") != 0 {
+			parts = append(parts, "("+sub+")")
+		}
+	}
+
+	return strings.Join(parts, logic), nil
+}
+
+// MergeFilters 以 AND 合并多个过滤条件组, 忽略空的过滤条件组
+func MergeFilters(groups ...*apiModel.FilterGroup) *apiModel.FilterGroup {
+	var result = make([]apiModel.FilterGroup, 0, len(groups))
+	for _, group := range groups {
+		if group != nil && (len(group.Conditions) > 0 || len(group.Groups) > 0) {
+			result = append(result, *group)
+		}
+	}
+
+	switch len(result) {
+	case 0:
+		return nil
+	case 1:
+		return &result[0]
+	default:
+		return &apiModel.FilterGroup{Logic: "AND", Groups: result}
+	}
+}
+
+// Match 以标签过滤条件匹配标签集, 标签不存在时以空字符串比较; 过滤条件为空时匹配所有标签集
+// 过滤条件需要事先经过 Compile 的校验, 无法编译的正则表达式视为不匹配
+func Match(group *apiModel.FilterGroup, labels map[string]string) bool {
+	if group == nil || (len(group.Conditions) == 0 && len(group.Groups) == 0) {
+		return true
+	}
+
+	var or = strings.EqualFold(group.Logic, "OR")
+	var results = make([]bool, 0, len(group.Conditions)+len(group.Groups))
+	for _, condition := range group.Conditions {
+		var value = labels[condition.Tag]
+		switch condition.Operator {
+		case "=":
+			results = append(results, value == condition.Value)
+		case "!=":
+			results = append(results, value != condition.Value)
+		case "=~", "!~":
+			matched, err := regexp.MatchString(condition.Value, value)
+			results = append(results, err == nil && matched == (condition.Operator == "=~"))
+		default:
+			results = append(results, false)
+		}
+	}
+
+	for i := range group.Groups {
+		var sub = &group.Groups[i]
+		if len(sub.Conditions) > 0 || len(sub.Groups) > 0 {
+			results = append(results, Match(sub, labels))
+		}
+	}
+
+	for _, result := range results {
+		if result == or {
+			return or
+		}
+	}
+	return !or
+}
+
+// ParseCondition 解析旧版的扩展条件字符串, 如: host = 'a' AND ("env" = 'prod' OR idc =~ /^sh/)
+// 只支持标签与字符串常量或正则表达式的比较, 其余写法均返回错误
+func ParseCondition(condition string) (*apiModel.FilterGroup, error) {
+	if strings.Compare(strings.TrimSpace(condition), "") == 0 {
+		return nil, nil
+	}
+
+	tokens, err := tokenize(condition)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &conditionParser{tokens: tokens}
+	group, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected {%s} in extension condition", parser.tokens[parser.pos].text)
+	}
+
+	return group, nil
+}
+
+// 词法单元的类型
+const (
+	tokenIdent = iota
+	tokenString
+	tokenRegex
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+	tokenAnd
+	tokenOr
+)
+
+type token struct {
+	kind int
+	text string
+}
+
+// 对扩展条件进行词法分析
+func tokenize(condition string) ([]token, error) {
+	var tokens = make([]token, 0)
+	var runes = []rune(condition)
+
+	for i := 0; i < len(runes); {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")"})
+			i++
+		case c == '\'' || c == '"' || c == '/':
+			// 字符串常量、带引号的标识符或正则表达式, 以反斜杠转义
+			var builder strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != c; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					if c == '/' && runes[j+1] != '/' {
+						builder.WriteRune(runes[j])
+					}
+					j++
+				}
+				builder.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated %c in extension condition", c)
+			}
+
+			var kind = tokenString
+			if c == '"' {
+				kind = tokenIdent
+			} else if c == '/' {
+				kind = tokenRegex
+			}
+			tokens = append(tokens, token{kind: kind, text: builder.String()})
+			i = j + 1
+		case c == '=' || c == '!' || c == '<':
+			var op = string(c)
+			if i+1 < len(runes) && strings.ContainsRune("=~>", runes[i+1]) {
+				op += string(runes[i+1])
+			}
+			switch op {
+			case "=", "!=", "=~", "!~":
+			case "<>":
+				op = "!="
+			default:
+				return nil, fmt.Errorf("unsupported operator {%s} in extension condition", op)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: op})
+			if op == "=" {
+				i++
+			} else {
+				i += 2
+			}
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || strings.ContainsRune("_.-", runes[j])) {
+				j++
+			}
+			word := string(runes[i:j])
+			switch strings.ToUpper(word) {
+			case "AND":
+				tokens = append(tokens, token{kind: tokenAnd, text: word})
+			case "OR":
+				tokens = append(tokens, token{kind: tokenOr, text: word})
+			default:
+				tokens = append(tokens, token{kind: tokenIdent, text: word})
+			}
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character {%c} in extension condition", c)
+		}
+	}
+
+	return tokens, nil
+}
+
+// 扩展条件的语法分析: OR 的优先级低于 AND
+type conditionParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *conditionParser) next() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, true
+}
+
+func (p *conditionParser) peek(kind int) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == kind
+}
+
+func (p *conditionParser) parseOr() (*apiModel.FilterGroup, error) {
+	var groups = make([]apiModel.FilterGroup, 0)
+	for {
+		group, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, *group)
+
+		if !p.peek(tokenOr) {
+			break
+		}
+		p.pos++
+	}
+
+	if len(groups) == 1 {
+		return &groups[0], nil
+	}
+	return &apiModel.FilterGroup{Logic: "OR", Groups: groups}, nil
+}
+
+func (p *conditionParser) parseAnd() (*apiModel.FilterGroup, error) {
+	var group = &apiModel.FilterGroup{Logic: "AND"}
+	for {
+		if p.peek(tokenLeftParen) {
+			p.pos++
+			sub, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.peek(tokenRightParen) {
+				return nil, errors.New("missing ) in extension condition")
+			}
+			p.pos++
+			group.Groups = append(group.Groups, *sub)
+		} else {
+			condition, err := p.parseCondition()
+			if err != nil {
+				return nil, err
+			}
+			group.Conditions = append(group.Conditions, condition)
+		}
+
+		if !p.peek(tokenAnd) {
+			break
+		}
+		p.pos++
+	}
+
+	// 只包含一个子组时, 直接返回该子组
+	if len(group.Conditions) == 0 && len(group.Groups) == 1 {
+		return &group.Groups[0], nil
+	}
+	return group, nil
+}
+
+func (p *conditionParser) parseCondition() (apiModel.TagFilter, error) {
+	var condition apiModel.TagFilter
+
+	tag, ok := p.next()
+	if !ok || tag.kind != tokenIdent {
+		return condition, errors.New("expect a tag name in extension condition")
+	}
+
+	op, ok := p.next()
+	if !ok || op.kind != tokenOperator {
+		return condition, fmt.Errorf("expect an operator after tag {%s} in extension condition", tag.text)
+	}
+
+	value, ok := p.next()
+	if !ok {
+		return condition, fmt.Errorf("expect a value after {%s %s} in extension condition", tag.text, op.text)
+	}
+
+	switch op.text {
+	case "=", "!=":
+		if value.kind != tokenString {
+			return condition, fmt.Errorf("the value of tag {%s} must be a quoted string in extension condition", tag.text)
+		}
+	default:
+		if value.kind != tokenRegex {
+			return condition, fmt.Errorf("the value of tag {%s} must be a regular expression in extension condition", tag.text)
+		}
+	}
+
+	condition.Tag = tag.text
+	condition.Operator = op.text
+	condition.Value = value.text
+	return condition, nil
+}
+
+// MigrateCondition 将旧版的扩展条件迁移为结构化的过滤条件, 并与已有的过滤条件以 AND 合并
+func MigrateCondition(filters *apiModel.FilterGroup, condition string) (*apiModel.FilterGroup, error) {
+	legacy, err := ParseCondition(condition)
+	if err != nil {
+		return filters, err
+	}
+
+	return MergeFilters(filters, legacy), nil
+}
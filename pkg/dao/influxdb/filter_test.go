@@ -0,0 +1,195 @@
+package influxdb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"owl-engine/pkg/model/apiModel"
+)
+
+func TestQuote(t *testing.T) {
+	var cases = []struct {
+		got, want string
+	}{
+		{QuoteIdent(`host`), `"host"`},
+		{QuoteIdent(`a"b\c`), `"a\"b\\c"`},
+		{QuoteIdent(`x" OR 1=1 --`), `"x\" OR 1=1 --"`},
+		{QuoteString(`prod`), `'prod'`},
+		{QuoteString(`it's`), `'it\'s'`},
+		{QuoteString(`a\' OR '1'='1`), `'a\\\' OR \'1\'=\'1'`},
+		{QuoteRegex(`^sh`), `/^sh/`},
+		{QuoteRegex(`a/b`), `/a\/b/`},
+		{QuoteRegex(`a\/b`), `/a\/b/`},
+		{QuoteRegex(`\d+\.\d+`), `/\d+\.\d+/`},
+		{QuoteRegex(`/) OR /x`), `/\/) OR \/x/`},
+	}
+
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("quote = %s, want %s", c.got, c.want)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	var cases = []struct {
+		group *apiModel.FilterGroup
+		want  string
+		err   string
+	}{
+		{group: nil, want: ""},
+		{
+			group: &apiModel.FilterGroup{Conditions: []apiModel.TagFilter{{Tag: "env", Operator: "=", Value: "prod"}, {Tag: "idc", Operator: "=~", Value: "^sh"}}},
+			want:  `"env" = 'prod' AND "idc" =~ /^sh/`,
+		},
+		{
+			group: &apiModel.FilterGroup{Logic: "or", Conditions: []apiModel.TagFilter{{Tag: "a", Operator: "!=", Value: "x"}},
+				Groups: []apiModel.FilterGroup{{Conditions: []apiModel.TagFilter{{Tag: "b", Operator: "!~", Value: "y"}, {Tag: "c", Operator: "=", Value: "z"}}}}},
+			want: `"a" != 'x' OR ("b" !~ /y/ AND "c" = 'z')`,
+		},
+		{group: &apiModel.FilterGroup{Logic: "XOR"}, err: "the logic of filters"},
+		{group: &apiModel.FilterGroup{Conditions: []apiModel.TagFilter{{Tag: " ", Operator: "=", Value: "x"}}}, err: "cannot be empty"},
+		{group: &apiModel.FilterGroup{Conditions: []apiModel.TagFilter{{Tag: "a", Operator: ">", Value: "1"}}}, err: "the operator of filters"},
+		{group: &apiModel.FilterGroup{Conditions: []apiModel.TagFilter{{Tag: "a", Operator: "=~", Value: "[a"}}}, err: "regular expression"},
+		{group: &apiModel.FilterGroup{Conditions: []apiModel.TagFilter{{Tag: "a", Operator: "=~", Value: `a\`}}}, err: "regular expression"},
+	}
+
+	for i, c := range cases {
+		got, err := Compile(c.group)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("case %d: error = %v, want %s", i, err, c.err)
+			}
+			continue
+		}
+		if err != nil || got != c.want {
+			t.Errorf("case %d: Compile = %s %v, want %s", i, got, err, c.want)
+		}
+	}
+}
+
+func TestParseCondition(t *testing.T) {
+	var cond = func(tag, op, value string) apiModel.TagFilter {
+		return apiModel.TagFilter{Tag: tag, Operator: op, Value: value}
+	}
+
+	var cases = []struct {
+		condition string
+		want      *apiModel.FilterGroup
+		err       string
+	}{
+		{condition: "  ", want: nil},
+		{
+			condition: `host = 'a'`,
+			want:      &apiModel.FilterGroup{Logic: "AND", Conditions: []apiModel.TagFilter{cond("host", "=", "a")}},
+		},
+		{
+			// 带引号的标识符、转义的引号及 <> 比较符
+			condition: `"app-name" <> 'it\'s' and host.ip != "x"`,
+			err:       "must be a quoted string",
+		},
+		{
+			condition: `"app-name" <> 'it\'s' and host.ip != 'x'`,
+			want: &apiModel.FilterGroup{Logic: "AND", Conditions: []apiModel.TagFilter{
+				cond("app-name", "!=", "it's"), cond("host.ip", "!=", "x")}},
+		},
+		{
+			// 正则表达式中转义的 / 去掉反斜杠, 其余转义保持不变
+			condition: `path =~ /^\/api\/v\d+/ AND ua !~ /bot/`,
+			want: &apiModel.FilterGroup{Logic: "AND", Conditions: []apiModel.TagFilter{
+				cond("path", "=~", `^/api/v\d+`), cond("ua", "!~", "bot")}},
+		},
+		{
+			// OR 的优先级低于 AND, 括号中的子组
+			condition: `a = '1' OR b = '2' AND (c = '3' OR (d = '4'))`,
+			want: &apiModel.FilterGroup{Logic: "OR", Groups: []apiModel.FilterGroup{
+				{Logic: "AND", Conditions: []apiModel.TagFilter{cond("a", "=", "1")}},
+				{Logic: "AND", Conditions: []apiModel.TagFilter{cond("b", "=", "2")}, Groups: []apiModel.FilterGroup{
+					{Logic: "OR", Groups: []apiModel.FilterGroup{
+						{Logic: "AND", Conditions: []apiModel.TagFilter{cond("c", "=", "3")}},
+						{Logic: "AND", Conditions: []apiModel.TagFilter{cond("d", "=", "4")}},
+					}},
+				}},
+			}},
+		},
+		{condition: `host = 'a`, err: "unterminated '"},
+		{condition: `host =~ /a`, err: "unterminated /"},
+		{condition: `"host = 'a'`, err: "unterminated \""},
+		{condition: `(host = 'a'`, err: "missing )"},
+		{condition: `host = 'a')`, err: "unexpected {)}"},
+		{condition: `host > 'a'`, err: "unexpected character"},
+		{condition: `host <= 'a'`, err: "unsupported operator"},
+		{condition: `host = a`, err: "must be a quoted string"},
+		{condition: `host =~ 'a'`, err: "must be a regular expression"},
+		{condition: `host 'a'`, err: "expect an operator"},
+		{condition: `host =`, err: "expect a value"},
+		{condition: `= 'a'`, err: "expect a tag name"},
+		{condition: `host = 'a' AND`, err: "expect a tag name"},
+		{condition: `host = 'a'; DROP MEASUREMENT x`, err: "unexpected character"},
+	}
+
+	for _, c := range cases {
+		got, err := ParseCondition(c.condition)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("ParseCondition(%s) error = %v, want %s", c.condition, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCondition(%s) error: %s", c.condition, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseCondition(%s) = %+v, want %+v", c.condition, got, c.want)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	var labels = map[string]string{"env": "prod", "host": "sh-01"}
+
+	var cases = []struct {
+		condition string
+		want      bool
+	}{
+		{condition: "", want: true},
+		{condition: `env = 'prod'`, want: true},
+		{condition: `env != 'prod'`, want: false},
+		{condition: `team = ''`, want: true},
+		{condition: `host =~ /^sh-/ AND env = 'prod'`, want: true},
+		{condition: `host !~ /^sh-/ OR env = 'test'`, want: false},
+		{condition: `env = 'test' OR (host =~ /01$/ AND team != 'db')`, want: true},
+		{condition: `env = 'test' OR (host =~ /02$/ AND team != 'db')`, want: false},
+	}
+
+	for _, c := range cases {
+		group, err := ParseCondition(c.condition)
+		if err != nil {
+			t.Fatalf("ParseCondition(%s) error: %s", c.condition, err.Error())
+		}
+		if got := Match(group, labels); got != c.want {
+			t.Errorf("Match(%s) = %t, want %t", c.condition, got, c.want)
+		}
+	}
+
+	// 无法编译的正则表达式视为不匹配
+	var invalid = &apiModel.FilterGroup{Conditions: []apiModel.TagFilter{{Tag: "env", Operator: "=~", Value: "[a"}}}
+	if Match(invalid, labels) {
+		t.Errorf("Match with invalid regex = true, want false")
+	}
+}
+
+func TestMigrateCondition(t *testing.T) {
+	var filters = &apiModel.FilterGroup{Conditions: []apiModel.TagFilter{{Tag: "env", Operator: "=", Value: "prod"}}}
+
+	merged, err := MigrateCondition(filters, `host = 'a'`)
+	if err != nil || merged.Logic != "AND" || len(merged.Groups) != 2 {
+		t.Errorf("MigrateCondition = %+v %v", merged, err)
+	}
+
+	if got, err := MigrateCondition(filters, `host = `); err == nil || got != filters {
+		t.Errorf("MigrateCondition with bad condition = %+v %v, want the original filters and an error", got, err)
+	}
+}
@@ -0,0 +1,166 @@
+package influxdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/lib/flux"
+	"owl-engine/pkg/model/apiModel"
+)
+
+// Flux 结果中不作为序列标签的分组列
+var fluxReservedColumns = map[string]bool{
+	"result":       true,
+	"table":        true,
+	"_start":       true,
+	"_stop":        true,
+	"_field":       true,
+	"_measurement": true,
+}
+
+// FluxColumn 以 r["name"] 的方式引用记录的列
+func FluxColumn(name string) string {
+	return "r[" + flux.String(name) + "]"
+}
+
+// FluxWhere 生成 Flux filter() 的基础条件: measurement、category、origin、type 以及标签过滤条件, 与 Where 对应
+func FluxWhere(measurement string, category int8, origin, businessType string, filters *apiModel.FilterGroup) (string, error) {
+	var where = fmt.Sprintf(`r._measurement == %s and r._field == "value" and %s == "%d" and %s == %s and %s == %s`,
+		flux.String(measurement), FluxColumn("category"), category, FluxColumn("origin"), flux.String(origin),
+		FluxColumn("type"), flux.String(businessType))
+
+	condition, err := CompileFlux(filters)
+	if err != nil {
+		return "", err
+	}
+	if strings.Compare(condition, "") != 0 {
+		where += " and (" + condition + ")"
+	}
+
+	return where, nil
+}
+
+// CompileFlux 将标签过滤条件编译为 Flux 的谓词表达式, 过滤条件为空时返回空字符串
+// 不存在的标签以空字符串比较, 与 InfluxQL 的行为保持一致
+func CompileFlux(group *apiModel.FilterGroup) (string, error) {
+	if group == nil {
+		return "", nil
+	}
+
+	var logic string
+	switch strings.ToUpper(group.Logic) {
+	case "", "AND":
+		logic = " and "
+	case "OR":
+		logic = " or "
+	default:
+		return "", errors.New("the logic of filters must be AND or OR, but got " + group.Logic)
+	}
+
+	var parts = make([]string, 0, len(group.Conditions)+len(group.Groups))
+	for _, condition := range group.Conditions {
+		if strings.Compare(strings.TrimSpace(condition.Tag), "") == 0 {
+			return "", errors.New("the tag of filters cannot be empty")
+		}
+
+		var column = "(if exists " + FluxColumn(condition.Tag) + " then " + FluxColumn(condition.Tag) + ` else "")`
+		switch condition.Operator {
+		case "=":
+			parts = append(parts, column+" == "+flux.String(condition.Value))
+		case "!=":
+			parts = append(parts, column+" != "+flux.String(condition.Value))
+		case "=~", "!~":
+			if _, err := regexp.Compile(condition.Value); err != nil {
+				return "", fmt.Errorf("the regular expression {%s} of tag {%s} is incorrect: %s", condition.Value, condition.Tag, err.Error())
+			}
+			parts = append(parts, column+" "+condition.Operator+" "+QuoteRegex(condition.Value))
+		default:
+			return "", errors.New("the operator of filters must be one of =, !=, =~, !~, but got " + condition.Operator)
+		}
+	}
+
+	for i := range group.Groups {
+		sub, err := CompileFlux(&group.Groups[i])
+		if err != nil {
+			return "", err
+		}
+		if strings.Compare(sub, "") != 0 {
+			parts = append(parts, "("+sub+")")
+		}
+	}
+
+	return strings.Join(parts, logic), nil
+}
+
+// QueryFlux 以 Flux 查询 InfluxDB 2.x, 返回与 Query 相同结构的序列
+// 分组列(除 _start、_stop 等保留列外)作为序列的标签; 点的时间为 _time, 聚合后没有 _time 时使用 _start
+func (m *metric) QueryFlux(ctx context.Context, query string, cli *flux.Client) ([]Series, error) {
+	if cli == nil {
+		return make([]Series, 0), errors.New("influxdb does not initialize")
+	}
+
+	tables, err := cli.Query(ctx, query)
+	if err != nil {
+		return make([]Series, 0), err
+	}
+
+	return fluxSeries(tables), nil
+}
+
+// 将 Flux 的结果表转换为序列, 分组标签相同的表合并为一个序列, 忽略值为 null 或非数值的点
+func fluxSeries(tables []flux.Table) []Series {
+	var merged = make(map[string]*Series)
+	var keys = make([]string, 0)
+	for _, table := range tables {
+		if len(table.Records) == 0 {
+			continue
+		}
+
+		var tags = make(map[string]string)
+		for _, column := range table.Columns {
+			if column.Group && strings.Compare(column.Name, "") != 0 && !fluxReservedColumns[column.Name] {
+				tags[column.Name] = table.Records[0][column.Name]
+			}
+		}
+
+		var series = Series{Tags: tags}
+		key := series.Key()
+		if _, ok := merged[key]; !ok {
+			merged[key] = &Series{Tags: tags, Points: make([]Point, 0, len(table.Records))}
+			keys = append(keys, key)
+		}
+
+		for _, record := range table.Records {
+			value, err := strconv.ParseFloat(record["_value"], 64)
+			if err != nil {
+				continue
+			}
+
+			var ts = record["_time"]
+			if strings.Compare(ts, "") == 0 {
+				ts = record["_start"]
+			}
+			timestamp, _ := time.Parse(time.RFC3339Nano, ts)
+
+			merged[key].Points = append(merged[key].Points, Point{Time: timestamp, Value: value})
+		}
+	}
+
+	var result = make([]Series, 0, len(keys))
+	for _, key := range keys {
+		var s = merged[key]
+		if len(s.Points) == 0 {
+			continue
+		}
+		sort.SliceStable(s.Points, func(i, j int) bool { return s.Points[i].Time.Before(s.Points[j].Time) })
+		result = append(result, *s)
+	}
+
+	return result
+}
@@ -1,8 +1,12 @@
 package influxdb
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"sort"
+	"strings"
+	"time"
 
 	client "github.com/influxdata/influxdb1-client/v2"
 )
@@ -11,12 +15,54 @@ type metric struct{}
 
 var Metric = new(metric)
 
-// 查询数据
-func (m *metric) Query(cmd, database, retentionPolicy string, chunk int, cli client.Client) ([]float64, error) {
-	var result = make([]float64, 0)
+// Point 查询结果中的单个数据点
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series 查询结果中的单个序列, 使用 GROUP BY <tags> 时, 每个标签集对应一个序列
+type Series struct {
+	Tags   map[string]string
+	Points []Point
+}
+
+// Key 以排序后的标签集生成序列的唯一标识, 未分组时为空字符串
+func (s Series) Key() string {
+	var keys = make([]string, 0, len(s.Tags))
+	for k := range s.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs = make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+"="+s.Tags[k])
+	}
+
+	return strings.Join(pairs, ",")
+}
 
+// Values 提取数据点的值
+func Values(points []Point) []float64 {
+	var result = make([]float64, 0, len(points))
+	for _, p := range points {
+		result = append(result, p.Value)
+	}
+
+	return result
+}
+
+// Query 查询数据, 返回所有的序列及其标签集
+// ctx 取消或超时时立即返回 ctx 的错误, 未完成的请求由 client 的超时时间兜底
+// 注意: 使用 fill(null) 等填充方式时, 值为 null 的点会被忽略
+func (m *metric) Query(ctx context.Context, cmd, database, retentionPolicy string, chunk int, cli client.Client) ([]Series, error) {
 	if cli == nil {
-		return result, errors.New("influxdb does not initialize")
+		return make([]Series, 0), errors.New("influxdb does not initialize")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return make([]Series, 0), err
 	}
 
 	query := client.Query{
@@ -26,20 +72,67 @@ func (m *metric) Query(cmd, database, retentionPolicy string, chunk int, cli cli
 		ChunkSize:       chunk,
 	}
 
-	if response, err := cli.Query(query); err == nil {
-		if len(response.Results) > 0 {
-			series := response.Results[0].Series
-			if len(series) > 0 {
-				if len(series[0].Values) > 0 {
-					for _, v := range series[0].Values {
-						value, _ := v[1].(json.Number).Float64()
-						result = append(result, value)
-					}
+	// client 不支持 context, 在单独的 goroutine 中执行查询; 通道带缓冲, 超时返回后 goroutine 也能正常退出
+	type queryResult struct {
+		response *client.Response
+		err      error
+	}
+	var ch = make(chan queryResult, 1)
+	go func() {
+		response, err := cli.Query(query)
+		ch <- queryResult{response: response, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return make([]Series, 0), ctx.Err()
+	case r := <-ch:
+		if r.err != nil {
+			return make([]Series, 0), r.err
+		}
+		return parseSeries(r.response)
+	}
+}
+
+// 解析查询结果中的序列, 忽略值为 null 或非数值的点
+func parseSeries(response *client.Response) ([]Series, error) {
+	var result = make([]Series, 0)
+
+	if err := response.Error(); err != nil {
+		return result, err
+	}
+
+	if len(response.Results) > 0 {
+		for _, row := range response.Results[0].Series {
+			var series = Series{
+				Tags:   row.Tags,
+				Points: make([]Point, 0, len(row.Values)),
+			}
+
+			for _, v := range row.Values {
+				if len(v) < 2 || v[1] == nil {
+					continue
 				}
+
+				number, ok := v[1].(json.Number)
+				if !ok {
+					continue
+				}
+				value, _ := number.Float64()
+
+				var timestamp time.Time
+				if ts, ok := v[0].(string); ok {
+					timestamp, _ = time.Parse(time.RFC3339Nano, ts)
+				}
+
+				series.Points = append(series.Points, Point{Time: timestamp, Value: value})
+			}
+
+			if len(series.Points) > 0 {
+				result = append(result, series)
 			}
 		}
-		return result, nil
-	} else {
-		return result, err
 	}
+
+	return result, nil
 }
@@ -0,0 +1,44 @@
+package influxdb
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"owl-engine/pkg/lib/flux"
+
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+// Write 写入数据点到 InfluxDB 1.x, 时间戳以纳秒精度写入
+func (m *metric) Write(points []*client.Point, database, retentionPolicy string, cli client.Client) error {
+	if cli == nil {
+		return errors.New("influxdb does not initialize")
+	}
+
+	bp, err := client.NewBatchPoints(client.BatchPointsConfig{
+		Database:        database,
+		RetentionPolicy: retentionPolicy,
+		Precision:       "ns",
+	})
+	if err != nil {
+		return err
+	}
+	bp.AddPoints(points)
+
+	return cli.Write(bp)
+}
+
+// WriteFlux 以 line protocol 写入数据点到 InfluxDB 2.x 的 bucket, 时间戳以纳秒精度写入
+func (m *metric) WriteFlux(ctx context.Context, points []*client.Point, bucket string, cli *flux.Client) error {
+	if cli == nil {
+		return errors.New("influxdb 2.x does not initialize")
+	}
+
+	var lines = make([]string, 0, len(points))
+	for _, p := range points {
+		lines = append(lines, p.String())
+	}
+
+	return cli.Write(ctx, bucket, "ns", []byte(strings.Join(lines, "\n")))
+}
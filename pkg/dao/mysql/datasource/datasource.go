@@ -0,0 +1,140 @@
+package datasource
+
+import (
+	"strings"
+
+	"owl-engine/pkg/client/database"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/dbModel"
+
+	"gorm.io/gorm"
+)
+
+type datasource struct{}
+
+var DatasourceDto = new(datasource)
+
+func (d *datasource) SelectByCondition(condition *apiModel.DatasourceCondition) (*[]dbModel.Datasource, int64, error) {
+	db := database.DB.Model(&dbModel.Datasource{})
+
+	if condition.Id > 0 {
+		db = db.Where("id = ?", condition.Id)
+	}
+
+	if strings.Compare(condition.Name, "") != 0 {
+		db = db.Where("name like ?", "%"+condition.Name+"%")
+	}
+
+	if strings.Compare(condition.Type, "") != 0 {
+		db = db.Where("type = ?", condition.Type)
+	}
+
+	var count int64
+	db.Count(&count)
+
+	var record = make([]dbModel.Datasource, 0, condition.Size)
+	offset := (condition.Page - 1) * condition.Size
+
+	// 按照更新时间进行排序
+	return &record, count, db.Offset(int(offset)).Limit(int(condition.Size)).Order("updated_at desc").Scan(&record).Error
+}
+
+func (d *datasource) SelectByIds(ids []int) (*[]dbModel.Datasource, int64, error) {
+	db := database.DB.Model(&dbModel.Datasource{}).Where("id in (?)", ids)
+
+	var count int64
+	db.Count(&count)
+
+	var record = make([]dbModel.Datasource, 0)
+	return &record, count, db.Order("created_at desc").Scan(&record).Error
+}
+
+// SelectById 依据 ID 查询数据源, 不存在时返回 gorm.ErrRecordNotFound
+func (d *datasource) SelectById(id uint) (*dbModel.Datasource, error) {
+	var record dbModel.Datasource
+	return &record, database.DB.Model(&dbModel.Datasource{}).Where("id = ?", id).First(&record).Error
+}
+
+func (d *datasource) Insert(data *dbModel.Datasource) error {
+	work := database.NewWork()
+	db := work.Begin()
+	defer work.Rollback()
+
+	err := db.Create(data).Error
+	if err == nil {
+		work.Commit()
+	}
+
+	return err
+}
+
+// 使用 Save 更新全部字段, 零值字段同样会被更新
+func (d *datasource) Save(data *dbModel.Datasource) error {
+	work := database.NewWork()
+	db := work.Begin()
+	defer work.Rollback()
+
+	var err error
+	var record dbModel.Datasource
+	err = db.Model(&dbModel.Datasource{}).Where("id = ?", data.ID).First(&record).Error
+	if err == nil {
+		record.Name = data.Name
+		record.Type = data.Type
+		record.Version = data.Version
+		record.Endpoints = data.Endpoints
+		record.Username = data.Username
+		record.Password = data.Password
+		record.Token = data.Token
+		record.Org = data.Org
+		record.Database = data.Database
+		record.RetentionPolicy = data.RetentionPolicy
+		record.Bucket = data.Bucket
+		record.TLSSkipVerify = data.TLSSkipVerify
+		record.TLSCA = data.TLSCA
+		record.Proxy = data.Proxy
+		record.Timeout = data.Timeout
+		record.Description = data.Description
+		record.Updater = data.Updater
+		record.UpdatedAt = data.UpdatedAt
+
+		err = db.Save(&record).Error
+	}
+
+	if err == nil {
+		work.Commit()
+	}
+
+	return err
+}
+
+func (d *datasource) Delete(updater string, ids []int) (err error) {
+	work := database.NewWork()
+	db := work.Begin()
+	defer work.Rollback()
+
+	err = db.Model(&dbModel.Datasource{}).Where("id in (?)", ids).UpdateColumn("updater", updater).Error
+	err = db.Model(&dbModel.Datasource{}).Where("id in (?)", ids).Delete(&dbModel.Datasource{}).Error
+	if err == nil {
+		work.Commit()
+	}
+
+	return
+}
+
+// CountReferences 统计引用数据源的规则数, 删除数据源前检查; 已删除的规则不计入
+func (d *datasource) CountReferences(ids []int) (int64, error) {
+	var math, logger int64
+	if err := references(database.DB, &dbModel.Rule{}, ids).Count(&math).Error; err != nil {
+		return 0, err
+	}
+	if err := references(database.DB, &dbModel.LoggerRule{}, ids).Count(&logger).Error; err != nil {
+		return 0, err
+	}
+
+	return math + logger, nil
+}
+
+// 引用数据源且未删除(inuse = 2)的规则
+func references(db *gorm.DB, model interface{}, ids []int) *gorm.DB {
+	return db.Model(model).Where("datasource_id in (?)", ids).Where("inuse = ?", 2)
+}
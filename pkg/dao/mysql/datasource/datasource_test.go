@@ -0,0 +1,38 @@
+package datasource
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"owl-engine/pkg/model/dbModel"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+func TestReferences(t *testing.T) {
+	// 只生成 SQL, 不连接数据库
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "user:password@tcp(127.0.0.1:3306)/engine", SkipInitializeWithVersion: true}), &gorm.Config{
+		NamingStrategy:       schema.NamingStrategy{SingularTable: true},
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatalf("open dry run db error: %s", err.Error())
+	}
+
+	for _, model := range []interface{}{&dbModel.Rule{}, &dbModel.LoggerRule{}} {
+		var count int64
+		stmt := references(db, model, []int{1, 2}).Count(&count).Statement
+
+		sql := stmt.SQL.String()
+		if !strings.Contains(sql, "datasource_id in (?,?)") || !strings.Contains(sql, "inuse = ?") || !strings.Contains(sql, "`deleted_at` IS NULL") {
+			t.Errorf("references(%T) sql = %s, want the datasource, inuse and deleted_at conditions", model, sql)
+		}
+		if !reflect.DeepEqual(stmt.Vars, []interface{}{1, 2, 2}) {
+			t.Errorf("references(%T) vars = %v, want [1 2 2]", model, stmt.Vars)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package event
 
 import (
+	"strings"
+	"time"
+
 	"owl-engine/pkg/client/database"
+	"owl-engine/pkg/dao/mysql"
+	"owl-engine/pkg/model/apiModel"
 	"owl-engine/pkg/model/dbModel"
 )
 
@@ -12,3 +17,60 @@ var EventDto = new(event)
 func (e *event) Insert(record *dbModel.Alert) error {
 	return database.DB.Model(&dbModel.Alert{}).Create(record).Error
 }
+
+// 原地更新告警事件的级别及告警内容
+func (e *event) Escalate(alertId string, level int8, content string) error {
+	return database.DB.Model(&dbModel.Alert{}).Where("alert_id = ?", alertId).Updates(map[string]interface{}{
+		"level":      level,
+		"content":    content,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// 依据条件分页查询告警事件, 按告警时间倒序
+func (e *event) SelectByCondition(condition *apiModel.AlertCondition) (*[]dbModel.Alert, int64, error) {
+	db := database.DB.Model(&dbModel.Alert{})
+
+	if strings.Compare(condition.Name, "") != 0 {
+		db = db.Where("name like ?", "%"+condition.Name+"%")
+	}
+
+	if strings.Compare(condition.RuleName, "") != 0 {
+		db = db.Where("rule_name = ?", condition.RuleName)
+	}
+
+	if strings.Compare(condition.Origin, "") != 0 {
+		db = db.Where("origin = ?", condition.Origin)
+	}
+
+	if condition.Level > 0 {
+		db = db.Where("level = ?", condition.Level)
+	}
+
+	if condition.Status > 0 {
+		db = db.Where("status = ?", condition.Status)
+	}
+
+	if strings.Compare(condition.StartTime, "") != 0 {
+		db = db.Where("alert_time >= ?", condition.StartTime)
+	}
+
+	if strings.Compare(condition.EndTime, "") != 0 {
+		db = db.Where("alert_time <= ?", condition.EndTime)
+	}
+
+	// 告警标签的过滤条件
+	if where, args, err := mysql.LabelCondition("labels", condition.Labels); err != nil {
+		return &[]dbModel.Alert{}, 0, err
+	} else if strings.Compare(where, "") != 0 {
+		db = db.Where(where, args...)
+	}
+
+	var count int64
+	db.Count(&count)
+
+	var record = make([]dbModel.Alert, 0, condition.Size)
+	offset := (condition.Page - 1) * condition.Size
+
+	return &record, count, db.Offset(int(offset)).Limit(int(condition.Size)).Order("alert_time desc").Scan(&record).Error
+}
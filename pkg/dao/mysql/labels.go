@@ -0,0 +1,96 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/lib/labels"
+	"owl-engine/pkg/model/apiModel"
+)
+
+// LabelCondition 将标签过滤条件编译为 MySQL 的查询条件, column 为 json 格式的标签列, 如: labels
+// 过滤条件的写法与规则的扩展条件相同, 如: env = 'prod' AND (team = 'db' OR host =~ /^sh/); 为空时返回空字符串
+func LabelCondition(column, condition string) (string, []interface{}, error) {
+	if strings.Compare(strings.TrimSpace(condition), "") == 0 {
+		return "", nil, nil
+	}
+
+	group, err := influxDto.ParseCondition(condition)
+	if err != nil {
+		return "", nil, errors.New("labels: " + err.Error())
+	}
+
+	return compileLabels(column, group)
+}
+
+// LabelFilter 将结构化的标签过滤条件编译为 MySQL 的查询条件, 过滤条件为空时返回空字符串
+func LabelFilter(column string, group *apiModel.FilterGroup) (string, []interface{}, error) {
+	if group == nil {
+		return "", nil, nil
+	}
+
+	return compileLabels(column, group)
+}
+
+// LabelColumn 取 json 格式的标签列中标签 name 的值, 标签不存在或标签列为空时为空字符串
+// 标签名拼接在 json 路径中, 只允许字母、数字及下划线, 否则返回错误
+func LabelColumn(column, name string) (string, error) {
+	if err := labels.ValidateName(name); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("COALESCE(JSON_UNQUOTE(JSON_EXTRACT(IF(`%s` IS NULL OR `%s` = '', '{}', `%s`), '$.\"%s\"')), '')",
+		column, column, column, name), nil
+}
+
+func compileLabels(column string, group *apiModel.FilterGroup) (string, []interface{}, error) {
+	var logic = " AND "
+	if strings.EqualFold(group.Logic, "OR") {
+		logic = " OR "
+	}
+
+	var parts = make([]string, 0, len(group.Conditions)+len(group.Groups))
+	var args = make([]interface{}, 0)
+	for _, condition := range group.Conditions {
+		// 标签不存在或标签列为空时, 以空字符串比较
+		value, err := LabelColumn(column, condition.Tag)
+		if err != nil {
+			return "", nil, errors.New("labels: " + err.Error())
+		}
+
+		switch condition.Operator {
+		case "=":
+			parts = append(parts, value+" = ?")
+		case "!=":
+			parts = append(parts, value+" <> ?")
+		case "=~", "!~":
+			if _, err := regexp.Compile(condition.Value); err != nil {
+				return "", nil, fmt.Errorf("labels: the regular expression {%s} of label {%s} is incorrect: %s", condition.Value, condition.Tag, err.Error())
+			}
+			if strings.Compare(condition.Operator, "=~") == 0 {
+				parts = append(parts, value+" REGEXP ?")
+			} else {
+				parts = append(parts, value+" NOT REGEXP ?")
+			}
+		default:
+			return "", nil, errors.New("labels: the operator must be one of =, !=, =~, !~, but got " + condition.Operator)
+		}
+		args = append(args, condition.Value)
+	}
+
+	for i := range group.Groups {
+		sub, subArgs, err := compileLabels(column, &group.Groups[i])
+		if err != nil {
+			return "", nil, err
+		}
+		if strings.Compare(sub, "") != 0 {
+			parts = append(parts, "("+sub+")")
+			args = append(args, subArgs...)
+		}
+	}
+
+	return strings.Join(parts, logic), args, nil
+}
@@ -0,0 +1,71 @@
+package mysql
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"owl-engine/pkg/model/apiModel"
+)
+
+func TestLabelCondition(t *testing.T) {
+	var env, _ = LabelColumn("labels", "env")
+	var team, _ = LabelColumn("labels", "team")
+
+	var cases = []struct {
+		condition string
+		where     string
+		args      []interface{}
+		err       string
+	}{
+		{condition: "  ", where: ""},
+		{condition: "env = 'prod'", where: env + " = ?", args: []interface{}{"prod"}},
+		{condition: `"env" != 'prod'`, where: env + " <> ?", args: []interface{}{"prod"}},
+		{condition: "env =~ /^p/ OR team !~ /db/", where: "(" + env + " REGEXP ?) OR (" + team + " NOT REGEXP ?)", args: []interface{}{"^p", "db"}},
+		{condition: "env = 'a' AND (team = 'b' OR team = 'c')", where: env + " = ? AND ((" + team + " = ?) OR (" + team + " = ?))", args: []interface{}{"a", "b", "c"}},
+		{condition: `env = 'it''s'`, err: "labels:"},
+		{condition: "env =~ /[/", err: "regular expression"},
+		// 标签名拼接在 json 路径中, 非法的标签名不能进入 SQL
+		{condition: `"a')) OR 1=1 -- " = 'x'`, err: "the label name"},
+		{condition: `"a\"b" = 'x'`, err: "the label name"},
+		{condition: `"a.b" = 'x'`, err: "the label name"},
+		{condition: `host-name = 'x'`, err: "the label name"},
+		{condition: `"" = 'x'`, err: "the label name"},
+	}
+
+	for _, c := range cases {
+		where, args, err := LabelCondition("labels", c.condition)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("LabelCondition(%s) error = %v, want %s", c.condition, err, c.err)
+			}
+			if where != "" {
+				t.Errorf("LabelCondition(%s) = %s, want no sql on error", c.condition, where)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("LabelCondition(%s) error: %s", c.condition, err.Error())
+			continue
+		}
+		if where != c.where || !reflect.DeepEqual(args, c.args) {
+			t.Errorf("LabelCondition(%s) = %s %v, want %s %v", c.condition, where, args, c.where, c.args)
+		}
+	}
+}
+
+func TestLabelFilter(t *testing.T) {
+	var group = &apiModel.FilterGroup{Conditions: []apiModel.TagFilter{{Tag: "x')) OR 1=1 --", Operator: "=", Value: "a"}}}
+	if where, _, err := LabelFilter("extension", group); err == nil {
+		t.Errorf("LabelFilter with hostile tag = %s, want error", where)
+	}
+
+	if where, args, err := LabelFilter("extension", nil); err != nil || where != "" || args != nil {
+		t.Errorf("LabelFilter(nil) = %s %v %v", where, args, err)
+	}
+
+	column, err := LabelColumn("extension", "host")
+	if err != nil || column != "COALESCE(JSON_UNQUOTE(JSON_EXTRACT(IF(`extension` IS NULL OR `extension` = '', '{}', `extension`), '$.\"host\"')), '')" {
+		t.Errorf("LabelColumn(host) = %s %v", column, err)
+	}
+}
@@ -0,0 +1,195 @@
+package metric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/client/database"
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/dao/mysql"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/dbModel"
+)
+
+// 指标的标签所在的列
+const labelColumn = "extension"
+
+type metric struct{}
+
+var MetricDto = new(metric)
+
+// Query 指标值表的查询条件
+type Query struct {
+	Metric    string                // 指标名
+	Origin    string                // 产品名
+	Type      string                // 业务域
+	Category  int8                  // 指标类型
+	Filters   *apiModel.FilterGroup // 标签过滤条件, 以 extension 中的标签匹配
+	GroupBy   []string              // 分组的标签, 每个标签集为一个序列
+	Aggregate string                // 时间窗口内的聚合方式: max, min, mean, count; 为空时返回原始的点
+	Interval  time.Duration         // 原始的点按该时间间隔分桶后取平均值, 只在 Aggregate 为空时使用, 0 表示不分桶
+	Start     time.Time             // 时间范围 [Start, Stop)
+	Stop      time.Time
+}
+
+// 聚合方式对应的 SQL 函数
+var aggregates = map[string]string{
+	"max":   "MAX(`value`)",
+	"min":   "MIN(`value`)",
+	"mean":  "AVG(`value`)",
+	"count": "COUNT(`value`)",
+}
+
+// Build 生成参数化的查询语句, 返回语句及参数; 查询结果的列依次为: 各分组标签、value、time
+func (q *Query) Build() (string, []interface{}, error) {
+	var tags = make([]string, 0, len(q.GroupBy))
+	for i, name := range q.GroupBy {
+		column, err := mysql.LabelColumn(labelColumn, name)
+		if err != nil {
+			return "", nil, errors.New("group_by: " + err.Error())
+		}
+		tags = append(tags, fmt.Sprintf("%s AS `g%d`", column, i))
+	}
+
+	// 聚合或分桶后时间列的别名不能与 time 列同名, 否则 GROUP BY、ORDER BY 会引用原始的 time 列
+	var selects, groups []string
+	var order = "`time`"
+	var args = make([]interface{}, 0)
+	switch {
+	case strings.Compare(q.Aggregate, "") != 0:
+		aggregate, ok := aggregates[q.Aggregate]
+		if !ok {
+			return "", nil, errors.New("the aggregate of metric must be one of max, min, mean, count, but got " + q.Aggregate)
+		}
+		selects = append(tags, aggregate+" AS `value`", "MAX(`time`) AS `last_time`")
+		groups, order = groupColumns(len(tags)), "`last_time`"
+	case q.Interval > 0:
+		// 以 Start 为起点按时间间隔分桶, 桶的时间为桶的起始时间
+		seconds := int64(q.Interval / time.Second)
+		if seconds <= 0 {
+			return "", nil, errors.New("the interval of metric must be at least 1s")
+		}
+		selects = append(tags, "AVG(`value`) AS `value`",
+			"FROM_UNIXTIME(UNIX_TIMESTAMP(?) + FLOOR((UNIX_TIMESTAMP(`time`) - UNIX_TIMESTAMP(?)) / ?) * ?) AS `bucket`")
+		args = append(args, q.Start, q.Start, seconds, seconds)
+		groups, order = append(groupColumns(len(tags)), "`bucket`"), "`bucket`"
+	default:
+		selects = append(tags, "`value`", "`time`")
+	}
+
+	var where = []string{"`metric` = ?", "`origin` = ?", "`type` = ?", "`category` = ?", "`time` >= ?", "`time` < ?"}
+	args = append(args, q.Metric, q.Origin, q.Type, q.Category, q.Start, q.Stop)
+
+	condition, conditionArgs, err := mysql.LabelFilter(labelColumn, q.Filters)
+	if err != nil {
+		return "", nil, err
+	}
+	if strings.Compare(condition, "") != 0 {
+		where = append(where, "("+condition+")")
+		args = append(args, conditionArgs...)
+	}
+
+	var sql = fmt.Sprintf("SELECT %s FROM `%s` WHERE %s", strings.Join(selects, ", "), dbModel.Metric{}.TableName(), strings.Join(where, " AND "))
+	if len(groups) > 0 {
+		sql += " GROUP BY " + strings.Join(groups, ", ")
+	}
+	return sql + " ORDER BY " + order, args, nil
+}
+
+// 分组的列: g0, g1, ...
+func groupColumns(n int) []string {
+	var columns = make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		columns = append(columns, fmt.Sprintf("`g%d`", i))
+	}
+	return columns
+}
+
+// Query 查询指标值表, 返回与 influxDto.Metric.Query 相同结构的序列; 未分组时所有的点属于同一个序列
+func (m *metric) Query(ctx context.Context, q *Query) (string, []influxDto.Series, error) {
+	if database.DB == nil {
+		return "", nil, errors.New("mysql does not initialize")
+	}
+
+	sql, args, err := q.Build()
+	if err != nil {
+		return "", nil, err
+	}
+
+	rows, err := database.DB.WithContext(ctx).Raw(sql, args...).Rows()
+	if err != nil {
+		return sql, nil, err
+	}
+	defer rows.Close()
+
+	var merged = make(map[string]*influxDto.Series)
+	var keys = make([]string, 0)
+	for rows.Next() {
+		var values = make([]string, len(q.GroupBy))
+		var value *float64
+		var timestamp *time.Time
+
+		var dest = make([]interface{}, 0, len(values)+2)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		dest = append(dest, &value, &timestamp)
+		if err := rows.Scan(dest...); err != nil {
+			return sql, nil, err
+		}
+		if value == nil {
+			continue
+		}
+
+		var tags = make(map[string]string, len(q.GroupBy))
+		for i, name := range q.GroupBy {
+			tags[name] = values[i]
+		}
+
+		var series = influxDto.Series{Tags: tags}
+		key := series.Key()
+		if _, ok := merged[key]; !ok {
+			merged[key] = &influxDto.Series{Tags: tags, Points: make([]influxDto.Point, 0)}
+			keys = append(keys, key)
+		}
+
+		var point = influxDto.Point{Value: *value}
+		if timestamp != nil {
+			point.Time = *timestamp
+		}
+		merged[key].Points = append(merged[key].Points, point)
+	}
+	if err := rows.Err(); err != nil {
+		return sql, nil, err
+	}
+
+	sort.Strings(keys)
+	var result = make([]influxDto.Series, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *merged[key])
+	}
+
+	return sql, result, nil
+}
+
+// Insert 批量写入指标值, 每批最多 batchSize 条, 所有批次在同一个事务中写入
+func (m *metric) Insert(records []dbModel.Metric, batchSize int) error {
+	if database.DB == nil {
+		return errors.New("mysql does not initialize")
+	}
+
+	work := database.NewWork()
+	db := work.Begin()
+	defer work.Rollback()
+
+	err := db.CreateInBatches(records, batchSize).Error
+	if err == nil {
+		work.Commit()
+	}
+
+	return err
+}
@@ -0,0 +1,97 @@
+package metric
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"owl-engine/pkg/dao/mysql"
+	"owl-engine/pkg/model/apiModel"
+)
+
+func TestBuild(t *testing.T) {
+	var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var stop = start.Add(5 * time.Minute)
+	var host, _ = mysql.LabelColumn(labelColumn, "host")
+	var base = func() Query {
+		return Query{Metric: "cpu", Origin: "web", Type: "host", Category: 5, Start: start, Stop: stop}
+	}
+	var where = "WHERE `metric` = ? AND `origin` = ? AND `type` = ? AND `category` = ? AND `time` >= ? AND `time` < ?"
+
+	var cases = []struct {
+		name  string
+		query func(q *Query)
+		sql   string
+		args  []interface{}
+		err   string
+	}{
+		{
+			name:  "raw",
+			query: func(q *Query) {},
+			sql:   "SELECT `value`, `time` FROM `engine_tbl_metric` " + where + " ORDER BY `time`",
+			args:  []interface{}{"cpu", "web", "host", int8(5), start, stop},
+		},
+		{
+			name:  "aggregate",
+			query: func(q *Query) { q.Aggregate, q.GroupBy = "max", []string{"host"} },
+			sql: "SELECT " + host + " AS `g0`, MAX(`value`) AS `value`, MAX(`time`) AS `last_time` FROM `engine_tbl_metric` " + where +
+				" GROUP BY `g0` ORDER BY `last_time`",
+			args: []interface{}{"cpu", "web", "host", int8(5), start, stop},
+		},
+		{
+			// 分桶的参数在 SELECT 中, 位于 WHERE 的参数之前
+			name:  "interval",
+			query: func(q *Query) { q.Interval = time.Minute },
+			sql: "SELECT AVG(`value`) AS `value`, FROM_UNIXTIME(UNIX_TIMESTAMP(?) + FLOOR((UNIX_TIMESTAMP(`time`) - UNIX_TIMESTAMP(?)) / ?) * ?) AS `bucket` " +
+				"FROM `engine_tbl_metric` " + where + " GROUP BY `bucket` ORDER BY `bucket`",
+			args: []interface{}{start, start, int64(60), int64(60), "cpu", "web", "host", int8(5), start, stop},
+		},
+		{
+			// 过滤条件的参数位于 WHERE 的参数之后
+			name: "filter",
+			query: func(q *Query) {
+				q.Interval = time.Minute
+				q.Filters = &apiModel.FilterGroup{Logic: "OR", Conditions: []apiModel.TagFilter{
+					{Tag: "host", Operator: "=", Value: "a"}, {Tag: "host", Operator: "=~", Value: "^b"}}}
+			},
+			sql: "SELECT AVG(`value`) AS `value`, FROM_UNIXTIME(UNIX_TIMESTAMP(?) + FLOOR((UNIX_TIMESTAMP(`time`) - UNIX_TIMESTAMP(?)) / ?) * ?) AS `bucket` " +
+				"FROM `engine_tbl_metric` " + where + " AND (" + host + " = ? OR " + host + " REGEXP ?) GROUP BY `bucket` ORDER BY `bucket`",
+			args: []interface{}{start, start, int64(60), int64(60), "cpu", "web", "host", int8(5), start, stop, "a", "^b"},
+		},
+		{name: "bad aggregate", query: func(q *Query) { q.Aggregate = "sum" }, err: "the aggregate of metric"},
+		{name: "sub-second interval", query: func(q *Query) { q.Interval = time.Millisecond }, err: "at least 1s"},
+		{name: "hostile group_by", query: func(q *Query) { q.GroupBy = []string{"x')) OR 1=1 -- "} }, err: "group_by: the label name"},
+		{name: "quoted group_by", query: func(q *Query) { q.GroupBy = []string{`a"b`} }, err: "group_by: the label name"},
+		{
+			name: "hostile filter",
+			query: func(q *Query) {
+				q.Filters = &apiModel.FilterGroup{Conditions: []apiModel.TagFilter{{Tag: "a' OR '1'='1", Operator: "=", Value: "x"}}}
+			},
+			err: "the label name",
+		},
+	}
+
+	for _, c := range cases {
+		var q = base()
+		c.query(&q)
+
+		sql, args, err := q.Build()
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: error = %v, want %s", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error: %s", c.name, err.Error())
+			continue
+		}
+		if sql != c.sql {
+			t.Errorf("%s: sql = %s\nwant %s", c.name, sql, c.sql)
+		}
+		if !reflect.DeepEqual(args, c.args) {
+			t.Errorf("%s: args = %v, want %v", c.name, args, c.args)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package rule
+
+import (
+	"strings"
+
+	"owl-engine/pkg/client/database"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/dbModel"
+)
+
+type composite struct{}
+
+var CompositeDto = new(composite)
+
+func (c *composite) SelectByCondition(condition *apiModel.CompositeRuleCondition) (*[]dbModel.CompositeRule, int64, error) {
+	db := database.DB.Model(&dbModel.CompositeRule{})
+
+	if condition.Id > 0 {
+		db = db.Where("id = ?", condition.Id)
+	}
+
+	if strings.Compare(condition.Name, "") != 0 {
+		db = db.Where("name like ?", "%"+condition.Name+"%")
+	}
+
+	if strings.Compare(condition.Creator, "") != 0 {
+		db = db.Where("creator = ?", condition.Creator)
+	}
+
+	if strings.Compare(condition.ResponsiblePeople, "") != 0 {
+		db = db.Where("responsible_people = ?", condition.ResponsiblePeople)
+	}
+
+	if condition.Switch > 0 {
+		db = db.Where("switch = ?", condition.Switch)
+	}
+
+	if condition.Inuse > 0 {
+		db = db.Where("inuse = ?", condition.Inuse)
+	}
+
+	var count int64
+	db.Count(&count)
+
+	var record = make([]dbModel.CompositeRule, 0, condition.Size)
+	offset := (condition.Page - 1) * condition.Size
+
+	// 按照更新时间进行排序
+	return &record, count, db.Offset(int(offset)).Limit(int(condition.Size)).Order("updated_at desc").Scan(&record).Error
+}
+
+func (c *composite) SelectByIds(ids []int) (*[]dbModel.CompositeRule, int64, error) {
+	db := database.DB.Model(&dbModel.CompositeRule{}).Where("id in (?)", ids)
+
+	var count int64
+	db.Count(&count)
+
+	var record = make([]dbModel.CompositeRule, 0)
+	return &record, count, db.Order("created_at desc").Scan(&record).Error
+}
+
+func (c *composite) Insert(data *dbModel.CompositeRule) error {
+	work := database.NewWork()
+	db := work.Begin()
+	defer work.Rollback()
+
+	err := db.Create(data).Error
+	if err == nil {
+		work.Commit()
+	}
+
+	return err
+}
+
+// 只更新启用状态及更新者
+func (c *composite) Update(data *dbModel.CompositeRule) error {
+	work := database.NewWork()
+	db := work.Begin()
+	defer work.Rollback()
+
+	var err error
+	var record dbModel.CompositeRule
+	err = db.Model(&dbModel.CompositeRule{}).Where("id = ?", data.ID).First(&record).Error
+	if err == nil {
+		record.Switch = data.Switch
+		record.Updater = data.Updater
+
+		err = db.Save(&record).Error
+	}
+
+	if err == nil {
+		work.Commit()
+	}
+
+	return err
+}
+
+// 使用 Save 更新全部字段, 零值字段同样会被更新
+func (c *composite) Save(data *dbModel.CompositeRule) error {
+	work := database.NewWork()
+	db := work.Begin()
+	defer work.Rollback()
+
+	var err error
+	var record dbModel.CompositeRule
+	err = db.Model(&dbModel.CompositeRule{}).Where("id = ?", data.ID).First(&record).Error
+	if err == nil {
+		record.Name = data.Name
+		record.Express = data.Express
+		record.MatchOn = data.MatchOn
+		record.Silent = data.Silent
+		record.SilenceFilters = data.SilenceFilters
+		record.Template = data.Template
+		record.Level = data.Level
+		record.Creator = data.Creator
+		record.Updater = data.Updater
+		record.ResponsiblePeople = data.ResponsiblePeople
+		record.Crontab = data.Crontab
+		record.Switch = data.Switch
+		record.Inuse = data.Inuse
+		record.GroupIp = data.GroupIp
+		record.WebHooks = data.WebHooks
+		record.Description = data.Description
+		record.UpdatedAt = data.UpdatedAt
+
+		err = db.Save(&record).Error
+	}
+
+	if err == nil {
+		work.Commit()
+	}
+
+	return err
+}
+
+func (c *composite) Delete(updater string, ids []int) (err error) {
+	work := database.NewWork()
+	db := work.Begin()
+	defer work.Rollback()
+
+	err = db.Model(&dbModel.CompositeRule{}).Where("id in (?)", ids).UpdateColumn("updater", updater).Error
+	err = db.Model(&dbModel.CompositeRule{}).Where("id in (?)", ids).Delete(&dbModel.CompositeRule{}).Error
+	if err == nil {
+		work.Commit()
+	}
+
+	return
+}
@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"owl-engine/pkg/client/database"
+	"owl-engine/pkg/dao/mysql"
 	"owl-engine/pkg/model/apiModel"
 	"owl-engine/pkg/model/dbModel"
 )
@@ -52,6 +53,13 @@ func (r *rule) SelectByCondition(condition *apiModel.MathRuleCondition) (*[]dbMo
 		db = db.Where("inuse = ?", condition.Inuse)
 	}
 
+	// 规则标签的过滤条件
+	if where, args, err := mysql.LabelCondition("labels", condition.Labels); err != nil {
+		return &[]dbModel.Rule{}, 0, err
+	} else if strings.Compare(where, "") != 0 {
+		db = db.Where(where, args...)
+	}
+
 	var count int64
 	db.Count(&count)
 
@@ -123,10 +131,26 @@ func (r *rule) Save(data *dbModel.Rule) error {
 		record.Unit = data.Unit
 		record.TimeWindow = data.TimeWindow
 		record.Duration = data.Duration
+		record.Interval = data.Interval
+		record.Fill = data.Fill
+		record.MatchCount = data.MatchCount
+		record.PointCount = data.PointCount
 		record.Origin = data.Origin
 		record.BusinessType = data.BusinessType
 		record.Category = data.Category
 		record.ExtensionCondition = data.ExtensionCondition
+		record.Filters = data.Filters
+		record.GroupBy = data.GroupBy
+		record.NoData = data.NoData
+		record.AbsentFor = data.AbsentFor
+		record.Timezone = data.Timezone
+		record.Datasource = data.Datasource
+		record.DatasourceId = data.DatasourceId
+		record.Baseline = data.Baseline
+		record.Horizon = data.Horizon
+		record.ForecastMethod = data.ForecastMethod
+		record.Levels = data.Levels
+		record.Labels = data.Labels
 		record.Level = data.Level
 		record.Creator = data.Creator
 		record.Updater = data.Updater
@@ -0,0 +1,115 @@
+package anomaly
+
+import (
+	"errors"
+	"math"
+
+	"owl-engine/pkg/lib/stats"
+)
+
+// 检测所需的当前窗口的最少点数
+const minPoints = 10
+
+// Windows 异常检测的数据窗口, 与 Metis 使用的三个窗口相同
+//
+//	Current    当前时刻往前的窗口, 最后一个点为待检测的点, 如: 过去 180 分钟的 181 个点
+//	Yesterday  昨天同一时刻前后的窗口, 如: 前后各 180 分钟的 361 个点
+//	LastWeek   上周同一时刻前后的窗口, 如: 前后各 180 分钟的 361 个点
+type Windows struct {
+	Current   []float64
+	Yesterday []float64
+	LastWeek  []float64
+}
+
+// Result 异常检测的结果, 各检测方法的得分及综合得分的取值范围均为 [0, 1], 越大越异常
+type Result struct {
+	Score  float64            // 综合得分, 为各检测方法得分的平均值
+	Scores map[string]float64 // 各检测方法的得分, key 为检测方法的名称
+}
+
+// Detect 对当前窗口的最后一个点进行异常检测
+// 当前窗口的检测: EWMA 及 3-sigma; 同比的检测: 与昨天、上周同一时刻的差值, 昨天或上周的数据不足时跳过
+func Detect(w Windows) (Result, error) {
+	if len(w.Current) < minPoints {
+		return Result{}, errors.New("insufficient number of points in current window")
+	}
+
+	var history, value = w.Current[:len(w.Current)-1], w.Current[len(w.Current)-1]
+	var result = Result{Scores: make(map[string]float64)}
+
+	result.Scores["ewma"] = confidence(EWMA(history, value, 0.3))
+	result.Scores["3-sigma"] = confidence(Sigma(history, value))
+
+	if z, ok := Seasonal(w.Current, w.Yesterday); ok {
+		result.Scores["yesterday"] = confidence(z)
+	}
+	if z, ok := Seasonal(w.Current, w.LastWeek); ok {
+		result.Scores["last_week"] = confidence(z)
+	}
+
+	var sum float64
+	for _, score := range result.Scores {
+		sum += score
+	}
+	result.Score = sum / float64(len(result.Scores))
+
+	return result, nil
+}
+
+// EWMA 以指数加权移动平均预测待检测的点, 返回预测误差相对于历史预测误差标准差的倍数
+// alpha 为平滑系数, 取值范围 (0, 1], 越大越偏重最近的点
+func EWMA(history []float64, value, alpha float64) float64 {
+	if len(history) == 0 {
+		return 0
+	}
+
+	var forecast = history[0]
+	var errs = make([]float64, 0, len(history)-1)
+	for _, v := range history[1:] {
+		errs = append(errs, v-forecast)
+		forecast = alpha*v + (1-alpha)*forecast
+	}
+
+	return zScore(value-forecast, stats.Mean(errs), stats.StdDev(errs))
+}
+
+// Sigma 待检测的点相对于历史均值的标准差倍数, 大于 3 即为 3-sigma 异常
+func Sigma(history []float64, value float64) float64 {
+	return zScore(value, stats.Mean(history), stats.StdDev(history))
+}
+
+// Seasonal 同比检测: current 与 reference 按时间对齐(reference 的起点与 current 的起点为同一时刻),
+// 以历史点的同比差值作为基准, 返回待检测的点的同比差值相对于基准的标准差倍数; reference 的点数不足时返回 false
+func Seasonal(current, reference []float64) (float64, bool) {
+	if len(current) < minPoints || len(reference) < len(current) {
+		return 0, false
+	}
+
+	var last = len(current) - 1
+	var diffs = make([]float64, 0, last)
+	for i := 0; i < last; i++ {
+		diffs = append(diffs, current[i]-reference[i])
+	}
+
+	return zScore(current[last]-reference[last], stats.Mean(diffs), stats.StdDev(diffs)), true
+}
+
+// 偏离均值的标准差倍数; 标准差为 0 时, 与均值相等为 0, 否则视为无穷大
+func zScore(value, mean, stdDev float64) float64 {
+	if stdDev == 0 {
+		if value == mean {
+			return 0
+		}
+		return math.Inf(1)
+	}
+
+	return math.Abs(value-mean) / stdDev
+}
+
+// 将标准差倍数转换为异常的置信度: 正态分布下 |X| < z 的概率, 如: z = 3 时约为 0.9973
+func confidence(z float64) float64 {
+	if math.IsInf(z, 1) {
+		return 1
+	}
+	return math.Erf(z / math.Sqrt2)
+}
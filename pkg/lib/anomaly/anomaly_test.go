@@ -0,0 +1,67 @@
+package anomaly
+
+import (
+	"math"
+	"testing"
+)
+
+// 以正弦曲线模拟有周期的指标, offset 为相位偏移
+func wave(n int, offset float64) []float64 {
+	var values = make([]float64, n)
+	for i := range values {
+		values[i] = 100 + 10*math.Sin(float64(i)/10+offset)
+	}
+	return values
+}
+
+func TestDetect(t *testing.T) {
+	var normal = Windows{Current: wave(181, 0), Yesterday: wave(361, 0), LastWeek: wave(361, 0)}
+	result, err := Detect(normal)
+	if err != nil {
+		t.Fatalf("detect error: %s", err.Error())
+	}
+	if result.Score > 0.5 {
+		t.Fatalf("normal score = %v, want <= 0.5", result.Score)
+	}
+	if len(result.Scores) != 4 {
+		t.Fatalf("scores = %v, want 4 detectors", result.Scores)
+	}
+
+	var spike = Windows{Current: wave(181, 0), Yesterday: wave(361, 0), LastWeek: wave(361, 0)}
+	spike.Current[180] += 100
+	result, err = Detect(spike)
+	if err != nil {
+		t.Fatalf("detect error: %s", err.Error())
+	}
+	if result.Score < 0.99 {
+		t.Fatalf("spike score = %v, want >= 0.99", result.Score)
+	}
+}
+
+func TestDetectInsufficient(t *testing.T) {
+	if _, err := Detect(Windows{Current: []float64{1, 2, 3}}); err == nil {
+		t.Fatal("want error for insufficient points")
+	}
+
+	// 没有同比数据时只使用当前窗口的检测方法
+	result, err := Detect(Windows{Current: wave(60, 0)})
+	if err != nil {
+		t.Fatalf("detect error: %s", err.Error())
+	}
+	if _, ok := result.Scores["yesterday"]; ok || len(result.Scores) != 2 {
+		t.Fatalf("scores = %v, want ewma and 3-sigma only", result.Scores)
+	}
+}
+
+func TestSigma(t *testing.T) {
+	var history = []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	if z := Sigma(history, 11); z != 3 {
+		t.Fatalf("Sigma = %v, want 3", z)
+	}
+	if z := Sigma([]float64{1, 1, 1}, 1); z != 0 {
+		t.Fatalf("Sigma of constant = %v, want 0", z)
+	}
+	if c := confidence(Sigma([]float64{1, 1, 1}, 2)); c != 1 {
+		t.Fatalf("confidence of constant breach = %v, want 1", c)
+	}
+}
@@ -0,0 +1,199 @@
+package express
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/Knetic/govaluate"
+)
+
+// Functions 规则表达式中可用的函数, 规则校验与运行时计算均使用该函数集, 保证两者一致
+//
+//	abs(x)                  绝对值
+//	max(x, y, ...)          最大值
+//	min(x, y, ...)          最小值
+//	round(x[, n])           四舍五入, 保留 n 位小数, 默认为 0
+//	log(x[, base])          对数, 默认为自然对数; x 必须大于 0, base 必须大于 0 且不为 1
+//	pct_change(cur, prev)   变化率(百分比): (cur - prev) / prev * 100; prev 为 0 时返回错误
+//	clamp(x, lower, upper)  将 x 限制在 [lower, upper] 区间内
+//	if(cond, a, b)          条件表达式, cond 为真时返回 a, 否则返回 b
+//
+// 例如: abs(pct_change([A], [B])) > 20 && if([C] > 0, [D] / [C], 0) > 0.5
+var Functions = map[string]govaluate.ExpressionFunction{
+	"abs": func(args ...interface{}) (interface{}, error) {
+		values, err := numbers("abs", args, 1, 1)
+		if err != nil {
+			return nil, err
+		}
+		return math.Abs(values[0]), nil
+	},
+	"max": func(args ...interface{}) (interface{}, error) {
+		values, err := numbers("max", args, 1, -1)
+		if err != nil {
+			return nil, err
+		}
+		var result = values[0]
+		for _, v := range values[1:] {
+			result = math.Max(result, v)
+		}
+		return result, nil
+	},
+	"min": func(args ...interface{}) (interface{}, error) {
+		values, err := numbers("min", args, 1, -1)
+		if err != nil {
+			return nil, err
+		}
+		var result = values[0]
+		for _, v := range values[1:] {
+			result = math.Min(result, v)
+		}
+		return result, nil
+	},
+	"round": func(args ...interface{}) (interface{}, error) {
+		values, err := numbers("round", args, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) == 1 {
+			return math.Round(values[0]), nil
+		}
+		pow := math.Pow(10, math.Trunc(values[1]))
+		return math.Round(values[0]*pow) / pow, nil
+	},
+	"log": func(args ...interface{}) (interface{}, error) {
+		values, err := numbers("log", args, 1, 2)
+		if err != nil {
+			return nil, err
+		}
+		// 非正数的对数为 NaN 或 -Inf, 参与比较时会静默地不告警或误告警
+		if values[0] <= 0 {
+			return nil, fmt.Errorf("log: the argument must be greater than 0, but got %v", values[0])
+		}
+		if len(values) == 1 {
+			return math.Log(values[0]), nil
+		}
+		if values[1] <= 0 || values[1] == 1 {
+			return nil, fmt.Errorf("log: the base must be greater than 0 and not equal to 1, but got %v", values[1])
+		}
+		return math.Log(values[0]) / math.Log(values[1]), nil
+	},
+	"pct_change": func(args ...interface{}) (interface{}, error) {
+		values, err := numbers("pct_change", args, 2, 2)
+		if err != nil {
+			return nil, err
+		}
+		// 计数器的前值为 0 很常见, 此时变化率为 ±Inf 或 NaN, 不参与比较
+		if values[1] == 0 {
+			return nil, errors.New("pct_change: the previous value is 0")
+		}
+		return (values[0] - values[1]) / values[1] * 100, nil
+	},
+	"clamp": func(args ...interface{}) (interface{}, error) {
+		values, err := numbers("clamp", args, 3, 3)
+		if err != nil {
+			return nil, err
+		}
+		if values[1] > values[2] {
+			return nil, errors.New("clamp: lower bound cannot be greater than upper bound")
+		}
+		return math.Min(math.Max(values[0], values[1]), values[2]), nil
+	},
+	"if": func(args ...interface{}) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("if: expect 3 arguments, but got %d", len(args))
+		}
+		cond, ok := args[0].(bool)
+		if !ok {
+			return nil, fmt.Errorf("if: the first argument must be a boolean, but got %v", args[0])
+		}
+		if cond {
+			return args[1], nil
+		}
+		return args[2], nil
+	},
+}
+
+// New 以规则表达式的函数集解析表达式
+func New(expression string) (*govaluate.EvaluableExpression, error) {
+	return govaluate.NewEvaluableExpressionWithFunctions(expression, Functions)
+}
+
+// Evaluate 解析并计算表达式
+func Evaluate(expression string, params map[string]interface{}) (interface{}, error) {
+	expr, err := New(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return expr.Evaluate(params)
+}
+
+// LeftOperand 返回表达式中第一个比较符左侧的部分, 函数参数及括号内的比较符不参与切割
+// 如: if([A] > 0, [B], 0) >= 10 返回 if([A] > 0, [B], 0)
+func LeftOperand(expression string) string {
+	if i := comparatorIndex(expression); i >= 0 {
+		return strings.TrimSpace(expression[:i])
+	}
+
+	return strings.TrimSpace(expression)
+}
+
+// Comparator 返回表达式中第一个比较符, 如: >、>=、==、!=; 不存在时返回空字符串
+func Comparator(expression string) string {
+	i := comparatorIndex(expression)
+	if i < 0 {
+		return ""
+	}
+
+	if i+1 < len(expression) && expression[i+1] == '=' {
+		return expression[i : i+2]
+	}
+	return expression[i : i+1]
+}
+
+// 表达式中第一个比较符的位置, 函数参数及括号内的比较符不参与切割; 不存在时返回 -1
+func comparatorIndex(expression string) int {
+	var depth = 0
+	for i := 0; i < len(expression); i++ {
+		switch c := expression[i]; c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '=', '!', '>', '<':
+			if depth != 0 {
+				continue
+			}
+			// 跳过逻辑非 ! 以及正则匹配 =~、!~
+			if c == '=' || c == '!' {
+				if i+1 < len(expression) && expression[i+1] == '=' {
+					return i
+				}
+				continue
+			}
+			return i
+		}
+	}
+
+	return -1
+}
+
+// 将函数参数转换为数值, max 为 -1 时不限制参数个数
+func numbers(name string, args []interface{}, min, max int) ([]float64, error) {
+	if len(args) < min || (max >= 0 && len(args) > max) {
+		return nil, fmt.Errorf("%s: incorrect number of arguments %d", name, len(args))
+	}
+
+	var values = make([]float64, 0, len(args))
+	for _, arg := range args {
+		value, ok := arg.(float64)
+		if !ok {
+			return nil, fmt.Errorf("%s: the argument must be a number, but got %v", name, arg)
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
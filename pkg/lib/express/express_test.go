@@ -0,0 +1,84 @@
+package express
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	var params = map[string]interface{}{"A": 120.0, "B": 100.0, "C": 0.0}
+
+	cases := []struct {
+		express string
+		want    interface{}
+	}{
+		{"abs([C] - [A])", 120.0},
+		{"max([A], [B], 150)", 150.0},
+		{"min([A], [B])", 100.0},
+		{"round(3.14159, 2)", 3.14},
+		{"round(2.5)", 3.0},
+		{"log(100, 10)", 2.0},
+		{"pct_change([A], [B])", 20.0},
+		{"clamp([A], 0, 100)", 100.0},
+		{"if([C] > 0, [A] / [C], 0)", 0.0},
+		{"abs(pct_change([B], [A])) > 10 && [A] > [B]", true},
+	}
+
+	for _, c := range cases {
+		got, err := Evaluate(c.express, params)
+		if err != nil {
+			t.Fatalf("evaluate %s error: %s", c.express, err.Error())
+		}
+
+		if value, ok := got.(float64); ok {
+			if math.Abs(value-c.want.(float64)) > 1e-9 {
+				t.Errorf("evaluate %s = %v, want %v", c.express, got, c.want)
+			}
+		} else if got != c.want {
+			t.Errorf("evaluate %s = %v, want %v", c.express, got, c.want)
+		}
+	}
+}
+
+func TestEvaluateError(t *testing.T) {
+	for _, e := range []string{"abs(1, 2)", "clamp(1, 10, 0)", "if(1, 2, 3)", "unknown(1)",
+		"pct_change(5, 0)", "pct_change(0, 0) > 20", "log(0)", "log(-1) < 0", "log(10, 1)", "log(10, 0)", "log(10, -2)"} {
+		if _, err := Evaluate(e, nil); err == nil {
+			t.Errorf("evaluate %s should return error", e)
+		}
+	}
+}
+
+func TestLeftOperand(t *testing.T) {
+	cases := map[string]string{
+		"[A] > 10":                      "[A]",
+		"[A] + [B] >= 10":               "[A] + [B]",
+		"if([A] > 0, [B], 0) != 1":      "if([A] > 0, [B], 0)",
+		"max([A], [B]) == 2":            "max([A], [B])",
+		"[A] - [B]":                     "[A] - [B]",
+		"pct_change([A], [B]) <= -20.5": "pct_change([A], [B])",
+	}
+
+	for e, want := range cases {
+		if got := LeftOperand(e); got != want {
+			t.Errorf("left operand of %s = %s, want %s", e, got, want)
+		}
+	}
+}
+
+func TestComparator(t *testing.T) {
+	cases := map[string]string{
+		"[A] > 10":                      ">",
+		"[A] + [B] >= 10":               ">=",
+		"if([A] > 0, [B], 0) != 1":      "!=",
+		"max([A], [B]) == 2":            "==",
+		"[A] - [B]":                     "",
+		"pct_change([A], [B]) <= -20.5": "<=",
+	}
+
+	for e, want := range cases {
+		if got := Comparator(e); got != want {
+			t.Errorf("comparator of %s = %s, want %s", e, got, want)
+		}
+	}
+}
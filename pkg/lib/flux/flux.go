@@ -0,0 +1,231 @@
+package flux
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client InfluxDB 2.x 的客户端, 以 /api/v2/query 接口执行 Flux 查询(以 annotated CSV 返回结果), 以 /api/v2/write 接口写入数据
+type Client struct {
+	Address string // 如: http://127.0.0.1:8086
+	Org     string // 组织名称
+	Token   string // API Token
+	HTTP    *http.Client
+}
+
+// Column 结果表的列
+type Column struct {
+	Name     string // 列名, 如: _time、_value、host
+	DataType string // 列的类型, 如: dateTime:RFC3339、double、string
+	Group    bool   // 是否属于分组的 key
+}
+
+// Table 结果中的一张表, 同一张表中的记录分组的 key 相同
+type Table struct {
+	Columns []Column
+	Records []map[string]string // 列名 --> 值, 值为空字符串时表示 null
+}
+
+// NewClient 创建客户端, timeout 为单次查询的超时时间
+func NewClient(address, org, token string, timeout time.Duration) *Client {
+	return &Client{
+		Address: strings.TrimRight(address, "/"),
+		Org:     org,
+		Token:   token,
+		HTTP:    &http.Client{Timeout: timeout},
+	}
+}
+
+// 查询请求的 dialect, 要求返回 datatype、group 及 default 三种注解
+var dialect = map[string]interface{}{
+	"header":         true,
+	"delimiter":      ",",
+	"annotations":    []string{"datatype", "group", "default"},
+	"commentPrefix":  "#",
+	"dateTimeFormat": "RFC3339",
+}
+
+// Query 执行 Flux 查询, 返回所有的结果表
+func (c *Client) Query(ctx context.Context, query string) ([]Table, error) {
+	if strings.Compare(c.Address, "") == 0 {
+		return nil, errors.New("the address of influxdb is not configured")
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"query": query, "type": "flux", "dialect": dialect})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Address+"/api/v2/query?org="+url.QueryEscape(c.Org), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/csv")
+	if strings.Compare(c.Token, "") != 0 {
+		req.Header.Set("Authorization", "Token "+c.Token)
+	}
+
+	var cli = c.HTTP
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("query", resp)
+	}
+
+	return Parse(resp.Body)
+}
+
+// Write 以 line protocol 写入数据到 bucket, 使用 /api/v2/write 接口; precision 为时间戳的精度: ns、us、ms、s
+func (c *Client) Write(ctx context.Context, bucket, precision string, lines []byte) error {
+	if strings.Compare(c.Address, "") == 0 {
+		return errors.New("the address of influxdb is not configured")
+	}
+
+	var params = url.Values{}
+	params.Set("org", c.Org)
+	params.Set("bucket", bucket)
+	params.Set("precision", precision)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Address+"/api/v2/write?"+params.Encode(), bytes.NewReader(lines))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if strings.Compare(c.Token, "") != 0 {
+		req.Header.Set("Authorization", "Token "+c.Token)
+	}
+
+	var cli = c.HTTP
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 写入成功时返回 204
+	if resp.StatusCode/100 != 2 {
+		return responseError("write", resp)
+	}
+
+	return nil
+}
+
+// 解析失败请求的错误信息, InfluxDB 2.x 以 {"code": "...", "message": "..."} 返回错误
+func responseError(action string, resp *http.Response) error {
+	data, _ := ioutil.ReadAll(resp.Body)
+	var result = struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(data, &result); err == nil && strings.Compare(result.Message, "") != 0 {
+		return fmt.Errorf("influxdb %s error, %s: %s", action, result.Code, result.Message)
+	}
+	return fmt.Errorf("influxdb %s error, status code: %d", action, resp.StatusCode)
+}
+
+// Parse 解析 annotated CSV 格式的查询结果, 见: https://docs.influxdata.com/influxdb/v2/reference/syntax/annotated-csv/
+// 注解及表头之后为数据行, 不同结构的表以新的注解开始; 查询出错时结果中包含 error 列
+func Parse(r io.Reader) ([]Table, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = false
+
+	var tables = make([]Table, 0)
+	var columns []Column
+	var types, groups, defaults []string
+	var current = -1 // 当前表在 tables 中的下标
+	var currentKey string
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch row[0] {
+		case "#datatype":
+			// 不同结构的表以新的注解开始, 之后重新读取表头
+			types, columns, current = row, nil, -1
+			continue
+		case "#group":
+			groups = row
+			continue
+		case "#default":
+			defaults = row
+			continue
+		}
+
+		// 注解之后的第一行为表头
+		if columns == nil {
+			columns = make([]Column, 0, len(row))
+			for i, name := range row {
+				var column = Column{Name: name}
+				if i < len(types) {
+					column.DataType = types[i]
+				}
+				if i < len(groups) {
+					column.Group = groups[i] == "true"
+				}
+				columns = append(columns, column)
+			}
+			continue
+		}
+
+		var record = make(map[string]string, len(columns))
+		for i, column := range columns {
+			var value string
+			if i < len(row) {
+				value = row[i]
+			}
+			if strings.Compare(value, "") == 0 && i < len(defaults) {
+				value = defaults[i]
+			}
+			if strings.Compare(column.Name, "") != 0 {
+				record[column.Name] = value
+			}
+		}
+
+		if message, ok := record["error"]; ok && len(columns) <= 3 {
+			return nil, fmt.Errorf("influxdb query error: %s", message)
+		}
+
+		// 以 result 及 table 列区分不同的表
+		key := record["result"] + "|" + record["table"]
+		if current < 0 || strings.Compare(key, currentKey) != 0 {
+			tables = append(tables, Table{Columns: columns, Records: make([]map[string]string, 0)})
+			current, currentKey = len(tables)-1, key
+		}
+		tables[current].Records = append(tables[current].Records, record)
+	}
+
+	return tables, nil
+}
+
+// String 转义为 Flux 的字符串常量, 以双引号包裹
+func String(value string) string {
+	return "\"" + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`).Replace(value) + "\""
+}
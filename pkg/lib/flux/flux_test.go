@@ -0,0 +1,108 @@
+package flux
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const result = `#datatype,string,long,string,dateTime:RFC3339,double
+#group,false,false,true,false,false
+#default,_result,,,,
+,result,table,host,_time,_value
+,,0,a,2024-01-01T00:00:00Z,1.5
+,,0,a,2024-01-01T00:01:00Z,
+,,1,b,2024-01-01T00:00:00Z,3
+
+#datatype,string,long,string,long
+#group,false,false,true,false
+#default,_result,,,
+,result,table,type,_value
+,,2,web,7
+`
+
+func TestQuery(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path != "/api/v2/query" || r.URL.Query().Get("org") != "owl" || r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("unexpected request %s %v", r.URL.String(), r.Header)
+		}
+
+		switch {
+		case strings.Contains(string(body), "bad"):
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":"invalid","message":"compilation failed"}`))
+		case strings.Contains(string(body), "fail"):
+			w.Write([]byte("#datatype,string,string\n#group,true,true\n#default,,\n,error,reference\n,runtime error,\n"))
+		default:
+			w.Write([]byte(result))
+		}
+	}))
+	defer server.Close()
+
+	cli := NewClient(server.URL, "owl", "secret", 5*time.Second)
+	tables, err := cli.Query(context.Background(), `from(bucket: "owl")`)
+	if err != nil {
+		t.Fatalf("query error: %s", err.Error())
+	}
+
+	if len(tables) != 3 {
+		t.Fatalf("query got %d tables, want 3", len(tables))
+	}
+	if len(tables[0].Records) != 2 || tables[0].Records[1]["_value"] != "" || tables[0].Records[0]["result"] != "_result" {
+		t.Errorf("table 0 = %+v", tables[0].Records)
+	}
+	if !tables[0].Columns[3].Group || tables[0].Columns[5].DataType != "double" {
+		t.Errorf("table 0 columns = %+v", tables[0].Columns)
+	}
+	if tables[2].Records[0]["type"] != "web" || tables[2].Records[0]["_value"] != "7" {
+		t.Errorf("table 2 = %+v", tables[2].Records)
+	}
+
+	if _, err := cli.Query(context.Background(), "bad"); err == nil || !strings.Contains(err.Error(), "compilation failed") {
+		t.Errorf("query bad = %v, want the error message of influxdb", err)
+	}
+	if _, err := cli.Query(context.Background(), "fail"); err == nil || !strings.Contains(err.Error(), "runtime error") {
+		t.Errorf("query fail = %v, want the error in the result", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var lines = "cpu,origin=web value=1 1700000000\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var params = r.URL.Query()
+		if r.URL.Path != "/api/v2/write" || params.Get("org") != "owl" || params.Get("precision") != "s" || r.Header.Get("Authorization") != "Token secret" {
+			t.Errorf("unexpected request %s %v", r.URL.String(), r.Header)
+		}
+
+		if params.Get("bucket") == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"code":"not found","message":"bucket \"missing\" not found"}`))
+			return
+		}
+		if string(body) != lines {
+			t.Errorf("write body = %q, want %q", body, lines)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	cli := NewClient(server.URL, "owl", "secret", 5*time.Second)
+	if err := cli.Write(context.Background(), "owl", "s", []byte(lines)); err != nil {
+		t.Errorf("write error: %s", err.Error())
+	}
+	if err := cli.Write(context.Background(), "missing", "s", []byte(lines)); err == nil || !strings.Contains(err.Error(), `bucket "missing" not found`) {
+		t.Errorf("write missing = %v, want the error message of influxdb", err)
+	}
+}
+
+func TestString(t *testing.T) {
+	if got := String(`a"b\c${d}`); got != `"a\"b\\c\${d}"` {
+		t.Errorf("string = %s", got)
+	}
+}
@@ -0,0 +1,54 @@
+package forecast
+
+import "errors"
+
+// 拟合所需的最少点数
+const minPoints = 3
+
+// Linear 最小二乘线性回归, 返回 y = slope * x + intercept 的斜率及截距
+func Linear(xs, ys []float64) (slope, intercept float64, err error) {
+	if len(xs) != len(ys) {
+		return 0, 0, errors.New("the number of x and y must be the same")
+	}
+	if len(xs) < minPoints {
+		return 0, 0, errors.New("insufficient number of points to fit")
+	}
+
+	var n = float64(len(xs))
+	var sumX, sumY, sumXY, sumXX float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+		sumXY += xs[i] * ys[i]
+		sumXX += xs[i] * xs[i]
+	}
+
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0, 0, errors.New("all x are the same")
+	}
+
+	slope = (n*sumXY - sumX*sumY) / denominator
+	intercept = (sumY - slope*sumX) / n
+	return slope, intercept, nil
+}
+
+// Holt 双指数平滑(Holt 线性趋势), 返回最后一个点的平滑水平及每步的趋势, 预测 h 步后的值为 level + h * trend
+// alpha 为水平的平滑系数, beta 为趋势的平滑系数, 取值范围 (0, 1)
+func Holt(values []float64, alpha, beta float64) (level, trend float64, err error) {
+	if len(values) < minPoints {
+		return 0, 0, errors.New("insufficient number of points to fit")
+	}
+	if alpha <= 0 || alpha >= 1 || beta <= 0 || beta >= 1 {
+		return 0, 0, errors.New("alpha and beta must be between 0 and 1")
+	}
+
+	level, trend = values[0], values[1]-values[0]
+	for _, v := range values[1:] {
+		prevLevel := level
+		level = alpha*v + (1-alpha)*(level+trend)
+		trend = beta*(level-prevLevel) + (1-beta)*trend
+	}
+
+	return level, trend, nil
+}
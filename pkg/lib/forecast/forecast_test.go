@@ -0,0 +1,45 @@
+package forecast
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLinear(t *testing.T) {
+	var xs = []float64{0, 1, 2, 3, 4}
+	var ys = []float64{1, 3, 5, 7, 9}
+
+	slope, intercept, err := Linear(xs, ys)
+	if err != nil {
+		t.Fatalf("linear error: %s", err.Error())
+	}
+	if math.Abs(slope-2) > 1e-9 || math.Abs(intercept-1) > 1e-9 {
+		t.Fatalf("Linear = (%v, %v), want (2, 1)", slope, intercept)
+	}
+
+	if _, _, err := Linear([]float64{1, 1, 1}, []float64{1, 2, 3}); err == nil {
+		t.Fatal("want error for the same x")
+	}
+	if _, _, err := Linear([]float64{1}, []float64{1}); err == nil {
+		t.Fatal("want error for insufficient points")
+	}
+}
+
+func TestHolt(t *testing.T) {
+	var values = make([]float64, 50)
+	for i := range values {
+		values[i] = 10 + 2*float64(i)
+	}
+
+	level, trend, err := Holt(values, 0.5, 0.3)
+	if err != nil {
+		t.Fatalf("holt error: %s", err.Error())
+	}
+	if math.Abs(level-values[len(values)-1]) > 1e-6 || math.Abs(trend-2) > 1e-6 {
+		t.Fatalf("Holt = (%v, %v), want (%v, 2)", level, trend, values[len(values)-1])
+	}
+
+	if _, _, err := Holt(values, 0, 0.3); err == nil {
+		t.Fatal("want error for alpha out of range")
+	}
+}
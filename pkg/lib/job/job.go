@@ -2,6 +2,7 @@ package job
 
 import (
 	"errors"
+	"strings"
 	"sync"
 
 	"github.com/robfig/cron/v3"
@@ -107,3 +108,13 @@ func (c *CronTab) IsExists(jid string) bool {
 	_, exist := c.ids[jid]
 	return exist
 }
+
+// WithTimezone 为 crontab 表达式指定时区, 如: CRON_TZ=Asia/Shanghai 0 * * * *
+// 表达式中已指定时区或 timezone 为空时, 原样返回
+func WithTimezone(spec, timezone string) string {
+	if strings.Compare(timezone, "") == 0 || strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		return spec
+	}
+
+	return "CRON_TZ=" + timezone + " " + spec
+}
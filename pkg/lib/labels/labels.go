@@ -0,0 +1,104 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// 标签名的格式: 以字母或下划线开头, 只能包含字母、数字及下划线
+var namePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Set 标签集, 在模板中既可以整体输出, 也可以按标签名取值, 如: {{ .Labels }}、{{ .Labels.env }}
+type Set map[string]string
+
+// String 以排序后的 name=value 输出标签集, 多个标签以 ',' 分隔
+func (s Set) String() string {
+	var names = make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var pairs = make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, name+"="+s[name])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// ValidateName 校验标签名的格式, 以标签名拼接查询语句(如: MySQL 的 json 路径)之前必须校验
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("the label name {%s} is incorrect, it must match %s", name, namePattern.String())
+	}
+	return nil
+}
+
+// Validate 校验标签名的格式, 标签值可以为模板, 模板必须能够解析
+func Validate(labels map[string]string) error {
+	for name, value := range labels {
+		if err := ValidateName(name); err != nil {
+			return err
+		}
+		if strings.Compare(strings.TrimSpace(value), "") == 0 {
+			return fmt.Errorf("the value of label {%s} cannot be empty", name)
+		}
+		if _, err := template.New(name).Parse(value); err != nil {
+			return fmt.Errorf("the value of label {%s} is not a valid template: %s", name, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// Merge 合并多个标签集, 同名标签以后面的标签集为准
+func Merge(sets ...map[string]string) map[string]string {
+	var result = make(map[string]string)
+	for _, set := range sets {
+		for name, value := range set {
+			result[name] = value
+		}
+	}
+
+	return result
+}
+
+// Expand 以模板的方式展开标签值, 标签值中可以引用序列的标签, 如: {{ .Tags.host }}
+// 不包含模板的标签值保持不变; 展开失败的标签保留原值, 并返回第一个错误
+func Expand(labels map[string]string, tags map[string]string) (map[string]string, error) {
+	var data = struct {
+		Tags Set
+	}{
+		Tags: tags,
+	}
+
+	var result = make(map[string]string, len(labels))
+	var first error
+	for name, value := range labels {
+		result[name] = value
+		if !strings.Contains(value, "{{") {
+			continue
+		}
+
+		var buffer bytes.Buffer
+		tmpl, err := template.New(name).Option("missingkey=zero").Parse(value)
+		if err == nil {
+			err = tmpl.Execute(&buffer, data)
+		}
+		if err != nil {
+			if first == nil {
+				first = fmt.Errorf("expand the value of label {%s} error: %s", name, err.Error())
+			}
+			continue
+		}
+
+		result[name] = buffer.String()
+	}
+
+	return result, first
+}
@@ -0,0 +1,66 @@
+package labels
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		labels map[string]string
+		valid  bool
+	}{
+		{map[string]string{"env": "prod", "team_1": "db"}, true},
+		{map[string]string{"instance": "{{ .Tags.host }}"}, true},
+		{map[string]string{"1env": "prod"}, false},
+		{map[string]string{"env-name": "prod"}, false},
+		{map[string]string{"env": " "}, false},
+		{map[string]string{"instance": "{{ .Tags.host "}, false},
+	}
+
+	for _, c := range cases {
+		if err := Validate(c.labels); (err == nil) != c.valid {
+			t.Errorf("validate %v = %v, want valid %v", c.labels, err, c.valid)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	got := Merge(map[string]string{"host": "a", "env": "test"}, nil, map[string]string{"env": "prod"})
+	want := map[string]string{"host": "a", "env": "prod"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merge = %v, want %v", got, want)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	labels := map[string]string{
+		"env":      "prod",
+		"instance": "{{ .Tags.host }}:{{ .Tags.port }}",
+		"missing":  "x{{ .Tags.idc }}",
+	}
+
+	got, err := Expand(labels, map[string]string{"host": "10.0.0.1", "port": "8080"})
+	if err != nil {
+		t.Fatalf("expand error: %s", err.Error())
+	}
+
+	want := map[string]string{"env": "prod", "instance": "10.0.0.1:8080", "missing": "x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expand = %v, want %v", got, want)
+	}
+
+	got, err = Expand(map[string]string{"bad": "{{ .Tags.host "}, nil)
+	if err == nil || got["bad"] != "{{ .Tags.host " {
+		t.Errorf("expand invalid template = %v, %v, want the raw value and an error", got, err)
+	}
+}
+
+func TestSetString(t *testing.T) {
+	if got := (Set{"b": "2", "a": "1"}).String(); got != "a=1,b=2" {
+		t.Errorf("set string = %s, want a=1,b=2", got)
+	}
+	if got := (Set{}).String(); got != "" {
+		t.Errorf("empty set string = %s, want empty", got)
+	}
+}
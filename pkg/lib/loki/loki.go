@@ -0,0 +1,316 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client Grafana Loki HTTP API 的客户端, 只使用 /loki/api/v1/query 及 /loki/api/v1/query_range 两个接口
+type Client struct {
+	Address  string // 如: http://127.0.0.1:3100
+	Username string // basic auth 的用户名, 为空时不认证
+	Password string
+	OrgID    string // 多租户时的租户, 以 X-Scope-OrgID 请求头传递
+	HTTP     *http.Client
+}
+
+// Sample 指标查询(vector、matrix、scalar)结果中的一个点
+type Sample struct {
+	Labels map[string]string
+	Time   time.Time
+	Value  float64
+}
+
+// Entry 日志流中的一行日志
+type Entry struct {
+	Time time.Time
+	Line string
+}
+
+// Stream 标签相同的一组日志, 按时间倒序排列
+type Stream struct {
+	Labels  map[string]string
+	Entries []Entry
+}
+
+// Result 查询结果, 日志查询的结果为 Streams, 指标查询的结果为 Samples
+type Result struct {
+	Type    string // vector、matrix、scalar 或 streams
+	Samples []Sample
+	Streams []Stream
+}
+
+// NewClient 创建客户端, timeout 为单次查询的超时时间
+func NewClient(address, username, password string, timeout time.Duration) *Client {
+	return &Client{
+		Address:  strings.TrimRight(address, "/"),
+		Username: username,
+		Password: password,
+		HTTP:     &http.Client{Timeout: timeout},
+	}
+}
+
+// Query instant 查询, 计算 LogQL 在 ts 时刻的值; 日志查询时最多返回 limit 行
+func (c *Client) Query(ctx context.Context, query string, ts time.Time, limit int) (*Result, error) {
+	var params = url.Values{}
+	params.Set("query", query)
+	params.Set("time", strconv.FormatInt(ts.UnixNano(), 10))
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	return c.do(ctx, "/loki/api/v1/query", params)
+}
+
+// QueryRange range 查询 [start, end] 内的日志, 从最新的日志开始最多返回 limit 行
+func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, limit int) (*Result, error) {
+	var params = url.Values{}
+	params.Set("query", query)
+	params.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	params.Set("direction", "backward")
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	return c.do(ctx, "/loki/api/v1/query_range", params)
+}
+
+// 接口的响应, 见: https://grafana.com/docs/loki/latest/reference/loki-http-api/
+type response struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// Labels 查询 [start, end] 内的标签名, 可用于检查连通性及认证
+func (c *Client) Labels(ctx context.Context, start, end time.Time) ([]string, error) {
+	var params = url.Values{}
+	params.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+
+	var result = struct {
+		Status string   `json:"status"`
+		Data   []string `json:"data"`
+	}{}
+	if err := c.get(ctx, "/loki/api/v1/labels", params, &result); err != nil {
+		return nil, err
+	}
+	if strings.Compare(result.Status, "success") != 0 {
+		return nil, fmt.Errorf("loki query labels error, status: %s", result.Status)
+	}
+
+	return result.Data, nil
+}
+
+func (c *Client) do(ctx context.Context, path string, params url.Values) (*Result, error) {
+	var result response
+	if err := c.get(ctx, path, params, &result); err != nil {
+		return nil, err
+	}
+	if strings.Compare(result.Status, "success") != 0 {
+		return nil, fmt.Errorf("loki query error, %s", result.Error)
+	}
+
+	return parseResult(result.Data.ResultType, result.Data.Result)
+}
+
+// 以 GET 请求接口并解析 json 格式的响应
+func (c *Client) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	if strings.Compare(c.Address, "") == 0 {
+		return errors.New("the address of loki is not configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Address+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if strings.Compare(c.Username, "") != 0 {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	if strings.Compare(c.OrgID, "") != 0 {
+		req.Header.Set("X-Scope-OrgID", c.OrgID)
+	}
+
+	var cli = c.HTTP
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// 查询出错时, Loki 以纯文本返回错误信息
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, v) != nil {
+		return fmt.Errorf("loki query error, status code: %d, %s", resp.StatusCode, truncate(strings.TrimSpace(string(body))))
+	}
+
+	return nil
+}
+
+// 解析查询结果, 支持 streams、vector、matrix 及 scalar 四种类型; matrix 的各点展开为 Samples
+func parseResult(resultType string, raw json.RawMessage) (*Result, error) {
+	var result = &Result{Type: resultType, Samples: make([]Sample, 0), Streams: make([]Stream, 0)}
+
+	switch resultType {
+	case "streams":
+		var streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][2]string       `json:"values"`
+		}
+		if err := json.Unmarshal(raw, &streams); err != nil {
+			return nil, err
+		}
+
+		for _, s := range streams {
+			var entries = make([]Entry, 0, len(s.Values))
+			for _, v := range s.Values {
+				ns, err := strconv.ParseInt(v[0], 10, 64)
+				if err != nil {
+					return nil, fmt.Errorf("the timestamp {%s} of loki is incorrect", v[0])
+				}
+				entries = append(entries, Entry{Time: time.Unix(0, ns), Line: v[1]})
+			}
+			sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.After(entries[j].Time) })
+			result.Streams = append(result.Streams, Stream{Labels: s.Stream, Entries: entries})
+		}
+	case "vector":
+		var vector []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &vector); err != nil {
+			return nil, err
+		}
+
+		for _, v := range vector {
+			sample, err := parseSample(v.Metric, v.Value)
+			if err != nil {
+				return nil, err
+			}
+			result.Samples = append(result.Samples, sample)
+		}
+	case "matrix":
+		var matrix []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][2]interface{}  `json:"values"`
+		}
+		if err := json.Unmarshal(raw, &matrix); err != nil {
+			return nil, err
+		}
+
+		for _, m := range matrix {
+			for _, v := range m.Values {
+				sample, err := parseSample(m.Metric, v)
+				if err != nil {
+					return nil, err
+				}
+				result.Samples = append(result.Samples, sample)
+			}
+		}
+	case "scalar":
+		var scalar [2]interface{}
+		if err := json.Unmarshal(raw, &scalar); err != nil {
+			return nil, err
+		}
+
+		sample, err := parseSample(map[string]string{}, scalar)
+		if err != nil {
+			return nil, err
+		}
+		result.Samples = append(result.Samples, sample)
+	default:
+		return nil, fmt.Errorf("the result type {%s} of loki is not supported", resultType)
+	}
+
+	return result, nil
+}
+
+// 解析 [<unix_time>, "<value>"] 格式的点
+func parseSample(labels map[string]string, v [2]interface{}) (Sample, error) {
+	ts, ok := v[0].(float64)
+	if !ok {
+		return Sample{}, fmt.Errorf("the timestamp {%v} of loki is incorrect", v[0])
+	}
+
+	text, ok := v[1].(string)
+	if !ok {
+		return Sample{}, fmt.Errorf("the value {%v} of loki is incorrect", v[1])
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Sample{}, fmt.Errorf("the value {%s} of loki is incorrect", text)
+	}
+
+	sec := int64(ts)
+	return Sample{Labels: labels, Time: time.Unix(sec, int64((ts-float64(sec))*1e9)).Round(time.Millisecond), Value: value}, nil
+}
+
+// 错误信息过长时截断
+func truncate(text string) string {
+	if len(text) > 256 {
+		return text[:256] + "..."
+	}
+	return text
+}
+
+// IsLogQuery 是否为日志查询(以流选择器 {...} 开始), 否则为指标查询, 如: sum(count_over_time({app="web"}[5m]))
+func IsLogQuery(query string) bool {
+	return strings.HasPrefix(strings.TrimSpace(query), "{")
+}
+
+// LogSelector 提取指标查询中的日志查询, 即第一个流选择器到其时间范围 [...] 之前的部分, 用于拉取命中的日志
+// 如: sum(count_over_time({app="web"} |= "error" [5m])) --> {app="web"} |= "error"; 没有流选择器时返回空字符串
+func LogSelector(query string) string {
+	if IsLogQuery(query) {
+		return strings.TrimSpace(query)
+	}
+
+	var start = -1
+	var quote rune
+	for i, ch := range query {
+		switch {
+		case quote != 0:
+			// 字符串中的字符不作为流选择器及时间范围的边界, 反引号的字符串中没有转义
+			if ch == quote && (quote == '`' || !escaped(query, i)) {
+				quote = 0
+			}
+		case ch == '"' || ch == '`':
+			quote = ch
+		case ch == '{' && start < 0:
+			start = i
+		case ch == '[' && start >= 0:
+			return strings.TrimSpace(query[start:i])
+		}
+	}
+
+	return ""
+}
+
+// 引号之前是否有奇数个反斜杠
+func escaped(query string, i int) bool {
+	var n int
+	for j := i - 1; j >= 0 && query[j] == '\\'; j-- {
+		n++
+	}
+	return n%2 == 1
+}
@@ -0,0 +1,96 @@
+package loki
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// 模拟 Loki 的 /loki/api/v1/query 及 /loki/api/v1/query_range 接口
+func stubServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params = r.URL.Query()
+		if r.Header.Get("X-Scope-OrgID") != "team-a" {
+			t.Errorf("X-Scope-OrgID = %s, want team-a", r.Header.Get("X-Scope-OrgID"))
+		}
+
+		switch {
+		case r.URL.Path == "/loki/api/v1/query" && params.Get("query") == `sum(count_over_time({app="web"}[5m]))`:
+			if params.Get("time") != "1700000000000000000" {
+				t.Errorf("query time = %s, want 1700000000000000000", params.Get("time"))
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{},"value":[1700000000,"42"]}]}}`))
+		case r.URL.Path == "/loki/api/v1/query_range" && params.Get("query") == `{app="web"} |= "error"`:
+			if params.Get("direction") != "backward" || params.Get("limit") != "2" || params.Get("start") != "1699999700000000000" {
+				t.Errorf("query_range params = %v", params)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"success","data":{"resultType":"streams","result":[
+				{"stream":{"app":"web","level":"error"},"values":[["1699999990000000000","older"],["1699999999000000000","newer"]]}]}}`))
+		case r.URL.Path == "/loki/api/v1/labels":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"status":"success","data":["app","level"]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("parse error at line 1, col 1: syntax error\n"))
+		}
+	}))
+}
+
+func TestQuery(t *testing.T) {
+	server := stubServer(t)
+	defer server.Close()
+
+	cli := NewClient(server.URL+"/", "", "", 5*time.Second)
+	cli.OrgID = "team-a"
+
+	result, err := cli.Query(context.Background(), `sum(count_over_time({app="web"}[5m]))`, time.Unix(1700000000, 0), 0)
+	if err != nil {
+		t.Fatalf("query error: %s", err.Error())
+	}
+	if result.Type != "vector" || len(result.Samples) != 1 || result.Samples[0].Value != 42 {
+		t.Errorf("query result = %+v", result)
+	}
+
+	result, err = cli.QueryRange(context.Background(), `{app="web"} |= "error"`, time.Unix(1699999700, 0), time.Unix(1700000000, 0), 2)
+	if err != nil {
+		t.Fatalf("query range error: %s", err.Error())
+	}
+	if len(result.Streams) != 1 || result.Streams[0].Labels["level"] != "error" {
+		t.Fatalf("query range result = %+v", result)
+	}
+	if entries := result.Streams[0].Entries; len(entries) != 2 || entries[0].Line != "newer" || !entries[1].Time.Equal(time.Unix(1699999990, 0)) {
+		t.Errorf("query range entries = %+v, want the newer line first", entries)
+	}
+
+	if names, err := cli.Labels(context.Background(), time.Unix(1699999700, 0), time.Unix(1700000000, 0)); err != nil || len(names) != 2 {
+		t.Errorf("labels = %v, %v", names, err)
+	}
+
+	if _, err := cli.Query(context.Background(), "bad", time.Now(), 0); err == nil || err.Error() != "loki query error, status code: 400, parse error at line 1, col 1: syntax error" {
+		t.Errorf("query bad = %v, want the error message of loki", err)
+	}
+}
+
+func TestLogSelector(t *testing.T) {
+	var cases = map[string]string{
+		`{app="web"} |= "error"`:                                 `{app="web"} |= "error"`,
+		`sum(count_over_time({app="web"} |= "error" [5m]))`:      `{app="web"} |= "error"`,
+		`sum by (host) (rate({app="web"} |~ "a\"[b]" [1m])) > 0`: `{app="web"} |~ "a\"[b]"`,
+		"count_over_time({app=~\"w{1}\"} |~ `[0-9]{3}` [10m])":   "{app=~\"w{1}\"} |~ `[0-9]{3}`",
+		`vector(1)`: ``,
+	}
+	for query, want := range cases {
+		if got := LogSelector(query); got != want {
+			t.Errorf("LogSelector(%s) = %s, want %s", query, got, want)
+		}
+	}
+
+	if !IsLogQuery(` {app="web"}`) || IsLogQuery(`rate({app="web"}[1m])`) {
+		t.Errorf("IsLogQuery is incorrect")
+	}
+}
@@ -0,0 +1,214 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client Prometheus HTTP API 的客户端, 只使用 /api/v1/query 及 /api/v1/query_range 两个接口
+type Client struct {
+	Address  string // 如: http://127.0.0.1:9090
+	Username string // basic auth 的用户名, 为空时不认证
+	Password string
+	HTTP     *http.Client
+}
+
+// Point 序列上的一个点
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series 查询结果中的一个序列, instant 查询的序列只有一个点
+type Series struct {
+	Labels map[string]string
+	Points []Point
+}
+
+// NewClient 创建客户端, timeout 为单次查询的超时时间
+func NewClient(address, username, password string, timeout time.Duration) *Client {
+	return &Client{
+		Address:  strings.TrimRight(address, "/"),
+		Username: username,
+		Password: password,
+		HTTP:     &http.Client{Timeout: timeout},
+	}
+}
+
+// Query instant 查询, 计算 PromQL 在 ts 时刻的值
+func (c *Client) Query(ctx context.Context, query string, ts time.Time) ([]Series, error) {
+	var params = url.Values{}
+	params.Set("query", query)
+	params.Set("time", formatTime(ts))
+
+	return c.do(ctx, "/api/v1/query", params)
+}
+
+// QueryRange range 查询, 以 step 为间隔计算 PromQL 在 [start, end] 内的值
+func (c *Client) QueryRange(ctx context.Context, query string, start, end time.Time, step time.Duration) ([]Series, error) {
+	if step <= 0 {
+		return nil, errors.New("the step of range query must be greater than 0")
+	}
+
+	var params = url.Values{}
+	params.Set("query", query)
+	params.Set("start", formatTime(start))
+	params.Set("end", formatTime(end))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+
+	return c.do(ctx, "/api/v1/query_range", params)
+}
+
+// 接口的响应, 见: https://prometheus.io/docs/prometheus/latest/querying/api/
+type response struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// 以表单提交查询, 避免 PromQL 过长时超出 URL 的长度限制
+func (c *Client) do(ctx context.Context, path string, params url.Values) ([]Series, error) {
+	if strings.Compare(c.Address, "") == 0 {
+		return nil, errors.New("the address of prometheus is not configured")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Address+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if strings.Compare(c.Username, "") != 0 {
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	var cli = c.HTTP
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	resp, err := cli.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result response
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("prometheus response is incorrect, status code: %d, body: %s", resp.StatusCode, truncate(string(body)))
+	}
+	if strings.Compare(result.Status, "success") != 0 {
+		return nil, fmt.Errorf("prometheus query error, %s: %s", result.ErrorType, result.Error)
+	}
+
+	return parseResult(result.Data.ResultType, result.Data.Result)
+}
+
+// 解析查询结果, 支持 vector、matrix 及 scalar 三种类型, scalar 视为没有标签的序列
+func parseResult(resultType string, raw json.RawMessage) ([]Series, error) {
+	switch resultType {
+	case "vector":
+		var vector []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &vector); err != nil {
+			return nil, err
+		}
+
+		var result = make([]Series, 0, len(vector))
+		for _, v := range vector {
+			point, err := parsePoint(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, Series{Labels: v.Metric, Points: []Point{point}})
+		}
+		return result, nil
+	case "matrix":
+		var matrix []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][2]interface{}  `json:"values"`
+		}
+		if err := json.Unmarshal(raw, &matrix); err != nil {
+			return nil, err
+		}
+
+		var result = make([]Series, 0, len(matrix))
+		for _, m := range matrix {
+			var points = make([]Point, 0, len(m.Values))
+			for _, v := range m.Values {
+				point, err := parsePoint(v)
+				if err != nil {
+					return nil, err
+				}
+				points = append(points, point)
+			}
+			sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+			result = append(result, Series{Labels: m.Metric, Points: points})
+		}
+		return result, nil
+	case "scalar":
+		var scalar [2]interface{}
+		if err := json.Unmarshal(raw, &scalar); err != nil {
+			return nil, err
+		}
+
+		point, err := parsePoint(scalar)
+		if err != nil {
+			return nil, err
+		}
+		return []Series{{Labels: map[string]string{}, Points: []Point{point}}}, nil
+	default:
+		return nil, fmt.Errorf("the result type {%s} of prometheus is not supported", resultType)
+	}
+}
+
+// 解析 [<unix_time>, "<value>"] 格式的点, 值为 NaN、+Inf 等特殊值时同样保留
+func parsePoint(v [2]interface{}) (Point, error) {
+	ts, ok := v[0].(float64)
+	if !ok {
+		return Point{}, fmt.Errorf("the timestamp {%v} of prometheus is incorrect", v[0])
+	}
+
+	text, ok := v[1].(string)
+	if !ok {
+		return Point{}, fmt.Errorf("the value {%v} of prometheus is incorrect", v[1])
+	}
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Point{}, fmt.Errorf("the value {%s} of prometheus is incorrect", text)
+	}
+
+	sec := int64(ts)
+	return Point{Time: time.Unix(sec, int64((ts-float64(sec))*1e9)).Round(time.Millisecond), Value: value}, nil
+}
+
+// 以秒为单位的 unix 时间戳, 保留到毫秒
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano()/int64(time.Millisecond))/1000, 'f', -1, 64)
+}
+
+// 截断过长的响应, 用于错误信息
+func truncate(body string) string {
+	if len(body) > 256 {
+		return body[:256] + "..."
+	}
+	return body
+}
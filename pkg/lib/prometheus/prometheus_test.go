@@ -0,0 +1,93 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 模拟 Prometheus 的 /api/v1/query 及 /api/v1/query_range 接口
+func stubServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("parse form error: %s", err.Error())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/api/v1/query" && r.Form.Get("query") == "up":
+			if r.Form.Get("time") != "1700000000" {
+				t.Errorf("query time = %s, want 1700000000", r.Form.Get("time"))
+			}
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"__name__":"up","instance":"a:9100","job":"node"},"value":[1700000000,"1"]},
+				{"metric":{"__name__":"up","instance":"b:9100","job":"node"},"value":[1700000000,"0"]}]}}`))
+		case r.URL.Path == "/api/v1/query" && r.Form.Get("query") == "scalar(1)":
+			w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1700000000.5,"1"]}}`))
+		case r.URL.Path == "/api/v1/query_range":
+			if r.Form.Get("step") != "60" {
+				t.Errorf("query step = %s, want 60", r.Form.Get("step"))
+			}
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{"instance":"a:9100"},"values":[[1700000060,"3"],[1700000000,"2.5"]]}]}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		}
+	}))
+}
+
+func TestQuery(t *testing.T) {
+	server := stubServer(t)
+	defer server.Close()
+
+	cli := NewClient(server.URL+"/", "", "", 5*time.Second)
+	series, err := cli.Query(context.Background(), "up", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatalf("query error: %s", err.Error())
+	}
+	if len(series) != 2 {
+		t.Fatalf("query got %d series, want 2", len(series))
+	}
+	if series[1].Labels["instance"] != "b:9100" || series[1].Points[0].Value != 0 || !series[1].Points[0].Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("query series = %+v", series[1])
+	}
+
+	series, err = cli.Query(context.Background(), "scalar(1)", time.Unix(1700000000, 0))
+	if err != nil {
+		t.Fatalf("query scalar error: %s", err.Error())
+	}
+	if len(series) != 1 || len(series[0].Labels) != 0 || !series[0].Points[0].Time.Equal(time.Unix(1700000000, 5e8)) {
+		t.Errorf("query scalar = %+v", series)
+	}
+
+	if _, err := cli.Query(context.Background(), "up{", time.Unix(1700000000, 0)); err == nil {
+		t.Errorf("query invalid expression should return an error")
+	}
+}
+
+func TestQueryRange(t *testing.T) {
+	server := stubServer(t)
+	defer server.Close()
+
+	cli := NewClient(server.URL, "", "", 5*time.Second)
+	series, err := cli.QueryRange(context.Background(), "rate(cpu[1m])", time.Unix(1700000000, 0), time.Unix(1700000060, 0), time.Minute)
+	if err != nil {
+		t.Fatalf("query range error: %s", err.Error())
+	}
+
+	want := []Series{{
+		Labels: map[string]string{"instance": "a:9100"},
+		Points: []Point{{Time: time.Unix(1700000000, 0), Value: 2.5}, {Time: time.Unix(1700000060, 0), Value: 3}},
+	}}
+	if !reflect.DeepEqual(series, want) {
+		t.Errorf("query range = %+v, want %+v", series, want)
+	}
+
+	if _, err := cli.QueryRange(context.Background(), "up", time.Unix(0, 0), time.Unix(60, 0), 0); err == nil {
+		t.Errorf("query range with zero step should return an error")
+	}
+}
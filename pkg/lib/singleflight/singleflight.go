@@ -0,0 +1,58 @@
+package singleflight
+
+import (
+	"context"
+	"sync"
+)
+
+// 正在执行或已完成的调用
+type call struct {
+	done chan struct{} // 调用完成后关闭
+	val  interface{}
+	err  error
+}
+
+// Group 合并相同 key 的并发调用: 同一时刻相同 key 只执行一次, 其余调用等待并共享结果
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Do 执行 fn 并返回其结果; 相同 key 的调用正在执行时, 等待其完成并共享结果, shared 为 true
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	return g.DoContext(context.Background(), key, fn)
+}
+
+// DoContext 与 Do 相同, 但等待其他调用的结果时, ctx 结束即返回 ctx.Err(), 不再等待
+// fn 由第一个调用者执行, 其结果(包括 fn 自身的超时或取消错误)由等待者共享, 是否重试由调用方决定
+func (g *Group) DoContext(ctx context.Context, key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, c.err, true
+		case <-ctx.Done():
+			return nil, ctx.Err(), true
+		}
+	}
+
+	c := &call{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	// fn panic 时也要唤醒等待者并移除调用, 避免相同 key 的调用永久阻塞
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+
+	c.val, c.err = fn()
+	return c.val, c.err, false
+}
@@ -0,0 +1,100 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+
+	v, err, shared := g.Do("key", func() (interface{}, error) { return "value", nil })
+	if v != "value" || err != nil || shared {
+		t.Fatalf("Do = (%v, %v, %v), want (value, nil, false)", v, err, shared)
+	}
+
+	_, err, _ = g.Do("key", func() (interface{}, error) { return nil, errors.New("failed") })
+	if err == nil || err.Error() != "failed" {
+		t.Fatalf("Do error = %v, want failed", err)
+	}
+}
+
+func TestDoCollapse(t *testing.T) {
+	var g Group
+	var calls int32
+	var release = make(chan struct{})
+
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return 1, nil
+	}
+
+	var wg sync.WaitGroup
+	var sharedCount int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, shared := g.Do("key", fn)
+			if v != 1 || err != nil {
+				t.Errorf("Do = (%v, %v), want (1, nil)", v, err)
+			}
+			if shared {
+				atomic.AddInt32(&sharedCount, 1)
+			}
+		}()
+	}
+
+	// 等待所有调用进入 Do 后再放行
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("fn called %d times, want 1", got)
+	}
+	if got := atomic.LoadInt32(&sharedCount); got != 9 {
+		t.Fatalf("shared %d times, want 9", got)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group
+	var release = make(chan struct{})
+	var started = make(chan struct{})
+
+	var leader = make(chan error, 1)
+	go func() {
+		_, err, _ := g.DoContext(context.Background(), "key", func() (interface{}, error) {
+			close(started)
+			<-release
+			return 1, nil
+		})
+		leader <- err
+	}()
+	<-started
+
+	// 等待者的 ctx 结束后立即返回, 不等待执行者
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	v, err, shared := g.DoContext(ctx, "key", func() (interface{}, error) { return 2, nil })
+	if v != nil || err != context.DeadlineExceeded || !shared {
+		t.Fatalf("DoContext = (%v, %v, %v), want (nil, deadline exceeded, true)", v, err, shared)
+	}
+
+	close(release)
+	if err := <-leader; err != nil {
+		t.Fatalf("leader error = %v", err)
+	}
+
+	// 执行完成后, 相同 key 的调用重新执行
+	v, err, shared = g.DoContext(context.Background(), "key", func() (interface{}, error) { return 3, nil })
+	if v != 3 || err != nil || shared {
+		t.Fatalf("DoContext = (%v, %v, %v), want (3, nil, false)", v, err, shared)
+	}
+}
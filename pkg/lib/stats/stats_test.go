@@ -0,0 +1,36 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	var values = []float64{2, 4, 4, 4, 5, 5, 7, 9}
+
+	if got := Mean(values); got != 5 {
+		t.Fatalf("Mean = %v, want 5", got)
+	}
+	if got := StdDev(values); got != 2 {
+		t.Fatalf("StdDev = %v, want 2", got)
+	}
+
+	cases := []struct {
+		p    float64
+		want float64
+	}{
+		{0, 2},
+		{50, 4.5},
+		{100, 9},
+		{90, 7.6},
+	}
+	for _, c := range cases {
+		if got := Percentile(values, c.p); math.Abs(got-c.want) > 1e-9 {
+			t.Fatalf("Percentile(%v) = %v, want %v", c.p, got, c.want)
+		}
+	}
+
+	if Mean(nil) != 0 || StdDev(nil) != 0 || Percentile(nil, 50) != 0 {
+		t.Fatal("empty sample should be 0")
+	}
+}
@@ -0,0 +1,39 @@
+package apiModel
+
+// Alert 告警事件接口响应参数
+type Alert struct {
+	Id           int               `json:"id"`
+	AlertId      string            `json:"alert_id"`      // 告警事件的唯一id
+	Name         string            `json:"name"`          // 告警名称, 对应规则的名称
+	Item         string            `json:"item"`          // 告警项, 对应规则的表达式
+	Labels       map[string]string `json:"labels"`        // 告警标签, 规则标签与分组序列的标签合并后的标签
+	Origin       string            `json:"origin"`        // 告警源
+	Type         string            `json:"type"`          // 告警子类型
+	Category     int8              `json:"category"`      // 告警类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控
+	Value        float64           `json:"value"`         // 告警值
+	Level        int8              `json:"level"`         // 告警级别:0-Not classified; 1-Information; 2-Warning; 3-critical; 4-Disaster
+	Content      string            `json:"content"`       // 告警内容
+	RuleName     string            `json:"rule_name"`     // 规则名称
+	GroupId      string            `json:"group_id"`      // 告警联系组id, 多个id 以 , 进行分割
+	Owner        string            `json:"owner"`         // 告警负责人
+	Status       int8              `json:"status"`        // 告警状态,1-告警中,2-恢复,3-忽略,4-静默
+	Platform     int8              `json:"platform"`      // 告警平台,1-owl,2-zcat,3-prometheus,4-zms等
+	PlatformName string            `json:"platform_name"` // 告警平台名称
+	AlertTime    string            `json:"alert_time"`    // 告警时间
+	CreatedAt    string            `json:"created_at"`
+	UpdatedAt    string            `json:"updated_at"`
+}
+
+// AlertCondition 告警事件查询条件接口参数, 时间格式为: 2006-01-02 15:04:05
+type AlertCondition struct {
+	Name      string `form:"name"`
+	RuleName  string `form:"rule_name"`
+	Origin    string `form:"origin"`
+	Level     int8   `form:"level"`  // 告警级别, 为 0 时不过滤
+	Status    int8   `form:"status"` // 告警状态,1-告警中,2-恢复,3-忽略,4-静默
+	Labels    string `form:"labels"` // 告警标签的过滤条件, 如: env = 'prod' AND team =~ /^db/
+	StartTime string `form:"start_time"`
+	EndTime   string `form:"end_time"`
+	Page      int64  `form:"page" binding:"required,page_and_size"`
+	Size      int64  `form:"size" binding:"required,page_and_size"`
+}
@@ -0,0 +1,36 @@
+package apiModel
+
+// CompositeRule 组合规则接口参数
+type CompositeRule struct {
+	Id                uint         `json:"id"`
+	Name              string       `json:"name"`
+	Express           string       `json:"express"`            // 组合表达式, 以 [math:ID]、[logger:ID] 引用规则的告警状态, 如: [math:12] && [logger:3]
+	MatchOn           []string     `json:"match_on"`           // 按标签匹配被引用规则的序列, 如: ["origin"]; 为空时只要被引用的规则有序列告警即为真
+	Silent            int8         `json:"silent"`             // 被引用的规则是否静默通知, 1 --- yes; 2 --- no
+	SilenceFilters    *FilterGroup `json:"silence_filters"`    // 静默的标签过滤条件, 只静默标签匹配的告警; 为空时静默被引用规则的全部告警
+	Template          string       `json:"template"`           // 告警内容的模板(text/template), 为空时使用默认模板
+	Level             int8         `json:"level"`              // 告警级别: 0 -- Not classified; 1 --- Information; 2 --- Warning; 3 --- critical; 4 --- Disaster
+	Creator           string       `json:"creator"`            // 规则创建者, 用户钉钉的 userid
+	Updater           string       `json:"updater"`            // 规则的更新者,用户钉钉的 userid
+	ResponsiblePeople string       `json:"responsible_people"` // 告警时间的处理人, 用户钉钉的 userid
+	Crontab           string       `json:"crontab"`            // 每条规则的定时任务执行表达式, 默认为: "* * * * *"
+	Switch            int8         `json:"switch"`             // 是否启用, 1 --- on; 2 --- off
+	Inuse             int8         `json:"inuse"`              // 是否删除, 1 --- yes; 2 --- no
+	GroupId           []int        `json:"group_id"`           // 告警时间接收者的组id
+	WebHooks          []string     `json:"web_hooks"`          // 告警的 hook 地址
+	Description       string       `json:"description"`
+	CreatedAt         string       `json:"created_at"`
+	UpdatedAt         string       `json:"updated_at"`
+}
+
+// 组合规则查询条件接口参数
+type CompositeRuleCondition struct {
+	Id                uint   `form:"id"`
+	Name              string `form:"name"`
+	Creator           string `form:"creator"`
+	ResponsiblePeople string `form:"responsible_people"` // 告警时间的处理人, 用户钉钉的 userid
+	Switch            int8   `form:"switch"`             // 是否启用, 1 --- on; 2 --- off
+	Inuse             int8   `form:"inuse"`              // 是否删除, 1 --- yes; 2 --- no
+	Page              int64  `form:"page" binding:"required,page_and_size"`
+	Size              int64  `form:"size" binding:"required,page_and_size"`
+}
@@ -0,0 +1,45 @@
+package apiModel
+
+// Datasource 数据源接口参数
+type Datasource struct {
+	Id              uint     `json:"id"`
+	Name            string   `json:"name"`
+	Type            string   `json:"type"`             // 数据源类型: influxdb, prometheus, elasticsearch, loki
+	Version         int      `json:"version"`          // 数据源的版本, influxdb: 1 -- 1.x(InfluxQL, 默认), 2 -- 2.x(Flux)
+	Endpoints       []string `json:"endpoints"`        // 连接地址, 如: ["http://127.0.0.1:9200"]; influxdb、prometheus、loki 只使用第一个地址
+	Username        string   `json:"username"`         // 认证的用户名
+	Password        string   `json:"password"`         // 认证的密码, 查询时不返回
+	Token           string   `json:"token"`            // 认证的 token, 如: InfluxDB 2.x 的 API Token, 查询时不返回
+	Org             string   `json:"org"`              // InfluxDB 2.x 的组织; loki 的租户(X-Scope-OrgID), 为空时不指定租户
+	Database        string   `json:"database"`         // InfluxDB 1.x 的数据库
+	RetentionPolicy string   `json:"retention_policy"` // InfluxDB 1.x 的保留策略
+	Bucket          string   `json:"bucket"`           // InfluxDB 2.x 的 bucket, 为空时使用 database/retention_policy
+	TLSSkipVerify   int8     `json:"tls_skip_verify"`  // 是否跳过证书校验, 1 --- yes; 2 --- no
+	TLSCA           string   `json:"tls_ca"`           // 校验服务端证书的 CA 证书, PEM 格式
+	Proxy           string   `json:"proxy"`            // HTTP 代理地址, 如: http://127.0.0.1:3128
+	Timeout         int      `json:"timeout"`          // 单次请求的超时时间, 单位: 秒, 默认为 30
+	Description     string   `json:"description"`
+	Creator         string   `json:"creator"` // 创建者, 用户钉钉的 userid
+	Updater         string   `json:"updater"` // 更新者, 用户钉钉的 userid
+	CreatedAt       string   `json:"created_at"`
+	UpdatedAt       string   `json:"updated_at"`
+}
+
+// 数据源查询条件接口参数
+type DatasourceCondition struct {
+	Id   uint   `form:"id"`
+	Name string `form:"name"`
+	Type string `form:"type"`
+	Page int64  `form:"page" binding:"required,page_and_size"`
+	Size int64  `form:"size" binding:"required,page_and_size"`
+}
+
+// DatasourceHealth 数据源连接的健康检查结果
+type DatasourceHealth struct {
+	Id      uint   `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Healthy bool   `json:"healthy"` // 是否可以正常连接及认证
+	Latency int64  `json:"latency"` // 检查的耗时, 单位: 毫秒
+	Message string `json:"message"` // 检查失败时的错误信息
+}
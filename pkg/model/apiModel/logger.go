@@ -2,30 +2,33 @@ package apiModel
 
 // 日志规则接口响应参数
 type LoggerRule struct {
-	Id                uint    `json:"id"`
-	Name              string  `json:"name"`
-	Source            string  `json:"source"`             // 数据源, 当前默认从 elasticsearch
-	Address           string  `json:"address"`            // elasticsearch 的连接地址, 多个地址, 以 ',' 分隔
-	Username          string  `json:"username"`           // elasticsearch 的用户名
-	Password          string  `json:"password"`           // elasticsearch 的密码
-	Index             string  `json:"index"`              // elasticsearch 的索引, 支持模糊匹配
-	MessageField      string  `json:"message_field"`      // elasticsearch 中的告警记录的字段
-	Sql               string  `json:"sql"`                // Es 的查询语句
-	Threshold         float64 `json:"threshold"`          // 阈值
-	Origin            string  `json:"origin"`             // 来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip
-	BusinessType      string  `json:"business_type"`      // 产品名: 来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip
-	Category          int8    `json:"category"`           // '指标类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控'
-	Level             int8    `json:"level"`              // 告警级别: 0 -- Not classified; 1 --- Information; 2 --- Warning; 3 --- critical; 4 --- Disaster
-	Creator           string  `json:"creator"`            // 规则创建者, 用户钉钉的 userid
-	Updater           string  `json:"updater"`            // 规则的更新者,用户钉钉的 userid
-	ResponsiblePeople string  `json:"responsible_people"` // 告警时间的处理人, 用户钉钉的 userid
-	Crontab           string  `json:"crontab"`            // 每条规则的定时任务执行表达式, 默认为: "* * * * *"
-	Switch            int8    `json:"switch"`             // 是否启用, 1 --- on; 2 --- off
-	Inuse             int8    `json:"inuse"`              // 是否删除, 1 --- yes; 2 --- no
-	GroupId           []int   `json:"group_id"`           //  告警时间接收者的组id
-	Description       string  `json:"description"`
-	CreatedAt         string  `json:"created_at"`
-	UpdatedAt         string  `json:"updated_at"`
+	Id                uint              `json:"id"`
+	Name              string            `json:"name"`
+	Source            string            `json:"source"`             // 数据源: es -- elasticsearch(默认); loki -- Grafana Loki
+	Address           string            `json:"address"`            // elasticsearch 的连接地址, 多个地址, 以 ',' 分隔
+	Username          string            `json:"username"`           // elasticsearch 的用户名
+	Password          string            `json:"password"`           // elasticsearch 的密码
+	DatasourceId      uint              `json:"datasource_id"`      // 引用的数据源 ID(见 /datasource 接口), 不为 0 时忽略 address、username 及 password
+	Index             string            `json:"index"`              // elasticsearch 的索引, 支持模糊匹配
+	MessageField      string            `json:"message_field"`      // elasticsearch 中的告警记录的字段; loki 日志的标签或 json 字段, 为空时为整行日志
+	Sql               string            `json:"sql"`                // Es 的查询语句; loki 的 LogQL, 日志查询统计时间窗口内的条数, 指标查询直接取其值
+	TimeWindow        string            `json:"time_window"`        // loki 统计日志条数及拉取日志的时间窗口, 如: 5m, 默认为 5m
+	Threshold         float64           `json:"threshold"`          // 阈值
+	Origin            string            `json:"origin"`             // 来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip
+	BusinessType      string            `json:"business_type"`      // 产品名: 来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip
+	Category          int8              `json:"category"`           // '指标类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控'
+	Level             int8              `json:"level"`              // 告警级别: 0 -- Not classified; 1 --- Information; 2 --- Warning; 3 --- critical; 4 --- Disaster
+	Labels            map[string]string `json:"labels"`             // 规则标签, 作为告警的标签
+	Creator           string            `json:"creator"`            // 规则创建者, 用户钉钉的 userid
+	Updater           string            `json:"updater"`            // 规则的更新者,用户钉钉的 userid
+	ResponsiblePeople string            `json:"responsible_people"` // 告警时间的处理人, 用户钉钉的 userid
+	Crontab           string            `json:"crontab"`            // 每条规则的定时任务执行表达式, 默认为: "* * * * *"
+	Switch            int8              `json:"switch"`             // 是否启用, 1 --- on; 2 --- off
+	Inuse             int8              `json:"inuse"`              // 是否删除, 1 --- yes; 2 --- no
+	GroupId           []int             `json:"group_id"`           //  告警时间接收者的组id
+	Description       string            `json:"description"`
+	CreatedAt         string            `json:"created_at"`
+	UpdatedAt         string            `json:"updated_at"`
 }
 
 // 日志规则查询条件接口参数
@@ -36,6 +39,19 @@ type LoggerRuleCondition struct {
 	ResponsiblePeople string `form:"responsible_people"` // 告警时间的处理人, 用户钉钉的 userid
 	Switch            int8   `form:"switch"`             // 是否启用, 1 --- on; 2 --- off
 	Inuse             int8   `json:"inuse"`              // 是否删除, 1 --- yes; 2 --- no
+	Labels            string `form:"labels"`             // 规则标签的过滤条件, 如: env = 'prod' AND team =~ /^db/
 	Page              int64  `form:"page" binding:"required,page_and_size"`
 	Size              int64  `form:"size" binding:"required,page_and_size"`
 }
+
+// LoggerEvaluateResult 日志规则立即计算(试运行)的结果
+type LoggerEvaluateResult struct {
+	Time      string   `json:"time"`      // 计算的时刻
+	Source    string   `json:"source"`    // 日志数据源类型
+	Index     string   `json:"index"`     // 查询的索引
+	Query     string   `json:"query"`     // 执行的查询语句
+	Count     float64  `json:"count"`     // 命中的日志条数
+	Threshold float64  `json:"threshold"` // 告警阈值
+	Alert     bool     `json:"alert"`     // 是否会触发告警
+	Messages  []string `json:"messages"`  // 命中日志的告警内容字段
+}
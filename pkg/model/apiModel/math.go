@@ -1,20 +1,38 @@
 package apiModel
 
+import "encoding/json"
+
 // MathRule 数学规则接口响应参数
 type MathRule struct {
 	Id                 uint                `json:"id"`
 	Name               string              `json:"name"`
-	CalculateType      int                 `json:"calculate_type"`      // 计算类型: 1 -- 最大值; 2 -- 最小值; 3 -- 环比; 4 -- TopN; 5 -- BottomN
+	CalculateType      int                 `json:"calculate_type"`      // 计算类型: 1 -- 最大值; 2 -- 最小值; 3 -- 环比; 4 -- TopN; 5 -- BottomN; 6 -- 平均值; 7 -- 无数据(缺失)检测; 8 -- 预测上升至阈值; 9 -- 预测下降至阈值
 	Express            string              `json:"express"`             // 计算表达式
 	MetricList         map[string]string   `json:"metric_list"`         // 指标名集
 	Threshold          float64             `json:"threshold"`           // 阈值, 可为零值
 	Unit               string              `json:"unit"`                // 单位
 	TimeWindow         map[string][]string `json:"time_window"`         // 时间窗口
 	Duration           int                 `json:"duration"`            // 持续次数
+	Interval           string              `json:"interval"`            // TopN/BottomN 对齐数据点的时间间隔, 即 GROUP BY time(interval), 为空时按原始点的时间戳对齐
+	Fill               string              `json:"fill"`                // TopN/BottomN 对齐时缺失点的填充方式: null, none, previous, linear 或数值
+	MatchCount         int                 `json:"match_count"`         // TopN/BottomN 越过阈值的点数(N)达到该值即告警, 0 表示参与计算的点均需越过阈值
+	PointCount         int                 `json:"point_count"`         // TopN/BottomN 参与计算的最近的点数(M), 0 表示时间窗口内的所有点
 	Origin             string              `json:"origin"`              // 产品名: '来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip'
 	Type               string              `json:"type"`                // 业务域: '类型,前端-异常、crash/业务-业务域/应用-异常、服务、JVM/组件-db、mq、redis/基础-网络、k8s、物理机、虚拟机'
 	Category           int8                `json:"category"`            // '指标类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控'
-	ExtensionCondition string              `json:"extension_condition"` // 扩展条件
+	ExtensionCondition string              `json:"extension_condition"` // 扩展条件(已废弃), 保存时迁移为 filters, 无法解析时拒绝
+	Filters            *FilterGroup        `json:"filters"`             // 标签过滤条件
+	GroupBy            []string            `json:"group_by"`            // 分组的标签, 每个标签集(序列)单独计算并告警
+	NoData             string              `json:"nodata"`              // 查询无数据时的处理策略: alert -- 告警; keep -- 保持之前的状态; ok -- 视为正常(默认)
+	AbsentFor          string              `json:"absent_for"`          // 无数据检测规则: 持续该时长没有数据点即告警, 如: 10m
+	Timezone           string              `json:"timezone"`            // 规则的时区, 如: Asia/Shanghai; 为空时使用服务的时区
+	Datasource         string              `json:"datasource"`          // 规则的数据源: influxdb -- 默认, metric_list 为 measurement; prometheus -- metric_list 为 PromQL 表达式; mysql -- 指标值表 engine_tbl_metric
+	DatasourceId       uint                `json:"datasource_id"`       // 引用的数据源 ID(见 /datasource 接口), 数据源的类型即为 datasource; 0 表示使用配置文件中的数据源
+	Baseline           *Baseline           `json:"baseline"`            // 动态基线阈值, 为空时使用静态阈值
+	Horizon            string              `json:"horizon"`             // 预测规则: 向前预测的时长, 如: 6h
+	ForecastMethod     string              `json:"forecast_method"`     // 预测规则: 拟合方法, linear -- 线性回归(默认); holt -- Holt 双指数平滑
+	Levels             []LevelTier         `json:"levels"`              // 多级阈值, 规则的表达式及告警级别为第一级, 命中的最高级别为告警级别
+	Labels             map[string]string   `json:"labels"`              // 规则标签, 与分组序列的标签合并后作为告警的标签; 标签值可以引用序列的标签, 如: {{ .Tags.host }}
 	Level              int8                `json:"level"`               // 告警级别: 0 -- Not classified; 1 --- Information; 2 --- Warning; 3 --- critical; 4 --- Disaster
 	Creator            string              `json:"creator"`             // 规则创建者, 用户钉钉的 userid
 	Updater            string              `json:"updater"`             // 规则的更新者,用户钉钉的 userid
@@ -27,6 +45,26 @@ type MathRule struct {
 	Description        string              `json:"description"`
 	CreatedAt          string              `json:"created_at"`
 	UpdatedAt          string              `json:"updated_at"`
+	ThresholdSet       bool                `json:"-"` // 是否指定了阈值: 请求中包含 threshold 字段或规则读取自数据库
+}
+
+// UnmarshalJSON 记录请求中是否包含 threshold 字段, 预测规则要求显式指定阈值
+func (m *MathRule) UnmarshalJSON(data []byte) error {
+	type rule MathRule
+	var aux = struct {
+		*rule
+		Threshold *float64 `json:"threshold"`
+	}{rule: (*rule)(m)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	m.ThresholdSet = aux.Threshold != nil
+	if aux.Threshold != nil {
+		m.Threshold = *aux.Threshold
+	}
+	return nil
 }
 
 // MathRuleCondition 数学规则查询条件接口参数
@@ -40,6 +78,125 @@ type MathRuleCondition struct {
 	Category          int8   `form:"category"`
 	Switch            int8   `form:"switch"` // 是否启用, 1 --- on; 2 --- off
 	Inuse             int8   `json:"inuse"`  // 是否删除, 1 --- yes; 2 --- no
+	Labels            string `form:"labels"` // 规则标签的过滤条件, 如: env = 'prod' AND team =~ /^db/
 	Page              int64  `form:"page" binding:"required,page_and_size"`
 	Size              int64  `form:"size" binding:"required,page_and_size"`
 }
+
+// TagFilter 标签过滤条件
+type TagFilter struct {
+	Tag      string `json:"tag"`      // 标签名
+	Operator string `json:"operator"` // 比较符: = ; != ; =~ -- 正则匹配; !~ -- 正则不匹配
+	Value    string `json:"value"`    // 标签值, 比较符为 =~ 或 !~ 时为正则表达式
+}
+
+// FilterGroup 标签过滤条件组, 组内的条件及子组之间以 logic 连接
+type FilterGroup struct {
+	Logic      string        `json:"logic"` // AND 或 OR, 默认为 AND
+	Conditions []TagFilter   `json:"conditions"`
+	Groups     []FilterGroup `json:"groups"`
+}
+
+// Baseline 动态基线阈值: 以过去 N 天同一时刻的计算值作为基线, 当前值超出基线区间时触发告警
+type Baseline struct {
+	Mode  string  `json:"mode"`  // stddev -- mean ± k·σ; percentile -- 分位数区间 [lower, upper]
+	Days  int     `json:"days"`  // 参考过去的天数, 默认为 7
+	K     float64 `json:"k"`     // stddev 模式下标准差的倍数, 默认为 3
+	Lower float64 `json:"lower"` // percentile 模式下区间的下分位数, 如: 5
+	Upper float64 `json:"upper"` // percentile 模式下区间的上分位数, 如: 95
+}
+
+// LevelTier 多级阈值中的一级, 表达式与阈值二选一; 只配置阈值时, 以规则表达式比较符左侧的值与阈值进行比较
+type LevelTier struct {
+	Express   string   `json:"express"`   // 该级别的表达式, 只能使用规则表达式中的因子, 如: [A] > 90
+	Threshold *float64 `json:"threshold"` // 该级别的阈值, 如: 90
+	Level     int8     `json:"level"`     // 告警级别: 0 -- Not classified; 1 --- Information; 2 --- Warning; 3 --- critical; 4 --- Disaster
+}
+
+// CalculateType 已注册的计算类型
+type CalculateType struct {
+	Type        int    `json:"calculate_type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// BacktestRequest 规则回测的接口参数, 时间格式为: 2006-01-02 15:04:05, 以规则的时区解析
+type BacktestRequest struct {
+	Rule  MathRule `json:"rule"`
+	Start string   `json:"start" binding:"required"` // 回测的开始时间
+	End   string   `json:"end" binding:"required"`   // 回测的结束时间
+}
+
+// BacktestResult 规则回测的结果
+type BacktestResult struct {
+	Ticks  int             `json:"ticks"`  // 定时任务的执行次数
+	Alerts int             `json:"alerts"` // 触发告警的序列数
+	Points []BacktestPoint `json:"points"`
+}
+
+// BacktestPoint 定时任务单次执行的计算结果
+type BacktestPoint struct {
+	Time   string           `json:"time"`
+	NoData string           `json:"nodata,omitempty"` // 查询无数据的因子
+	Error  string           `json:"error,omitempty"`
+	Series []BacktestSeries `json:"series"`
+}
+
+// BacktestSeries 单个序列的计算结果
+type BacktestSeries struct {
+	Key    string                 `json:"key"`
+	Tags   map[string]string      `json:"tags"`
+	Values map[string]interface{} `json:"values"` // 各因子的值
+	Firing bool                   `json:"firing"` // 是否触发告警
+	Level  int8                   `json:"level"`  // 告警级别
+	Detail string                 `json:"detail"` // 告警内容的补充说明
+}
+
+// EvaluateResult 规则立即计算(试运行)的结果
+type EvaluateResult struct {
+	Time    string                  `json:"time"`             // 计算的时刻
+	Queries map[string]string       `json:"queries"`          // 各因子执行的查询语句
+	Values  map[string][]SeriesData `json:"values"`           // 各因子查询得到的序列
+	NoData  string                  `json:"nodata,omitempty"` // 查询无数据的因子
+	Series  []EvaluateSeries        `json:"series"`           // 各序列的计算结果
+	Alert   bool                    `json:"alert"`            // 是否会触发告警
+}
+
+// SeriesData 因子查询得到的单个序列
+type SeriesData struct {
+	Key    string            `json:"key"`
+	Tags   map[string]string `json:"tags"`
+	Points []PointData       `json:"points"`
+}
+
+// PointData 序列中的数据点
+type PointData struct {
+	Time  string  `json:"time"`
+	Value float64 `json:"value"`
+}
+
+// EvaluateSeries 试运行时单个序列的计算结果
+type EvaluateSeries struct {
+	Key    string                 `json:"key"`
+	Tags   map[string]string      `json:"tags"`
+	Values map[string]interface{} `json:"values"` // 各因子的值
+	Value  interface{}            `json:"value"`  // 比较符左侧表达式的值, 即告警值
+	Result interface{}            `json:"result"` // 表达式的计算结果
+	Firing bool                   `json:"firing"` // 是否触发告警
+	Level  int8                   `json:"level"`  // 告警级别
+	Detail string                 `json:"detail"` // 告警内容的补充说明
+}
+
+// MigrateFiltersResult 旧版扩展条件迁移为过滤条件的结果
+type MigrateFiltersResult struct {
+	Migrated []string                `json:"migrated"` // 已迁移的规则名
+	Skipped  []MigrateFiltersSkipped `json:"skipped"`  // 无法迁移的规则
+}
+
+// MigrateFiltersSkipped 无法迁移的规则及原因
+type MigrateFiltersSkipped struct {
+	Id                 uint   `json:"id"`
+	Name               string `json:"name"`
+	ExtensionCondition string `json:"extension_condition"`
+	Error              string `json:"error"`
+}
@@ -0,0 +1,25 @@
+package apiModel
+
+// MetricPoint 上报的指标值, 字段与数学规则的查询条件一一对应
+type MetricPoint struct {
+	Metric   string            `json:"metric"`   // 指标名, 即规则 metric_list 的值
+	Origin   string            `json:"origin"`   // 来源, 如: 产品名、appid、集群名
+	Type     string            `json:"type"`     // 类型, 如: 业务域、组件类型
+	Category int8              `json:"category"` // 指标类型, 1-前端监控, 2-业务监控, 3-应用监控, 4-组件监控, 5-基础监控
+	Value    *float64          `json:"value"`    // 指标值
+	Time     int64             `json:"time"`     // 时间戳, 精度由 precision 指定, 默认为秒; 为 0 时使用接收的时间
+	Tags     map[string]string `json:"tags"`     // 扩展标签, 用于规则的标签过滤及 group_by, 如: {"host": "10.0.0.1"}
+}
+
+// MetricPushCondition 指标上报的参数
+type MetricPushCondition struct {
+	Datasource string `form:"datasource"` // 写入的存储: influxdb, mysql; 为空时配置了 InfluxDB 写入 InfluxDB, 否则写入 mysql
+	Precision  string `form:"precision"`  // 时间戳的精度: s(默认), ms, us, ns
+}
+
+// MetricPushResult 指标上报的结果
+type MetricPushResult struct {
+	Datasource string `json:"datasource"` // 写入的存储
+	Written    int    `json:"written"`    // 写入的指标值数量
+	Failed     int    `json:"failed"`     // 写入失败及未写入的指标值数量
+}
@@ -22,6 +22,11 @@ const (
 	DateTimeWholeMinFormat = "2006-01-02 15:04:00"
 )
 
+// timezone constant
+const (
+	DefaultTimezone = "Asia/Shanghai" // 默认时区
+)
+
 // symbol constant
 const (
 	SymbolSemicolon    = ";"
@@ -10,6 +10,7 @@ type Alert struct {
 	AlertId      string    `gorm:"column:alert_id;type:varchar(16);NOT NULL"`       // 告警事件的唯一id
 	Name         string    `gorm:"column:name;type:varchar(255);NOT NULL"`          // 告警名称, 对应规则的名称
 	Item         string    `gorm:"column:item;type:varchar(128);NOT NULL"`          // 告警项, 对应规则的表达式
+	Labels       string    `gorm:"column:labels;type:text"`                         // 告警标签, json 格式, 如 group_by 分组后序列的标签集
 	Origin       string    `gorm:"column:origin;type:varchar(128);NOT NULL;index"`  // 告警源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip
 	BusinessType string    `gorm:"column:type;type:varchar(128);NOT NULL"`          // 告警子类型,前端-异常、crash/业务-业务域/应用-异常、服务、JVM/组件-db、mq、redis/基础-网络、k8s、物理机、虚拟机
 	Category     int8      `gorm:"column:category;type:tinyint(1);NOT NULL"`        // 告警类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控
@@ -0,0 +1,35 @@
+package dbModel
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CompositeRule 组合规则表, 以布尔表达式组合其他规则的告警状态
+type CompositeRule struct {
+	ID                uint           `gorm:"column:id;type:int;AUTO_INCREMENT;PRIMARY_KEY"`
+	Name              string         `gorm:"column:name;type:varchar(255);NOT NULL;UNIQUE_INDEX"`  // 规则唯一名称
+	Express           string         `gorm:"column:express;type:tinytext(512);NOT NULL"`           // 组合表达式, 如: [math:12] && [logger:3]
+	MatchOn           string         `gorm:"column:match_on;type:varchar(255)"`                    // 按标签匹配被引用规则的序列, 多个值以 ',' 分隔
+	Silent            int8           `gorm:"column:silent;type:tinyint(1);default:2"`              // 被引用的规则是否静默通知, 1 --- yes; 2 --- no
+	SilenceFilters    string         `gorm:"column:silence_filters;type:text"`                     // 静默的标签过滤条件, json 格式
+	Template          string         `gorm:"column:template;type:text"`                            // 告警内容的模板, 为空时使用默认模板
+	Level             int8           `gorm:"column:level;type:tinyint(1);NOT NULL"`                // 告警级别: 0 -- Not classified; 1 --- Information; 2 --- Warning; 3 --- critical; 4 --- Disaster
+	Creator           string         `gorm:"column:creator;type:varchar(32);NOT NULL"`             // 规则创建者, 用户钉钉的 userid
+	Updater           string         `gorm:"column:updater;type:varchar(32)"`                      // 规则创建者, 用户钉钉的 userid
+	ResponsiblePeople string         `gorm:"column:responsible_people;type:varchar(255);NOT NULL"` // 告警时间的处理人, 用户钉钉的 userid
+	Crontab           string         `gorm:"column:crontab;type:varchar(32);default:* * * * *"`    // 每条规则的定时任务执行表达式, 默认为: "* * * * *"
+	Switch            int8           `gorm:"column:switch;type:tinyint(1);default:1"`              // 是否启用, 1 --- on; 2 --- off
+	Inuse             int8           `gorm:"column:inuse;type:tinyint(1);default:2"`               // 是否删除, 1 --- yes; 2 --- no
+	GroupIp           string         `gorm:"column:group_ip;type:varchar(255);NOT NULL"`           //  告警时间接收者的组id, 多个值以 ',' 分隔
+	WebHooks          string         `gorm:"column:web_hooks;type:tinytext(1024)"`                 // 告警的 hook 地址,  多个值以 ',' 分隔
+	Description       string         `gorm:"column:description;type:tinytext(1024)"`               // 描述
+	CreatedAt         time.Time      `gorm:"column:created_at"`
+	UpdatedAt         time.Time      `gorm:"column:updated_at"`
+	DeletedAt         gorm.DeletedAt `gorm:"column:deleted_at;index"`
+}
+
+func (CompositeRule) TableName() string {
+	return "engine_tbl_composite_rules"
+}
@@ -0,0 +1,37 @@
+package dbModel
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Datasource 数据源表, 规则以 datasource_id 引用数据源, 集群的变更只需修改一处
+type Datasource struct {
+	ID              uint           `gorm:"column:id;type:int;AUTO_INCREMENT;PRIMARY_KEY"`
+	Name            string         `gorm:"column:name;type:varchar(255);NOT NULL;UNIQUE_INDEX"` // 数据源唯一名称
+	Type            string         `gorm:"column:type;type:varchar(16);NOT NULL"`               // 数据源类型: influxdb, prometheus, elasticsearch, loki
+	Version         int            `gorm:"column:version;type:int;default:0"`                   // 数据源的版本, influxdb: 1 -- 1.x(InfluxQL), 2 -- 2.x(Flux)
+	Endpoints       string         `gorm:"column:endpoints;type:varchar(1024);NOT NULL"`        // 连接地址, 多个地址以 ',' 分隔
+	Username        string         `gorm:"column:username;type:varchar(64)"`                    // 认证的用户名
+	Password        string         `gorm:"column:password;type:varchar(255)"`                   // 认证的密码
+	Token           string         `gorm:"column:token;type:varchar(255)"`                      // 认证的 token, 如: InfluxDB 2.x 的 API Token
+	Org             string         `gorm:"column:org;type:varchar(64)"`                         // InfluxDB 2.x 的组织; loki 的租户(X-Scope-OrgID)
+	Database        string         `gorm:"column:database;type:varchar(64)"`                    // InfluxDB 1.x 的数据库
+	RetentionPolicy string         `gorm:"column:retention_policy;type:varchar(64)"`            // InfluxDB 1.x 的保留策略
+	Bucket          string         `gorm:"column:bucket;type:varchar(128)"`                     // InfluxDB 2.x 的 bucket, 为空时使用 database/retention_policy
+	TLSSkipVerify   int8           `gorm:"column:tls_skip_verify;type:tinyint(1);default:2"`    // 是否跳过证书校验, 1 --- yes; 2 --- no
+	TLSCA           string         `gorm:"column:tls_ca;type:text"`                             // 校验服务端证书的 CA 证书, PEM 格式
+	Proxy           string         `gorm:"column:proxy;type:varchar(255)"`                      // HTTP 代理地址
+	Timeout         int            `gorm:"column:timeout;type:int;default:30"`                  // 单次请求的超时时间, 单位: 秒
+	Description     string         `gorm:"column:description;type:varchar(255)"`                // 描述
+	Creator         string         `gorm:"column:creator;type:varchar(32);NOT NULL"`            // 创建者, 用户钉钉的 userid
+	Updater         string         `gorm:"column:updater;type:varchar(32)"`                     // 更新者, 用户钉钉的 userid
+	CreatedAt       time.Time      `gorm:"column:created_at"`
+	UpdatedAt       time.Time      `gorm:"column:updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"column:deleted_at;index"`
+}
+
+func (Datasource) TableName() string {
+	return "engine_tbl_datasources"
+}
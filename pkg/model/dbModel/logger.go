@@ -2,6 +2,7 @@ package dbModel
 
 import (
 	database2 "owl-engine/pkg/client/database"
+	"owl-engine/pkg/dao/mysql"
 	"owl-engine/pkg/model/apiModel"
 	"strings"
 	"time"
@@ -13,18 +14,21 @@ import (
 type LoggerRule struct {
 	ID                uint           `gorm:"column:id;type:int;AUTO_INCREMENT;PRIMARY_KEY"`
 	Name              string         `gorm:"column:name;type:varchar(255);NOT NULL;UNIQUE_INDEX"`  // 规则唯一名称
-	Source            string         `gorm:"column:source;type:varchar(16);NOT NULL;default:es"`   // 日志的数据源, 默认为 elasticsearch
+	Source            string         `gorm:"column:source;type:varchar(16);NOT NULL;default:es"`   // 日志的数据源: es(默认), loki
 	Address           string         `gorm:"column:address;type:varchar(255)"`                     // 对于es等数据源，会需要连接地址，多个地址以 ',' 分隔
 	Username          string         `gorm:"column:username;type:varchar(32)"`                     // 对于esc等数据源，其认证的用户名
 	Password          string         `gorm:"column:password;type:varchar(32)"`                     // 对于es等数据源, 其需要认证的密码
+	DatasourceId      uint           `gorm:"column:datasource_id;type:int;default:0"`              // 引用的数据源 ID, 不为 0 时忽略 address、username 及 password
 	Index             string         `gorm:"index;type:varchar(128)"`                              // 对于 es 等数据源的索引, 支持模糊匹配
 	MessageField      string         `gorm:"column:message_field;type:varchar(32);NOT NULL"`       // 告警时，需要查询到的告警内容的字段
-	Sql               string         `gorm:"column:sql;type:json;NOT NULL"`                        // es 查询语句
+	Sql               string         `gorm:"column:sql;type:text;NOT NULL"`                        // es 查询语句(json) 或 loki 的 LogQL
+	TimeWindow        string         `gorm:"column:time_window;type:varchar(16)"`                  // loki 统计日志条数及拉取日志的时间窗口, 如: 5m
 	Threshold         float64        `gorm:"column:threshold;type:float;NOT NULL"`                 // 阈值
 	Origin            string         `gorm:"column:origin;type:varchar(64);NOT NULL"`              // 来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip
 	BusinessType      string         `gorm:"column:business_type;type:varchar(64);NOT NULL"`       // 产品名: 来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip
 	Category          int8           `gorm:"column:category;type:tinyint(1);NOT NULL"`             // '指标类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控'
 	Level             int8           `gorm:"column:level;type:tinyint(1);default:3;NOT NULL"`      // 告警级别: 0 -- Not classified; 1 --- Information; 2 --- Warning; 3 --- critical; 4 --- Disaster
+	Labels            string         `gorm:"column:labels;type:text"`                              // 规则标签, json 格式
 	Creator           string         `gorm:"column:creator;type:varchar(32);NOT NULL"`             // 规则创建者, 用户钉钉的 userid
 	Updater           string         `gorm:"column:updater;type:varchar(32)"`                      // 规则创建者, 用户钉钉的 userid
 	ResponsiblePeople string         `gorm:"column:responsible_people;type:varchar(255);NOT NULL"` // 告警时间的处理人, 用户钉钉的 userid
@@ -70,6 +74,13 @@ func (l *LoggerRule) Select(condition *apiModel.LoggerRuleCondition) (*[]LoggerR
 		db = db.Where("inuse = ?", condition.Inuse)
 	}
 
+	// 规则标签的过滤条件
+	if where, args, err := mysql.LabelCondition("labels", condition.Labels); err != nil {
+		return &[]LoggerRule{}, 0, err
+	} else if strings.Compare(where, "") != 0 {
+		db = db.Where(where, args...)
+	}
+
 	var count int64
 	db.Count(&count)
 
@@ -145,14 +156,17 @@ func (l *LoggerRule) Save() error {
 		record.Address = l.Address
 		record.Username = l.Username
 		record.Password = l.Password
+		record.DatasourceId = l.DatasourceId
 		record.Index = l.Index
 		record.MessageField = l.MessageField
 		record.Sql = l.Sql
+		record.TimeWindow = l.TimeWindow
 		record.Threshold = l.Threshold
 		record.Origin = l.Origin
 		record.BusinessType = l.BusinessType
 		record.Category = l.Category
 		record.Level = l.Level
+		record.Labels = l.Labels
 		record.Creator = l.Creator
 		record.Updater = l.Updater
 		record.ResponsiblePeople = l.ResponsiblePeople
@@ -10,17 +10,33 @@ import (
 type Rule struct {
 	ID                 uint           `gorm:"column:id;type:int;AUTO_INCREMENT;PRIMARY_KEY"`
 	Name               string         `gorm:"column:name;type:varchar(255);NOT NULL;UNIQUE_INDEX"`  // 规则唯一名称
-	CalculateType      int            `gorm:"column:calculate_type;type:tinyint(1);NOT NULL"`       // 计算类型: 1 -- 最大值; 2 -- 最小值; 3 -- 环比; 4 -- TopN; 5 -- BottomN
+	CalculateType      int            `gorm:"column:calculate_type;type:tinyint(1);NOT NULL"`       // 计算类型: 1 -- 最大值; 2 -- 最小值; 3 -- 环比; 4 -- TopN; 5 -- BottomN; 6 -- 平均值; 7 -- 无数据检测; 8/9 -- 预测
 	Express            string         `gorm:"column:express;type:tinytext(512);NOT NULL"`           // 计算表达式
 	MetricList         string         `gorm:"column:metric_list;type:tinytext;NOT NULL"`            // 指标名集合
 	Threshold          float64        `gorm:"column:threshold;type:float;default:0.0"`              // 阈值, 可为零值
 	Unit               string         `gorm:"column:unit;type:varchar(16)"`                         // 单位
 	TimeWindow         string         `gorm:"column:time_window;type:varchar(255)"`                 // 时间窗口, 默认都以 分钟 作为单位
 	Duration           int            `gorm:"column:duration;type:tinyint(1);default:1"`            // 持续的次数在
+	Interval           string         `gorm:"column:interval;type:varchar(16)"`                     // TopN/BottomN 对齐数据点的时间间隔
+	Fill               string         `gorm:"column:fill;type:varchar(16)"`                         // TopN/BottomN 对齐时缺失点的填充方式
+	MatchCount         int            `gorm:"column:match_count;type:int;default:0"`                // TopN/BottomN 需越过阈值的点数(N), 0 表示全部
+	PointCount         int            `gorm:"column:point_count;type:int;default:0"`                // TopN/BottomN 参与计算的最近的点数(M), 0 表示全部
 	Origin             string         `gorm:"column:origin;type:varchar(64);NOT NULL"`              // 产品名: '来源，前端-产品/业务-产品/应用-appid/组件-ip、集群名/基础-域名、ip'
 	BusinessType       string         `gorm:"column:business_type;type:varchar(64);NOT NULL"`       // 业务域: '类型,前端-异常、crash/业务-业务域/应用-异常、服务、JVM/组件-db、mq、redis/基础-网络、k8s、物理机、虚拟机'
 	Category           int8           `gorm:"column:category;type:tinyint(1);NOT NULL"`             // '指标类型,1-前端监控,2-业务监控,3-应用监控,4-组件监控,5-基础监控'
 	ExtensionCondition string         `gorm:"column:extension_condition;type:varchar(255)"`         // 扩展条件
+	Filters            string         `gorm:"column:filters;type:text"`                             // 标签过滤条件, json 格式
+	GroupBy            string         `gorm:"column:group_by;type:varchar(255)"`                    // 分组的标签, 多个值以 ',' 分隔
+	NoData             string         `gorm:"column:nodata;type:varchar(16)"`                       // 查询无数据时的处理策略: alert, keep, ok
+	AbsentFor          string         `gorm:"column:absent_for;type:varchar(16)"`                   // 无数据检测规则: 持续该时长没有数据点即告警
+	Timezone           string         `gorm:"column:timezone;type:varchar(64)"`                     // 规则的时区, 为空时使用服务的时区
+	Datasource         string         `gorm:"column:datasource;type:varchar(32)"`                   // 规则的数据源: influxdb(默认), prometheus, mysql
+	DatasourceId       uint           `gorm:"column:datasource_id;type:int;default:0"`              // 引用的数据源 ID, 0 表示使用配置文件中的数据源
+	Baseline           string         `gorm:"column:baseline;type:text"`                            // 动态基线阈值, json 格式
+	Horizon            string         `gorm:"column:horizon;type:varchar(16)"`                      // 预测规则: 向前预测的时长
+	ForecastMethod     string         `gorm:"column:forecast_method;type:varchar(16)"`              // 预测规则: 拟合方法
+	Levels             string         `gorm:"column:levels;type:text"`                              // 多级阈值, json 格式
+	Labels             string         `gorm:"column:labels;type:text"`                              // 规则标签, json 格式
 	Level              int8           `gorm:"column:level;type:tinyint(1);NOT NULL"`                // 告警级别: 0 -- Not classified; 1 --- Information; 2 --- Warning; 3 --- critical; 4 --- Disaster
 	Creator            string         `gorm:"column:creator;type:varchar(32);NOT NULL"`             // 规则创建者, 用户钉钉的 userid
 	Updater            string         `gorm:"column:updater;type:varchar(32)"`                      // 规则创建者, 用户钉钉的 userid
@@ -0,0 +1,68 @@
+package alert
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/config"
+	"owl-engine/pkg/dao/mysql/event"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/constParam"
+	"owl-engine/pkg/util"
+)
+
+type alert struct{}
+
+var AlertSrv = new(alert)
+
+// QueryAlert 查询告警事件, 支持以告警标签过滤
+func (a *alert) QueryAlert(condition *apiModel.AlertCondition) (*[]apiModel.Alert, int64, error) {
+	var result = make([]apiModel.Alert, 0)
+
+	// 时间范围的校验, 以服务的时区解析
+	for _, value := range []string{condition.StartTime, condition.EndTime} {
+		if strings.Compare(value, "") == 0 {
+			continue
+		}
+		if _, err := time.ParseInLocation(constParam.DateTimeFormat, value, config.Get().ServerOptions.Location()); err != nil {
+			return &result, 0, errors.New("the time is set incorrectly, example: 2006-01-02 15:04:05")
+		}
+	}
+
+	records, count, err := event.EventDto.SelectByCondition(condition)
+	if err != nil {
+		return &result, 0, err
+	}
+
+	for _, v := range *records {
+		var alertLabels map[string]string
+		_ = json.Unmarshal([]byte(v.Labels), &alertLabels)
+
+		result = append(result, apiModel.Alert{
+			Id:           v.ID,
+			AlertId:      v.AlertId,
+			Name:         v.Name,
+			Item:         v.Item,
+			Labels:       alertLabels,
+			Origin:       v.Origin,
+			Type:         v.BusinessType,
+			Category:     v.Category,
+			Value:        v.Value,
+			Level:        v.Level,
+			Content:      v.Content,
+			RuleName:     v.RuleName,
+			GroupId:      v.GroupId,
+			Owner:        v.Owner,
+			Status:       v.Status,
+			Platform:     v.Platform,
+			PlatformName: v.PlatformName,
+			AlertTime:    util.DateTimeToString(v.AlertTime),
+			CreatedAt:    util.DateTimeToString(v.CreatedAt),
+			UpdatedAt:    util.DateTimeToString(v.UpdatedAt),
+		})
+	}
+
+	return &result, count, nil
+}
@@ -0,0 +1,415 @@
+package calculate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/config"
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/lib/express"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/xlogs"
+
+	"github.com/Knetic/govaluate"
+)
+
+// Aggregator 计算类型, 以 calculate_type 注册到 aggregators 中
+// 所有的计算类型共用同一个计算流程: 查询各因子的序列 --> 计算表达式并判定 --> 告警
+type Aggregator interface {
+	// Name 计算类型的名称, 如: max
+	Name() string
+	// Description 计算类型的说明
+	Description() string
+	// Validate 计算类型相关的规则校验
+	Validate(data *apiModel.MathRule) error
+	// Query 查询各因子的选项, 编译执行计划时使用
+	Query(data *apiModel.MathRule) (QueryOptions, error)
+	// Evaluate 对查询得到的各因子的序列进行计算, 返回每个序列的计算结果
+	Evaluate(plan *Plan, data *apiModel.MathRule, factorSeries map[string][]influxDto.Series) []Evaluation
+}
+
+// QueryOptions 查询各因子的选项
+type QueryOptions struct {
+	Selector   string          // 查询字段, 如: MAX(value)
+	Reduce     string          // 不支持聚合查询的数据源在查询后对时间窗口内的点进行聚合: max, min, mean, count; 为空时使用原始的点
+	GroupBy    string          // GROUP BY 子句
+	Interval   string          // 按时间间隔对齐数据点, 与 GroupBy 中的 time(interval) 对应, 用于生成其它查询语言的查询
+	Fill       string          // 对齐时缺失点的填充方式, 与 GroupBy 中的 fill(...) 对应
+	Window     []time.Duration // 所有因子统一的时间窗口的起止偏移, 为空时使用各因子的时间窗口
+	AllowEmpty bool            // 查询无数据时仍进行计算, 否则按规则的 nodata 策略处理
+}
+
+// Evaluation 单个序列的计算结果
+type Evaluation struct {
+	Key    string                 // 序列标识
+	Tags   map[string]string      // 序列的标签集
+	Params map[string]interface{} // 各因子的值, 用于计算告警值
+	Firing bool                   // 是否触发告警
+	Level  int8                   // 多级阈值命中的告警级别, 未配置多级阈值时不使用
+	Detail string                 // 告警内容的补充说明
+}
+
+// 已注册的计算类型, key 为 calculate_type
+var aggregators = make(map[int]Aggregator)
+
+// Register 注册计算类型, 同一个 calculate_type 不能重复注册
+func Register(calculateType int, aggregator Aggregator) {
+	if _, ok := aggregators[calculateType]; ok {
+		panic(fmt.Sprintf("calculate_type %d has been registered", calculateType))
+	}
+	aggregators[calculateType] = aggregator
+}
+
+// GetAggregator 获取 calculate_type 对应的计算类型
+func GetAggregator(calculateType int) (Aggregator, error) {
+	if aggregator, ok := aggregators[calculateType]; ok {
+		return aggregator, nil
+	}
+
+	var example string
+	for _, v := range CalculateTypes() {
+		example += fmt.Sprintf("; %d -- %s", v.Type, v.Name)
+	}
+	return nil, errors.New("the parameter calculate_type is set incorrectly. example: " + example[2:])
+}
+
+// CalculateTypes 已注册的计算类型, 按 calculate_type 排序
+func CalculateTypes() []apiModel.CalculateType {
+	var result = make([]apiModel.CalculateType, 0, len(aggregators))
+	for calculateType, aggregator := range aggregators {
+		result = append(result, apiModel.CalculateType{
+			Type:        calculateType,
+			Name:        aggregator.Name(),
+			Description: aggregator.Description(),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Type < result[j].Type })
+
+	return result
+}
+
+// 计算流程: 查询各因子的序列, 由计算类型进行计算并判定, 记录各序列的状态后对触发的序列进行告警
+func (r *mathRuleCalculate) pipeline(ctx context.Context, now time.Time, data *apiModel.MathRule, conf *config.ServerRunOptions) {
+	calIndex, evaluations, empty, err := r.evaluate(ctx, now, data, conf)
+	if err != nil {
+		xlogs.Error(fmt.Sprintf("rule name = {%s} %s", data.Name, err.Error()))
+		return
+	}
+
+	if strings.Compare(empty, "") != 0 {
+		xlogs.Error(fmt.Sprintf("rule name = {%s} to query factor [%s] has no result", data.Name, empty))
+		r.noData(ctx, calIndex, data, conf)
+		return
+	}
+
+	var ref = ruleRef(RefMath, data.Id)
+	var previous = ruleStates.Get(ref)
+	var expiresAt = r.stateExpiry(data)
+	var keys = make(map[string]bool, len(evaluations))
+	for _, result := range evaluations {
+		keys[result.Key] = true
+		var state = &ruleState{
+			Name:      data.Name,
+			Origin:    data.Origin,
+			Firing:    result.Firing,
+			CalIndex:  calIndex,
+			Params:    result.Params,
+			Detail:    result.Detail,
+			Tags:      result.Tags,
+			Labels:    alertLabels(data.Name, data.Labels, result.Tags),
+			Level:     result.Level,
+			ExpiresAt: expiresAt,
+		}
+
+		if result.Firing {
+			// 告警中的序列级别变化时, 原地升级或降级之前的告警
+			var escalate *escalation
+			if last, ok := previous[result.Key]; ok && last.Firing && strings.Compare(last.AlertId, "") != 0 && last.Level != result.Level {
+				escalate = &escalation{AlertId: last.AlertId, From: last.Level, To: result.Level}
+			}
+
+			// 发送告警
+			state.AlertId, _ = r.warning(ctx, calIndex, data, result.Level, escalate, result.Params, conf, result.Detail, result.Tags)
+		}
+
+		ruleStates.Set(ref, result.Key, state)
+	}
+
+	// 本次计算中不再出现的序列视为已恢复
+	ruleStates.Retain(ref, keys)
+}
+
+// 计算规则在 now 时刻各序列的判定结果, 不记录状态也不发送告警
+// 返回告警的指标名称、各序列的判定结果; 有因子查询无数据且计算类型不允许无数据时, 返回该因子且不进行计算
+func (r *mathRuleCalculate) evaluate(ctx context.Context, now time.Time, data *apiModel.MathRule,
+	conf *config.ServerRunOptions) (string, []Evaluation, string, error) {
+	// 各因子按 group_by 标签分组后的序列
+	factorSeries, _, err := r.fetch(ctx, now, conf)
+	if err != nil {
+		return "", nil, "", err
+	}
+
+	return r.judge(ctx, now, data, conf, factorSeries)
+}
+
+// 对各因子的序列进行计算及判定, 包括动态基线及多级阈值
+func (r *mathRuleCalculate) judge(ctx context.Context, now time.Time, data *apiModel.MathRule, conf *config.ServerRunOptions,
+	factorSeries map[string][]influxDto.Series) (string, []Evaluation, string, error) {
+	// 为 anomaly 查询 InfluxDB 的指标名称
+	var calIndex string
+	for _, factor := range r.plan.Factors {
+		// 计算的指标名称
+		calIndex = data.MetricList[factor]
+
+		if len(factorSeries[factor]) == 0 && !r.plan.AllowEmpty {
+			return calIndex, nil, factor, nil
+		}
+	}
+
+	var err error
+	evaluations := r.plan.Aggregator.Evaluate(r.plan, data, factorSeries)
+
+	// 动态基线: 以过去 N 天同一时刻的基线区间重新判定
+	if r.plan.Baseline != nil {
+		if evaluations, err = r.applyBaseline(ctx, now, data, conf, evaluations); err != nil {
+			return calIndex, nil, "", err
+		}
+	}
+
+	// 多级阈值: 命中的最高级别为告警级别
+	if len(r.plan.Levels) > 0 {
+		evaluations = applyLevels(r.plan.Levels, evaluations)
+	} else {
+		for i := range evaluations {
+			evaluations[i].Level = data.Level
+		}
+	}
+
+	return calIndex, evaluations, "", nil
+}
+
+// 并发查询各因子的序列及执行的查询语句, 任一因子查询失败时取消其余的查询并返回错误
+func (r *mathRuleCalculate) fetch(ctx context.Context, now time.Time, conf *config.ServerRunOptions) (map[string][]influxDto.Series, map[string]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type fetchResult struct {
+		factor string
+		cmd    string
+		series []influxDto.Series
+		err    error
+	}
+
+	var ch = make(chan fetchResult, len(r.plan.Factors))
+	for _, factor := range r.plan.Factors {
+		go func(factor string) {
+			cmd, series, err := r.query(ctx, now, factor, conf)
+			ch <- fetchResult{factor: factor, cmd: cmd, series: series, err: err}
+		}(factor)
+	}
+
+	var factorSeries = make(map[string][]influxDto.Series, len(r.plan.Factors))
+	var queries = make(map[string]string, len(r.plan.Factors))
+	for range r.plan.Factors {
+		result := <-ch
+		if result.err != nil {
+			return nil, nil, fmt.Errorf("to execute sql [%s] error: %s", result.cmd, result.err.Error())
+		}
+		factorSeries[result.factor] = result.series
+		queries[result.factor] = result.cmd
+	}
+
+	return factorSeries, queries, nil
+}
+
+// 依据执行计划查询因子在时间窗口内的序列, 返回执行的查询语句
+func (r *mathRuleCalculate) query(ctx context.Context, now time.Time, factor string, conf *config.ServerRunOptions) (string, []influxDto.Series, error) {
+	// 时间窗口以规则的时区计算, 与查询的 TZ() 子句保持一致
+	now = now.In(r.plan.Location)
+	window := r.plan.Windows[factor]
+	return r.plan.Queries[factor].Query(ctx, now.Add(window[0]), now.Add(window[1]), conf)
+}
+
+// 以编译后的表达式进行运算
+func calculate(expr *govaluate.EvaluableExpression, params map[string]interface{}) (interface{}, error) {
+	result, err := expr.Evaluate(params)
+	if result != nil && err == nil {
+		return result, nil
+	} else if err == nil {
+		err = errors.New("result is nil")
+	}
+
+	return nil, err
+}
+
+// 以样本值作为因子的值计算表达式, 用于校验表达式结果的类型
+func sampleResult(data *apiModel.MathRule) (interface{}, error) {
+	expr, err := express.New(data.Express)
+	if err != nil {
+		return nil, errors.New("mathematical expression is incorrect, " + err.Error())
+	}
+
+	var factors = make([]string, 0)
+	for _, k := range factorRegexp.FindAllStringSubmatch(data.Express, -1) {
+		factors = append(factors, k[1])
+	}
+
+	result, err := sampleEvaluate(expr, factors)
+	if err != nil {
+		return nil, fmt.Errorf("mathematical expression calculation is incorrect, %v", err)
+	}
+
+	return result, nil
+}
+
+// 表达式中的函数对参数有取值范围(如: pct_change 的前值不能为 0, log 的参数必须大于 0)
+// 依次以样本值作为所有因子的值计算表达式, 任一样本计算成功即返回其结果
+var sampleValues = []float64{0, 2}
+
+func sampleEvaluate(expr *govaluate.EvaluableExpression, factors []string) (interface{}, error) {
+	var err error
+	for _, value := range sampleValues {
+		var params = make(map[string]interface{}, len(factors))
+		for _, factor := range factors {
+			params[factor] = value
+		}
+
+		var result interface{}
+		if result, err = calculate(expr, params); err == nil {
+			return result, nil
+		}
+	}
+
+	return nil, err
+}
+
+// 校验表达式的结果为布尔值, 如: [A] > 0
+func checkBoolResult(data *apiModel.MathRule) error {
+	result, err := sampleResult(data)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := result.(bool); !ok {
+		return errors.New("incorrect regular expression, example: [A] > 0")
+	}
+	return nil
+}
+
+// 逐点计算的计算类型(TopN、BottomN、预测等)的对齐参数校验
+func checkPoints(data *apiModel.MathRule) error {
+	if strings.Compare(data.Interval, "") != 0 && !intervalRegexp.MatchString(data.Interval) {
+		return errors.New("incorrect value written in interval, example: 1m")
+	}
+
+	switch strings.ToLower(data.Fill) {
+	case "", "none", "null", "previous", "linear":
+	default:
+		if _, err := strconv.ParseFloat(data.Fill, 64); err != nil {
+			return errors.New("the parameter fill is set incorrectly. example: none, null, previous, linear or a number")
+		}
+	}
+
+	return nil
+}
+
+// 逐点计算的计算类型的查询选项
+// 指定了对齐的时间间隔时, 使用 GROUP BY time(interval) fill(...) 将各因子的点对齐到相同的时间戳上
+func pointsQuery(data *apiModel.MathRule) QueryOptions {
+	if strings.Compare(data.Interval, "") == 0 {
+		return QueryOptions{Selector: "value", GroupBy: groupByClause(data.GroupBy)}
+	}
+
+	return QueryOptions{
+		Selector: "MEAN(value)",
+		GroupBy:  fmt.Sprintf("%s fill(%s)", groupByClause(append([]string{"time(" + data.Interval + ")"}, data.GroupBy...)), fillOption(data.Fill)),
+		Interval: data.Interval,
+		Fill:     fillOption(data.Fill),
+	}
+}
+
+// 按时间戳对齐后的序列
+type alignedSeries struct {
+	Key        string
+	Tags       map[string]string
+	Timestamps []int64                      // 所有因子都有值的时间戳, 升序
+	Points     map[string]map[int64]float64 // 因子 --> 时间戳 --> 值
+}
+
+// Params 时间戳 ts 上各因子的值
+func (s alignedSeries) Params(factors []string, ts int64) map[string]interface{} {
+	var params = make(map[string]interface{}, len(factors))
+	for _, factor := range factors {
+		params[factor] = s.Points[factor][ts]
+	}
+	return params
+}
+
+// 将各因子的序列按序列标识分组, 并按时间戳对齐
+// 只有所有因子都存在的序列才参与计算; 只有所有因子在该时间戳上都有值时, 该点才参与计算
+func alignSeries(plan *Plan, data *apiModel.MathRule, factorSeries map[string][]influxDto.Series) []alignedSeries {
+	var metricKeys = plan.Factors
+	if len(metricKeys) == 0 {
+		return nil
+	}
+
+	// 各因子的数据点, key 为因子名, value 为 序列标识 --> 时间戳 --> 值
+	var factorPoints = make(map[string]map[string]map[int64]float64, len(metricKeys))
+	// 序列标识 --> 序列的标签集
+	var seriesTags = make(map[string]map[string]string)
+	for factor, series := range factorSeries {
+		factorPoints[factor] = make(map[string]map[int64]float64, len(series))
+		for _, s := range series {
+			points := make(map[int64]float64, len(s.Points))
+			for _, p := range s.Points {
+				points[p.Time.UnixNano()] = p.Value
+			}
+			factorPoints[factor][s.Key()] = points
+			seriesTags[s.Key()] = s.Tags
+		}
+	}
+
+	var result = make([]alignedSeries, 0, len(seriesTags))
+	for key, tags := range seriesTags {
+		var series = alignedSeries{Key: key, Tags: tags, Points: make(map[string]map[int64]float64, len(metricKeys))}
+		for _, metricKey := range metricKeys {
+			if p, ok := factorPoints[metricKey][key]; ok {
+				series.Points[metricKey] = p
+			}
+		}
+
+		if len(series.Points) != len(metricKeys) {
+			continue
+		}
+
+		// 按时间戳对齐: 只保留所有因子都有值的时间戳
+		for ts := range series.Points[metricKeys[0]] {
+			aligned := true
+			for _, metricKey := range metricKeys[1:] {
+				if _, ok := series.Points[metricKey][ts]; !ok {
+					aligned = false
+					break
+				}
+			}
+
+			if aligned {
+				series.Timestamps = append(series.Timestamps, ts)
+			}
+		}
+
+		if len(series.Timestamps) == 0 {
+			xlogs.Error(fmt.Sprintf("rule name = {%s} has no aligned points for expression {%s}", data.Name, data.Express))
+			continue
+		}
+		sort.Slice(series.Timestamps, func(i, j int) bool { return series.Timestamps[i] < series.Timestamps[j] })
+
+		result = append(result, series)
+	}
+
+	return result
+}
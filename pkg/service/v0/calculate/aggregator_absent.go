@@ -0,0 +1,86 @@
+package calculate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/xlogs"
+)
+
+func init() {
+	Register(7, &absentAggregator{})
+}
+
+// 无数据检测: 表达式中各因子的值为 absent_for 时长内的数据点数, 没有数据点时为 0
+// 如: [A] == 0, 即指标 A 在 absent_for 时长内没有任何数据点时触发告警
+type absentAggregator struct{}
+
+func (a *absentAggregator) Name() string {
+	return "absent"
+}
+
+func (a *absentAggregator) Description() string {
+	return "无数据检测: 持续 absent_for 时长没有数据点"
+}
+
+// 必须配置大于 0 的检测时长, 且不支持分组
+func (a *absentAggregator) Validate(data *apiModel.MathRule) error {
+	if duration, err := time.ParseDuration(data.AbsentFor); err != nil || duration <= 0 {
+		return errors.New("incorrect value written in absent_for, example: 10m")
+	}
+
+	if len(data.GroupBy) > 0 {
+		return errors.New("the parameter group_by is not supported for absent rule")
+	}
+
+	return checkBoolResult(data)
+}
+
+// 以 absent_for 作为所有因子的时间窗口
+func (a *absentAggregator) Query(data *apiModel.MathRule) (QueryOptions, error) {
+	absentFor, err := time.ParseDuration(data.AbsentFor)
+	if err != nil || absentFor <= 0 {
+		return QueryOptions{}, fmt.Errorf("absent_for {%s} is incorrect", data.AbsentFor)
+	}
+
+	return QueryOptions{
+		Selector:   "COUNT(value)",
+		Reduce:     "count",
+		Window:     []time.Duration{-absentFor, 0},
+		AllowEmpty: true,
+	}, nil
+}
+
+func (a *absentAggregator) Evaluate(plan *Plan, data *apiModel.MathRule, factorSeries map[string][]influxDto.Series) []Evaluation {
+	var params = make(map[string]interface{}, len(plan.Factors))
+	var absentMetrics = make([]string, 0)
+
+	for _, factor := range plan.Factors {
+		// 没有数据点时, InfluxDB 不返回任何序列, 数据点数即为 0
+		var count = 0.0
+		if series := factorSeries[factor]; len(series) > 0 && len(series[0].Points) > 0 {
+			count = series[0].Points[0].Value
+		}
+		if count == 0 {
+			absentMetrics = append(absentMetrics, data.MetricList[factor])
+		}
+		params[factor] = count
+	}
+
+	result, err := calculate(plan.Expression, params)
+	if err != nil {
+		xlogs.Error(fmt.Sprintf("calculate expression {%s} for rule name = {%s} error: %s", data.Express, data.Name, err.Error()))
+		return nil
+	}
+
+	var evaluation = Evaluation{Params: params}
+	if evaluation.Firing, _ = result.(bool); evaluation.Firing {
+		evaluation.Detail = fmt.Sprintf("最近 %s 内无数据点的指标: %s", data.AbsentFor, strings.Join(absentMetrics, ", "))
+	}
+
+	return []Evaluation{evaluation}
+}
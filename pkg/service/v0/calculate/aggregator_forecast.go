@@ -0,0 +1,175 @@
+package calculate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/lib/forecast"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/util"
+	"owl-engine/pkg/xlogs"
+)
+
+// Holt 双指数平滑的平滑系数
+const (
+	holtAlpha = 0.5
+	holtBeta  = 0.3
+)
+
+func init() {
+	Register(8, &forecastAggregator{})
+	Register(9, &forecastAggregator{below: true})
+}
+
+// 预测: 对时间窗口内的点进行拟合, 向前预测 horizon 时长后的值, 预测值上升至(或下降至)阈值时触发告警
+// 表达式的值即拟合的点的值, 只能为数值, 与规则的阈值 threshold 比较; 多因子时按时间戳对齐后逐点计算
+type forecastAggregator struct {
+	below bool
+}
+
+func (a *forecastAggregator) Name() string {
+	if a.below {
+		return "forecastBelow"
+	}
+	return "forecast"
+}
+
+func (a *forecastAggregator) Description() string {
+	if a.below {
+		return "预测: horizon 时长后的预测值小于等于阈值"
+	}
+	return "预测: horizon 时长后的预测值大于等于阈值"
+}
+
+// 必须配置大于 0 的预测时长及阈值, 表达式只能为数值
+func (a *forecastAggregator) Validate(data *apiModel.MathRule) error {
+	if err := checkPoints(data); err != nil {
+		return err
+	}
+
+	if horizon, err := time.ParseDuration(data.Horizon); err != nil || horizon <= 0 {
+		return errors.New("incorrect value written in horizon, example: 6h")
+	}
+
+	switch strings.ToLower(data.ForecastMethod) {
+	case "", "linear", "holt":
+	default:
+		return errors.New("the parameter forecast_method is set incorrectly. example: linear, holt")
+	}
+
+	if strings.Contains(data.Express, "||") || strings.Contains(data.Express, "&&") {
+		return errors.New("forecast does not support expression containing && or ||")
+	}
+
+	// 以表达式的值进行拟合, 比较符不参与计算, 因此不允许
+	result, err := sampleResult(data)
+	if err != nil {
+		return err
+	}
+	if _, ok := result.(float64); !ok {
+		return errors.New("the express of forecast must be a number compared with threshold, example: [A] / [B]")
+	}
+
+	// 阈值的零值也是有效的阈值, 必须显式指定
+	if !data.ThresholdSet {
+		return errors.New("the threshold of forecast must be specified")
+	}
+
+	return nil
+}
+
+func (a *forecastAggregator) Query(data *apiModel.MathRule) (QueryOptions, error) {
+	return pointsQuery(data), nil
+}
+
+func (a *forecastAggregator) Evaluate(plan *Plan, data *apiModel.MathRule, factorSeries map[string][]influxDto.Series) []Evaluation {
+	horizon, _ := time.ParseDuration(data.Horizon)
+
+	var result = make([]Evaluation, 0)
+
+	// 组合表达式没有拟合的值, 校验时已拒绝; 此前保存的规则不再计算
+	if plan.Value == nil {
+		return result
+	}
+
+	for _, series := range alignSeries(plan, data, factorSeries) {
+		evaluation, err := a.evaluateSeries(plan, data, series, horizon)
+		if err != nil {
+			xlogs.Error(fmt.Sprintf("rule name = {%s} series {%s} forecast error: %s", data.Name, series.Key, err.Error()))
+			continue
+		}
+
+		evaluation.Key = series.Key
+		evaluation.Tags = series.Tags
+		result = append(result, evaluation)
+	}
+
+	return result
+}
+
+// 对单个序列进行拟合, 计算当前的拟合值、每秒的变化量及 horizon 后的预测值
+func (a *forecastAggregator) evaluateSeries(plan *Plan, data *apiModel.MathRule, series alignedSeries, horizon time.Duration) (Evaluation, error) {
+	var last = series.Timestamps[len(series.Timestamps)-1]
+
+	// 横坐标为距最后一个点的秒数, 纵坐标为表达式的值
+	var xs, ys = make([]float64, 0, len(series.Timestamps)), make([]float64, 0, len(series.Timestamps))
+	for _, ts := range series.Timestamps {
+		result, err := calculate(plan.Value, series.Params(plan.Factors, ts))
+		if err != nil {
+			continue
+		}
+		if value, ok := result.(float64); ok {
+			xs = append(xs, time.Duration(ts-last).Seconds())
+			ys = append(ys, value)
+		}
+	}
+
+	var current, rate float64 // 当前的拟合值, 每秒的变化量
+	var method = strings.ToLower(data.ForecastMethod)
+	switch method {
+	case "holt":
+		level, trend, err := forecast.Holt(ys, holtAlpha, holtBeta)
+		if err != nil {
+			return Evaluation{}, err
+		}
+
+		// Holt 的趋势为每个点的变化量, 以点的平均间隔换算为每秒的变化量
+		step := (xs[len(xs)-1] - xs[0]) / float64(len(xs)-1)
+		if step <= 0 {
+			return Evaluation{}, errors.New("the interval of points is incorrect")
+		}
+		current, rate = level, trend/step
+	default:
+		method = "linear"
+		slope, intercept, err := forecast.Linear(xs, ys)
+		if err != nil {
+			return Evaluation{}, err
+		}
+		current, rate = intercept, slope
+	}
+
+	predicted := current + rate*horizon.Seconds()
+
+	var evaluation = Evaluation{Params: series.Params(plan.Factors, last)}
+	if a.below {
+		evaluation.Firing = predicted <= data.Threshold
+	} else {
+		evaluation.Firing = predicted >= data.Threshold
+	}
+
+	if evaluation.Firing {
+		var reached = "当前已达到阈值"
+		if (!a.below && current < data.Threshold) || (a.below && current > data.Threshold) {
+			remaining := time.Duration((data.Threshold - current) / rate * float64(time.Second))
+			reached = fmt.Sprintf("预计 %s 后达到阈值", remaining.Round(time.Minute).String())
+		}
+
+		evaluation.Detail = fmt.Sprintf("%s %v, %s 后的预测值为 %s (%s 拟合, 变化速率 %s/h)", reached, data.Threshold,
+			horizon.String(), util.Float64ToString(predicted, 2), method, util.Float64ToString(rate*3600, 2))
+	}
+
+	return evaluation, nil
+}
@@ -0,0 +1,63 @@
+package calculate
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"owl-engine/pkg/model/apiModel"
+)
+
+func TestForecastValidate(t *testing.T) {
+	var cases = []struct {
+		body string
+		err  string
+	}{
+		{body: `{"express": "[A]", "threshold": 90}`},
+		{body: `{"express": "[A] / [B] * 100", "threshold": 0}`},
+		{body: `{"express": "[A]"}`, err: "the threshold of forecast must be specified"},
+		{body: `{"express": "[A] > 90", "threshold": 90}`, err: "must be a number"},
+		{body: `{"express": "[A] > 90 && [B] > 1", "threshold": 90}`, err: "&& or ||"},
+	}
+
+	for _, c := range cases {
+		var data apiModel.MathRule
+		if err := json.Unmarshal([]byte(c.body), &data); err != nil {
+			t.Fatalf("unmarshal %s error: %s", c.body, err.Error())
+		}
+		data.CalculateType = 8
+		data.Horizon = "6h"
+		data.MetricList = map[string]string{"A": "disk", "B": "total"}
+		data.TimeWindow = map[string][]string{"A": {"-1h", "0m"}, "B": {"-1h", "0m"}}
+
+		err := (&forecastAggregator{}).Validate(&data)
+		if c.err == "" && err != nil {
+			t.Errorf("Validate(%s) error: %s", c.body, err.Error())
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("Validate(%s) error = %v, want %s", c.body, err, c.err)
+		}
+	}
+}
+
+func TestMathRuleThresholdSet(t *testing.T) {
+	var data apiModel.MathRule
+	if err := json.Unmarshal([]byte(`{"name": "disk", "threshold": 0, "express": "[A]"}`), &data); err != nil {
+		t.Fatalf("unmarshal error: %s", err.Error())
+	}
+	if !data.ThresholdSet || data.Threshold != 0 || data.Name != "disk" || data.Express != "[A]" {
+		t.Errorf("unmarshal = %+v, want threshold 0 set", data)
+	}
+
+	data = apiModel.MathRule{}
+	_ = json.Unmarshal([]byte(`{"threshold": 1.5}`), &data)
+	if !data.ThresholdSet || data.Threshold != 1.5 {
+		t.Errorf("threshold = %v %t, want 1.5 set", data.Threshold, data.ThresholdSet)
+	}
+
+	data = apiModel.MathRule{}
+	_ = json.Unmarshal([]byte(`{"name": "disk"}`), &data)
+	if data.ThresholdSet {
+		t.Errorf("threshold should not be set without the field")
+	}
+}
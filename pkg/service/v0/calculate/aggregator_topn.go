@@ -0,0 +1,151 @@
+package calculate
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/lib/express"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/util"
+)
+
+func init() {
+	Register(4, &topNAggregator{})
+	Register(5, &topNAggregator{bottom: true})
+}
+
+// TopN or Bottom: 时间窗口内最近的 M 个点中, 至少有 N 个点大于(TopN)/小于(BottomN)阈值时触发告警
+// 点的值为表达式比较符左侧的计算结果, 总是与规则的阈值 threshold 比较, 表达式中的比较符及常量不参与判定
+// 多因子时, 各因子的数据点按时间戳对齐后, 逐点进行表达式的计算; 只有所有因子在该时间戳上都有值时, 该点才参与计算
+type topNAggregator struct {
+	bottom bool
+}
+
+func (a *topNAggregator) Name() string {
+	if a.bottom {
+		return "bottomN"
+	}
+	return "topN"
+}
+
+func (a *topNAggregator) Description() string {
+	if a.bottom {
+		return "BottomN: 最近的 M 个点中至少有 N 个点小于阈值"
+	}
+	return "TopN: 最近的 M 个点中至少有 N 个点大于阈值"
+}
+
+// 多因子时按时间戳对齐数据点, 表达式可直接为数值; 不支持包含 && 或 || 的组合表达式
+func (a *topNAggregator) Validate(data *apiModel.MathRule) error {
+	if err := checkPoints(data); err != nil {
+		return err
+	}
+
+	if data.MatchCount < 0 || data.PointCount < 0 {
+		return errors.New("the match_count and point_count of the rule must be greater than or equal to 0")
+	}
+
+	if data.PointCount > 0 && data.MatchCount > data.PointCount {
+		return errors.New("the match_count of the rule cannot be greater than point_count")
+	}
+
+	// 以比较符左侧的值与阈值比较, 组合表达式没有单一的值
+	if strings.Contains(data.Express, "||") || strings.Contains(data.Express, "&&") {
+		return errors.New("the express of topN and bottomN cannot contain && or ||, it is compared with threshold, example: [A] / [B]")
+	}
+
+	var value = *data
+	value.Express = express.LeftOperand(data.Express)
+	result, err := sampleResult(&value)
+	if err != nil {
+		return err
+	}
+	if _, ok := result.(float64); !ok {
+		return errors.New("the express of topN and bottomN must be a number, example: [A] / [B]")
+	}
+
+	return nil
+}
+
+func (a *topNAggregator) Query(data *apiModel.MathRule) (QueryOptions, error) {
+	return pointsQuery(data), nil
+}
+
+func (a *topNAggregator) Evaluate(plan *Plan, data *apiModel.MathRule, factorSeries map[string][]influxDto.Series) []Evaluation {
+	// 按序列逐个进行计算, 每个序列单独判定是否告警
+	var result = make([]Evaluation, 0)
+
+	// 组合表达式没有与阈值比较的值, 校验时已拒绝; 此前保存的规则不再计算
+	if plan.Value == nil {
+		return result
+	}
+
+	for _, series := range alignSeries(plan, data, factorSeries) {
+		evaluation := a.evaluateSeries(plan, data, series)
+		evaluation.Key = series.Key
+		evaluation.Tags = series.Tags
+		result = append(result, evaluation)
+	}
+
+	return result
+}
+
+// 对单个序列按时间戳对齐后的数据点, 逐点计算
+func (a *topNAggregator) evaluateSeries(plan *Plan, data *apiModel.MathRule, series alignedSeries) Evaluation {
+	var metricKeys = plan.Factors
+	var timestamps = series.Timestamps
+
+	// 只取窗口内最近的 M 个点参与计算
+	if data.PointCount > 0 && data.PointCount < len(timestamps) {
+		timestamps = timestamps[len(timestamps)-data.PointCount:]
+	}
+
+	// 逐点计算, 统计越过阈值的点数
+	// 点的值为表达式比较符左侧的计算结果; TopN: 点的值大于阈值; BottomN: 点的值小于阈值
+	var params map[string]interface{}
+	var breached = make([]string, 0)
+	for _, ts := range timestamps {
+		params = series.Params(metricKeys, ts)
+
+		result, err := calculate(plan.Value, params)
+		if err != nil {
+			continue
+		}
+		value, ok := result.(float64)
+		if !ok {
+			continue
+		}
+
+		var isBreached = value > data.Threshold
+		if a.bottom {
+			isBreached = value < data.Threshold
+		}
+
+		if isBreached {
+			breached = append(breached, fmt.Sprintf("%s=%s", time.Unix(0, ts).In(plan.Location).Format("15:04:05"), util.Float64ToString(value, 2)))
+		}
+	}
+
+	// 默认 M 个点均需越过阈值; 配置了 match_count 时, 只需 N 个点越过阈值即可
+	required := len(timestamps)
+	if data.MatchCount > 0 && data.MatchCount < required {
+		required = data.MatchCount
+	}
+
+	// 告警值以最近一个对齐点计算
+	var evaluation = Evaluation{Params: params, Firing: len(breached) >= required}
+	if evaluation.Firing {
+		// 告警内容中列出越过阈值的点, 避免内容过长, 最多列出 10 个
+		evaluation.Detail = fmt.Sprintf("%d/%d 个点越过阈值", len(breached), len(timestamps))
+		if len(breached) > 10 {
+			evaluation.Detail += ": " + strings.Join(breached[len(breached)-10:], ", ") + " ..."
+		} else {
+			evaluation.Detail += ": " + strings.Join(breached, ", ")
+		}
+	}
+
+	return evaluation
+}
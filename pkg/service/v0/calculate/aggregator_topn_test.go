@@ -0,0 +1,89 @@
+package calculate
+
+import (
+	"strings"
+	"testing"
+
+	"owl-engine/pkg/model/apiModel"
+)
+
+func TestTopNEvaluateSeries(t *testing.T) {
+	// 三个点的值分别为 50, 90, 95
+	var series = alignedSeries{
+		Timestamps: []int64{1e9, 2e9, 3e9},
+		Points:     map[string]map[int64]float64{"A": {1e9: 50, 2e9: 90, 3e9: 95}},
+	}
+
+	var cases = []struct {
+		express   string
+		bottom    bool
+		threshold float64
+		match     int
+		firing    bool
+	}{
+		// 比较符左侧的值总是与阈值比较, 相同的表达式 TopN 与 BottomN 的结果不同
+		{express: "[A] > 90", threshold: 40, match: 1, firing: true},
+		{express: "[A] > 90", bottom: true, threshold: 40, match: 1},
+		{express: "[A] > 90", threshold: 100, match: 1},
+		{express: "[A] > 90", bottom: true, threshold: 100, match: 3, firing: true},
+		{express: "[A] * 2 < 10", threshold: 150, match: 2, firing: true},
+		// TopN 大于阈值, BottomN 小于阈值, 至少 N 个点
+		{express: "[A]", threshold: 80, match: 2, firing: true},
+		{express: "[A]", threshold: 80, match: 3},
+		{express: "[A]", bottom: true, threshold: 80, match: 1, firing: true},
+		{express: "[A]", bottom: true, threshold: 40, match: 1},
+	}
+
+	for _, c := range cases {
+		var data = &apiModel.MathRule{
+			CalculateType: 4,
+			Express:       c.express,
+			MetricList:    map[string]string{"A": "cpu"},
+			TimeWindow:    map[string][]string{"A": {"-5m", "0m"}},
+			Threshold:     c.threshold,
+			MatchCount:    c.match,
+		}
+		if c.bottom {
+			data.CalculateType = 5
+		}
+
+		plan, err := compilePlan(data)
+		if err != nil {
+			t.Fatalf("compilePlan(%s) error: %s", c.express, err.Error())
+		}
+
+		var aggregator = &topNAggregator{bottom: c.bottom}
+		if got := aggregator.evaluateSeries(plan, data, series); got.Firing != c.firing {
+			t.Errorf("%s(%s, threshold %v, match %d) firing = %t, want %t", aggregator.Name(), c.express, c.threshold, c.match, got.Firing, c.firing)
+		}
+	}
+}
+
+func TestTopNValidate(t *testing.T) {
+	var cases = []struct {
+		express string
+		err     string
+	}{
+		{express: "[A] / [B]"},
+		{express: "[A] > 90"},
+		{express: "[A] > 90 && [B] > 1", err: "cannot contain && or ||"},
+		{express: "[A] > 1 || [B] > 1", err: "cannot contain && or ||"},
+	}
+
+	for _, c := range cases {
+		var data = &apiModel.MathRule{
+			CalculateType: 4,
+			Express:       c.express,
+			MetricList:    map[string]string{"A": "cpu", "B": "mem"},
+			TimeWindow:    map[string][]string{"A": {"-5m", "0m"}, "B": {"-5m", "0m"}},
+		}
+
+		err := (&topNAggregator{}).Validate(data)
+		if c.err == "" && err != nil {
+			t.Errorf("Validate(%s) error: %s", c.express, err.Error())
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("Validate(%s) error = %v, want %s", c.express, err, c.err)
+		}
+	}
+}
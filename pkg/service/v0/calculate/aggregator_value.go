@@ -0,0 +1,83 @@
+package calculate
+
+import (
+	"fmt"
+
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/xlogs"
+)
+
+func init() {
+	Register(1, &valueAggregator{name: "max", description: "最大值: 时间窗口内的最大值", selector: "MAX(value)", reduce: "max"})
+	Register(2, &valueAggregator{name: "min", description: "最小值: 时间窗口内的最小值", selector: "MIN(value)", reduce: "min"})
+	Register(3, &valueAggregator{name: "chainRatio", description: "环比: 各时间窗口内的平均值, 以表达式计算变化率", selector: "MEAN(value)", reduce: "mean"})
+	Register(6, &valueAggregator{name: "avg", description: "平均值: 时间窗口内的平均值", selector: "MEAN(value)", reduce: "mean"})
+}
+
+// 聚合值的计算类型: 各因子查询时间窗口内的聚合值(MAX、MIN、MEAN 等)后, 按序列(标签集)对齐进行计算
+type valueAggregator struct {
+	name        string
+	description string
+	selector    string
+	reduce      string // 不支持聚合查询的数据源对时间窗口内的点的聚合方式, 与 selector 对应
+}
+
+func (a *valueAggregator) Name() string {
+	return a.name
+}
+
+func (a *valueAggregator) Description() string {
+	return a.description
+}
+
+func (a *valueAggregator) Validate(data *apiModel.MathRule) error {
+	return checkBoolResult(data)
+}
+
+func (a *valueAggregator) Query(data *apiModel.MathRule) (QueryOptions, error) {
+	return QueryOptions{Selector: a.selector, Reduce: a.reduce, GroupBy: groupByClause(data.GroupBy)}, nil
+}
+
+// 对各因子的聚合值按序列(标签集)进行对齐后计算, 只有所有因子都存在的序列才进行计算
+func (a *valueAggregator) Evaluate(plan *Plan, data *apiModel.MathRule, factorSeries map[string][]influxDto.Series) []Evaluation {
+	var values = make(map[string]map[string]float64, len(factorSeries))
+	var tags = make(map[string]map[string]string)
+	for factor, series := range factorSeries {
+		values[factor] = make(map[string]float64, len(series))
+		for _, s := range series {
+			if len(s.Points) == 0 {
+				continue
+			}
+			values[factor][s.Key()] = s.Points[0].Value
+			tags[s.Key()] = s.Tags
+		}
+	}
+
+	var result = make([]Evaluation, 0, len(tags))
+	for key, tag := range tags {
+		var params = make(map[string]interface{}, len(values))
+		for factor, v := range values {
+			if value, ok := v[key]; ok {
+				params[factor] = value
+			}
+		}
+
+		// 只有表达式的因子个数和传值个数相匹配时, 才进行计算
+		if len(params) != len(factorSeries) {
+			continue
+		}
+
+		// 进行计算
+		value, err := calculate(plan.Expression, params)
+		if err != nil {
+			xlogs.Error(fmt.Sprintf("calculate expression {%s} for rule name = {%s} error: %s", data.Express, data.Name, err.Error()))
+			continue
+		}
+
+		firing, _ := value.(bool)
+		result = append(result, Evaluation{Key: key, Tags: tag, Params: params, Firing: firing})
+	}
+
+	return result
+}
@@ -0,0 +1,194 @@
+package calculate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	influxInit "owl-engine/pkg/client/influxdb"
+	"owl-engine/pkg/config"
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/lib/anomaly"
+	"owl-engine/pkg/lib/flux"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/util"
+	"owl-engine/pkg/xlogs"
+)
+
+// AnomalyBackend 异常检测的后端, 以 InfluxDB 配置中的 anomalyBackend 选择
+type AnomalyBackend interface {
+	// Name 后端的名称, 如: native
+	Name() string
+	// Score 对当前窗口的最后一个点进行异常检测, 返回异常评分, 取值范围 [0, 100]; at 为待检测的点的时间
+	Score(name, at string, windows anomaly.Windows, option *config.InfluxDBOptions) (float64, error)
+}
+
+// 已注册的异常检测后端, key 为后端的名称
+var anomalyBackends = make(map[string]AnomalyBackend)
+
+func init() {
+	RegisterAnomalyBackend(new(nativeBackend))
+	RegisterAnomalyBackend(new(metisBackend))
+}
+
+// RegisterAnomalyBackend 注册异常检测的后端, 同名的后端不能重复注册
+func RegisterAnomalyBackend(backend AnomalyBackend) {
+	if _, ok := anomalyBackends[backend.Name()]; ok {
+		panic(fmt.Sprintf("anomaly backend %s has been registered", backend.Name()))
+	}
+	anomalyBackends[backend.Name()] = backend
+}
+
+// 内置的异常检测: EWMA、3-sigma 及与昨天、上周同一时刻的同比检测
+type nativeBackend struct{}
+
+func (b *nativeBackend) Name() string {
+	return "native"
+}
+
+func (b *nativeBackend) Score(name, at string, windows anomaly.Windows, option *config.InfluxDBOptions) (float64, error) {
+	result, err := anomaly.Detect(windows)
+	if err != nil {
+		return 0, err
+	}
+
+	xlogs.Infof("rule name = %s, anomaly scores at %s: %v", name, at, result.Scores)
+	return result.Score * 100, nil
+}
+
+// 外部的 Metis 服务, 要求三个窗口的点数分别为 181、361、361
+type metisBackend struct{}
+
+func (b *metisBackend) Name() string {
+	return "metis"
+}
+
+func (b *metisBackend) Score(name, at string, windows anomaly.Windows, option *config.InfluxDBOptions) (float64, error) {
+	if strings.Compare(option.MetisUrl, "") == 0 {
+		return 0, errors.New("metis url is not configured")
+	}
+
+	if len(windows.Current) != 181 || len(windows.Yesterday) != 361 || len(windows.LastWeek) != 361 {
+		return 0, fmt.Errorf("insufficient number of records, %d/%d/%d", len(windows.Current), len(windows.Yesterday), len(windows.LastWeek))
+	}
+
+	var jsonData = struct {
+		ViewId   string `json:"viewId"`
+		ViewName string `json:"viewName"`
+		AttrId   string `json:"attrId"`
+		AttrName string `json:"attrName"`
+		TaskId   string `json:"taskId"`
+		Window   int    `json:"window"`
+		Time     string `json:"time"`
+		DataC    string `json:"dataC"`
+		DataB    string `json:"dataB"`
+		DataA    string `json:"dataA"`
+	}{
+		ViewId:   "1",
+		ViewName: "业务方",
+		AttrId:   "1",
+		AttrName: "各渠道订单量",
+		TaskId:   "1",
+		Window:   180,
+		Time:     at,
+		DataC:    strings.Replace(strings.Trim(fmt.Sprint(windows.LastWeek), "[]"), " ", ",", -1),
+		DataB:    strings.Replace(strings.Trim(fmt.Sprint(windows.Yesterday), "[]"), " ", ",", -1),
+		DataA:    strings.Replace(strings.Trim(fmt.Sprint(windows.Current), "[]"), " ", ",", -1),
+	}
+
+	response, err := Post(option.MetisUrl, jsonData)
+	if err != nil {
+		return 0, err
+	}
+
+	var result = struct {
+		Code    int    `json:"code"`
+		Message string `json:"msg"`
+		Data    struct {
+			Ret int    `json:"ret"`
+			P   string `json:"p"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal([]byte(response), &result); err != nil {
+		return 0, err
+	}
+
+	p, err := strconv.ParseFloat(result.Data.P, 64)
+	if err != nil {
+		return 0, fmt.Errorf("metis response is incorrect: %s", response)
+	}
+	return (1 - p) * 100, nil
+}
+
+// 计算告警指标的异常评分, 保留两位小数
+// 由于前置 flink 处理数据时, 其机制: 会延迟将近2分钟, 故以当前时间往前推2分钟的点作为待检测的点
+// 三个窗口: 过去 180 分钟; 昨天同一时刻前后各 180 分钟; 上周同一时刻前后各 180 分钟
+func (r *mathRuleCalculate) anomalyScore(ctx context.Context, now time.Time, name, calIndex, origin, businessType string,
+	filters *apiModel.FilterGroup, category int8, option *config.InfluxDBOptions) (string, error) {
+	backend, ok := anomalyBackends[strings.ToLower(option.AnomalyBackend)]
+	if !ok {
+		backend = anomalyBackends["native"]
+	}
+
+	where, err := influxDto.Where(category, origin, businessType, filters)
+	if err != nil {
+		return "", err
+	}
+	fluxWhere, err := influxDto.FluxWhere(calIndex, category, origin, businessType, filters)
+	if err != nil {
+		return "", err
+	}
+
+	// 查询窗口内的点
+	queryWindow := func(start, stop time.Time) ([]float64, error) {
+		var cmd string
+		var series []influxDto.Series
+		var err error
+		if option.Version == 2 {
+			// 时间取整到分钟, 包含结束时间, 与 InfluxQL 的查询保持一致
+			start, stop = start.Truncate(time.Minute), stop.Truncate(time.Minute).Add(time.Nanosecond)
+			cmd = fmt.Sprintf("from(bucket: %s)\n  |> range(start: %s, stop: %s)\n  |> filter(fn: (r) => %s)\n  |> group()",
+				flux.String(option.FluxBucket()), start.UTC().Format(time.RFC3339Nano), stop.UTC().Format(time.RFC3339Nano), fluxWhere)
+			series, err = influxDto.QueryCache.QueryFlux(ctx, cmd, option.FluxBucket(), influxInit.FluxClient)
+		} else {
+			cmd = fmt.Sprintf("SELECT value FROM %s WHERE %s AND time >= '%s' AND time <= '%s'%s", influxDto.QuoteIdent(calIndex),
+				where, util.DatetimeToWholeMinutes(start), util.DatetimeToWholeMinutes(stop), tzClause(r.plan.Timezone))
+			series, err = influxDto.QueryCache.Query(ctx, cmd, option.Database, option.RetentionPolicy, 10, *influxInit.InfluxDBClient)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("to execute sql [%s] error: %s", cmd, err.Error())
+		}
+
+		if len(series) == 0 {
+			return make([]float64, 0), nil
+		}
+		return influxDto.Values(series[0].Points), nil
+	}
+
+	var windows anomaly.Windows
+	current := now.Add(-2 * time.Minute)
+	if windows.Current, err = queryWindow(current.Add(-180*time.Minute), current); err != nil {
+		return "", err
+	}
+
+	yesterday := current.AddDate(0, 0, -1)
+	if windows.Yesterday, err = queryWindow(yesterday.Add(-180*time.Minute), yesterday.Add(180*time.Minute)); err != nil {
+		return "", err
+	}
+
+	lastWeek := current.AddDate(0, 0, -7)
+	if windows.LastWeek, err = queryWindow(lastWeek.Add(-180*time.Minute), lastWeek.Add(180*time.Minute)); err != nil {
+		return "", err
+	}
+
+	score, err := backend.Score(name, util.DatetimeToWholeMinutes(current), windows, option)
+	if err != nil {
+		return "", fmt.Errorf("%s anomaly detection error: %s", backend.Name(), err.Error())
+	}
+
+	return util.Float64ToString(score, 2), nil
+}
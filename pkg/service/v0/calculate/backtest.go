@@ -0,0 +1,106 @@
+package calculate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/config"
+	"owl-engine/pkg/lib/job"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/constParam"
+	"owl-engine/pkg/util"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 单次回测最多执行的次数, 避免长时间占用 InfluxDB
+const maxBacktestTicks = 1440
+
+// Backtest 以历史数据回放规则: 在 [start, end] 范围内按规则的 crontab 逐次计算, 返回各次的因子值及判定结果
+// 回测不记录规则的计算状态, 也不写入告警记录及发送通知
+func Backtest(ctx context.Context, data *apiModel.MathRule, start, end string) (*apiModel.BacktestResult, error) {
+	plan, err := compilePlan(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := plan.Aggregator.Validate(data); err != nil {
+		return nil, err
+	}
+
+	begin, err := time.ParseInLocation(constParam.DateTimeFormat, start, plan.Location)
+	if err != nil {
+		return nil, errors.New("the start time is set incorrectly, example: 2006-01-02 15:04:05")
+	}
+	stop, err := time.ParseInLocation(constParam.DateTimeFormat, end, plan.Location)
+	if err != nil {
+		return nil, errors.New("the end time is set incorrectly, example: 2006-01-02 15:04:05")
+	}
+	if !stop.After(begin) || stop.After(time.Now()) {
+		return nil, errors.New("the end time must be after the start time and not later than now")
+	}
+
+	var crontab = data.Crontab
+	if strings.Compare(crontab, "") == 0 {
+		crontab = "* * * * *"
+	}
+	schedule, err := cron.ParseStandard(job.WithTimezone(crontab, plan.Timezone))
+	if err != nil {
+		return nil, errors.New("cron express: " + err.Error())
+	}
+
+	// 定时任务在回测范围内的执行时间
+	var ticks = make([]time.Time, 0)
+	for tick := schedule.Next(begin.Add(-time.Second)); !tick.After(stop); tick = schedule.Next(tick) {
+		if len(ticks) >= maxBacktestTicks {
+			return nil, fmt.Errorf("the rule would run more than %d times in the range, please narrow it", maxBacktestTicks)
+		}
+		ticks = append(ticks, tick)
+	}
+
+	var r = &mathRuleCalculate{Params: data, plan: plan, ctx: ctx}
+	var conf = config.Get()
+	var result = &apiModel.BacktestResult{Ticks: len(ticks), Points: make([]apiModel.BacktestPoint, 0, len(ticks))}
+
+	for _, tick := range ticks {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var point = apiModel.BacktestPoint{Time: util.DateTimeToString(tick), Series: make([]apiModel.BacktestSeries, 0)}
+
+		// 每次计算使用与定时任务相同的超时时间
+		tickCtx, cancel := context.WithTimeout(ctx, conf.ServerOptions.Deadline())
+		_, evaluations, empty, err := r.evaluate(tickCtx, tick, data, conf)
+		cancel()
+
+		switch {
+		case err != nil:
+			point.Error = err.Error()
+		case strings.Compare(empty, "") != 0:
+			point.NoData = empty
+		}
+
+		for _, evaluation := range evaluations {
+			point.Series = append(point.Series, apiModel.BacktestSeries{
+				Key:    evaluation.Key,
+				Tags:   evaluation.Tags,
+				Values: evaluation.Params,
+				Firing: evaluation.Firing,
+				Level:  evaluation.Level,
+				Detail: evaluation.Detail,
+			})
+
+			if evaluation.Firing {
+				result.Alerts++
+			}
+		}
+
+		result.Points = append(result.Points, point)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,146 @@
+package calculate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/config"
+	"owl-engine/pkg/lib/stats"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/util"
+)
+
+// 动态基线的默认参数及限制
+const (
+	defaultBaselineDays = 7  // 默认参考过去 7 天
+	defaultBaselineK    = 3  // 默认为 mean ± 3σ
+	maxBaselineDays     = 30 // 最多参考过去 30 天, 每天都需要单独查询一次
+	minBaselineSamples  = 2  // 历史值少于该数量时不进行判定
+)
+
+// 校验动态基线的参数并补全默认值, 未配置或 mode 为空时使用静态阈值, 返回 nil
+// 动态基线以表达式比较符左侧的值与基线区间进行比较, 只支持聚合值的计算类型, 且表达式不能为组合表达式
+func compileBaseline(aggregator Aggregator, data *apiModel.MathRule) (*apiModel.Baseline, error) {
+	if data.Baseline == nil || strings.Compare(data.Baseline.Mode, "") == 0 {
+		return nil, nil
+	}
+
+	if _, ok := aggregator.(*valueAggregator); !ok {
+		var names = make([]string, 0)
+		for _, v := range CalculateTypes() {
+			if _, ok := aggregators[v.Type].(*valueAggregator); ok {
+				names = append(names, fmt.Sprintf("%d -- %s", v.Type, v.Name))
+			}
+		}
+		return nil, errors.New("baseline is only supported for calculate_type: " + strings.Join(names, "; "))
+	}
+
+	if strings.Contains(data.Express, "||") || strings.Contains(data.Express, "&&") {
+		return nil, errors.New("baseline does not support expression containing && or ||")
+	}
+
+	var baseline = *data.Baseline
+	baseline.Mode = strings.ToLower(baseline.Mode)
+
+	if baseline.Days == 0 {
+		baseline.Days = defaultBaselineDays
+	}
+	if baseline.Days < minBaselineSamples || baseline.Days > maxBaselineDays {
+		return nil, fmt.Errorf("the days of baseline must be between %d and %d", minBaselineSamples, maxBaselineDays)
+	}
+
+	switch baseline.Mode {
+	case "stddev":
+		if baseline.K == 0 {
+			baseline.K = defaultBaselineK
+		}
+		if baseline.K < 0 {
+			return nil, errors.New("the k of baseline must be greater than 0")
+		}
+	case "percentile":
+		if baseline.Lower < 0 || baseline.Upper > 100 || baseline.Lower >= baseline.Upper {
+			return nil, errors.New("the percentile of baseline must satisfy 0 <= lower < upper <= 100, example: lower = 5, upper = 95")
+		}
+	default:
+		return nil, errors.New("the mode of baseline is set incorrectly. example: stddev, percentile")
+	}
+
+	return &baseline, nil
+}
+
+// 以过去 N 天同一时刻的计算值作为各序列的基线, 当前值超出基线区间时触发告警
+// 历史值不足的序列不触发告警; 查询历史数据出错时返回错误, 本次计算不再进行
+func (r *mathRuleCalculate) applyBaseline(ctx context.Context, now time.Time, data *apiModel.MathRule,
+	conf *config.ServerRunOptions, evaluations []Evaluation) ([]Evaluation, error) {
+	var baseline = r.plan.Baseline
+
+	// 各序列的历史值, 以规则的时区计算同一时刻
+	var history = make(map[string][]float64)
+	for day := 1; day <= baseline.Days; day++ {
+		factorSeries, _, err := r.fetch(ctx, now.In(r.plan.Location).AddDate(0, 0, -day), conf)
+		if err != nil {
+			return nil, fmt.Errorf("baseline of %d days ago %s", day, err.Error())
+		}
+
+		for _, result := range r.plan.Aggregator.Evaluate(r.plan, data, factorSeries) {
+			if value, ok := r.value(result.Params); ok {
+				history[result.Key] = append(history[result.Key], value)
+			}
+		}
+	}
+
+	for i := range evaluations {
+		var evaluation = &evaluations[i]
+		evaluation.Firing = false
+		evaluation.Detail = ""
+
+		value, ok := r.value(evaluation.Params)
+		samples := history[evaluation.Key]
+		if !ok || len(samples) < minBaselineSamples {
+			continue
+		}
+
+		lower, upper := baselineBounds(baseline, samples)
+		evaluation.Firing = value < lower || value > upper
+		evaluation.Detail = fmt.Sprintf("基线区间为: [%s, %s], %s", util.Float64ToString(lower, 2),
+			util.Float64ToString(upper, 2), baselineDescription(baseline, len(samples)))
+	}
+
+	return evaluations, nil
+}
+
+// 以表达式比较符左侧的表达式计算当前值
+func (r *mathRuleCalculate) value(params map[string]interface{}) (float64, bool) {
+	if r.plan.Value == nil || len(params) == 0 {
+		return 0, false
+	}
+
+	result, err := calculate(r.plan.Value, params)
+	if err != nil {
+		return 0, false
+	}
+
+	value, ok := result.(float64)
+	return value, ok
+}
+
+// 基线区间: stddev 模式为 mean ± k·σ; percentile 模式为 [P(lower), P(upper)]
+func baselineBounds(baseline *apiModel.Baseline, samples []float64) (float64, float64) {
+	if strings.Compare(baseline.Mode, "percentile") == 0 {
+		return stats.Percentile(samples, baseline.Lower), stats.Percentile(samples, baseline.Upper)
+	}
+
+	mean, stdDev := stats.Mean(samples), stats.StdDev(samples)
+	return mean - baseline.K*stdDev, mean + baseline.K*stdDev
+}
+
+// 基线区间的说明, 展示在告警内容中
+func baselineDescription(baseline *apiModel.Baseline, count int) string {
+	if strings.Compare(baseline.Mode, "percentile") == 0 {
+		return fmt.Sprintf("基于过去 %d 天同一时刻的 P%v ~ P%v", count, baseline.Lower, baseline.Upper)
+	}
+	return fmt.Sprintf("基于过去 %d 天同一时刻的 mean ± %v·σ", count, baseline.K)
+}
@@ -0,0 +1,585 @@
+package calculate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	appConfig "owl-engine/pkg/config"
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/dao/mysql/event"
+	"owl-engine/pkg/dao/mysql/rule"
+	"owl-engine/pkg/lib/express"
+	"owl-engine/pkg/lib/job"
+	"owl-engine/pkg/lib/labels"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/dbModel"
+	"owl-engine/pkg/util"
+	"owl-engine/pkg/xlogs"
+
+	"github.com/Knetic/govaluate"
+	uuid "github.com/satori/go.uuid"
+)
+
+// 规则更新的信号
+var (
+	CompositeRuleCh    = make(chan map[string]*apiModel.CompositeRule, 1)
+	CompositeTaskQueue = make(map[string]string)
+)
+
+// 组合规则可引用的规则类型
+const (
+	RefMath   = "math"
+	RefLogger = "logger"
+)
+
+// 组合表达式中对规则的引用, 如: [math:12]
+var refPattern = regexp.MustCompile(`\[\s*(\w+)\s*:\s*(\d+)\s*\]`)
+
+// 规则引用的标识, 如: math:12; 作为规则计算状态的 key 及组合表达式中的变量名
+func ruleRef(kind string, id uint) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
+
+// CompositeRefs 解析组合表达式中引用的规则, 返回各类型下被引用的规则 ID
+func CompositeRefs(expression string) (map[string][]int, error) {
+	var result = make(map[string][]int)
+
+	matches := refPattern.FindAllStringSubmatch(expression, -1)
+	if len(matches) == 0 {
+		return nil, errors.New("the express must reference at least one rule, example: [math:12] && [logger:3]")
+	}
+
+	for _, match := range matches {
+		kind := strings.ToLower(match[1])
+		switch kind {
+		case RefMath, RefLogger:
+		default:
+			return nil, fmt.Errorf("unsupported rule kind [%s] in express, example: math, logger", match[1])
+		}
+
+		id, _ := strconv.Atoi(match[2])
+		result[kind] = append(result[kind], id)
+	}
+
+	return result, nil
+}
+
+// 组合规则的执行计划
+type compositePlan struct {
+	Expression *govaluate.EvaluableExpression
+	Refs       []string           // 被引用的规则, 如: math:12
+	Template   *template.Template // 告警内容的模板
+}
+
+// 组合规则的默认告警模板
+const compositeTemplate = `
+告警名称：{{ .Name }}
+组合条件：{{ .Express }}
+{{- if .Labels }}
+告警标签：{{ .Labels }}
+{{- end }}
+告警内容：{{ .Content }}
+告警规则：{{ range .Rules }}
+  - {{ . }}{{ end }}
+告警时间：{{ .Datetime }}
+负责人：{{ .ResponsiblePeople }}
+`
+
+// 编译组合规则: 表达式中的引用统一为 [kind:id] 的变量, 以全部为真及全部为假校验表达式的结果为布尔值
+func compileComposite(data *apiModel.CompositeRule) (*compositePlan, error) {
+	if _, err := CompositeRefs(data.Express); err != nil {
+		return nil, err
+	}
+
+	var plan = new(compositePlan)
+	var seen = make(map[string]bool)
+	normalized := refPattern.ReplaceAllStringFunc(data.Express, func(s string) string {
+		match := refPattern.FindStringSubmatch(s)
+		id, _ := strconv.Atoi(match[2])
+		ref := ruleRef(strings.ToLower(match[1]), uint(id))
+		if !seen[ref] {
+			seen[ref] = true
+			plan.Refs = append(plan.Refs, ref)
+		}
+		return "[" + ref + "]"
+	})
+
+	var err error
+	if plan.Expression, err = express.New(normalized); err != nil {
+		return nil, fmt.Errorf("incorrect composite express: %s", err.Error())
+	}
+
+	for _, firing := range []bool{true, false} {
+		var params = make(map[string]interface{}, len(plan.Refs))
+		for _, ref := range plan.Refs {
+			params[ref] = firing
+		}
+		result, err := plan.Expression.Evaluate(params)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect composite express: %s", err.Error())
+		}
+		if _, ok := result.(bool); !ok {
+			return nil, errors.New("the result of composite express must be boolean, example: [math:12] && [logger:3]")
+		}
+	}
+
+	var text = data.Template
+	if strings.Compare(strings.TrimSpace(text), "") == 0 {
+		text = compositeTemplate
+	}
+	if plan.Template, err = template.New(data.Name).Option("missingkey=zero").Parse(text); err != nil {
+		return nil, fmt.Errorf("incorrect template: %s", err.Error())
+	}
+
+	return plan, nil
+}
+
+// CheckComposite 校验组合规则的表达式及告警模板
+func CheckComposite(data *apiModel.CompositeRule) error {
+	_, err := compileComposite(data)
+	return err
+}
+
+// 被组合规则静默通知的规则, 被引用的规则仍然计算并记录告警, 只是不再发送通知
+// 组合规则配置了静默的标签过滤条件时, 只静默告警标签匹配的告警
+type silenceStore struct {
+	lock sync.RWMutex
+	refs map[string]map[uint]*apiModel.FilterGroup // 被引用的规则 --> 静默该规则的组合规则 ID --> 静默的标签过滤条件
+}
+
+var silences = &silenceStore{refs: make(map[string]map[uint]*apiModel.FilterGroup)}
+
+// 以组合规则当前引用的规则及静默的标签过滤条件替换其之前静默的规则
+func (s *silenceStore) Set(id uint, refs []string, filters *apiModel.FilterGroup) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.remove(id)
+	for _, ref := range refs {
+		if _, ok := s.refs[ref]; !ok {
+			s.refs[ref] = make(map[uint]*apiModel.FilterGroup)
+		}
+		s.refs[ref][id] = filters
+	}
+}
+
+// 取消组合规则静默的全部规则
+func (s *silenceStore) Delete(id uint) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.remove(id)
+}
+
+func (s *silenceStore) remove(id uint) {
+	for ref, ids := range s.refs {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(s.refs, ref)
+		}
+	}
+}
+
+// 规则标签为 alertLabels 的告警是否被组合规则静默通知
+func (s *silenceStore) Silenced(ref string, alertLabels map[string]string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, filters := range s.refs[ref] {
+		if influxDto.Match(filters, alertLabels) {
+			return true
+		}
+	}
+	return false
+}
+
+type compositeRuleCalculate struct {
+	Params *apiModel.CompositeRule
+	plan   *compositePlan
+}
+
+// Composite 组合规则的计算
+func Composite(stopCh <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	// 只查找 未被禁用且未被删除的规则记录, 执行定时任务
+	condition := apiModel.CompositeRuleCondition{
+		Switch: 1,
+		Inuse:  2,
+	}
+
+	records, count, err := rule.CompositeDto.SelectByCondition(&condition)
+	if err != nil {
+		xlogs.Errorf("query composite rule from db error: %s", err.Error())
+		return
+	}
+
+	cronTab := job.NewCronTab()
+
+	if records != nil && count > 0 {
+		for _, v := range *records {
+			syncComposite("add", CompositeRule(&v), cronTab)
+
+			time.Sleep(1 * time.Millisecond)
+		}
+
+		xlogs.Infof("successfully loaded %d composite rules", count)
+	}
+
+	cronTab.Start()
+
+	for {
+		select {
+		case value, ok := <-CompositeRuleCh:
+			if ok {
+				reValue := reflect.ValueOf(value)
+
+				for _, key := range reValue.MapKeys() {
+					k := key.String()
+					syncComposite(k, value[k], cronTab)
+				}
+			}
+		case <-stopCh:
+			ids := cronTab.IDs()
+			for _, id := range ids {
+				cronTab.DelByID(id)
+			}
+			cronTab.Stop()
+
+			xlogs.Info("composite rule timed task stop calculation")
+			return
+		}
+	}
+}
+
+// CompositeRule 将组合规则的数据库记录转换为接口参数
+func CompositeRule(v *dbModel.CompositeRule) *apiModel.CompositeRule {
+	var groupIds = make([]int, 0)
+	for _, id := range strings.Split(v.GroupIp, ",") {
+		if strings.Compare(id, "") != 0 {
+			groupIds = append(groupIds, util.StringToInt(id))
+		}
+	}
+
+	var filters *apiModel.FilterGroup
+	_ = json.Unmarshal([]byte(v.SilenceFilters), &filters)
+
+	return &apiModel.CompositeRule{
+		Id:                v.ID,
+		Name:              v.Name,
+		Express:           v.Express,
+		MatchOn:           util.StringToStringSl(v.MatchOn),
+		Silent:            v.Silent,
+		SilenceFilters:    filters,
+		Template:          v.Template,
+		Level:             v.Level,
+		Creator:           v.Creator,
+		Updater:           v.Updater,
+		ResponsiblePeople: v.ResponsiblePeople,
+		Crontab:           v.Crontab,
+		Switch:            v.Switch,
+		Inuse:             v.Inuse,
+		GroupId:           groupIds,
+		WebHooks:          util.StringToStringSl(v.WebHooks),
+		Description:       v.Description,
+		CreatedAt:         util.DateTimeToString(v.CreatedAt),
+		UpdatedAt:         util.DateTimeToString(v.UpdatedAt),
+	}
+}
+
+// 监听规则变化
+func syncComposite(action string, record *apiModel.CompositeRule, cron *job.CronTab) {
+	id := CompositeTaskQueue[record.Name]
+	if strings.Compare(id, "") != 0 {
+		cron.DelByID(id)
+		delete(CompositeTaskQueue, record.Name)
+	}
+	silences.Delete(record.Id)
+
+	switch strings.ToLower(action) {
+	case "delete":
+		xlogs.Infof("composite rule [name = %s] has been deleted", record.Name)
+	case "update", "add":
+		// 未被禁用且未被删除的规则记录, 执行定时任务
+		if record.Switch == 1 && record.Inuse == 2 {
+			plan, err := compileComposite(record)
+			if err != nil {
+				xlogs.Errorf("compile composite rule [name = %s] error: %s", record.Name, err.Error())
+				return
+			}
+
+			var calculate = &compositeRuleCalculate{Params: record, plan: plan}
+			id := uuid.NewV4().String()
+			if err := cron.AddByID(id, job.WithTimezone(record.Crontab, appConfig.Get().ServerOptions.Timezone), calculate); err != nil {
+				jsonStr, _ := json.Marshal(record)
+				xlogs.Errorf("add cron task for composite rule [%s] error: %s", string(jsonStr), err.Error())
+				return
+			}
+			CompositeTaskQueue[record.Name] = id
+
+			if record.Silent == 1 {
+				silences.Set(record.Id, plan.Refs, record.SilenceFilters)
+			}
+		}
+
+		xlogs.Infof("composite rule [name = %s] has been updated or added", record.Name)
+	}
+}
+
+// 组合规则按 match_on 的标签值分组后的计算单元
+type compositeGroup struct {
+	Key     string
+	Labels  map[string]string
+	Firing  map[string]bool // 被引用的规则 --> 是否有序列处于告警中
+	Known   map[string]bool // 被引用的规则 --> 是否有未过期的序列状态
+	Unknown map[string]bool // 被引用的规则 --> 序列状态均已过期, 即规则连续未能计算, 状态未知
+	Rules   []string        // 处于告警中的被引用规则的序列
+}
+
+// 组合表达式中状态未知的规则最多的个数, 超过时不进行计算
+const maxUnknownRefs = 8
+
+// Run 以被引用规则最近一次的计算状态计算组合表达式, 为真时触发告警
+func (c *compositeRuleCalculate) Run() {
+	for _, group := range c.groups(time.Now()) {
+		firing, err := c.evaluate(group)
+		if err != nil {
+			xlogs.Errorf("composite rule name = {%s} evaluate error: %s", c.Params.Name, err.Error())
+			continue
+		}
+
+		if firing {
+			c.warning(group)
+		}
+	}
+}
+
+// 计算分组的组合表达式; 有状态未知的规则时, 只有其取值不影响结果时(如: 已知为假的规则与之 AND)才以该结果为准
+// 结果依赖于状态未知的规则时, 返回错误且不触发告警
+func (c *compositeRuleCalculate) evaluate(group *compositeGroup) (bool, error) {
+	var unknown = make([]string, 0, len(group.Unknown))
+	for _, ref := range c.plan.Refs {
+		if group.Unknown[ref] {
+			unknown = append(unknown, ref)
+		}
+	}
+	if len(unknown) > maxUnknownRefs {
+		return false, fmt.Errorf("the states of %s are stale", strings.Join(unknown, ", "))
+	}
+
+	// 以状态未知的规则的所有取值组合计算表达式, 结果均相同时才确定
+	var decided *bool
+	for mask := 0; mask < 1<<uint(len(unknown)); mask++ {
+		var params = make(map[string]interface{}, len(c.plan.Refs))
+		for _, ref := range c.plan.Refs {
+			params[ref] = group.Firing[ref]
+		}
+		for i, ref := range unknown {
+			params[ref] = mask&(1<<uint(i)) != 0
+		}
+
+		result, err := c.plan.Expression.Evaluate(params)
+		if err != nil {
+			return false, err
+		}
+		firing, ok := result.(bool)
+		if !ok {
+			return false, errors.New("the result of composite express must be boolean")
+		}
+
+		if decided == nil {
+			decided = &firing
+		} else if *decided != firing {
+			return false, fmt.Errorf("the states of %s are stale, the result of group {%s} is unknown", strings.Join(unknown, ", "), group.Key)
+		}
+	}
+
+	return *decided, nil
+}
+
+// 按 match_on 的标签值对被引用规则的序列进行分组; 未配置 match_on 时所有序列为同一组
+// 标签值优先取序列的标签, 标签 origin 不存在时取规则的来源; 缺少任一标签的序列不参与计算
+// 超过有效期的状态视为未知, 规则在分组中只有过期的状态时, 该规则在分组中的状态未知
+func (c *compositeRuleCalculate) groups(now time.Time) []*compositeGroup {
+	var groups = make(map[string]*compositeGroup)
+	var newGroup = func(key string, labels map[string]string) *compositeGroup {
+		return &compositeGroup{Key: key, Labels: labels, Firing: make(map[string]bool), Known: make(map[string]bool), Unknown: make(map[string]bool)}
+	}
+	if len(c.Params.MatchOn) == 0 {
+		groups[""] = newGroup("", nil)
+	}
+
+	for _, ref := range c.plan.Refs {
+		for key, state := range ruleStates.Get(ref) {
+			labels, ok := matchLabels(state, c.Params.MatchOn)
+			if !ok {
+				continue
+			}
+
+			var series = influxDto.Series{Tags: labels}
+			group, ok := groups[series.Key()]
+			if !ok {
+				group = newGroup(series.Key(), labels)
+				groups[group.Key] = group
+			}
+
+			if state.Stale(now) {
+				if !group.Known[ref] {
+					group.Unknown[ref] = true
+				}
+				continue
+			}
+			group.Known[ref] = true
+			delete(group.Unknown, ref)
+
+			if state.Firing {
+				group.Firing[ref] = true
+
+				var name = fmt.Sprintf("[%s] %s", ref, state.Name)
+				if strings.Compare(key, "") != 0 {
+					name += " {" + key + "}"
+				}
+				group.Rules = append(group.Rules, name)
+			}
+		}
+	}
+
+	var result = make([]*compositeGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Strings(group.Rules)
+		result = append(result, group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+
+	return result
+}
+
+// 序列在 match_on 标签上的取值, 优先取告警标签(规则标签与序列标签合并后的标签)
+func matchLabels(state *ruleState, matchOn []string) (map[string]string, bool) {
+	var result = make(map[string]string, len(matchOn))
+	for _, label := range matchOn {
+		if value, ok := state.Labels[label]; ok {
+			result[label] = value
+			continue
+		}
+		if value, ok := state.Tags[label]; ok {
+			result[label] = value
+			continue
+		}
+		if strings.Compare(label, "origin") == 0 && strings.Compare(state.Origin, "") != 0 {
+			result[label] = state.Origin
+			continue
+		}
+		return nil, false
+	}
+
+	return result, true
+}
+
+// 发送组合规则的告警
+func (c *compositeRuleCalculate) warning(group *compositeGroup) {
+	data := c.Params
+	conf := appConfig.Get()
+
+	var content = fmt.Sprintf("组合规则 【%s】触发告警, 条件 %s 成立", data.Name, data.Express)
+	if len(group.Labels) > 0 {
+		content = fmt.Sprintf("组合规则 【%s】序列 {%s} 触发告警, 条件 %s 成立", data.Name, group.Key, data.Express)
+	}
+
+	var params = struct {
+		Name              string     `json:"name"`
+		Express           string     `json:"express"`
+		Labels            labels.Set `json:"labels"`
+		Content           string     `json:"content"`
+		Rules             []string   `json:"rules"`
+		Level             int8       `json:"level"`
+		Datetime          string     `json:"datetime"`
+		ResponsiblePeople string     `json:"responsible_people"`
+	}{
+		Name:              data.Name,
+		Express:           data.Express,
+		Labels:            group.Labels,
+		Content:           content,
+		Rules:             group.Rules,
+		Level:             data.Level,
+		Datetime:          util.DateTimeToString(time.Now().In(conf.ServerOptions.Location())),
+		ResponsiblePeople: data.ResponsiblePeople,
+	}
+
+	var buffer bytes.Buffer
+	if err := c.plan.Template.Execute(&buffer, params); err != nil {
+		xlogs.Error(fmt.Sprintf("template composite alert event error: %s", err.Error()))
+		return
+	}
+
+	var labelStr string
+	if len(group.Labels) > 0 {
+		jsonLabels, _ := json.Marshal(group.Labels)
+		labelStr = string(jsonLabels)
+	}
+
+	alertId := uuid.NewV4().String()
+	var record = dbModel.Alert{
+		AlertId:      alertId,
+		Name:         data.Name,
+		Item:         data.Express,
+		Labels:       labelStr,
+		Origin:       group.Labels["origin"],
+		Value:        1,
+		Level:        data.Level, // 告警级别:0-Not classified; 1-Information; 2-Warning; 3-critical; 4-Disaster
+		Content:      content,
+		RuleName:     data.Name,
+		GroupId:      strings.Replace(strings.Trim(fmt.Sprint(data.GroupId), "[]"), " ", ",", -1),
+		Owner:        data.ResponsiblePeople,
+		Status:       1, // 告警状态,1-告警中,2-恢复,3-忽略,4-静默
+		Platform:     1, // 告警平台,1-owl,2-zcat,3-prometheus,4-zms等
+		AlertTime:    time.Now(),
+		PlatformName: "owl",
+		AggregatorId: 0,
+		Creator:      data.Creator,
+		Updater:      data.Updater,
+		CreatedAt:    time.Now(),
+	}
+
+	jsonStr, _ := json.Marshal(record)
+	if err := event.EventDto.Insert(&record); err != nil {
+		xlogs.Error(fmt.Sprintf("insert alert event for {%s} to db error: %s", string(jsonStr), err.Error()))
+	}
+
+	var alert = struct {
+		UUID    string `json:"uuid"`
+		Level   int8   `json:"level"`
+		GroupId string `json:"group_id"`
+		Owner   string `json:"owner"`
+		Content string `json:"content"`
+		AlertId int    `json:"alert_id"`
+	}{
+		UUID:    alertId,
+		Level:   data.Level,
+		GroupId: record.GroupId,
+		Owner:   data.Creator,
+		Content: buffer.String(),
+	}
+
+	// 发送 http post 到全局及规则自身的 hook 地址
+	var hooks = append(append(make([]string, 0), conf.EventOptions.Hooks...), data.WebHooks...)
+	for _, hook := range hooks {
+		if msg, err := Post(hook, alert); err == nil {
+			xlogs.Infof("post request to [%s] for alert id [%s] success, response result: [%v]", hook, alert.UUID, msg)
+		} else {
+			xlogs.Errorf("post data [%s] to %s fail, error message: %s", string(jsonStr), hook, err.Error())
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package calculate
+
+import (
+	"testing"
+	"time"
+
+	"owl-engine/pkg/model/apiModel"
+)
+
+// 被引用规则的状态
+const (
+	missing = iota
+	firing
+	resolved
+	staleFiring
+	staleResolved
+)
+
+func setState(ref string, state int, now time.Time) {
+	ruleStates.Delete(ref)
+	if state == missing {
+		return
+	}
+
+	var expiresAt = now.Add(time.Minute)
+	if state == staleFiring || state == staleResolved {
+		expiresAt = now.Add(-time.Minute)
+	}
+	ruleStates.Set(ref, "", &ruleState{Name: ref, Firing: state == firing || state == staleFiring, ExpiresAt: expiresAt})
+}
+
+func TestCompositeEvaluate(t *testing.T) {
+	var cases = []struct {
+		express string
+		a, b    int
+		firing  bool
+		unknown bool // 结果依赖于状态未知的规则
+	}{
+		{express: "[math:9001] && [math:9002]", a: firing, b: firing, firing: true},
+		{express: "[math:9001] && [math:9002]", a: firing, b: resolved},
+		{express: "[math:9001] && [math:9002]", a: firing, b: missing},
+		{express: "[math:9001] && [math:9002]", a: resolved, b: staleFiring},
+		{express: "[math:9001] && [math:9002]", a: firing, b: staleFiring, unknown: true},
+		{express: "[math:9001] && [math:9002]", a: staleFiring, b: staleFiring, unknown: true},
+		{express: "[math:9001] || [math:9002]", a: firing, b: staleResolved, firing: true},
+		{express: "[math:9001] || [math:9002]", a: resolved, b: missing},
+		{express: "[math:9001] || [math:9002]", a: resolved, b: staleFiring, unknown: true},
+		{express: "[math:9001] || [math:9002]", a: staleResolved, b: staleResolved, unknown: true},
+		{express: "[math:9001] && !([math:9002])", a: firing, b: staleResolved, unknown: true},
+		{express: "[math:9001] && !([math:9002])", a: firing, b: resolved, firing: true},
+	}
+
+	var now = time.Now()
+	defer ruleStates.Delete("math:9001")
+	defer ruleStates.Delete("math:9002")
+
+	for _, c := range cases {
+		var data = &apiModel.CompositeRule{Name: "composite", Express: c.express}
+		plan, err := compileComposite(data)
+		if err != nil {
+			t.Fatalf("compile %s error: %s", c.express, err.Error())
+		}
+		var calculate = &compositeRuleCalculate{Params: data, plan: plan}
+
+		setState("math:9001", c.a, now)
+		setState("math:9002", c.b, now)
+
+		groups := calculate.groups(now)
+		if len(groups) != 1 {
+			t.Fatalf("%s: got %d groups, want 1", c.express, len(groups))
+		}
+
+		got, err := calculate.evaluate(groups[0])
+		if c.unknown {
+			if err == nil {
+				t.Errorf("%s (%d, %d) = %t, want unknown", c.express, c.a, c.b, got)
+			}
+			continue
+		}
+		if err != nil || got != c.firing {
+			t.Errorf("%s (%d, %d) = %t %v, want %t", c.express, c.a, c.b, got, err, c.firing)
+		}
+	}
+}
+
+func TestCompositeMatchOn(t *testing.T) {
+	var now = time.Now()
+	defer ruleStates.Delete("math:9003")
+	defer ruleStates.Delete("logger:9004")
+
+	ruleStates.Delete("math:9003")
+	ruleStates.Set("math:9003", "host=a", &ruleState{Name: "cpu", Firing: true, Tags: map[string]string{"host": "a"}, ExpiresAt: now.Add(time.Minute)})
+	ruleStates.Set("math:9003", "host=b", &ruleState{Name: "cpu", Firing: true, Tags: map[string]string{"host": "b"}, ExpiresAt: now.Add(-time.Minute)})
+	ruleStates.Delete("logger:9004")
+	ruleStates.Set("logger:9004", "", &ruleState{Name: "log", Firing: true, Labels: map[string]string{"host": "a"}, ExpiresAt: now.Add(time.Minute)})
+
+	var data = &apiModel.CompositeRule{Name: "composite", Express: "[math:9003] && [logger:9004]", MatchOn: []string{"host"}}
+	plan, err := compileComposite(data)
+	if err != nil {
+		t.Fatalf("compile error: %s", err.Error())
+	}
+	var calculate = &compositeRuleCalculate{Params: data, plan: plan}
+
+	var results = make(map[string]bool)
+	for _, group := range calculate.groups(now) {
+		firing, err := calculate.evaluate(group)
+		results[group.Key] = err == nil && firing
+	}
+	// host=b 的序列已过期, 且 logger 规则在该分组中无状态(为假), AND 的结果确定为假
+	if len(results) != 2 || !results["host=a"] || results["host=b"] {
+		t.Errorf("groups = %v, want host=a firing only", results)
+	}
+}
+
+func TestRuleStateRetain(t *testing.T) {
+	var ref = "math:9005"
+	defer ruleStates.Delete(ref)
+
+	ruleStates.Set(ref, "host=a", &ruleState{Firing: true})
+	ruleStates.Set(ref, "host=b", &ruleState{Firing: true})
+	ruleStates.Retain(ref, map[string]bool{"host=a": true})
+
+	states := ruleStates.Get(ref)
+	if _, ok := states["host=b"]; ok || len(states) != 1 {
+		t.Errorf("states after retain = %v, want only host=a", states)
+	}
+}
+
+func TestStateExpiry(t *testing.T) {
+	var now = time.Date(2024, 1, 1, 10, 0, 30, 0, time.UTC)
+	if got := stateExpiry("CRON_TZ=UTC */5 * * * *", now); !got.Equal(time.Date(2024, 1, 1, 10, 11, 0, 0, time.UTC)) {
+		t.Errorf("stateExpiry = %s, want the second next run plus grace", got)
+	}
+	if got := stateExpiry("bad", now); !got.IsZero() {
+		t.Errorf("stateExpiry(bad) = %s, want zero", got)
+	}
+	if (&ruleState{}).Stale(now) {
+		t.Errorf("state without expiry should never be stale")
+	}
+}
@@ -0,0 +1,102 @@
+package calculate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/config"
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/lib/stats"
+	"owl-engine/pkg/model/apiModel"
+)
+
+// 默认的数据源, 规则未指定 datasource 时使用
+const defaultDatasource = "influxdb"
+
+// Datasource 规则的数据源, 以 datasource 注册到 datasources 中
+// 数据源负责将各因子编译为查询, 查询结果统一为 influxDto.Series, 之后的计算、判定及告警流程与数据源无关
+type Datasource interface {
+	// Name 数据源的名称, 如: influxdb
+	Name() string
+	// Validate 数据源相关的规则校验
+	Validate(data *apiModel.MathRule) error
+	// Compile 编译因子的查询, 编译执行计划时使用
+	Compile(plan *Plan, data *apiModel.MathRule, factor string, options QueryOptions) (FactorQuery, error)
+}
+
+// FactorQuery 编译后的因子查询, 每次执行时只需指定时间范围
+type FactorQuery interface {
+	// Query 查询时间范围 [start, stop) 内的序列, 返回执行的查询语句
+	Query(ctx context.Context, start, stop time.Time, conf *config.ServerRunOptions) (string, []influxDto.Series, error)
+}
+
+// 已注册的数据源, key 为 datasource
+var datasources = make(map[string]Datasource)
+
+// RegisterDatasource 注册数据源, 同一个 datasource 不能重复注册
+func RegisterDatasource(datasource Datasource) {
+	if _, ok := datasources[datasource.Name()]; ok {
+		panic(fmt.Sprintf("datasource %s has been registered", datasource.Name()))
+	}
+	datasources[datasource.Name()] = datasource
+}
+
+// GetDatasource 获取规则的数据源, 为空时使用默认的数据源
+func GetDatasource(name string) (Datasource, error) {
+	if strings.Compare(name, "") == 0 {
+		name = defaultDatasource
+	}
+
+	if datasource, ok := datasources[strings.ToLower(name)]; ok {
+		return datasource, nil
+	}
+
+	var names = make([]string, 0, len(datasources))
+	for k := range datasources {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return nil, errors.New("the parameter datasource is set incorrectly. example: " + strings.Join(names, ", "))
+}
+
+// 在客户端对序列的点进行聚合, 用于不支持 InfluxQL 聚合查询的数据源; reduce 为空时返回原始的点
+// 聚合后只保留一个点, 时间戳为最后一个点的时间戳
+func reducePoints(reduce string, points []influxDto.Point) []influxDto.Point {
+	if strings.Compare(reduce, "") == 0 {
+		return points
+	}
+
+	var value float64
+	var values = influxDto.Values(points)
+	switch reduce {
+	case "count":
+		value = float64(len(values))
+	case "max", "min":
+		if len(values) == 0 {
+			return points
+		}
+		value = values[0]
+		for _, v := range values[1:] {
+			if (reduce == "max" && v > value) || (reduce == "min" && v < value) {
+				value = v
+			}
+		}
+	case "mean":
+		if len(values) == 0 {
+			return points
+		}
+		value = stats.Mean(values)
+	default:
+		return points
+	}
+
+	var ts time.Time
+	if len(points) > 0 {
+		ts = points[len(points)-1].Time
+	}
+	return []influxDto.Point{{Time: ts, Value: value}}
+}
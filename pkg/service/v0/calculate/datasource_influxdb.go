@@ -0,0 +1,212 @@
+package calculate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dsClient "owl-engine/pkg/client/datasource"
+	influxInit "owl-engine/pkg/client/influxdb"
+	"owl-engine/pkg/config"
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/lib/flux"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/util"
+)
+
+func init() {
+	RegisterDatasource(&influxDatasource{})
+}
+
+// InfluxDB 数据源: 以 metric_list 的值作为 measurement, 按 category、origin、type 及标签过滤条件查询
+// 配置的 version 为 2 时, 以 Flux 查询 InfluxDB 2.x, 否则以 InfluxQL 查询 InfluxDB 1.x
+type influxDatasource struct{}
+
+func (d *influxDatasource) Name() string {
+	return "influxdb"
+}
+
+func (d *influxDatasource) Validate(data *apiModel.MathRule) error {
+	return nil
+}
+
+func (d *influxDatasource) Compile(plan *Plan, data *apiModel.MathRule, factor string, options QueryOptions) (FactorQuery, error) {
+	// 引用数据源时, 数据源的版本可能变更, 同时编译 InfluxQL 及 Flux 的查询, 查询时依据数据源的版本选择
+	if data.DatasourceId > 0 {
+		ql, err := compileInfluxQL(plan, data, factor, options)
+		if err != nil {
+			return nil, err
+		}
+		fq, err := compileFlux(plan, data, factor, options, "")
+		if err != nil {
+			return nil, err
+		}
+		return sourceQuery{Id: data.DatasourceId, InfluxQL: ql, Flux: fq}, nil
+	}
+
+	// InfluxDB 2.x 以 Flux 查询
+	if conf := config.Get(); conf != nil && conf.InfluxDBOptions != nil && conf.InfluxDBOptions.Version == 2 {
+		return compileFlux(plan, data, factor, options, conf.InfluxDBOptions.FluxBucket())
+	}
+
+	return compileInfluxQL(plan, data, factor, options)
+}
+
+// 编译 InfluxDB 1.x 的 InfluxQL 查询
+func compileInfluxQL(plan *Plan, data *apiModel.MathRule, factor string, options QueryOptions) (queryTemplate, error) {
+	// 查询的基础条件, 标签过滤条件编译为转义后的 InfluxQL
+	where, err := influxDto.Where(data.Category, data.Origin, data.Type, data.Filters)
+	if err != nil {
+		return queryTemplate{}, errors.New("filters are incorrect: " + err.Error())
+	}
+
+	return queryTemplate{
+		Head: fmt.Sprintf("SELECT %s FROM %s WHERE %s AND ", options.Selector, influxDto.QuoteIdent(data.MetricList[factor]), where),
+		Tail: options.GroupBy + tzClause(plan.Timezone),
+	}, nil
+}
+
+// 查询语句模板, 每次执行时只需填充时间范围
+type queryTemplate struct {
+	Head string // 时间范围之前的部分
+	Tail string // 时间范围之后的部分
+}
+
+// 填充时间范围 [start, stop) 生成查询语句
+func (q queryTemplate) Build(start, stop string) string {
+	return q.Head + fmt.Sprintf("time >= '%s' AND time < '%s'", start, stop) + q.Tail
+}
+
+// 时间范围以规则的时区格式化, 与查询的 TZ() 子句保持一致
+func (q queryTemplate) Query(ctx context.Context, start, stop time.Time, conf *config.ServerRunOptions) (string, []influxDto.Series, error) {
+	cmd := q.Build(util.DateTimeToString(start), util.DateTimeToString(stop))
+
+	series, err := influxDto.QueryCache.Query(ctx, cmd, conf.InfluxDBOptions.Database, conf.InfluxDBOptions.RetentionPolicy,
+		10, *influxInit.InfluxDBClient)
+	return cmd, series, err
+}
+
+// 编译 InfluxDB 2.x 的 Flux 查询, 与 InfluxQL 的查询一一对应:
+// 聚合值 --> max()、min()、mean()、count(); GROUP BY time(interval) fill(...) --> aggregateWindow() 及 fill()
+// GROUP BY 标签 --> group(columns: [...]); 未分组时将所有序列合并为一个序列
+func compileFlux(plan *Plan, data *apiModel.MathRule, factor string, options QueryOptions, bucket string) (fluxTemplate, error) {
+	where, err := influxDto.FluxWhere(data.MetricList[factor], data.Category, data.Origin, data.Type, data.Filters)
+	if err != nil {
+		return fluxTemplate{}, errors.New("filters are incorrect: " + err.Error())
+	}
+
+	var imports = make([]string, 0)
+	var pipes = []string{"filter(fn: (r) => " + where + ")"}
+
+	// _start 及 _stop 在同一次查询中均相同, 保留在分组中使聚合后的点以 _start 为时间
+	var columns = []string{`"_start"`, `"_stop"`}
+	for _, tag := range data.GroupBy {
+		if !strings.HasPrefix(tag, "time(") {
+			columns = append(columns, flux.String(tag))
+		}
+	}
+	pipes = append(pipes, "group(columns: ["+strings.Join(columns, ", ")+"])")
+
+	switch {
+	case strings.Compare(options.Reduce, "") != 0:
+		pipes = append(pipes, options.Reduce+"()")
+	case strings.Compare(options.Interval, "") != 0:
+		// 时间窗口的分桶以规则的时区对齐, 与 InfluxQL 的 TZ() 子句保持一致
+		imports = append(imports, `import "timezone"`, "", "option location = timezone.location(name: "+flux.String(plan.Timezone)+")")
+
+		var fill string
+		switch options.Fill {
+		case "none", "null":
+			// 缺失的点不填充, null 的点在解析结果时忽略
+		case "previous":
+			fill = "fill(usePrevious: true)"
+		case "linear":
+			imports = append([]string{`import "interpolate"`}, imports...)
+			fill = "interpolate.linear(every: " + options.Interval + ")"
+		default:
+			fill = "fill(value: " + fluxFloat(options.Fill) + ")"
+		}
+
+		var createEmpty = options.Fill != "none" && options.Fill != "linear"
+		pipes = append(pipes, fmt.Sprintf("aggregateWindow(every: %s, fn: mean, createEmpty: %t)", options.Interval, createEmpty))
+		if strings.Compare(fill, "") != 0 {
+			pipes = append(pipes, fill)
+		}
+	}
+
+	var head = ""
+	if len(imports) > 0 {
+		head = strings.Join(imports, "\n") + "\n\n"
+	}
+
+	return fluxTemplate{
+		Bucket: bucket,
+		Head:   head,
+		Tail:   ")\n  |> " + strings.Join(pipes, "\n  |> "),
+	}, nil
+}
+
+// Flux 的浮点数常量必须包含小数点, 如: 0.0
+func fluxFloat(value string) string {
+	v, _ := strconv.ParseFloat(value, 64)
+	text := strconv.FormatFloat(v, 'f', -1, 64)
+	if !strings.Contains(text, ".") {
+		text += ".0"
+	}
+	return text
+}
+
+// Flux 查询模板, 每次执行时只需填充 range() 的时间范围
+type fluxTemplate struct {
+	Bucket string // 查询的 bucket, 引用数据源时在查询时指定
+	Head   string // from() 之前的部分, 如: import 及 option
+	Tail   string // range() 的参数之后的部分
+}
+
+// 填充时间范围 [start, stop) 生成查询语句, 时间精确到秒并以 UTC 格式化, 与 InfluxQL 的查询保持一致, 便于缓存
+func (q fluxTemplate) Build(start, stop time.Time) string {
+	return q.Head + "from(bucket: " + flux.String(q.Bucket) + ")\n  |> range(" +
+		fmt.Sprintf("start: %s, stop: %s", start.UTC().Format(time.RFC3339), stop.UTC().Format(time.RFC3339)) + q.Tail
+}
+
+func (q fluxTemplate) Query(ctx context.Context, start, stop time.Time, conf *config.ServerRunOptions) (string, []influxDto.Series, error) {
+	cmd := q.Build(start, stop)
+
+	series, err := influxDto.QueryCache.QueryFlux(ctx, cmd, q.Bucket, influxInit.FluxClient)
+	return cmd, series, err
+}
+
+// 引用数据源的查询, 依据数据源的版本以 InfluxQL 或 Flux 查询, 使用数据源的库、保留策略及 bucket
+type sourceQuery struct {
+	Id       uint // 数据源 ID
+	InfluxQL queryTemplate
+	Flux     fluxTemplate
+}
+
+func (q sourceQuery) Query(ctx context.Context, start, stop time.Time, conf *config.ServerRunOptions) (string, []influxDto.Series, error) {
+	conn, err := dsClient.Get(q.Id)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var source = "datasource:" + strconv.Itoa(int(q.Id))
+	switch {
+	case conn.Flux != nil:
+		var template = q.Flux
+		template.Bucket = conn.Bucket()
+		cmd := template.Build(start, stop)
+
+		series, err := influxDto.QueryCache.QueryFluxSource(ctx, source, cmd, template.Bucket, conn.Flux)
+		return cmd, series, err
+	case conn.Influx != nil:
+		cmd := q.InfluxQL.Build(util.DateTimeToString(start), util.DateTimeToString(stop))
+
+		series, err := influxDto.QueryCache.QuerySource(ctx, source, cmd, conn.Record.Database, conn.Record.RetentionPolicy, 10, conn.Influx)
+		return cmd, series, err
+	default:
+		return "", nil, fmt.Errorf("the datasource [%d] is not of type influxdb", q.Id)
+	}
+}
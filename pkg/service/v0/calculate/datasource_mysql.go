@@ -0,0 +1,87 @@
+package calculate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/config"
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/dao/mysql/metric"
+	"owl-engine/pkg/lib/labels"
+	"owl-engine/pkg/model/apiModel"
+)
+
+func init() {
+	RegisterDatasource(&mysqlDatasource{})
+}
+
+// MySQL 数据源: 查询指标值表 engine_tbl_metric, 用于没有部署 InfluxDB 的小规模环境
+// metric_list 的值为指标名, 标签存储在 extension 列中, 标签过滤条件及 group_by 均以 extension 中的标签计算
+type mysqlDatasource struct{}
+
+func (d *mysqlDatasource) Name() string {
+	return "mysql"
+}
+
+func (d *mysqlDatasource) Validate(data *apiModel.MathRule) error {
+	for _, tag := range data.GroupBy {
+		if strings.HasPrefix(tag, "time(") {
+			return errors.New("datasource mysql does not support time() in group_by, please use interval")
+		}
+		// 分组的标签拼接在 extension 列的 json 路径中
+		if err := labels.ValidateName(tag); err != nil {
+			return errors.New("group_by: " + err.Error())
+		}
+	}
+
+	// 分桶后缺失的点不填充
+	switch strings.ToLower(data.Fill) {
+	case "", "none", "null":
+	default:
+		return errors.New("datasource mysql only supports fill none or null")
+	}
+
+	return nil
+}
+
+func (d *mysqlDatasource) Compile(plan *Plan, data *apiModel.MathRule, factor string, options QueryOptions) (FactorQuery, error) {
+	var query = metricQuery{
+		Metric:    data.MetricList[factor],
+		Origin:    data.Origin,
+		Type:      data.Type,
+		Category:  data.Category,
+		Filters:   data.Filters,
+		GroupBy:   data.GroupBy,
+		Aggregate: options.Reduce,
+	}
+
+	if strings.Compare(options.Reduce, "") == 0 && strings.Compare(options.Interval, "") != 0 {
+		var err error
+		if query.Interval, err = time.ParseDuration(options.Interval); err != nil || query.Interval < time.Second {
+			return nil, errors.New("incorrect value written in interval, example: 1m")
+		}
+	}
+
+	// 校验查询语句能否生成, 如: 过滤条件中的正则表达式
+	if _, _, err := query.build(time.Time{}, time.Time{}).Build(); err != nil {
+		return nil, errors.New("filters are incorrect: " + err.Error())
+	}
+
+	return query, nil
+}
+
+// 编译后的指标值表查询
+type metricQuery metric.Query
+
+// 填充时间范围 [start, stop)
+func (q *metricQuery) build(start, stop time.Time) *metric.Query {
+	var query = metric.Query(*q)
+	query.Start, query.Stop = start, stop
+	return &query
+}
+
+func (q metricQuery) Query(ctx context.Context, start, stop time.Time, conf *config.ServerRunOptions) (string, []influxDto.Series, error) {
+	return metric.MetricDto.Query(ctx, q.build(start, stop))
+}
@@ -0,0 +1,159 @@
+package calculate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	dsClient "owl-engine/pkg/client/datasource"
+	promInit "owl-engine/pkg/client/prometheus"
+	"owl-engine/pkg/config"
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/lib/prometheus"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/util"
+)
+
+// range 查询默认的步长
+const defaultPrometheusStep = time.Minute
+
+func init() {
+	RegisterDatasource(&prometheusDatasource{})
+}
+
+// Prometheus 数据源: metric_list 的值为 PromQL 表达式, 标签的过滤及聚合在 PromQL 中完成
+// 因子的时间窗口起止相同时(如: ["0m", "0m"])为 instant 查询, 否则为 range 查询, 步长为规则的 interval, 默认为 1m
+// 计算类型需要聚合值时, 在查询后对 range 查询的点进行聚合(max、min、mean、count)
+type prometheusDatasource struct{}
+
+func (d *prometheusDatasource) Name() string {
+	return "prometheus"
+}
+
+func (d *prometheusDatasource) Validate(data *apiModel.MathRule) error {
+	if strings.Compare(strings.TrimSpace(data.ExtensionCondition), "") != 0 ||
+		(data.Filters != nil && (len(data.Filters.Conditions) > 0 || len(data.Filters.Groups) > 0)) {
+		return errors.New("datasource prometheus does not support filters or extension_condition, please use label matchers in PromQL")
+	}
+
+	for _, tag := range data.GroupBy {
+		if strings.HasPrefix(tag, "time(") {
+			return errors.New("datasource prometheus does not support time() in group_by, please use interval as the step")
+		}
+	}
+
+	for factor, query := range data.MetricList {
+		if strings.Compare(strings.TrimSpace(query), "") == 0 {
+			return fmt.Errorf("the PromQL of factor [%s] cannot be empty", factor)
+		}
+	}
+
+	return nil
+}
+
+func (d *prometheusDatasource) Compile(plan *Plan, data *apiModel.MathRule, factor string, options QueryOptions) (FactorQuery, error) {
+	var step = defaultPrometheusStep
+	if strings.Compare(data.Interval, "") != 0 {
+		var err error
+		if step, err = time.ParseDuration(data.Interval); err != nil || step <= 0 {
+			return nil, errors.New("incorrect value written in interval, example: 1m")
+		}
+	}
+
+	return promQuery{
+		Id:      data.DatasourceId,
+		Expr:    data.MetricList[factor],
+		Step:    step,
+		Reduce:  options.Reduce,
+		GroupBy: data.GroupBy,
+	}, nil
+}
+
+// 编译后的 PromQL 查询
+type promQuery struct {
+	Id      uint          // 引用的数据源 ID, 0 表示使用配置文件中的 Prometheus
+	Expr    string        // PromQL 表达式
+	Step    time.Duration // range 查询的步长
+	Reduce  string        // 对时间窗口内的点的聚合方式, 为空时使用原始的点
+	GroupBy []string      // 分组的标签, 序列只保留这些标签; 为空时保留除 __name__ 以外的所有标签
+}
+
+func (q promQuery) Query(ctx context.Context, start, stop time.Time, conf *config.ServerRunOptions) (string, []influxDto.Series, error) {
+	var cli = promInit.PrometheusClient
+	if q.Id > 0 {
+		conn, err := dsClient.Get(q.Id)
+		if err != nil {
+			return q.Expr, nil, err
+		}
+		if cli = conn.Prometheus; cli == nil {
+			return q.Expr, nil, fmt.Errorf("the datasource [%d] is not of type prometheus", q.Id)
+		}
+	}
+	if cli == nil {
+		return q.Expr, nil, errors.New("the prometheus client is not initialized")
+	}
+
+	var cmd string
+	var result []prometheus.Series
+	var err error
+	if start.Equal(stop) {
+		cmd = fmt.Sprintf("%s @ %s", q.Expr, util.DateTimeToString(stop))
+		result, err = cli.Query(ctx, q.Expr, stop)
+	} else {
+		// range 查询包含结束时间, 以 stop 前一个步长作为结束时间, 与 [start, stop) 保持一致
+		end := stop.Add(-q.Step)
+		if end.Before(start) {
+			end = start
+		}
+		cmd = fmt.Sprintf("%s [%s, %s] step %s", q.Expr, util.DateTimeToString(start), util.DateTimeToString(end), q.Step)
+		result, err = cli.QueryRange(ctx, q.Expr, start, end, q.Step)
+	}
+	if err != nil {
+		return cmd, nil, err
+	}
+
+	return cmd, q.series(result, start.Location()), nil
+}
+
+// 将 Prometheus 的序列转换为按 group_by 标签分组的序列, 分组后标签相同的序列合并其点
+func (q promQuery) series(result []prometheus.Series, loc *time.Location) []influxDto.Series {
+	var merged = make(map[string]*influxDto.Series)
+	var keys = make([]string, 0)
+	for _, s := range result {
+		var tags = make(map[string]string)
+		if len(q.GroupBy) > 0 {
+			for _, name := range q.GroupBy {
+				tags[name] = s.Labels[name]
+			}
+		} else {
+			for name, value := range s.Labels {
+				if strings.Compare(name, "__name__") != 0 {
+					tags[name] = value
+				}
+			}
+		}
+
+		var series = influxDto.Series{Tags: tags}
+		key := series.Key()
+		if _, ok := merged[key]; !ok {
+			merged[key] = &influxDto.Series{Tags: tags, Points: make([]influxDto.Point, 0, len(s.Points))}
+			keys = append(keys, key)
+		}
+		for _, p := range s.Points {
+			merged[key].Points = append(merged[key].Points, influxDto.Point{Time: p.Time.In(loc), Value: p.Value})
+		}
+	}
+
+	var series = make([]influxDto.Series, 0, len(keys))
+	for _, key := range keys {
+		var s = merged[key]
+		sort.SliceStable(s.Points, func(i, j int) bool { return s.Points[i].Time.Before(s.Points[j].Time) })
+		s.Points = reducePoints(q.Reduce, s.Points)
+		series = append(series, *s)
+	}
+
+	return series
+}
@@ -0,0 +1,117 @@
+package calculate
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/config"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/util"
+)
+
+// Evaluate 以真实的数据源立即计算一次规则, 返回执行的查询语句、查询得到的序列及各序列的判定结果
+// 试运行不记录规则的计算状态, 也不写入告警记录及发送通知
+func Evaluate(ctx context.Context, data *apiModel.MathRule) (*apiModel.EvaluateResult, error) {
+	plan, err := compilePlan(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := plan.Aggregator.Validate(data); err != nil {
+		return nil, err
+	}
+
+	var conf = config.Get()
+	ctx, cancel := context.WithTimeout(ctx, conf.ServerOptions.Deadline())
+	defer cancel()
+
+	var r = &mathRuleCalculate{Params: data, plan: plan, ctx: ctx}
+	var now = time.Now().In(plan.Location)
+
+	factorSeries, queries, err := r.fetch(ctx, now, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = &apiModel.EvaluateResult{
+		Time:    util.DateTimeToString(now),
+		Queries: queries,
+		Values:  make(map[string][]apiModel.SeriesData, len(factorSeries)),
+		Series:  make([]apiModel.EvaluateSeries, 0),
+	}
+
+	for factor, series := range factorSeries {
+		var values = make([]apiModel.SeriesData, 0, len(series))
+		for _, s := range series {
+			var points = make([]apiModel.PointData, 0, len(s.Points))
+			for _, point := range s.Points {
+				points = append(points, apiModel.PointData{Time: util.DateTimeToString(point.Time.In(plan.Location)), Value: point.Value})
+			}
+			values = append(values, apiModel.SeriesData{Key: s.Key(), Tags: s.Tags, Points: points})
+		}
+		result.Values[factor] = values
+	}
+
+	_, evaluations, empty, err := r.judge(ctx, now, data, conf, factorSeries)
+	if err != nil {
+		return nil, err
+	}
+	if strings.Compare(empty, "") != 0 {
+		result.NoData = empty
+		return result, nil
+	}
+
+	for _, evaluation := range evaluations {
+		var series = apiModel.EvaluateSeries{
+			Key:    evaluation.Key,
+			Tags:   evaluation.Tags,
+			Values: evaluation.Params,
+			Firing: evaluation.Firing,
+			Level:  evaluation.Level,
+			Detail: evaluation.Detail,
+		}
+		if value, ok := r.value(evaluation.Params); ok {
+			series.Value = value
+		}
+		if v, err := calculate(plan.Expression, evaluation.Params); err == nil {
+			series.Result = v
+		}
+
+		result.Series = append(result.Series, series)
+		result.Alert = result.Alert || evaluation.Firing
+	}
+
+	return result, nil
+}
+
+// EvaluateLogger 以真实的日志数据源立即计算一次日志规则, 不记录计算状态, 也不写入告警记录及发送通知
+func EvaluateLogger(ctx context.Context, data *apiModel.LoggerRule) (*apiModel.LoggerEvaluateResult, error) {
+	var conf = config.Get()
+	ctx, cancel := context.WithTimeout(ctx, conf.ServerOptions.Deadline())
+	defer cancel()
+
+	var l = &loggerRuleCalculate{Params: data}
+	var now = time.Now()
+
+	query, err := l.query()
+	if err != nil {
+		return nil, err
+	}
+
+	count, messages, err := l.search(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiModel.LoggerEvaluateResult{
+		Time:      util.DateTimeToString(now),
+		Source:    data.Source,
+		Index:     data.Index,
+		Query:     query,
+		Count:     count,
+		Threshold: data.Threshold,
+		Alert:     count >= data.Threshold,
+		Messages:  messages,
+	}, nil
+}
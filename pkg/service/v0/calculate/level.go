@@ -0,0 +1,129 @@
+package calculate
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"owl-engine/pkg/lib/express"
+	"owl-engine/pkg/model/apiModel"
+
+	"github.com/Knetic/govaluate"
+)
+
+// 多级阈值中的一级, 按告警级别从高到低排列
+type levelTier struct {
+	Level      int8
+	Express    string // 该级别的表达式, 用于告警内容的说明
+	Expression *govaluate.EvaluableExpression
+}
+
+// 告警级别的名称
+func levelName(level int8) string {
+	switch level {
+	case 1:
+		return "Information"
+	case 2:
+		return "Warning"
+	case 3:
+		return "Critical"
+	case 4:
+		return "Disaster"
+	default:
+		return "Not classified"
+	}
+}
+
+// 编译多级阈值, 规则的表达式及告警级别作为第一级; 未配置时返回 nil
+// 多级阈值以各序列的因子值逐级计算, 只支持聚合值的计算类型, 且不能与动态基线同时使用
+func compileLevels(aggregator Aggregator, data *apiModel.MathRule, plan *Plan) ([]levelTier, error) {
+	if len(data.Levels) == 0 {
+		return nil, nil
+	}
+
+	if _, ok := aggregator.(*valueAggregator); !ok {
+		return nil, errors.New("levels is only supported for the calculate_type of aggregated value, example: 1 -- max")
+	}
+
+	if plan.Baseline != nil {
+		return nil, errors.New("levels and baseline cannot be used at the same time")
+	}
+
+	var tiers = []levelTier{{Level: data.Level, Express: data.Express, Expression: plan.Expression}}
+	var seen = map[int8]bool{data.Level: true}
+
+	for _, tier := range data.Levels {
+		if tier.Level < 0 || tier.Level > 4 {
+			return nil, errors.New("the level of levels must be between 0 and 4")
+		}
+		if seen[tier.Level] {
+			return nil, fmt.Errorf("the level %d is duplicated in levels", tier.Level)
+		}
+		seen[tier.Level] = true
+
+		var text = strings.TrimSpace(tier.Express)
+		switch {
+		case strings.Compare(text, "") != 0 && tier.Threshold != nil:
+			return nil, errors.New("only one of express and threshold can be set for each level")
+		case tier.Threshold != nil:
+			// 以规则表达式的比较符与阈值组成该级别的表达式
+			if plan.Compound || plan.Value == nil || strings.Compare(express.Comparator(data.Express), "") == 0 {
+				return nil, errors.New("threshold of levels requires the express to be a comparison, example: [A] > 80")
+			}
+			text = fmt.Sprintf("%s %s %v", express.LeftOperand(data.Express), express.Comparator(data.Express), *tier.Threshold)
+		case strings.Compare(text, "") == 0:
+			return nil, errors.New("either express or threshold must be set for each level")
+		}
+
+		// 只能使用规则表达式中的因子
+		for _, k := range factorRegexp.FindAllStringSubmatch(text, -1) {
+			if _, ok := plan.Queries[k[1]]; !ok {
+				return nil, fmt.Errorf("factor [%s] of level %d is not in the express", k[1], tier.Level)
+			}
+		}
+
+		expression, err := express.New(text)
+		if err != nil {
+			return nil, fmt.Errorf("express {%s} of level %d is incorrect: %s", text, tier.Level, err.Error())
+		}
+
+		if result, err := sampleEvaluate(expression, plan.Factors); err != nil {
+			return nil, fmt.Errorf("express {%s} of level %d is incorrect: %s", text, tier.Level, err.Error())
+		} else if _, ok := result.(bool); !ok {
+			return nil, fmt.Errorf("the result of express {%s} of level %d must be boolean", text, tier.Level)
+		}
+
+		tiers = append(tiers, levelTier{Level: tier.Level, Express: text, Expression: expression})
+	}
+
+	sort.Slice(tiers, func(i, j int) bool {
+		return tiers[i].Level > tiers[j].Level
+	})
+
+	return tiers, nil
+}
+
+// 以多级阈值重新判定各序列, 命中的最高级别为序列的告警级别, 都未命中时不触发告警
+func applyLevels(tiers []levelTier, evaluations []Evaluation) []Evaluation {
+	for i := range evaluations {
+		var evaluation = &evaluations[i]
+		evaluation.Firing = false
+
+		for _, tier := range tiers {
+			result, err := calculate(tier.Expression, evaluation.Params)
+			if err != nil {
+				continue
+			}
+
+			if firing, ok := result.(bool); ok && firing {
+				evaluation.Firing = true
+				evaluation.Level = tier.Level
+				evaluation.Detail = fmt.Sprintf("命中级别 %s: %s", levelName(tier.Level), tier.Express)
+				break
+			}
+		}
+	}
+
+	return evaluations
+}
@@ -15,9 +15,11 @@ import (
 	"text/template"
 	"time"
 
+	dsClient "owl-engine/pkg/client/datasource"
 	appConfig "owl-engine/pkg/config"
 	"owl-engine/pkg/dao/mysql/event"
 	"owl-engine/pkg/lib/job"
+	"owl-engine/pkg/lib/labels"
 	"owl-engine/pkg/model/apiModel"
 	"owl-engine/pkg/model/dbModel"
 	"owl-engine/pkg/util"
@@ -57,42 +59,12 @@ func Logger(stopCh <-chan struct{}, wg *sync.WaitGroup) {
 
 	if len(*records) > 0 {
 		for _, v := range *records {
-			groups := make([]int, 0)
-			for _, group := range strings.Split(v.GroupIp, ",") {
-				groups = append(groups, util.StringToInt(group))
-			}
-
 			calculate := new(loggerRuleCalculate)
-			calculate.Params = &apiModel.LoggerRule{
-				Id:                v.ID,
-				Name:              v.Name,
-				Source:            v.Source,
-				Address:           v.Address,
-				Username:          v.Username,
-				Password:          v.Password,
-				Index:             v.Index,
-				MessageField:      v.MessageField,
-				Sql:               v.Sql,
-				Threshold:         v.Threshold,
-				Origin:            v.Origin,
-				BusinessType:      v.BusinessType,
-				Category:          v.Category,
-				Level:             v.Level,
-				Creator:           v.Creator,
-				Updater:           v.Updater,
-				ResponsiblePeople: v.ResponsiblePeople,
-				Crontab:           v.Crontab,
-				Switch:            v.Switch,
-				Inuse:             v.Inuse,
-				GroupId:           groups,
-				Description:       v.Description,
-				CreatedAt:         util.DateTimeToString(v.CreatedAt),
-				UpdatedAt:         util.DateTimeToString(v.UpdatedAt),
-			}
+			calculate.Params = LoggerRule(&v)
 
 			// 添加到定时任务
 			id := uuid.NewV4().String()
-			if err := cronTab.AddByID(id, v.Crontab, calculate); err == nil {
+			if err := cronTab.AddByID(id, job.WithTimezone(v.Crontab, appConfig.Get().ServerOptions.Timezone), calculate); err == nil {
 				LoggerTaskQueue[v.Name] = id
 			} else {
 				jsonStr, _ := json.Marshal(v)
@@ -141,115 +113,241 @@ func Logger(stopCh <-chan struct{}, wg *sync.WaitGroup) {
 //		更不容易发现的问题是,如果response.body的内容没有被ioutil.ReadAll正确读出来, 也会造成socket链接泄露,后续的服务无法使用。
 //		这里, response.body 是一个io.ReadCloser类型的接口， 包含了read和close接口。
 func (l *loggerRuleCalculate) Run() {
+	params := l.Params
+
+	count, messages, err := l.search(context.Background())
+	if err != nil {
+		xlogs.Error(fmt.Sprintf("logger rule name = {%s} %s", params.Name, err.Error()))
+		return
+	}
+
+	ruleStates.Set(ruleRef(RefLogger, params.Id), "", &ruleState{
+		Name:      params.Name,
+		Origin:    params.Origin,
+		Firing:    count >= params.Threshold,
+		Labels:    alertLabels(params.Name, params.Labels, nil),
+		ExpiresAt: stateExpiry(job.WithTimezone(params.Crontab, appConfig.Get().ServerOptions.Timezone), time.Now()),
+	})
+
+	if count >= params.Threshold { // 触发告警
+		message := strings.Replace(strings.Trim(fmt.Sprint(messages), "[]"), " ", " ", -1)
+		l.warning(count, message, params)
+	}
+}
+
+// 查询日志数据源, 返回命中的日志条数及命中日志的告警内容字段
+func (l *loggerRuleCalculate) search(ctx context.Context) (float64, []string, error) {
 	switch l.Params.Source {
 	case "es":
-		params := l.Params
-
-		conf := appConfig.Get()
-		// 测试环境使用代理
-		var config elasticsearch.Config
-		if conf.ServerOptions.EnableProxy && strings.Compare(conf.ServerOptions.Proxy, "") != 0 {
-			proxyUrl, _ := url.Parse(conf.ServerOptions.Proxy)
-			config = elasticsearch.Config{
-				Addresses:  strings.Split(params.Address, ","),
-				Username:   params.Username,
-				Password:   params.Password,
-				MaxRetries: 3,
-				Transport: &http.Transport{
-					MaxIdleConnsPerHost:   10,
-					ResponseHeaderTimeout: 5 * time.Second,
-					DialContext: (&net.Dialer{
-						Timeout: 5 * time.Second,
-					}).DialContext,
-					Proxy:             http.ProxyURL(proxyUrl),
-					TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS11},
-					DisableKeepAlives: true, // 使用短链接进行请求, 注意: http 的 keepalive 和 tcp 的 keepalive 的区别
-				},
-			}
-		} else {
-			config = elasticsearch.Config{
-				Addresses:  strings.Split(params.Address, ","),
-				Username:   params.Username,
-				Password:   params.Password,
-				MaxRetries: 3,
-				Transport: &http.Transport{
-					MaxIdleConnsPerHost:   10,
-					ResponseHeaderTimeout: 5 * time.Second,
-					DialContext: (&net.Dialer{
-						Timeout: 5 * time.Second,
-					}).DialContext,
-					TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS11},
-					DisableKeepAlives: true, // 使用短链接进行请求, 注意: http 的 keepalive 和 tcp 的 keepalive 的区别
-				},
-			}
-		}
+		return l.searchES(ctx)
+	case "loki":
+		return l.searchLoki(ctx)
+	default:
+		return 0, nil, fmt.Errorf("not realize the calculation for %s", l.Params.Source)
+	}
+}
 
-		var err error
-		es, err := elasticsearch.NewClient(config)
-		if err == nil {
-			// 将 sql string 转换为 map[string]interface
-			var query map[string]interface{}
-			_ = json.Unmarshal([]byte(params.Sql), &query)
-
-			var buf bytes.Buffer
-			if err := json.NewEncoder(&buf).Encode(query); err == nil {
-				response, err := es.Search(es.Search.WithContext(context.Background()),
-					es.Search.WithIndex(params.Index),
-					es.Search.WithBody(&buf),
-					es.Search.WithTrackTotalHits(true),
-					es.Search.WithPretty())
-
-				// 注意！注意！注意！要及时关闭
-				defer response.Body.Close()
-
-				if err == nil {
-					var result map[string]interface{}
-					if err := json.NewDecoder(response.Body).Decode(&result); err == nil {
-						// 注意: 在填写 es sql 查询时, 需要经过校验, 通过后才会加载到定时任务; 避免因为语句错误导致返回结果中没有 .hits.total.value 不存在
-						count := result["hits"].(map[string]interface{})["total"].(map[string]interface{})["value"].(float64)
-						if count >= params.Threshold { // 触发告警
-							messages := make([]string, 0)
-							hits := result["hits"].(map[string]interface{})["hits"].([]interface{})
-							if len(hits) > 0 {
-								// 需要对于相似度较高的内容进行聚合
-								for _, hit := range hits {
-									messages = append(messages, "{"+hit.(map[string]interface{})["_source"].(map[string]interface{})[params.MessageField].(string)+"}")
-								}
-							}
-							message := strings.Replace(strings.Trim(fmt.Sprint(messages), "[]"), " ", " ", -1)
-							l.warning(count, message, params)
-						}
-					}
-				} else {
-					xlogs.Error(fmt.Sprintf("elasticsearch query sql: %s to response error: %s", params.Sql, err.Error()))
-				}
-			} else {
-				xlogs.Error(fmt.Sprintf("elasticsearch query sql: %s error: %s", params.Sql, err.Error()))
-			}
-		} else {
-			xlogs.Error(fmt.Sprintf("creating the elasticsearch client error: %s", err.Error()))
+// 规则实际执行的查询语句: es 为规范化后的查询体, loki 为统计命中条数的 LogQL
+func (l *loggerRuleCalculate) query() (string, error) {
+	params := l.Params
+
+	switch params.Source {
+	case "es":
+		// 将 sql string 转换为 map[string]interface
+		var query map[string]interface{}
+		_ = json.Unmarshal([]byte(params.Sql), &query)
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(query); err != nil {
+			return "", fmt.Errorf("elasticsearch query sql: %s error: %s", params.Sql, err.Error())
+		}
+		return strings.TrimSpace(buf.String()), nil
+	case "loki":
+		window, _, err := LokiWindow(params.TimeWindow)
+		if err != nil {
+			return "", err
 		}
+		return LokiCountQuery(params.Sql, window), nil
 	default:
-		xlogs.Errorf("not realize the calculation for %s", l.Params.Source)
+		return "", fmt.Errorf("not realize the calculation for %s", params.Source)
+	}
+}
+
+// 以规则的 es 查询语句查询命中的日志条数及日志内容
+func (l *loggerRuleCalculate) searchES(ctx context.Context) (float64, []string, error) {
+	params := l.Params
+
+	es, err := ESClient(params)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	query, err := l.query()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	response, err := es.Search(es.Search.WithContext(ctx),
+		es.Search.WithIndex(params.Index),
+		es.Search.WithBody(strings.NewReader(query)),
+		es.Search.WithTrackTotalHits(true),
+		es.Search.WithPretty())
+	if err != nil {
+		return 0, nil, fmt.Errorf("elasticsearch query sql: %s to response error: %s", params.Sql, err.Error())
+	}
+
+	// 注意！注意！注意！要及时关闭
+	defer response.Body.Close()
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return 0, nil, fmt.Errorf("elasticsearch query sql: %s decode response error: %s", params.Sql, err.Error())
+	}
+
+	// 注意: 在填写 es sql 查询时, 需要经过校验, 通过后才会加载到定时任务; 避免因为语句错误导致返回结果中没有 .hits.total.value 不存在
+	hits, _ := result["hits"].(map[string]interface{})
+	total, _ := hits["total"].(map[string]interface{})
+	count, ok := total["value"].(float64)
+	if !ok {
+		return 0, nil, fmt.Errorf("elasticsearch query sql: %s has no hits.total.value in response", params.Sql)
+	}
+
+	// 需要对于相似度较高的内容进行聚合
+	messages := make([]string, 0)
+	items, _ := hits["hits"].([]interface{})
+	for _, item := range items {
+		source, _ := item.(map[string]interface{})["_source"].(map[string]interface{})
+		if message, ok := source[params.MessageField].(string); ok {
+			messages = append(messages, "{"+message+"}")
+		}
+	}
+
+	return count, messages, nil
+}
+
+// ESClient 日志规则的 elasticsearch 客户端
+// 引用数据源时使用数据源的连接, 否则以规则中的连接地址及认证信息创建客户端
+func ESClient(params *apiModel.LoggerRule) (*elasticsearch.Client, error) {
+	if params.DatasourceId > 0 {
+		conn, err := dsClient.Get(params.DatasourceId)
+		if err != nil {
+			return nil, err
+		}
+		if conn.ES == nil {
+			return nil, fmt.Errorf("the datasource [%d] is not of type elasticsearch", params.DatasourceId)
+		}
+		return conn.ES, nil
+	}
+
+	conf := appConfig.Get()
+	// 测试环境使用代理
+	var config elasticsearch.Config
+	if conf.ServerOptions.EnableProxy && strings.Compare(conf.ServerOptions.Proxy, "") != 0 {
+		proxyUrl, _ := url.Parse(conf.ServerOptions.Proxy)
+		config = elasticsearch.Config{
+			Addresses:  strings.Split(params.Address, ","),
+			Username:   params.Username,
+			Password:   params.Password,
+			MaxRetries: 3,
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost:   10,
+				ResponseHeaderTimeout: 5 * time.Second,
+				DialContext: (&net.Dialer{
+					Timeout: 5 * time.Second,
+				}).DialContext,
+				Proxy:             http.ProxyURL(proxyUrl),
+				TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS11},
+				DisableKeepAlives: true, // 使用短链接进行请求, 注意: http 的 keepalive 和 tcp 的 keepalive 的区别
+			},
+		}
+	} else {
+		config = elasticsearch.Config{
+			Addresses:  strings.Split(params.Address, ","),
+			Username:   params.Username,
+			Password:   params.Password,
+			MaxRetries: 3,
+			Transport: &http.Transport{
+				MaxIdleConnsPerHost:   10,
+				ResponseHeaderTimeout: 5 * time.Second,
+				DialContext: (&net.Dialer{
+					Timeout: 5 * time.Second,
+				}).DialContext,
+				TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS11},
+				DisableKeepAlives: true, // 使用短链接进行请求, 注意: http 的 keepalive 和 tcp 的 keepalive 的区别
+			},
+		}
+	}
+
+	es, err := elasticsearch.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating the elasticsearch client error: %s", err.Error())
+	}
+
+	return es, nil
+}
+
+// LoggerRule 将日志规则的数据库记录转换为接口参数
+func LoggerRule(v *dbModel.LoggerRule) *apiModel.LoggerRule {
+	groups := make([]int, 0)
+	for _, group := range strings.Split(v.GroupIp, ",") {
+		groups = append(groups, util.StringToInt(group))
+	}
+
+	var ruleLabels map[string]string
+	_ = json.Unmarshal([]byte(v.Labels), &ruleLabels)
+
+	return &apiModel.LoggerRule{
+		Id:                v.ID,
+		Name:              v.Name,
+		Source:            v.Source,
+		Address:           v.Address,
+		Username:          v.Username,
+		Password:          v.Password,
+		DatasourceId:      v.DatasourceId,
+		Index:             v.Index,
+		MessageField:      v.MessageField,
+		Sql:               v.Sql,
+		TimeWindow:        v.TimeWindow,
+		Threshold:         v.Threshold,
+		Origin:            v.Origin,
+		BusinessType:      v.BusinessType,
+		Category:          v.Category,
+		Level:             v.Level,
+		Labels:            ruleLabels,
+		Creator:           v.Creator,
+		Updater:           v.Updater,
+		ResponsiblePeople: v.ResponsiblePeople,
+		Crontab:           v.Crontab,
+		Switch:            v.Switch,
+		Inuse:             v.Inuse,
+		GroupId:           groups,
+		Description:       v.Description,
+		CreatedAt:         util.DateTimeToString(v.CreatedAt),
+		UpdatedAt:         util.DateTimeToString(v.UpdatedAt),
 	}
 }
 
 // 监听规则变化
 func syncLogger(action string, record *apiModel.LoggerRule, cron *job.CronTab) {
+	// 规则变更后, 之前的计算状态不再有效
+	ruleStates.Delete(ruleRef(RefLogger, record.Id))
+
 	switch strings.ToLower(action) {
 	case "delete":
 		id := LoggerTaskQueue[record.Name]
-		cron.DelByID(id)
-		delete(MathTaskQueue, record.Name)
+		if strings.Compare(id, "") != 0 {
+			cron.DelByID(id)
+			delete(LoggerTaskQueue, record.Name)
 
-		xlogs.Infof("logger rule [name = %s] has been deleted", record.Name)
+			xlogs.Infof("logger rule [name = %s] has been deleted", record.Name)
+		}
 	case "update", "add":
-		id := MathTaskQueue[record.Name]
+		id := LoggerTaskQueue[record.Name]
 		if strings.Compare(id, "") != 0 {
 			cron.DelByID(id)
-			delete(MathTaskQueue, record.Name)
+			delete(LoggerTaskQueue, record.Name)
 
-			xlogs.Infof("rule [name = %s] has been deleted", record.Name)
+			xlogs.Infof("logger rule [name = %s] has been deleted", record.Name)
 		}
 
 		// 未被禁用且未被删除的规则记录, 执行定时任务
@@ -259,7 +357,7 @@ func syncLogger(action string, record *apiModel.LoggerRule, cron *job.CronTab) {
 			var calculate = new(loggerRuleCalculate)
 			calculate.Params = record // 参数传递
 
-			if err := cron.AddByID(id, record.Crontab, calculate); err == nil {
+			if err := cron.AddByID(id, job.WithTimezone(record.Crontab, appConfig.Get().ServerOptions.Timezone), calculate); err == nil {
 				LoggerTaskQueue[record.Name] = id
 			} else {
 				cron.Stop()
@@ -278,6 +376,9 @@ func (l *loggerRuleCalculate) warning(calValue float64, message string, data *ap
 	// 告警记录插入数据库
 	var content = fmt.Sprintf("规则名称 【%s】触发告警, 当前值为: %v, 阈值为: %v", data.Name, calValue, data.Threshold)
 
+	// 告警标签
+	var alertLabelSet = alertLabels(data.Name, data.Labels, nil)
+
 	// 转换业务域
 	var category string
 	switch data.Category {
@@ -300,6 +401,9 @@ func (l *loggerRuleCalculate) warning(calValue float64, message string, data *ap
 告警类型：{{ .Category }}
 业务域： {{ .Type }}
 告警源：{{ .Origin }}
+{{- if .Labels }}
+告警标签：{{ .Labels }}
+{{- end }}
 告警内容：{{ .Content }}
 告警详情: {{ .Message }}
 告警值：{{ .Value }}
@@ -307,24 +411,26 @@ func (l *loggerRuleCalculate) warning(calValue float64, message string, data *ap
 负责人：{{ .ResponsiblePeople }}
 `
 	var params = struct {
-		Name              string  `json:"name"`
-		Type              string  `json:"type"`
-		Category          string  `json:"category"`
-		Origin            string  `json:"origin"`
-		Content           string  `json:"content"`
-		Message           string  `json:"message"`
-		Value             float64 `json:"value"`
-		Datetime          string  `json:"datetime"`
-		ResponsiblePeople string  `json:"responsible_people"`
+		Name              string     `json:"name"`
+		Type              string     `json:"type"`
+		Category          string     `json:"category"`
+		Origin            string     `json:"origin"`
+		Labels            labels.Set `json:"labels"`
+		Content           string     `json:"content"`
+		Message           string     `json:"message"`
+		Value             float64    `json:"value"`
+		Datetime          string     `json:"datetime"`
+		ResponsiblePeople string     `json:"responsible_people"`
 	}{
 		Name:              data.Name,
 		Type:              data.BusinessType,
 		Category:          category,
 		Origin:            data.Origin,
+		Labels:            alertLabelSet,
 		Content:           content,
 		Message:           message,
 		Value:             calValue,
-		Datetime:          util.DateTimeToString(time.Now()),
+		Datetime:          util.DateTimeToString(time.Now().In(appConfig.Get().ServerOptions.Location())),
 		ResponsiblePeople: data.ResponsiblePeople,
 	}
 
@@ -339,10 +445,24 @@ func (l *loggerRuleCalculate) warning(calValue float64, message string, data *ap
 
 	alertId := uuid.NewV4().String()
 
+	// 被组合规则静默的规则, 告警记录为静默状态且不发送通知
+	var status int8 = 1
+	silenced := silences.Silenced(ruleRef(RefLogger, data.Id), alertLabelSet)
+
+	var labelStr string
+	if len(alertLabelSet) > 0 {
+		jsonLabels, _ := json.Marshal(alertLabelSet)
+		labelStr = string(jsonLabels)
+	}
+	if silenced {
+		status = 4
+	}
+
 	var record = dbModel.Alert{
 		AlertId:      alertId,
 		Name:         data.Name,
 		Item:         "",
+		Labels:       labelStr,
 		Origin:       data.Origin,
 		BusinessType: data.BusinessType,
 		Category:     data.Category,
@@ -352,8 +472,8 @@ func (l *loggerRuleCalculate) warning(calValue float64, message string, data *ap
 		RuleName:     data.Name,
 		GroupId:      strings.Replace(strings.Trim(fmt.Sprint(data.GroupId), "[]"), " ", ",", -1),
 		Owner:        data.ResponsiblePeople,
-		Status:       1, // 告警状态,1-告警中,2-恢复,3-忽略,4-静默
-		Platform:     1, // 告警平台,1-owl,2-zcat,3-prometheus,4-zms等
+		Status:       status, // 告警状态,1-告警中,2-恢复,3-忽略,4-静默
+		Platform:     1,      // 告警平台,1-owl,2-zcat,3-prometheus,4-zms等
 		AlertTime:    time.Now(),
 		PlatformName: "owl",
 		AggregatorId: 0,
@@ -385,12 +505,12 @@ func (l *loggerRuleCalculate) warning(calValue float64, message string, data *ap
 
 	// 发送 http post 到指定的 hook 地址
 	conf := appConfig.Get()
-	if len(conf.EventOptions.Hooks) > 0 {
+	if len(conf.EventOptions.Hooks) > 0 && !silenced {
 		for _, hook := range conf.EventOptions.Hooks {
 			if msg, err := Post(hook, alert); err == nil {
 				xlogs.Infof("post request to [%s] for alert id [%s] success, response result: [%v]", hook, alert.UUID, msg)
 			} else {
-				xlogs.Errorf("post data [%s] to %s fail, error message: %s", string(jsonStr), err.Error())
+				xlogs.Errorf("post data [%s] to %s fail, error message: %s", string(jsonStr), hook, err.Error())
 			}
 		}
 	}
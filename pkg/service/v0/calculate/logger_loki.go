@@ -0,0 +1,167 @@
+package calculate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	dsClient "owl-engine/pkg/client/datasource"
+	appConfig "owl-engine/pkg/config"
+	"owl-engine/pkg/lib/loki"
+	"owl-engine/pkg/model/apiModel"
+)
+
+const (
+	defaultLokiWindow = "5m" // 未指定时间窗口时, 统计及拉取最近 5 分钟的日志
+	lokiSampleLimit   = 10   // 拉取命中日志的条数, 与 es 查询默认返回的条数一致
+	lokiTimeout       = 30 * time.Second
+)
+
+// LokiClient 日志规则的 loki 客户端
+// 引用数据源时使用数据源的连接, 否则以规则中的连接地址(第一个)及认证信息创建客户端
+func LokiClient(params *apiModel.LoggerRule) (*loki.Client, error) {
+	if params.DatasourceId > 0 {
+		conn, err := dsClient.Get(params.DatasourceId)
+		if err != nil {
+			return nil, err
+		}
+		if conn.Loki == nil {
+			return nil, fmt.Errorf("the datasource [%d] is not of type loki", params.DatasourceId)
+		}
+		return conn.Loki, nil
+	}
+
+	endpoints := dsClient.Endpoints(params.Address)
+	if len(endpoints) == 0 {
+		return nil, errors.New("the address of loki cannot be empty")
+	}
+
+	cli := loki.NewClient(endpoints[0], params.Username, params.Password, lokiTimeout)
+
+	// 测试环境使用代理
+	conf := appConfig.Get()
+	if conf.ServerOptions.EnableProxy && strings.Compare(conf.ServerOptions.Proxy, "") != 0 {
+		proxyUrl, _ := url.Parse(conf.ServerOptions.Proxy)
+		cli.HTTP.Transport = &http.Transport{Proxy: http.ProxyURL(proxyUrl)}
+	}
+
+	return cli, nil
+}
+
+// LokiWindow 规则的时间窗口, 为空时使用默认的 5m
+func LokiWindow(window string) (string, time.Duration, error) {
+	if strings.Compare(window, "") == 0 {
+		window = defaultLokiWindow
+	}
+
+	duration, err := time.ParseDuration(window)
+	if err != nil || duration <= 0 {
+		return "", 0, errors.New("incorrect value written in time_window of loki, example: 5m")
+	}
+	return window, duration, nil
+}
+
+// LokiCountQuery 统计命中日志条数的查询
+// 日志查询统计时间窗口内的条数: sum(count_over_time(<LogQL> [window])); 指标查询直接使用
+func LokiCountQuery(query, window string) string {
+	if loki.IsLogQuery(query) {
+		return fmt.Sprintf("sum(count_over_time(%s [%s]))", strings.TrimSpace(query), window)
+	}
+	return strings.TrimSpace(query)
+}
+
+// 以规则的 LogQL 查询命中的日志条数及日志内容
+// 查询结果有多个序列时(如: sum by (host))取其和; 命中时以其中的日志查询拉取时间窗口内最新的日志
+func (l *loggerRuleCalculate) searchLoki(ctx context.Context) (float64, []string, error) {
+	params := l.Params
+
+	cli, err := LokiClient(params)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	_, duration, err := LokiWindow(params.TimeWindow)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	query, err := l.query()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	now := time.Now()
+	result, err := cli.Query(ctx, query, now, 0)
+	if err != nil {
+		return 0, nil, fmt.Errorf("loki query logql: %s error: %s", query, err.Error())
+	}
+
+	var count float64
+	for _, sample := range result.Samples {
+		count += sample.Value
+	}
+
+	messages := make([]string, 0)
+	selector := loki.LogSelector(params.Sql)
+	if count <= 0 || strings.Compare(selector, "") == 0 {
+		return count, messages, nil
+	}
+
+	logs, err := cli.QueryRange(ctx, selector, now.Add(-duration), now, lokiSampleLimit)
+	if err != nil {
+		return 0, nil, fmt.Errorf("loki query logql: %s error: %s", selector, err.Error())
+	}
+
+	// 多个日志流的日志按时间倒序合并, 只保留最新的日志
+	type line struct {
+		time    time.Time
+		message string
+	}
+	var lines = make([]line, 0)
+	for _, stream := range logs.Streams {
+		for _, entry := range stream.Entries {
+			lines = append(lines, line{time: entry.Time, message: lokiMessage(stream.Labels, entry.Line, params.MessageField)})
+		}
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].time.After(lines[j].time) })
+	if len(lines) > lokiSampleLimit {
+		lines = lines[:lokiSampleLimit]
+	}
+
+	for _, v := range lines {
+		messages = append(messages, "{"+v.message+"}")
+	}
+
+	return count, messages, nil
+}
+
+// 日志的告警内容: message_field 为日志流的标签时取标签值, 为 json 日志的字段时取字段值, 否则为整行日志
+func lokiMessage(labels map[string]string, line, field string) string {
+	if strings.Compare(field, "") == 0 {
+		return line
+	}
+
+	if value, ok := labels[field]; ok {
+		return value
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err == nil {
+		switch value := fields[field].(type) {
+		case nil:
+		case string:
+			return value
+		default:
+			text, _ := json.Marshal(value)
+			return string(text)
+		}
+	}
+
+	return line
+}
@@ -0,0 +1,89 @@
+package calculate
+
+import (
+	"strings"
+	"testing"
+
+	appConfig "owl-engine/pkg/config"
+	"owl-engine/pkg/lib/job"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/xlogs"
+)
+
+func TestLoggerQuery(t *testing.T) {
+	var cases = []struct {
+		rule  apiModel.LoggerRule
+		query string
+		err   string
+	}{
+		{rule: apiModel.LoggerRule{Source: "loki", Sql: `{app="web"} |= "error"`, TimeWindow: "10m"}, query: `sum(count_over_time({app="web"} |= "error" [10m]))`},
+		{rule: apiModel.LoggerRule{Source: "loki", Sql: `{app="web"}`}, query: `sum(count_over_time({app="web"} [5m]))`},
+		{rule: apiModel.LoggerRule{Source: "loki", Sql: `sum(rate({app="web"}[1m]))`}, query: `sum(rate({app="web"}[1m]))`},
+		{rule: apiModel.LoggerRule{Source: "loki", Sql: `{app="web"}`, TimeWindow: "x"}, err: "time_window"},
+		{rule: apiModel.LoggerRule{Source: "es", Sql: `{ "query": { "match_all": {} } }`}, query: `{"query":{"match_all":{}}}`},
+		{rule: apiModel.LoggerRule{Source: "mysql"}, err: "not realize"},
+	}
+
+	for _, c := range cases {
+		var l = &loggerRuleCalculate{Params: &c.rule}
+		query, err := l.query()
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("query(%s) error = %v, want %s", c.rule.Sql, err, c.err)
+			}
+			continue
+		}
+		if err != nil || query != c.query {
+			t.Errorf("query(%s) = %s %v, want %s", c.rule.Sql, query, err, c.query)
+		}
+	}
+}
+
+func TestSyncLogger(t *testing.T) {
+	if appConfig.Get() == nil {
+		if err := appConfig.LoadFromFile("../../../../conf/config.yaml"); err != nil {
+			t.Fatalf("load config error: %s", err.Error())
+		}
+	}
+	if xlogs.Log == nil {
+		xlogs.Log = xlogs.New(xlogs.WithLogDir(t.TempDir()), xlogs.WithLogName("test.log")).Build()
+	}
+
+	var cron = job.NewCronTab()
+	var name = "sync-logger"
+	defer delete(MathTaskQueue, name)
+	defer delete(LoggerTaskQueue, name)
+
+	// 同名的数学规则的定时任务不受日志规则变更的影响
+	if err := cron.AddByID("math-task", "* * * * *", &mathRuleCalculate{}); err != nil {
+		t.Fatalf("add math task error: %s", err.Error())
+	}
+	MathTaskQueue[name] = "math-task"
+
+	var record = &apiModel.LoggerRule{Id: 9101, Name: name, Crontab: "* * * * *", Switch: 1, Inuse: 2}
+	syncLogger("add", record, cron)
+	first := LoggerTaskQueue[name]
+
+	// 更新时移除原来的定时任务, 只保留一个
+	syncLogger("update", record, cron)
+	second := LoggerTaskQueue[name]
+	if first == "" || second == "" || first == second {
+		t.Fatalf("logger task ids = %s, %s, want two different ids", first, second)
+	}
+
+	var ids = make(map[string]bool)
+	for _, id := range cron.IDs() {
+		ids[id] = true
+	}
+	if len(ids) != 2 || !ids["math-task"] || !ids[second] {
+		t.Errorf("cron ids = %v, want math-task and %s", ids, second)
+	}
+	if MathTaskQueue[name] != "math-task" {
+		t.Errorf("math task queue = %s, want math-task", MathTaskQueue[name])
+	}
+
+	syncLogger("delete", record, cron)
+	if _, ok := LoggerTaskQueue[name]; ok || len(cron.IDs()) != 1 {
+		t.Errorf("after delete, logger task queue = %v, cron ids = %v", LoggerTaskQueue, cron.IDs())
+	}
+}
@@ -2,35 +2,35 @@ package calculate
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
-	"math/rand"
 	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"text/template"
 	"time"
 
-	influxInit "owl-engine/pkg/client/influxdb"
 	"owl-engine/pkg/config"
 	influxDto "owl-engine/pkg/dao/influxdb"
 	"owl-engine/pkg/dao/mysql/event"
 	"owl-engine/pkg/dao/mysql/rule"
 	"owl-engine/pkg/lib/job"
+	"owl-engine/pkg/lib/labels"
 	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/constParam"
 	"owl-engine/pkg/model/dbModel"
 	"owl-engine/pkg/util"
 	"owl-engine/pkg/xlogs"
 
-	"github.com/Knetic/govaluate"
 	uuid "github.com/satori/go.uuid"
 )
 
 type mathRuleCalculate struct {
 	Params *apiModel.MathRule
+	plan   *Plan           // 规则的执行计划
+	ctx    context.Context // 服务停止时取消, 正在进行的计算随之取消
 }
 
 // 规则更新的信号
@@ -62,49 +62,30 @@ func Math(stopCh <-chan struct{}, wg *sync.WaitGroup) {
 
 	cronTab := job.NewCronTab()
 
+	// 服务停止时取消所有正在进行的计算
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	if records != nil && count > 0 {
 		for _, v := range *records {
 			id := uuid.NewV4().String()
-			calculate := new(mathRuleCalculate)
+			calculate := &mathRuleCalculate{ctx: ctx}
 
-			metricList := make(map[string]string, 0)
-			_ = json.Unmarshal([]byte(v.MetricList), &metricList) // 在通过 API 提交规则时，就已经进行过校验, 这时规则肯定正确
+			calculate.Params = MathRule(&v) // 参数传递
 
-			window := make(map[string][]string, 0)
-			_ = json.Unmarshal([]byte(v.TimeWindow), &window)
+			// 标签过滤条件; 旧版的扩展条件迁移为结构化的过滤条件, 无法解析的规则不再执行
+			if err := migrateFilters(calculate.Params); err != nil {
+				xlogs.Errorf("rule [name = %s] has incorrect extension condition {%s}, skip it: %s", v.Name, v.ExtensionCondition, err.Error())
+				continue
+			}
 
-			var groupIds = make([]int, 0)
-			for _, id := range strings.Split(v.GroupIp, ",") {
-				groupIds = append(groupIds, util.StringToInt(id))
+			// 编译规则的执行计划, 无法编译的规则不再执行
+			if calculate.plan, err = compilePlan(calculate.Params); err != nil {
+				xlogs.Errorf("compile plan for math rule [name = %s] error: %s", v.Name, err.Error())
+				continue
 			}
 
-			calculate.Params = &apiModel.MathRule{
-				Id:                 v.ID,
-				Name:               v.Name,
-				CalculateType:      v.CalculateType,
-				Express:            v.Express,
-				MetricList:         metricList,
-				Threshold:          v.Threshold,
-				Unit:               v.Unit,
-				TimeWindow:         window,
-				Duration:           v.Duration,
-				Origin:             v.Origin,
-				Type:               v.BusinessType,
-				Category:           v.Category,
-				ExtensionCondition: v.ExtensionCondition,
-				Level:              v.Level,
-				Creator:            v.Creator,
-				Updater:            v.Updater,
-				ResponsiblePeople:  v.ResponsiblePeople,
-				Crontab:            v.Crontab,
-				Switch:             v.Switch,
-				Inuse:              v.Inuse,
-				GroupId:            groupIds,
-				WebHooks:           strings.Split(v.WebHooks, ","),
-				Description:        v.Description,
-			} // 参数传递
-
-			if err := cronTab.AddByID(id, v.Crontab, calculate); err == nil {
+			if err := cronTab.AddByID(id, job.WithTimezone(v.Crontab, calculate.plan.Timezone), calculate); err == nil {
 				MathTaskQueue[v.Name] = id
 			} else {
 				xlogs.Errorf(fmt.Sprintf("add cron task for math rule error: %s", err.Error()))
@@ -127,10 +108,12 @@ func Math(stopCh <-chan struct{}, wg *sync.WaitGroup) {
 
 				for _, key := range reValue.MapKeys() {
 					k := key.String()
-					syncMath(k, value[k], cronTab)
+					syncMath(ctx, k, value[k], cronTab)
 				}
 			}
 		case <-stopCh:
+			cancel()
+
 			// 删除数学规则计算定时任务
 			ids := cronTab.IDs()
 			for _, id := range ids {
@@ -144,7 +127,101 @@ func Math(stopCh <-chan struct{}, wg *sync.WaitGroup) {
 	}
 }
 
-func syncMath(action string, record *apiModel.MathRule, cron *job.CronTab) {
+// MathRule 将规则的数据库记录转换为接口参数
+func MathRule(v *dbModel.Rule) *apiModel.MathRule {
+	metricList := make(map[string]string, 0)
+	_ = json.Unmarshal([]byte(v.MetricList), &metricList) // 在通过 API 提交规则时，就已经进行过校验, 这时规则肯定正确
+
+	window := make(map[string][]string, 0)
+	_ = json.Unmarshal([]byte(v.TimeWindow), &window)
+
+	var groupIds = make([]int, 0)
+	for _, id := range strings.Split(v.GroupIp, ",") {
+		groupIds = append(groupIds, util.StringToInt(id))
+	}
+
+	var filters *apiModel.FilterGroup
+	_ = json.Unmarshal([]byte(v.Filters), &filters)
+	var baseline *apiModel.Baseline
+	_ = json.Unmarshal([]byte(v.Baseline), &baseline)
+	var levels []apiModel.LevelTier
+	_ = json.Unmarshal([]byte(v.Levels), &levels)
+	var ruleLabels map[string]string
+	_ = json.Unmarshal([]byte(v.Labels), &ruleLabels)
+
+	return &apiModel.MathRule{
+		Id:                 v.ID,
+		Name:               v.Name,
+		CalculateType:      v.CalculateType,
+		Express:            v.Express,
+		MetricList:         metricList,
+		Threshold:          v.Threshold,
+		ThresholdSet:       true,
+		Unit:               v.Unit,
+		TimeWindow:         window,
+		Duration:           v.Duration,
+		Interval:           v.Interval,
+		Fill:               v.Fill,
+		MatchCount:         v.MatchCount,
+		PointCount:         v.PointCount,
+		Origin:             v.Origin,
+		Type:               v.BusinessType,
+		Category:           v.Category,
+		ExtensionCondition: v.ExtensionCondition,
+		Filters:            filters,
+		GroupBy:            util.StringToStringSl(v.GroupBy),
+		NoData:             v.NoData,
+		AbsentFor:          v.AbsentFor,
+		Timezone:           v.Timezone,
+		Datasource:         v.Datasource,
+		DatasourceId:       v.DatasourceId,
+		Horizon:            v.Horizon,
+		ForecastMethod:     v.ForecastMethod,
+		Baseline:           baseline,
+		Levels:             levels,
+		Labels:             ruleLabels,
+		Level:              v.Level,
+		Creator:            v.Creator,
+		Updater:            v.Updater,
+		ResponsiblePeople:  v.ResponsiblePeople,
+		Crontab:            v.Crontab,
+		Switch:             v.Switch,
+		Inuse:              v.Inuse,
+		GroupId:            groupIds,
+		WebHooks:           strings.Split(v.WebHooks, ","),
+		Description:        v.Description,
+		CreatedAt:          util.DateTimeToString(v.CreatedAt),
+		UpdatedAt:          util.DateTimeToString(v.UpdatedAt),
+	}
+}
+
+// 旧版的扩展条件在内存中迁移为结构化的过滤条件, 不回写数据库; 数据库记录的迁移由规则接口显式触发
+func migrateFilters(record *apiModel.MathRule) error {
+	if strings.Compare(record.ExtensionCondition, "") == 0 {
+		return nil
+	}
+
+	filters, err := influxDto.MigrateCondition(record.Filters, record.ExtensionCondition)
+	if err != nil {
+		return err
+	}
+
+	record.Filters = filters
+	record.ExtensionCondition = ""
+	return nil
+}
+
+func syncMath(ctx context.Context, action string, record *apiModel.MathRule, cron *job.CronTab) {
+	// 规则变更后, 之前的计算状态不再有效
+	ruleStates.Delete(ruleRef(RefMath, record.Id))
+
+	// 旧版的扩展条件迁移为结构化的过滤条件
+	if err := migrateFilters(record); err != nil {
+		xlogs.Errorf("rule [name = %s] has incorrect extension condition {%s}: %s", record.Name, record.ExtensionCondition, err.Error())
+		// 无法解析的规则不再执行
+		record.Switch = 2
+	}
+
 	switch strings.ToLower(action) {
 	case "delete":
 		id := MathTaskQueue[record.Name]
@@ -168,10 +245,18 @@ func syncMath(action string, record *apiModel.MathRule, cron *job.CronTab) {
 		if record.Switch == 1 && record.Inuse == 2 {
 			// 重新加载规则
 			id := uuid.NewV4().String()
-			var calculate = new(mathRuleCalculate)
+			var calculate = &mathRuleCalculate{ctx: ctx}
 			calculate.Params = record // 参数传递
 
-			if err := cron.AddByID(id, record.Crontab, calculate); err == nil {
+			// 规则更新时重新编译执行计划
+			plan, err := compilePlan(record)
+			if err != nil {
+				xlogs.Errorf("compile plan for math rule [name = %s] error: %s", record.Name, err.Error())
+				return
+			}
+			calculate.plan = plan
+
+			if err := cron.AddByID(id, job.WithTimezone(record.Crontab, calculate.plan.Timezone), calculate); err == nil {
 				MathTaskQueue[record.Name] = id
 			} else {
 				cron.Stop()
@@ -213,436 +298,58 @@ func (r *mathRuleCalculate) Run() {
 	// 获取配置
 	conf := config.Get()
 
-	switch r.Params.CalculateType {
-	case 1: // 最大值
-		r.maxValue(timeNow, r.Params, conf)
-	case 2: // 最小值
-		r.minValue(timeNow, r.Params, conf)
-	case 3: // 环比
-		r.chainRatio(timeNow, r.Params, conf)
-	case 4: // TopN
-		r.topN(timeNow, r.Params, conf)
-	case 5: // BottomN
-		r.topN(timeNow, r.Params, conf)
-	case 6:
-		r.avgValue(timeNow, r.Params, conf)
-	default:
-		xlogs.Errorf("this [calculate_type = %d] and [name = %s] has not yet been implemented", r.Params.CalculateType, r.Params.Name)
-		return
-	}
-}
-
-// 时间窗口内的记录的最大值计算
-func (r *mathRuleCalculate) maxValue(now time.Time, data *apiModel.MathRule, conf *config.ServerRunOptions) {
-	// 解析出表达式的 metric name
-	regx := regexp.MustCompile(`\[(.+?)\]`)
-	matchMetricKeys := regx.FindAllStringSubmatch(data.Express, -1)
-
-	var startTime string
-	var stopTime string
-	var params = make(map[string]interface{})
-	var calIndex string
-
-	for _, k := range matchMetricKeys {
-		// 对时间窗口的解析
-		startTimeOffset, _ := time.ParseDuration(data.TimeWindow[k[1]][0])
-		startTime = util.DateTimeToString(now.Add(startTimeOffset))
-
-		stopTimeOffset, _ := time.ParseDuration(data.TimeWindow[k[1]][1])
-		stopTime = util.DateTimeToString(now.Add(stopTimeOffset))
-
-		// 查询 mysql 数据库
-		/*
-			// 依据 metric 去库里查询值
-			// 注意: 对于查询语句的关键字，需要以 大写; 查询字段需要以小写
-			sql := "SELECT MAX(`value`) as `value` FROM tbl_metric WHERE `metric` = @metric AND `origin` = @origin AND `type` = @type AND `category` = @category AND `time` BETWEEN @start AND @stop"
-			var arg = map[string]interface{}{
-				"metric":   data.MetricList[k[1]],
-				"origin":   data.Origin,
-				"type":     data.Type,
-				"category": data.Category,
-				"start":    startTime,
-				"stop":     stopTime,
-			}
-
-			var value float64
-
-			err := rule.MetricDto.SelectBySQL(&value, sql, arg)
-			if err == nil {
-				params[k[1]] = value
-			} else {
-				log.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", data.Name, sql, err.Error()))
-				return
-			}
-		*/
-
-		// 查询 influxDB
-		var cmd string
-		if strings.Compare(data.ExtensionCondition, "") != 0 {
-			cmd = fmt.Sprintf("SELECT MAX(value) FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND %s AND type = '%s' AND time >= '%s' AND time < '%s' TZ('Asia/Shanghai')",
-				data.MetricList[k[1]], data.Category, data.Origin, data.ExtensionCondition, data.Type, startTime, stopTime)
-		} else {
-			cmd = fmt.Sprintf("SELECT MAX(value) FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND type = '%s' AND time >= '%s' AND time < '%s' TZ('Asia/Shanghai')",
-				data.MetricList[k[1]], data.Category, data.Origin, data.Type, startTime, stopTime)
-		}
-
-		// 计算的指标名称
-		calIndex = data.MetricList[k[1]]
-
-		if value, err := influxDto.Metric.Query(cmd, conf.InfluxDBOptions.Database, conf.InfluxDBOptions.RetentionPolicy,
-			10, *influxInit.InfluxDBClient); err == nil {
-			if len(value) == 1 {
-				params[k[1]] = value[0]
-			} else {
-				xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] has no result", data.Name, cmd))
-				return
-			}
-		} else {
-			xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", data.Name, cmd, err.Error()))
-			return
-		}
-	}
+	// 每次计算的超时时间, 超时或服务停止时, 未完成的查询立即返回
+	ctx, cancel := context.WithTimeout(r.ctx, conf.ServerOptions.Deadline())
+	defer cancel()
 
-	// 只有表达式的因子个数和传值个数相匹配时, 才进行计算
-	if len(matchMetricKeys) == len(params) {
-		// 进行计算
-		result, err := r.calculate(data.Name, data.Express, params)
-		if err == nil {
-			if result != nil {
-				if result.(bool) {
-					// 发送告警
-					r.warning(calIndex, data, params, conf)
-				}
-			} else {
-				xlogs.Error(fmt.Sprintf("calculate expression {%s} for rule name = {%s} of result is nil", data.Express, data.Name))
-			}
-		} else {
-			xlogs.Error(fmt.Sprintf("calculate expression {%s} for rule name = {%s} error: %s", data.Express, data.Name, err.Error()))
-		}
-	}
+	// 各计算类型共用同一个计算流程, 由执行计划中的计算类型进行计算
+	r.pipeline(ctx, timeNow, r.Params, conf)
 }
 
-// 最小值计算
-func (r *mathRuleCalculate) minValue(now time.Time, data *apiModel.MathRule, conf *config.ServerRunOptions) {
-	// 解析出表达式的 metric name
-	regx := regexp.MustCompile(`\[(.+?)\]`)
-	matchMetricKeys := regx.FindAllStringSubmatch(data.Express, -1)
-
-	var startTime string
-	var stopTime string
-	var params = make(map[string]interface{})
-	var calIndex string
-
-	for _, k := range matchMetricKeys {
-		// 对时间窗口的解析
-		startTimeOffset, _ := time.ParseDuration(data.TimeWindow[k[1]][0])
-		startTime = util.DateTimeToString(now.Add(startTimeOffset))
-
-		stopTimeOffset, _ := time.ParseDuration(data.TimeWindow[k[1]][1])
-		stopTime = util.DateTimeToString(now.Add(stopTimeOffset))
-
-		// 查询 mysql 数据库
-		/*
-			// 依据 metric 去库里查询值
-			// 注意: 对于查询语句的关键字，需要以 大写; 查询字段需要以小写
-			sql := "SELECT MIN(`value`) as `value` FROM tbl_metric WHERE `metric` = @metric AND `origin` = @origin AND `type` = @type AND `category` = @category AND `time` BETWEEN @start AND @stop"
-			var arg = map[string]interface{}{
-				"metric":   data.MetricList[k[1]],
-				"origin":   data.Origin,
-				"type":     data.Type,
-				"category": data.Category,
-				"start":    startTime,
-				"stop":     stopTime,
-			}
-
-			var value float64
-
-			err := rule.MetricDto.SelectBySQL(&value, sql, arg)
-			if err == nil {
-				params[k[1]] = value
-			} else {
-				log.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", data.Name, sql, err.Error()))
-				return
-			}
-		*/
-
-		// 查询 influxDB
-		var cmd string
-		if strings.Compare(data.ExtensionCondition, "") != 0 {
-			cmd = fmt.Sprintf("SELECT MIN(value) FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND %s AND type = '%s' AND time >= '%s' AND time < '%s' TZ('Asia/Shanghai')",
-				data.MetricList[k[1]], data.Category, data.Origin, data.ExtensionCondition, data.Type, startTime, stopTime)
-		} else {
-			cmd = fmt.Sprintf("SELECT MIN(value) FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND type = '%s' AND time >= '%s' AND time < '%s' TZ('Asia/Shanghai')",
-				data.MetricList[k[1]], data.Category, data.Origin, data.Type, startTime, stopTime)
-		}
-
-		// 计算的指标名称
-		calIndex = data.MetricList[k[1]]
-
-		if value, err := influxDto.Metric.Query(cmd, conf.InfluxDBOptions.Database, conf.InfluxDBOptions.RetentionPolicy,
-			10, *influxInit.InfluxDBClient); err == nil {
-			if len(value) == 1 {
-				params[k[1]] = value[0]
-			} else {
-				xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] has no result", data.Name, cmd))
-				return
-			}
-		} else {
-			xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", data.Name, cmd, err.Error()))
-			return
-		}
-	}
-
-	// 只有表达式的因子个数和传值个数相匹配时, 才进行计算
-	if len(matchMetricKeys) == len(params) {
-		// 进行计算
-		result, err := r.calculate(data.Name, data.Express, params)
-		if err == nil {
-			if result != nil {
-				if result.(bool) {
-					// 发送告警
-					r.warning(calIndex, data, params, conf)
+// 查询无数据时, 依据规则的 nodata 策略进行处理
+//   alert: 触发无数据告警
+//   keep: 保持之前的状态, 之前处于告警中的序列继续告警
+//   ok: 视为正常, 之前处于告警中的序列置为正常(默认)
+func (r *mathRuleCalculate) noData(ctx context.Context, calIndex string, data *apiModel.MathRule, conf *config.ServerRunOptions) {
+	switch strings.ToLower(data.NoData) {
+	case "alert":
+		_, _ = r.warning(ctx, calIndex, data, data.Level, nil, nil, conf, "时间窗口内查询无数据", nil)
+	case "keep":
+		ruleStates.Renew(ruleRef(RefMath, data.Id), r.stateExpiry(data))
+		for _, state := range ruleStates.Get(ruleRef(RefMath, data.Id)) {
+			if state.Firing {
+				var detail = "查询无数据, 保持之前的告警状态"
+				if strings.Compare(state.Detail, "") != 0 {
+					detail += ", " + state.Detail
 				}
-			} else {
-				xlogs.Error(fmt.Sprintf("calculate expression {%s} for rule name = {%s} of result is nil", data.Express, data.Name))
-			}
-		} else {
-			xlogs.Error(fmt.Sprintf("calculate expression {%s} for rule name = {%s} error: %s", data.Express, data.Name, err.Error()))
-		}
-	}
-}
-
-// 环比
-func (r *mathRuleCalculate) chainRatio(now time.Time, data *apiModel.MathRule, conf *config.ServerRunOptions) {
-	// 解析出表达式的 metric name
-	regx := regexp.MustCompile(`\[(.+?)\]`)
-	matchMetricKeys := regx.FindAllStringSubmatch(data.Express, -1)
-
-	var startTime string
-	var stopTime string
-	var params = make(map[string]interface{})
-	// 为 metis 查询 InfluxDB 的指标名称
-	var calIndex string
-
-	for _, k := range matchMetricKeys {
-		// 对时间窗口的解析
-		startTimeOffset, _ := time.ParseDuration(data.TimeWindow[k[1]][0])
-		startTime = util.DateTimeToString(now.Add(startTimeOffset))
-
-		stopTimeOffset, _ := time.ParseDuration(data.TimeWindow[k[1]][1])
-		stopTime = util.DateTimeToString(now.Add(stopTimeOffset))
-
-		// 查询 mysql 数据库
-		/*
-			// 依据 metric 去库里查询值
-			// 注意: 对于查询语句的关键字，需要以 大写; 查询字段需要以小写
-			sql := "SELECT AVG(`value`) as `value` FROM tbl_metric WHERE `metric` = @metric AND `origin` = @origin AND `type` = @type AND `category` = @category AND `time` BETWEEN @start AND @stop"
-			var arg = map[string]interface{}{
-				"metric":   data.MetricList[k[1]],
-				"origin":   data.Origin,
-				"type":     data.Type,
-				"category": data.Category,
-				"start":    startTime,
-				"stop":     stopTime,
-			}
-
-			var value float64
-
-			err := rule.MetricDto.SelectBySQL(&value, sql, arg)
-			if err == nil {
-				params[k[1]] = value
-			} else {
-				log.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", data.Name, sql, err.Error()))
-				return
+				_, _ = r.warning(ctx, state.CalIndex, data, state.Level, nil, state.Params, conf, detail, state.Tags)
 			}
-		*/
-
-		// 查询 influxDB
-		var cmd string
-		if strings.Compare(data.ExtensionCondition, "") != 0 {
-			cmd = fmt.Sprintf("SELECT MEAN(value) FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND %s AND type = '%s' AND time >= '%s' AND time < '%s' TZ('Asia/Shanghai')",
-				data.MetricList[k[1]], data.Category, data.Origin, data.ExtensionCondition, data.Type, startTime, stopTime)
-		} else {
-			cmd = fmt.Sprintf("SELECT MEAN(value) FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND type = '%s' AND time >= '%s' AND time < '%s' TZ('Asia/Shanghai')",
-				data.MetricList[k[1]], data.Category, data.Origin, data.Type, startTime, stopTime)
 		}
-
-		// 需要计算的指标名称
-		calIndex = data.MetricList[k[1]]
-
-		if value, err := influxDto.Metric.Query(cmd, conf.InfluxDBOptions.Database, conf.InfluxDBOptions.RetentionPolicy,
-			10, *influxInit.InfluxDBClient); err == nil {
-			if len(value) == 1 {
-				params[k[1]] = value[0]
-			} else {
-				xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] has no result", data.Name, cmd))
-				return
-			}
-		} else {
-			xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", data.Name, cmd, err.Error()))
-			return
-		}
-	}
-
-	// 只有表达式的因子个数和传值个数相匹配时, 才进行计算
-	if len(matchMetricKeys) == len(params) {
-		// 进行计算
-		result, err := r.calculate(data.Name, data.Express, params)
-		if err == nil {
-			if result != nil {
-				if result.(bool) {
-					// 发送告警
-					r.warning(calIndex, data, params, conf)
-				}
-			} else {
-				xlogs.Error(fmt.Sprintf("calculate expression {%s} for rule name = {%s} of result is nil", data.Express, data.Name))
-			}
-		} else {
-			xlogs.Error(fmt.Sprintf("calculate expression {%s} for rule name = {%s} error: %s", data.Express, data.Name, err.Error()))
-		}
-	}
-}
-
-// TopN or Bottom: 时间窗口内的所有的值均需要大于/小于某一个阈值
-func (r *mathRuleCalculate) topN(now time.Time, data *apiModel.MathRule, conf *config.ServerRunOptions) {
-	// 解析出表达式的 metric name
-	regx := regexp.MustCompile(`\[(.+?)\]`)
-	matchMetricKeys := regx.FindAllStringSubmatch(data.Express, -1)
-
-	var startTime string
-	var stopTime string
-	var params = make(map[string]interface{})
-	var calIndex string
-
-	if len(matchMetricKeys) == 1 { // 单因子
-		metricKey := matchMetricKeys[0][1]
-		// 对时间窗口的解析
-		startTimeOffset, _ := time.ParseDuration(data.TimeWindow[metricKey][0])
-		startTime = util.DateTimeToString(now.Add(startTimeOffset))
-
-		stopTimeOffset, _ := time.ParseDuration(data.TimeWindow[metricKey][1])
-		stopTime = util.DateTimeToString(now.Add(stopTimeOffset))
-
-		// 查询数据库
-		/*
-			// 依据 metric 去库里查询值
-			// 注意: 对于查询语句的关键字，需要以 大写; 查询字段需要以小写
-			sql := "SELECT `value` FROM tbl_metric WHERE `metric` = @metric AND `origin` = @origin AND `type` = @type AND `category` = @category AND `time` BETWEEN @start AND @stop"
-			var arg = map[string]interface{}{
-				"metric":   data.MetricList[matchMetricKeys[0][1]],
-				"origin":   data.Origin,
-				"type":     data.Type,
-				"category": data.Category,
-				"start":    startTime,
-				"stop":     stopTime,
-			}
-
-			var values []float64
-
-			err := rule.MetricDto.SelectBySQL(&values, sql, arg)
-			if err == nil {
-				if len(values) > 0 {
-					var judge = make([]bool, 0)
-
-					for _, v := range values {
-						params[matchMetricKeys[0][1]] = v
-						result, err := r.calculate(data.Name, data.Express, params)
-						if err == nil && result != nil {
-							judge = append(judge, result.(bool))
-						}
-					}
-
-					// 对结果进行判定
-					isWarning := true
-					for _, v := range judge {
-						if v == false {
-							isWarning = false
-						}
-					}
-
-					if isWarning {
-						// 发送告警
-						r.warning(data, params)
-					}
-				}
-			} else {
-				log.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", data.Name, sql, err.Error()))
-				return
-			}
-		*/
-
-		// 查询 influxDB
-		var cmd string
-		if strings.Compare(data.ExtensionCondition, "") != 0 {
-			cmd = fmt.Sprintf("SELECT value FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND %s AND type = '%s' AND time >= '%s' AND time < '%s' TZ('Asia/Shanghai')",
-				data.MetricList[matchMetricKeys[0][1]], data.Category, data.Origin, data.ExtensionCondition, data.Type, startTime, stopTime)
-		} else {
-			cmd = fmt.Sprintf("SELECT value FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND type = '%s' AND time >= '%s' AND time < '%s' TZ('Asia/Shanghai')",
-				data.MetricList[matchMetricKeys[0][1]], data.Category, data.Origin, data.Type, startTime, stopTime)
-		}
-
-		// 计算的指标
-		calIndex = data.MetricList[metricKey]
-
-		if values, err := influxDto.Metric.Query(cmd, conf.InfluxDBOptions.Database, conf.InfluxDBOptions.RetentionPolicy,
-			10, *influxInit.InfluxDBClient); err == nil {
-			if len(values) > 0 {
-				isWarning := true
-				for _, v := range values {
-					params[metricKey] = v
-					result, err := r.calculate(data.Name, data.Express, params)
-					if err == nil && result != nil {
-						if !result.(bool) {
-							isWarning = false
-						}
-					}
-				}
-
-				if isWarning {
-					// 发送告警
-					r.warning(calIndex, data, params, conf)
-				}
-			}
-		} else {
-			xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", data.Name, cmd, err.Error()))
-			return
-		}
-	} else if len(matchMetricKeys) > 1 { // 多因子
-		xlogs.Errorf(fmt.Sprintf("Support for multi-factors has not yet been implemented for expression {%s} of rule name: %s", data.Express, data.Name))
+	default:
+		ruleStates.Resolve(ruleRef(RefMath, data.Id), r.stateExpiry(data))
 	}
 }
 
-// 平均值
-func (r *mathRuleCalculate) avgValue(now time.Time, data *apiModel.MathRule, conf *config.ServerRunOptions) {
+// 规则本次计算后状态的有效期
+func (r *mathRuleCalculate) stateExpiry(data *apiModel.MathRule) time.Time {
+	return stateExpiry(job.WithTimezone(data.Crontab, r.plan.Timezone), time.Now())
 }
 
-// 进行运算
-func (r *mathRuleCalculate) calculate(name, expression string, params map[string]interface{}) (interface{}, error) {
-	expr, err := govaluate.NewEvaluableExpression(expression)
-	if err != nil {
-		xlogs.Errorf(fmt.Sprintf("rule name = {%s} for express = {%s} error: %s", name, expression, err.Error()))
-		return nil, err
-	}
-
-	result, err := expr.Evaluate(params)
-	if result != nil && err == nil {
-		return result, nil
-	} else {
-		return nil, err
-	}
+// 告警中的序列级别的变化
+type escalation struct {
+	AlertId  string // 告警中的告警事件 id
+	From, To int8   // 变化前后的告警级别
 }
 
-// 触发告警
-func (r *mathRuleCalculate) warning(calIndex string, data *apiModel.MathRule, mathValue map[string]interface{}, options *config.ServerRunOptions) error {
+// 触发告警, 返回告警事件 id; level 为告警级别; escalate 不为空时原地更新告警中的告警事件的级别并发送级别变化的通知
+// detail 为告警内容的补充说明, 可为空; tags 为 group_by 分组后序列的标签集, 作为告警的标签
+func (r *mathRuleCalculate) warning(ctx context.Context, calIndex string, data *apiModel.MathRule, level int8, escalate *escalation,
+	mathValue map[string]interface{}, options *config.ServerRunOptions, detail string, tags map[string]string) (string, error) {
 	var value = 0.0
 
 	// 对表达式进行解析，从而换算。如果包含多条表达式, 那么该条规则即不会被进行值计算
-	if !strings.Contains(data.Express, "||") &&
-		!strings.Contains(data.Express, "&&") {
-		leftExpress := r.regSplit(data.Express, "==|!=|>|>=|<|<=")
-
-		express := leftExpress[0]
-		result, err := r.calculate(data.Name, express, mathValue)
+	if !r.plan.Compound {
+		result, err := calculate(r.plan.Value, mathValue)
 		if err == nil && result != nil {
 			value = result.(float64)
 			// 保留两位小数
@@ -650,7 +357,34 @@ func (r *mathRuleCalculate) warning(calIndex string, data *apiModel.MathRule, ma
 		}
 	}
 
-	var content = fmt.Sprintf("规则名称 【%s】触发告警, 当前值为: %v, 阈值为: %v", data.Name, value, data.Threshold)
+	// 动态基线的区间在 detail 中给出
+	var threshold = fmt.Sprintf(", 阈值为: %v", data.Threshold)
+	if r.plan.Baseline != nil {
+		threshold = ""
+	}
+
+	// 告警标签: 规则标签与序列的标签集合并
+	var alertLabelSet = alertLabels(data.Name, data.Labels, tags)
+
+	var content = fmt.Sprintf("规则名称 【%s】触发告警, 当前值为: %v%s", data.Name, value, threshold)
+	var series = influxDto.Series{Tags: tags}
+	if len(tags) > 0 {
+		content = fmt.Sprintf("规则名称 【%s】序列 {%s} 触发告警, 当前值为: %v%s", data.Name, series.Key(), value, threshold)
+	}
+	// 无数据告警没有计算值
+	if len(mathValue) == 0 {
+		content = fmt.Sprintf("规则名称 【%s】触发无数据告警", data.Name)
+	}
+	if strings.Compare(detail, "") != 0 {
+		content += ", " + detail
+	}
+	if escalate != nil {
+		var action = "升级"
+		if escalate.To < escalate.From {
+			action = "降级"
+		}
+		content = fmt.Sprintf("告警级别由 %s %s为 %s, %s", levelName(escalate.From), action, levelName(escalate.To), content)
+	}
 
 	// 转换业务域
 	var category string
@@ -669,17 +403,24 @@ func (r *mathRuleCalculate) warning(calIndex string, data *apiModel.MathRule, ma
 		category = "业务告警"
 	}
 
-	// 值异常检测准确率
-	var err error
-	accuracy, err := r.metis(time.Now(), data.Name, calIndex, data.Origin, data.Type, data.ExtensionCondition, data.Category, options.InfluxDBOptions)
-	if err != nil {
-		var min = 70.0
-		var max = 78.0
+	// 分组的序列, 只对该序列的数据进行检测
+	var seriesFilters = &apiModel.FilterGroup{Logic: "AND"}
+	for _, k := range data.GroupBy {
+		if v, ok := tags[k]; ok {
+			seriesFilters.Conditions = append(seriesFilters.Conditions, apiModel.TagFilter{Tag: k, Operator: "=", Value: v})
+		}
+	}
 
-		// 生成随机值
-		rand.Seed(time.Now().UnixNano())
-		generateV, _ := strconv.ParseFloat(fmt.Sprintf("%.2f", min+rand.Float64()*(max-min)), 64)
-		accuracy = fmt.Sprintf("%v", generateV)
+	// 值异常评分, 无法计算时为 N/A; 异常检测只支持配置文件中的 InfluxDB 数据源
+	var anomalyScore = constParam.SymbolQueryNull
+	if strings.Compare(r.plan.Datasource.Name(), defaultDatasource) == 0 && data.DatasourceId == 0 {
+		score, err := r.anomalyScore(ctx, time.Now().In(r.plan.Location), data.Name, calIndex, data.Origin, data.Type,
+			influxDto.MergeFilters(data.Filters, seriesFilters), data.Category, options.InfluxDBOptions)
+		if err == nil {
+			anomalyScore = score + "%"
+		} else {
+			xlogs.Error(fmt.Sprintf("rule name = {%s} to calculate anomaly score error: %s", data.Name, err.Error()))
+		}
 	}
 
 	var alertTemplate = `
@@ -687,61 +428,86 @@ func (r *mathRuleCalculate) warning(calIndex string, data *apiModel.MathRule, ma
 告警类型：{{ .Category }}
 业务域： {{ .Type }}
 告警源：{{ .Origin }}
+{{- if .Labels }}
+告警标签：{{ .Labels }}
+{{- end }}
+告警级别：{{ .Level }}
 告警内容：{{ .Content }}
 告警值：{{ .Value }}
 告警时间：{{ .Datetime }}
 负责人：{{ .ResponsiblePeople }}
-值异常检测准确率(测试阶段): {{ .Accuracy }}
+值异常评分: {{ .AnomalyScore }}
 `
 
 	var params = struct {
-		Name              string  `json:"name"`
-		Type              string  `json:"type"`
-		Category          string  `json:"category"`
-		Origin            string  `json:"origin"`
-		Content           string  `json:"content"`
-		Value             float64 `json:"value"`
-		Datetime          string  `json:"datetime"`
-		ResponsiblePeople string  `json:"responsible_people"`
-		Accuracy          string  `json:"accuracy"`
+		Name              string     `json:"name"`
+		Type              string     `json:"type"`
+		Category          string     `json:"category"`
+		Origin            string     `json:"origin"`
+		Labels            labels.Set `json:"labels"`
+		Level             string     `json:"level"`
+		Content           string     `json:"content"`
+		Value             float64    `json:"value"`
+		Datetime          string     `json:"datetime"`
+		ResponsiblePeople string     `json:"responsible_people"`
+		AnomalyScore      string     `json:"anomaly_score"`
 	}{
 		Name:              data.Name,
 		Type:              data.Type,
 		Category:          category,
 		Origin:            data.Origin,
+		Labels:            alertLabelSet,
+		Level:             levelName(level),
 		Content:           content,
 		Value:             value,
-		Datetime:          util.DateTimeToString(time.Now()),
+		Datetime:          util.DateTimeToString(time.Now().In(r.plan.Location)),
 		ResponsiblePeople: data.ResponsiblePeople,
-		Accuracy:          accuracy + "%",
+		AnomalyScore:      anomalyScore,
 	}
 
 	result, _ := template.New("test").Parse(alertTemplate)
 	var buffer bytes.Buffer
 
-	err = result.Execute(&buffer, params)
+	err := result.Execute(&buffer, params)
 	if err != nil {
 		xlogs.Error(fmt.Sprintf("template alert event error: %s", err.Error()))
-		return err
+		return "", err
 	}
 
 	alertId := uuid.NewV4().String()
+	if escalate != nil {
+		alertId = escalate.AlertId
+	}
+
+	// 被组合规则静默的规则, 告警记录为静默状态且不发送通知
+	var status int8 = 1
+	silenced := silences.Silenced(ruleRef(RefMath, data.Id), alertLabelSet)
+	if silenced {
+		status = 4
+	}
+
+	var labelStr string
+	if len(alertLabelSet) > 0 {
+		jsonLabels, _ := json.Marshal(alertLabelSet)
+		labelStr = string(jsonLabels)
+	}
 
 	var record = dbModel.Alert{
 		AlertId:      alertId,
 		Name:         data.Name,
 		Item:         data.Express,
+		Labels:       labelStr,
 		Origin:       data.Origin,
 		BusinessType: data.Type,
 		Category:     data.Category,
 		Value:        value,
-		Level:        data.Level, // 告警级别:0-Not classified; 1-Information; 2-Warning; 3-critical; 4-Disaster
+		Level:        level, // 告警级别:0-Not classified; 1-Information; 2-Warning; 3-critical; 4-Disaster
 		Content:      content,
 		RuleName:     data.Name,
 		GroupId:      strings.Replace(strings.Trim(fmt.Sprint(data.GroupId), "[]"), " ", ",", -1),
 		Owner:        data.ResponsiblePeople,
-		Status:       1, // 告警状态,1-告警中,2-恢复,3-忽略,4-静默
-		Platform:     1, // 告警平台,1-owl,2-zcat,3-prometheus,4-zms等
+		Status:       status, // 告警状态,1-告警中,2-恢复,3-忽略,4-静默
+		Platform:     1,      // 告警平台,1-owl,2-zcat,3-prometheus,4-zms等
 		AlertTime:    time.Now(),
 		PlatformName: "owl",
 		AggregatorId: 0,
@@ -751,7 +517,12 @@ func (r *mathRuleCalculate) warning(calIndex string, data *apiModel.MathRule, ma
 	}
 
 	jsonStr, _ := json.Marshal(record)
-	if err := event.EventDto.Insert(&record); err != nil {
+	if escalate != nil {
+		// 原地更新告警中的告警事件的级别
+		if err := event.EventDto.Escalate(alertId, level, content); err != nil {
+			xlogs.Error(fmt.Sprintf("escalate alert event {%s} to level %d error: %s", alertId, level, err.Error()))
+		}
+	} else if err := event.EventDto.Insert(&record); err != nil {
 		jsonStr, _ := json.Marshal(record)
 		xlogs.Error(fmt.Sprintf("insert alert event for {%s} to db error: %s", string(jsonStr), err.Error()))
 	}
@@ -766,163 +537,22 @@ func (r *mathRuleCalculate) warning(calIndex string, data *apiModel.MathRule, ma
 		AlertId int    `json:"alert_id"`
 	}{
 		UUID:    alertId,
-		Level:   data.Level,
+		Level:   level,
 		GroupId: strings.Replace(strings.Trim(fmt.Sprint(data.GroupId), "[]"), " ", ",", -1),
 		Owner:   data.Creator,
 		Content: buffer.String(),
 	}
 
 	// 发送 http post 到指定的 hook 地址
-	if len(options.EventOptions.Hooks) > 0 {
+	if len(options.EventOptions.Hooks) > 0 && !silenced {
 		for _, hook := range options.EventOptions.Hooks {
 			if msg, err := Post(hook, alert); err == nil {
 				xlogs.Infof("post request to [%s] for alert id [%s] success, response result: [%v]", hook, alert.UUID, msg)
 			} else {
-				xlogs.Errorf("post data [%s] to %s fail, error message: %s", string(jsonStr), err.Error())
+				xlogs.Errorf("post data [%s] to %s fail, error message: %s", string(jsonStr), hook, err.Error())
 			}
 		}
 	}
 
-	return nil
-}
-
-// 正则切割表达式字符串
-func (r *mathRuleCalculate) regSplit(text string, delimeter string) []string {
-	reg := regexp.MustCompile(delimeter)
-	indexes := reg.FindAllStringIndex(text, -1)
-	lastStart := 0
-	result := make([]string, len(indexes)+1)
-	for i, element := range indexes {
-		result[i] = text[lastStart:element[0]]
-		lastStart = element[1]
-	}
-	result[len(indexes)] = text[lastStart:]
-	return result
-}
-
-// metis 计算异常值
-func (r *mathRuleCalculate) metis(now time.Time, name, calIndex, origin,
-	businessType, extensionCondition string, category int8, option *config.InfluxDBOptions) (string, error) {
-	// 由于前置 flink 处理数据时, 其机制: 会延迟将近2分钟, 故其当前时间往前的推2分钟的点作为计算值
-	interval, _ := time.ParseDuration("-2m")
-	currentDatetime := now.Add(interval)
-	startTime := util.DatetimeToWholeMinutes(currentDatetime.Add(-180 * time.Minute))
-	stopTime := util.DatetimeToWholeMinutes(currentDatetime)
-
-	var cmd string
-	if strings.Compare(extensionCondition, "") != 0 {
-		cmd = fmt.Sprintf("SELECT value FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND %s AND type = '%s' AND time >= '%s' AND time <= '%s' TZ('Asia/Shanghai')",
-			calIndex, category, origin, extensionCondition, businessType, startTime, stopTime)
-	} else {
-		cmd = fmt.Sprintf("SELECT value FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND type = '%s' AND time >= '%s' AND time <= '%s' TZ('Asia/Shanghai')",
-			calIndex, category, origin, businessType, startTime, stopTime)
-	}
-
-	dataA, err := influxDto.Metric.Query(cmd, option.Database, option.RetentionPolicy, 10, *influxInit.InfluxDBClient)
-	if err == nil {
-		if len(dataA) != 181 {
-			xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] have %d records", name, cmd, len(dataA)))
-			return "0", errors.New("insufficient number of records")
-		}
-	} else {
-		xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", name, cmd, err.Error()))
-		return "0", errors.New("insufficient number of records")
-	}
-
-	interval, _ = time.ParseDuration("-24h")
-	yesterdayCurrTime := currentDatetime.Add(interval)
-	yesterdayStartTime := util.DatetimeToWholeMinutes(yesterdayCurrTime.Add(-180 * time.Minute))
-	yesterdayStopTime := util.DatetimeToWholeMinutes(yesterdayCurrTime.Add(180 * time.Minute))
-
-	if strings.Compare(extensionCondition, "") != 0 {
-		cmd = fmt.Sprintf("SELECT value FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND %s AND type = '%s' AND time >= '%s' AND time <= '%s' TZ('Asia/Shanghai')",
-			calIndex, category, origin, extensionCondition, businessType, yesterdayStartTime, yesterdayStopTime)
-	} else {
-		cmd = fmt.Sprintf("SELECT value FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND type = '%s' AND time >= '%s' AND time <= '%s' TZ('Asia/Shanghai')",
-			calIndex, category, origin, businessType, yesterdayStartTime, yesterdayStopTime)
-	}
-
-	dataB, err := influxDto.Metric.Query(cmd, option.Database, option.RetentionPolicy, 10, *influxInit.InfluxDBClient)
-	if err == nil {
-		if len(dataB) != 361 {
-			xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] have %d records", name, cmd, len(dataA)))
-			return "0", errors.New("insufficient number of records")
-		}
-	} else {
-		xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", name, cmd, err.Error()))
-		return "0", errors.New("insufficient number of records")
-	}
-
-	interval, _ = time.ParseDuration("-168h")
-	lastWeekCurrTime := currentDatetime.Add(interval)
-	lastWeekStartTime := util.DatetimeToWholeMinutes(lastWeekCurrTime.Add(-180 * time.Minute))
-	lastWeekStopTime := util.DatetimeToWholeMinutes(lastWeekCurrTime.Add(180 * time.Minute))
-
-	if strings.Compare(extensionCondition, "") != 0 {
-		cmd = fmt.Sprintf("SELECT value FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND %s AND type = '%s' AND time >= '%s' AND time <= '%s' TZ('Asia/Shanghai')",
-			calIndex, category, origin, extensionCondition, businessType, lastWeekStartTime, lastWeekStopTime)
-	} else {
-		cmd = fmt.Sprintf("SELECT value FROM \"%s\" WHERE category = '%d' AND origin = '%s' AND type = '%s' AND time >= '%s' AND time <= '%s' TZ('Asia/Shanghai')",
-			calIndex, category, origin, businessType, lastWeekStartTime, lastWeekStopTime)
-	}
-
-	dataC, err := influxDto.Metric.Query(cmd, option.Database, option.RetentionPolicy, 10, *influxInit.InfluxDBClient)
-	if err == nil {
-		if len(dataC) != 361 {
-			xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] have %d records", name, cmd, len(dataA)))
-			return "0", errors.New("insufficient number of records")
-		}
-	} else {
-		xlogs.Error(fmt.Sprintf("rule name = {%s} to execute sql [%s] error: %s", name, cmd, err.Error()))
-		return "0", errors.New("insufficient number of records")
-	}
-
-	var jsonData = struct {
-		ViewId   string `json:"viewId"`
-		ViewName string `json:"viewName"`
-		AttrId   string `json:"attrId"`
-		AttrName string `json:"attrName"`
-		TaskId   string `json:"taskId"`
-		Window   int    `json:"window"`
-		Time     string `json:"time"`
-		DataC    string `json:"dataC"`
-		DataB    string `json:"dataB"`
-		DataA    string `json:"dataA"`
-	}{
-		ViewId:   "1",
-		ViewName: "业务方",
-		AttrId:   "1",
-		AttrName: "各渠道订单量",
-		TaskId:   "1",
-		Window:   180,
-		Time:     stopTime,
-		DataC:    strings.Replace(strings.Trim(fmt.Sprint(dataC), "[]"), " ", ",", -1),
-		DataB:    strings.Replace(strings.Trim(fmt.Sprint(dataB), "[]"), " ", ",", -1),
-		DataA:    strings.Replace(strings.Trim(fmt.Sprint(dataA), "[]"), " ", ",", -1),
-	}
-
-	// 测试写入日志
-	reqStr, _ := json.Marshal(jsonData)
-	xlogs.Info("rule name = " + name + ", dataset: " + string(reqStr))
-
-	if response, err := Post(option.MetisUrl, jsonData); err == nil {
-		var result = struct {
-			Code    int    `json:"code"`
-			Message string `json:"msg"`
-			Data    struct {
-				Ret int    `json:"ret"`
-				P   string `json:"p"`
-			} `json:"data"`
-		}{}
-
-		if err := json.Unmarshal([]byte(response), &result); err == nil {
-			generateV, _ := strconv.ParseFloat(result.Data.P, 64)
-			generateV = (1 - generateV) * 100
-			return fmt.Sprintf("%v", generateV), nil
-		} else {
-			return "0", err
-		}
-	} else {
-		return "0", err
-	}
+	return alertId, nil
 }
@@ -0,0 +1,194 @@
+package calculate
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"owl-engine/pkg/config"
+	influxDto "owl-engine/pkg/dao/influxdb"
+	"owl-engine/pkg/lib/express"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/constParam"
+	"owl-engine/pkg/util"
+
+	"github.com/Knetic/govaluate"
+)
+
+// 表达式中的因子, 如: [A]
+var factorRegexp = regexp.MustCompile(`\[(.+?)\]`)
+
+// group_by 中的时间分组, 原样拼接在 InfluxQL 中, 只允许单个正整数的时间长度, 如: time(1m)
+var groupTimeRegexp = regexp.MustCompile(`^time\([1-9]\d*(ns|u|µ|ms|s|m|h|d|w)\)$`)
+
+// interval 拼接在 InfluxQL 的 time(...) 及 Flux 的 aggregateWindow(every: ...) 中, 其它数据源以 time.ParseDuration 解析
+// 只允许单个正整数及三者共同支持的单位, 如: 1m
+var intervalRegexp = regexp.MustCompile(`^[1-9]\d*(ns|ms|s|m|h)$`)
+
+// Plan 规则的执行计划, 在规则加载或同步时编译一次, 每次定时计算时复用; 规则更新时重新编译
+type Plan struct {
+	Aggregator Aggregator                     // 规则的计算类型
+	Datasource Datasource                     // 规则的数据源
+	Factors    []string                       // 表达式中的因子, 同一因子出现多次时只保留一个
+	Windows    map[string][2]time.Duration    // 各因子时间窗口的起止偏移
+	Queries    map[string]FactorQuery         // 各因子编译后的查询
+	Expression *govaluate.EvaluableExpression // 完整的表达式
+	Value      *govaluate.EvaluableExpression // 比较符左侧的表达式, 用于计算告警值及 TopN/BottomN 逐点的值
+	Compound   bool                           // 是否为包含 && 或 || 的组合表达式
+	AllowEmpty bool                           // 查询无数据时仍进行计算
+	Timezone   string                         // 规则的时区, 用于查询的 TZ() 子句、时间窗口、定时任务及告警时间
+	Location   *time.Location                 // 规则时区对应的 Location
+	Baseline   *apiModel.Baseline             // 动态基线阈值, 为空时使用静态阈值
+	Levels     []levelTier                    // 多级阈值, 按告警级别从高到低排列; 为空时使用规则的告警级别
+}
+
+// 编译规则的执行计划
+func compilePlan(data *apiModel.MathRule) (*Plan, error) {
+	aggregator, err := GetAggregator(data.CalculateType)
+	if err != nil {
+		return nil, err
+	}
+
+	datasource, err := GetDatasource(data.Datasource)
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range data.GroupBy {
+		if strings.HasPrefix(tag, "time(") && !groupTimeRegexp.MatchString(tag) {
+			return nil, fmt.Errorf("the time {%s} of group_by is incorrect, example: time(1m)", tag)
+		}
+	}
+	if strings.Compare(data.Interval, "") != 0 && !intervalRegexp.MatchString(data.Interval) {
+		return nil, fmt.Errorf("the interval {%s} is incorrect, example: 1m", data.Interval)
+	}
+	if err := datasource.Validate(data); err != nil {
+		return nil, err
+	}
+
+	// 各计算类型的查询字段、GROUP BY 子句及时间窗口
+	options, err := aggregator.Query(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan = &Plan{
+		Aggregator: aggregator,
+		Datasource: datasource,
+		Factors:    make([]string, 0),
+		Windows:    make(map[string][2]time.Duration),
+		Queries:    make(map[string]FactorQuery),
+		Compound:   strings.Contains(data.Express, "||") || strings.Contains(data.Express, "&&"),
+		AllowEmpty: options.AllowEmpty,
+		Timezone:   ruleTimezone(data),
+	}
+
+	if plan.Location, err = util.LoadLocation(plan.Timezone); err != nil {
+		return nil, fmt.Errorf("timezone {%s} is incorrect: %s", plan.Timezone, err.Error())
+	}
+
+	if plan.Baseline, err = compileBaseline(aggregator, data); err != nil {
+		return nil, err
+	}
+
+	if plan.Expression, err = express.New(data.Express); err != nil {
+		return nil, fmt.Errorf("express {%s} is incorrect: %s", data.Express, err.Error())
+	}
+	if !plan.Compound {
+		if plan.Value, err = express.New(express.LeftOperand(data.Express)); err != nil {
+			return nil, fmt.Errorf("express {%s} is incorrect: %s", data.Express, err.Error())
+		}
+	}
+
+	for _, k := range factorRegexp.FindAllStringSubmatch(data.Express, -1) {
+		var factor = k[1]
+		if _, ok := plan.Queries[factor]; ok {
+			continue
+		}
+		plan.Factors = append(plan.Factors, factor)
+
+		// 对时间窗口的解析, 计算类型指定了统一的时间窗口时, 忽略各因子的时间窗口
+		var window [2]time.Duration
+		if len(options.Window) == 2 {
+			copy(window[:], options.Window)
+		} else {
+			if len(data.TimeWindow[factor]) != 2 {
+				return nil, fmt.Errorf("time window of factor [%s] is incorrect", factor)
+			}
+			for i, offset := range data.TimeWindow[factor] {
+				if window[i], err = time.ParseDuration(offset); err != nil {
+					return nil, fmt.Errorf("time window {%s} of factor [%s] is incorrect", offset, factor)
+				}
+			}
+		}
+		plan.Windows[factor] = window
+
+		if plan.Queries[factor], err = datasource.Compile(plan, data, factor, options); err != nil {
+			return nil, err
+		}
+	}
+
+	if plan.Levels, err = compileLevels(aggregator, data, plan); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// CheckPlan 校验规则能否编译为执行计划, 保证保存的规则在加载时能够执行
+func CheckPlan(data *apiModel.MathRule) error {
+	_, err := compilePlan(data)
+	return err
+}
+
+// 规则使用的时区: 规则单独配置的时区优先, 否则使用服务的时区
+func ruleTimezone(data *apiModel.MathRule) string {
+	if strings.Compare(data.Timezone, "") != 0 {
+		return data.Timezone
+	}
+
+	if conf := config.Get(); conf != nil && conf.ServerOptions != nil && strings.Compare(conf.ServerOptions.Timezone, "") != 0 {
+		return conf.ServerOptions.Timezone
+	}
+
+	return constParam.DefaultTimezone
+}
+
+// InfluxQL 的 TZ() 子句, 查询结果的时间戳及 GROUP BY time() 的分桶以该时区计算
+func tzClause(timezone string) string {
+	return " TZ(" + influxDto.QuoteString(timezone) + ")"
+}
+
+// 依据 group_by 的标签生成 InfluxQL 的 GROUP BY 子句, time(...) 原样保留, 其余作为标签名加上双引号
+func groupByClause(groupBy []string) string {
+	if len(groupBy) == 0 {
+		return ""
+	}
+
+	var dimensions = make([]string, 0, len(groupBy))
+	for _, tag := range groupBy {
+		if strings.HasPrefix(tag, "time(") {
+			dimensions = append(dimensions, tag)
+		} else {
+			dimensions = append(dimensions, influxDto.QuoteIdent(tag))
+		}
+	}
+
+	return " GROUP BY " + strings.Join(dimensions, ",")
+}
+
+// 对齐数据点时, InfluxQL fill() 的取值, 默认为 none, 即缺失的点不参与计算
+func fillOption(fill string) string {
+	switch strings.ToLower(fill) {
+	case "", "none":
+		return "none"
+	case "null", "previous", "linear":
+		return strings.ToLower(fill)
+	default:
+		if _, err := strconv.ParseFloat(fill, 64); err == nil {
+			return fill
+		}
+		return "none"
+	}
+}
@@ -0,0 +1,90 @@
+package calculate
+
+import (
+	"strings"
+	"testing"
+
+	"owl-engine/pkg/model/apiModel"
+)
+
+func TestCompilePlanGroupBy(t *testing.T) {
+	var cases = []struct {
+		groupBy  []string
+		interval string
+		err      string
+	}{
+		{groupBy: []string{"host"}},
+		{groupBy: []string{"time(1m)", "host"}},
+		{groupBy: []string{"time(90s)"}},
+		{groupBy: []string{"time(1m)); DROP MEASUREMENT x; SELECT (1"}, err: "group_by is incorrect"},
+		{groupBy: []string{"time(1m),host"}, err: "group_by is incorrect"},
+		{groupBy: []string{"time(1.5m)"}, err: "group_by is incorrect"},
+		{groupBy: []string{"time(now())"}, err: "group_by is incorrect"},
+		{groupBy: []string{"time(0s)"}, err: "group_by is incorrect"},
+		{groupBy: []string{"host"}, interval: "90s"},
+		{groupBy: []string{"host"}, interval: "10ms"},
+		{interval: "1m) fill(none); DROP MEASUREMENT x; SELECT (1", err: "interval"},
+		// InfluxQL、Flux 与 time.ParseDuration 的写法不一致或不支持的时间长度
+		{interval: "1.5m", err: "interval"},
+		{interval: "-1m", err: "interval"},
+		{interval: "0s", err: "interval"},
+		{interval: "1h30m", err: "interval"},
+		{interval: "1d", err: "interval"},
+		{interval: "5µs", err: "interval"},
+		{interval: "5us", err: "interval"},
+	}
+
+	for _, c := range cases {
+		var data = &apiModel.MathRule{
+			CalculateType: 1,
+			Express:       "[A] > 1",
+			MetricList:    map[string]string{"A": "cpu"},
+			TimeWindow:    map[string][]string{"A": {"-5m", "0m"}},
+			GroupBy:       c.groupBy,
+			Interval:      c.interval,
+		}
+
+		plan, err := compilePlan(data)
+		if c.err == "" {
+			if err != nil {
+				t.Errorf("compilePlan(%v) error: %s", c.groupBy, err.Error())
+			} else if q, ok := plan.Queries["A"].(queryTemplate); !ok || !strings.Contains(q.Tail, "GROUP BY") {
+				t.Errorf("compilePlan(%v) query = %+v", c.groupBy, plan.Queries["A"])
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("compilePlan(%v, %s) error = %v, want %s", c.groupBy, c.interval, err, c.err)
+		}
+	}
+}
+
+func TestSampleResult(t *testing.T) {
+	var cases = []struct {
+		express string
+		want    interface{}
+		err     bool
+	}{
+		{express: "[A] > 1", want: false},
+		{express: "[A] / [B]"},
+		// 因子均为 0 时函数报错, 以其它样本值校验
+		{express: "pct_change([A], [B]) > 20", want: false},
+		{express: "log([A], 2) >= 1", want: true},
+		{express: "abs(1, 2)", err: true},
+	}
+
+	for _, c := range cases {
+		result, err := sampleResult(&apiModel.MathRule{Express: c.express})
+		if c.err {
+			if err == nil {
+				t.Errorf("sampleResult(%s) = %v, want error", c.express, result)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("sampleResult(%s) error: %s", c.express, err.Error())
+		} else if c.want != nil && result != c.want {
+			t.Errorf("sampleResult(%s) = %v, want %v", c.express, result, c.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package calculate
+
+import (
+	"sync"
+	"time"
+
+	"owl-engine/pkg/lib/labels"
+	"owl-engine/pkg/xlogs"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 规则下单个序列最近一次的计算状态, 用于查询无数据时保持之前的状态及组合规则的计算
+type ruleState struct {
+	Name      string                 // 规则名称
+	Origin    string                 // 规则的来源
+	Firing    bool                   // 最近一次计算是否触发告警
+	CalIndex  string                 // 计算的指标名称
+	Params    map[string]interface{} // 最近一次计算的因子值
+	Detail    string                 // 最近一次告警内容的补充说明
+	Tags      map[string]string      // 序列的标签集
+	Labels    map[string]string      // 告警标签, 规则标签与序列的标签集合并后的标签
+	Level     int8                   // 告警中的级别
+	AlertId   string                 // 告警中的告警事件 id, 级别变化时原地升级或降级
+	ExpiresAt time.Time              // 状态的有效期, 规则连续未能计算(如: 查询失败)超过有效期时视为未知; 为零值时不过期
+	UpdatedAt time.Time
+}
+
+// 状态有效期在规则第二次计算之后的宽限时间, 避免计算耗时导致状态在更新前过期
+const stateGrace = time.Minute
+
+// Stale 状态是否已过期
+func (s *ruleState) Stale(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && now.After(s.ExpiresAt)
+}
+
+// 依据规则的定时任务计算状态的有效期: 之后的第二次计算时间加上宽限时间, 即错过一次计算后状态过期
+// spec 为带时区的 crontab, 无法解析时不过期
+func stateExpiry(spec string, now time.Time) time.Time {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return schedule.Next(schedule.Next(now)).Add(stateGrace)
+}
+
+type ruleStateStore struct {
+	lock   sync.RWMutex
+	states map[string]map[string]*ruleState // 规则引用(如: math:12) --> 序列标识 --> 状态
+}
+
+// 规则计算状态, 仅保存在内存中, 服务重启或规则变更后重新计算
+var ruleStates = &ruleStateStore{states: make(map[string]map[string]*ruleState)}
+
+// 记录规则下某个序列的计算状态
+func (s *ruleStateStore) Set(ref, key string, state *ruleState) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.states[ref]; !ok {
+		s.states[ref] = make(map[string]*ruleState)
+	}
+	state.UpdatedAt = time.Now()
+	s.states[ref][key] = state
+}
+
+// 获取规则下所有序列的计算状态
+func (s *ruleStateStore) Get(ref string) map[string]*ruleState {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var result = make(map[string]*ruleState, len(s.states[ref]))
+	for key, state := range s.states[ref] {
+		var value = *state
+		result[key] = &value
+	}
+
+	return result
+}
+
+// 只保留规则下 keys 中的序列的状态: 本次计算中不再出现的序列视为已恢复, 删除其状态
+func (s *ruleStateStore) Retain(ref string, keys map[string]bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for key := range s.states[ref] {
+		if !keys[key] {
+			delete(s.states[ref], key)
+		}
+	}
+}
+
+// 将规则下所有序列置为正常状态, expiresAt 为状态新的有效期
+func (s *ruleStateStore) Resolve(ref string, expiresAt time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, state := range s.states[ref] {
+		state.Firing = false
+		state.ExpiresAt = expiresAt
+		state.UpdatedAt = time.Now()
+	}
+}
+
+// 延长规则下所有序列状态的有效期, 用于查询无数据时保持之前的状态
+func (s *ruleStateStore) Renew(ref string, expiresAt time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, state := range s.states[ref] {
+		state.ExpiresAt = expiresAt
+	}
+}
+
+// 删除规则的计算状态
+func (s *ruleStateStore) Delete(ref string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	delete(s.states, ref)
+}
+
+// 告警标签: 以序列的标签集展开规则标签中的模板后, 与序列的标签集合并, 同名标签以规则标签为准
+func alertLabels(name string, ruleLabels, tags map[string]string) map[string]string {
+	expanded, err := labels.Expand(ruleLabels, tags)
+	if err != nil {
+		xlogs.Errorf("rule name = {%s} %s", name, err.Error())
+	}
+
+	return labels.Merge(tags, expanded)
+}
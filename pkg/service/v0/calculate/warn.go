@@ -3,6 +3,7 @@ package calculate
 import (
 	"fmt"
 	"owl-engine/pkg/client/database"
+	"owl-engine/pkg/config"
 	"owl-engine/pkg/util"
 	"sync"
 	"time"
@@ -46,7 +47,7 @@ func Warn(stopCh <-chan struct{}, wg *sync.WaitGroup) {
 
 func (r *RuleWarn) Run() {
 	var warnRules = make([]string, 0)
-	timePast := util.DateTimeToString(time.Now().Add(-2 * time.Hour))
+	timePast := util.DateTimeToString(time.Now().In(config.Get().ServerOptions.Location()).Add(-2 * time.Hour))
 
 	for _, table := range []string{"engine_tbl_rules", "engine_tbl_logger_rules"} {
 		var names = make([]string, 0)
@@ -0,0 +1,322 @@
+package datasource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	dsClient "owl-engine/pkg/client/datasource"
+	datasourceDto "owl-engine/pkg/dao/mysql/datasource"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/dbModel"
+	"owl-engine/pkg/util"
+	"owl-engine/pkg/xlogs"
+)
+
+type datasource struct{}
+
+var DatasourceSrv = new(datasource)
+
+// 健康检查的超时时间
+const healthTimeout = 10 * time.Second
+
+// CheckDatasource 数据源合法性校验, 并以校验后的配置创建客户端
+func (d *datasource) CheckDatasource(data *apiModel.Datasource) (*dsClient.Connection, error) {
+	if strings.Compare(strings.TrimSpace(data.Name), "") == 0 {
+		return nil, errors.New("the datasource name cannot be empty")
+	}
+
+	// 数据源名称唯一
+	var condition = apiModel.DatasourceCondition{Name: data.Name, Page: 1, Size: 100}
+	if records, _, err := datasourceDto.DatasourceDto.SelectByCondition(&condition); err == nil {
+		for _, v := range *records {
+			if strings.Compare(v.Name, data.Name) == 0 && v.ID != data.Id {
+				return nil, errors.New("datasource already exists for name " + data.Name)
+			}
+		}
+	}
+
+	data.Type = strings.ToLower(data.Type)
+	switch data.Type {
+	case dsClient.TypeInfluxDB:
+		// 版本: 1 --- InfluxDB 1.x; 2 --- InfluxDB 2.x
+		switch data.Version {
+		case 0, 1:
+			data.Version = 1
+			if strings.Compare(data.Database, "") == 0 {
+				return nil, errors.New("the database of influxdb 1.x cannot be empty")
+			}
+		case 2:
+			if strings.Compare(data.Org, "") == 0 || (strings.Compare(data.Bucket, "") == 0 && strings.Compare(data.Database, "") == 0) {
+				return nil, errors.New("the org and bucket of influxdb 2.x cannot be empty")
+			}
+		default:
+			return nil, errors.New("the version of influxdb, 1 --- 1.x; 2 --- 2.x")
+		}
+	case dsClient.TypePrometheus, dsClient.TypeElasticsearch, dsClient.TypeLoki:
+		data.Version = 0
+	default:
+		return nil, errors.New("the type of datasource must be one of " + strings.Join(dsClient.Types, ", "))
+	}
+
+	// 是否跳过证书校验: 1 --- yes; 2 --- no
+	switch data.TLSSkipVerify {
+	case 0:
+		data.TLSSkipVerify = 2
+	case 1, 2:
+	default:
+		return nil, errors.New("whether to skip the tls verify, 1 --- yes; 2 --- no")
+	}
+
+	if data.Timeout < 0 {
+		return nil, errors.New("the timeout of datasource cannot be negative")
+	} else if data.Timeout == 0 {
+		data.Timeout = 30
+	}
+
+	var record = datasourceRecord(data)
+	return dsClient.NewConnection(&record)
+}
+
+// 接口参数转换为数据库记录
+func datasourceRecord(data *apiModel.Datasource) dbModel.Datasource {
+	endpoints := make([]string, 0, len(data.Endpoints))
+	for _, endpoint := range data.Endpoints {
+		endpoints = append(endpoints, dsClient.Endpoints(endpoint)...)
+	}
+
+	return dbModel.Datasource{
+		ID:              data.Id,
+		Name:            strings.TrimSpace(data.Name),
+		Type:            data.Type,
+		Version:         data.Version,
+		Endpoints:       strings.Join(endpoints, ","),
+		Username:        data.Username,
+		Password:        data.Password,
+		Token:           data.Token,
+		Org:             data.Org,
+		Database:        data.Database,
+		RetentionPolicy: data.RetentionPolicy,
+		Bucket:          data.Bucket,
+		TLSSkipVerify:   data.TLSSkipVerify,
+		TLSCA:           data.TLSCA,
+		Proxy:           data.Proxy,
+		Timeout:         data.Timeout,
+		Description:     data.Description,
+		Creator:         data.Creator,
+		Updater:         data.Updater,
+	}
+}
+
+// Datasource 将数据源的数据库记录转换为接口参数, 不返回密码及 token
+func Datasource(v *dbModel.Datasource) *apiModel.Datasource {
+	return &apiModel.Datasource{
+		Id:              v.ID,
+		Name:            v.Name,
+		Type:            v.Type,
+		Version:         v.Version,
+		Endpoints:       dsClient.Endpoints(v.Endpoints),
+		Username:        v.Username,
+		Org:             v.Org,
+		Database:        v.Database,
+		RetentionPolicy: v.RetentionPolicy,
+		Bucket:          v.Bucket,
+		TLSSkipVerify:   v.TLSSkipVerify,
+		TLSCA:           v.TLSCA,
+		Proxy:           v.Proxy,
+		Timeout:         v.Timeout,
+		Description:     v.Description,
+		Creator:         v.Creator,
+		Updater:         v.Updater,
+		CreatedAt:       util.DateTimeToString(v.CreatedAt),
+		UpdatedAt:       util.DateTimeToString(v.UpdatedAt),
+	}
+}
+
+// QueryDatasource 查询数据源
+func (d *datasource) QueryDatasource(condition *apiModel.DatasourceCondition) (*[]apiModel.Datasource, int64, error) {
+	var result = make([]apiModel.Datasource, 0)
+
+	records, count, err := datasourceDto.DatasourceDto.SelectByCondition(condition)
+	if err != nil {
+		xlogs.Errorf("query datasources from table %s error, %s", dbModel.Datasource{}.TableName(), err.Error())
+		return &result, 0, err
+	}
+
+	for _, v := range *records {
+		result = append(result, *Datasource(&v))
+	}
+
+	return &result, count, nil
+}
+
+// AddDatasource 添加数据源
+func (d *datasource) AddDatasource(data *apiModel.Datasource) error {
+	data.Id = 0
+	if strings.Compare(data.Creator, "") == 0 {
+		return errors.New("the creator value of the datasource must be specified")
+	}
+
+	conn, err := d.CheckDatasource(data)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+
+	var record = datasourceRecord(data)
+	record.CreatedAt = time.Now()
+	record.UpdatedAt = record.CreatedAt
+
+	if err := datasourceDto.DatasourceDto.Insert(&record); err != nil {
+		return err
+	}
+
+	data.Id = record.ID
+	return nil
+}
+
+// UpdateDatasource 更新数据源, 密码及 token 为空时保留原来的值, 连接地址或代理变更时需要重新填写
+func (d *datasource) UpdateDatasource(data *apiModel.Datasource) error {
+	if data.Id == 0 {
+		return errors.New("the datasource id should be a positive integer")
+	}
+
+	old, err := datasourceDto.DatasourceDto.SelectById(data.Id)
+	if err != nil {
+		return fmt.Errorf("query the datasource [%d] error: %s", data.Id, err.Error())
+	}
+	if err := reuseSecret(data, old); err != nil {
+		return err
+	}
+
+	// 被规则引用时不能修改数据源的类型
+	if strings.Compare(strings.ToLower(data.Type), old.Type) != 0 {
+		if count, err := datasourceDto.DatasourceDto.CountReferences([]int{int(data.Id)}); err != nil {
+			return err
+		} else if count > 0 {
+			return fmt.Errorf("the datasource is referenced by %d rules, its type cannot be changed", count)
+		}
+	}
+
+	conn, err := d.CheckDatasource(data)
+	if err != nil {
+		return err
+	}
+	conn.Close()
+
+	var record = datasourceRecord(data)
+	record.UpdatedAt = time.Now()
+
+	err = datasourceDto.DatasourceDto.Save(&record)
+	if err == nil {
+		dsClient.Invalidate(data.Id)
+	}
+
+	return err
+}
+
+// 密码及 token 为空时沿用原来的值; 连接地址或代理变更时不沿用, 避免原来的凭据被发送到新的地址
+func reuseSecret(data *apiModel.Datasource, old *dbModel.Datasource) error {
+	if strings.Compare(data.Password, "") != 0 && strings.Compare(data.Token, "") != 0 {
+		return nil
+	}
+
+	var record = datasourceRecord(data)
+	var moved = strings.Compare(record.Endpoints, strings.Join(dsClient.Endpoints(old.Endpoints), ",")) != 0 ||
+		strings.Compare(strings.TrimSpace(record.Proxy), strings.TrimSpace(old.Proxy)) != 0
+	if strings.Compare(data.Password, "") == 0 && strings.Compare(old.Password, "") != 0 {
+		if moved {
+			return errors.New("the endpoints or proxy of datasource changed, the password must be re-entered")
+		}
+		data.Password = old.Password
+	}
+	if strings.Compare(data.Token, "") == 0 && strings.Compare(old.Token, "") != 0 {
+		if moved {
+			return errors.New("the endpoints or proxy of datasource changed, the token must be re-entered")
+		}
+		data.Token = old.Token
+	}
+	return nil
+}
+
+// DeleteDatasource 删除数据源, 被规则引用的数据源不能删除
+func (d *datasource) DeleteDatasource(updater string, ids []int) error {
+	count, err := datasourceDto.DatasourceDto.CountReferences(ids)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("the datasources are referenced by %d rules and cannot be deleted", count)
+	}
+
+	err = datasourceDto.DatasourceDto.Delete(updater, ids)
+	if err == nil {
+		for _, id := range ids {
+			dsClient.Invalidate(uint(id))
+		}
+	}
+
+	return err
+}
+
+// Health 检查已保存的数据源的连通性及认证
+func (d *datasource) Health(ctx context.Context, id uint) (*apiModel.DatasourceHealth, error) {
+	record, err := datasourceDto.DatasourceDto.SelectById(id)
+	if err != nil {
+		return nil, fmt.Errorf("query the datasource [%d] error: %s", id, err.Error())
+	}
+
+	conn, err := dsClient.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return health(ctx, record, conn), nil
+}
+
+// CheckConnection 检查未保存的数据源配置的连通性及认证
+func (d *datasource) CheckConnection(ctx context.Context, data *apiModel.Datasource) (*apiModel.DatasourceHealth, error) {
+	conn, err := d.CheckDatasource(data)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return health(ctx, &conn.Record, conn), nil
+}
+
+func health(ctx context.Context, record *dbModel.Datasource, conn *dsClient.Connection) *apiModel.DatasourceHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	var result = &apiModel.DatasourceHealth{Id: record.ID, Name: record.Name, Type: record.Type}
+
+	start := time.Now()
+	err := conn.Health(ctx)
+	result.Latency = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Message = err.Error()
+	} else {
+		result.Healthy = true
+	}
+
+	return result
+}
+
+// Resolve 规则引用数据源时的校验: 数据源必须存在, 且类型为 types 之一; 返回数据源的类型
+func Resolve(id uint, types ...string) (string, error) {
+	record, err := datasourceDto.DatasourceDto.SelectById(id)
+	if err != nil {
+		return "", fmt.Errorf("the datasource [%d] referenced by datasource_id does not exist", id)
+	}
+
+	for _, t := range types {
+		if strings.Compare(record.Type, t) == 0 {
+			return record.Type, nil
+		}
+	}
+
+	return "", fmt.Errorf("the datasource [%d] is of type %s, the rule requires one of %s", id, record.Type, strings.Join(types, ", "))
+}
@@ -0,0 +1,44 @@
+package datasource
+
+import (
+	"strings"
+	"testing"
+
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/dbModel"
+)
+
+func TestReuseSecret(t *testing.T) {
+	var old = dbModel.Datasource{Endpoints: "http://127.0.0.1:8086", Proxy: "http://127.0.0.1:3128", Password: "secret", Token: "token"}
+
+	var cases = []struct {
+		name     string
+		data     apiModel.Datasource
+		password string
+		token    string
+		err      string
+	}{
+		{name: "unchanged", data: apiModel.Datasource{Endpoints: []string{"http://127.0.0.1:8086/"}, Proxy: "http://127.0.0.1:3128"},
+			password: "secret", token: "token"},
+		{name: "re-entered", data: apiModel.Datasource{Endpoints: []string{"http://10.0.0.1:8086"}, Password: "new", Token: "new"},
+			password: "new", token: "new"},
+		{name: "endpoints changed", data: apiModel.Datasource{Endpoints: []string{"http://10.0.0.1:8086"}, Proxy: "http://127.0.0.1:3128"},
+			err: "password must be re-entered"},
+		{name: "proxy changed", data: apiModel.Datasource{Endpoints: []string{"http://127.0.0.1:8086"}, Password: "new"},
+			err: "token must be re-entered"},
+	}
+
+	for _, c := range cases {
+		var data = c.data
+		err := reuseSecret(&data, &old)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: reuseSecret() error = %v, want %q", c.name, err, c.err)
+			}
+			continue
+		}
+		if err != nil || data.Password != c.password || data.Token != c.token {
+			t.Errorf("%s: reuseSecret() = %v, password %q token %q, want %q %q", c.name, err, data.Password, data.Token, c.password, c.token)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package metric
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	influxInit "owl-engine/pkg/client/influxdb"
+	"owl-engine/pkg/config"
+	influxDto "owl-engine/pkg/dao/influxdb"
+	metricDto "owl-engine/pkg/dao/mysql/metric"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/dbModel"
+
+	"github.com/influxdata/influxdb1-client/models"
+	client "github.com/influxdata/influxdb1-client/v2"
+)
+
+type metric struct{}
+
+var MetricSrv = new(metric)
+
+const (
+	maxPoints     = 10000 // 单次上报的指标值数量上限
+	maxPointBytes = 1024  // 单个指标值(json 或 line protocol)的长度上限, 用于限制请求体的大小
+	batchSize     = 1000  // 每批写入的指标值数量
+	creator       = "apiRobot"
+)
+
+// MaxBodyBytes 上报请求体的大小上限, 在解析之前限制, 避免超大的请求耗尽内存
+const MaxBodyBytes = maxPoints * maxPointBytes
+
+// 写入的存储, 与数学规则的数据源名称保持一致
+const (
+	storeInfluxDB = "influxdb"
+	storeMySQL    = "mysql"
+)
+
+// 时间戳的精度
+var precisions = map[string]time.Duration{
+	"s":  time.Second,
+	"ms": time.Millisecond,
+	"us": time.Microsecond,
+	"ns": time.Nanosecond,
+}
+
+// 标签中不能使用的名称, 与指标值的字段重名
+var reserved = map[string]bool{"metric": true, "origin": true, "type": true, "category": true, "value": true, "time": true}
+
+// 上报时未指定时间戳的指标值, 以接收的时间为时间戳
+type point struct {
+	apiModel.MetricPoint
+	timestamp time.Time
+}
+
+// Precision 时间戳的精度, 为空时为秒
+func Precision(precision string) (string, error) {
+	if strings.Compare(precision, "") == 0 {
+		return "s", nil
+	}
+	if _, ok := precisions[precision]; !ok {
+		return "", errors.New("the precision must be one of s, ms, us, ns, but got " + precision)
+	}
+	return precision, nil
+}
+
+// ParseLines 解析 InfluxDB line protocol 格式的指标值
+// measurement 为指标名, 标签 origin、type、category 为指标的基础字段, 其它标签为扩展标签, 只支持数值类型的 value 字段
+// 如: cpu_usage,origin=web,type=host,category=5,host=10.0.0.1 value=0.5 1700000000
+func ParseLines(body []byte, precision string) ([]apiModel.MetricPoint, error) {
+	precision, err := Precision(precision)
+	if err != nil {
+		return nil, err
+	}
+
+	// line protocol 中微秒及纳秒的精度为 u、n
+	var linePrecision = map[string]string{"s": "s", "ms": "ms", "us": "u", "ns": "n"}[precision]
+	lines, err := models.ParsePointsWithPrecision(body, time.Time{}, linePrecision)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]apiModel.MetricPoint, 0, len(lines))
+	for i, line := range lines {
+		var p = apiModel.MetricPoint{Metric: string(line.Name()), Tags: line.Tags().Map()}
+
+		p.Origin, p.Type = p.Tags["origin"], p.Tags["type"]
+		if category, ok := p.Tags["category"]; ok {
+			value, err := strconv.ParseInt(category, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: the category {%s} is not an integer", i+1, category)
+			}
+			p.Category = int8(value)
+		}
+		delete(p.Tags, "origin")
+		delete(p.Tags, "type")
+		delete(p.Tags, "category")
+
+		fields, err := line.Fields()
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err.Error())
+		}
+		for name, field := range fields {
+			if strings.Compare(name, "value") != 0 {
+				return nil, fmt.Errorf("line %d: only the field value is supported, but got %s", i+1, name)
+			}
+
+			var value float64
+			switch v := field.(type) {
+			case float64:
+				value = v
+			case int64:
+				value = float64(v)
+			case uint64:
+				value = float64(v)
+			default:
+				return nil, fmt.Errorf("line %d: the field value must be a number", i+1)
+			}
+			p.Value = &value
+		}
+
+		if !line.Time().IsZero() {
+			p.Time = line.Time().UnixNano() / int64(precisions[precision])
+		}
+		result = append(result, p)
+	}
+
+	return result, nil
+}
+
+// 指标值的合法性校验, 并计算其时间戳
+func check(data []apiModel.MetricPoint, precision string, now time.Time) ([]point, error) {
+	if len(data) == 0 {
+		return nil, errors.New("the metric points cannot be empty")
+	}
+	if len(data) > maxPoints {
+		return nil, fmt.Errorf("at most %d metric points can be pushed at a time, but got %d", maxPoints, len(data))
+	}
+
+	precision, err := Precision(precision)
+	if err != nil {
+		return nil, err
+	}
+
+	var result = make([]point, 0, len(data))
+	for i, p := range data {
+		switch {
+		case strings.Compare(strings.TrimSpace(p.Metric), "") == 0:
+			return nil, fmt.Errorf("point %d: the metric cannot be empty", i+1)
+		case strings.Compare(p.Origin, "") == 0 || strings.Compare(p.Type, "") == 0:
+			return nil, fmt.Errorf("point %d: the origin and type cannot be empty", i+1)
+		case p.Category < 1 || p.Category > 5:
+			return nil, fmt.Errorf("point %d: the category must be one of 1, 2, 3, 4, 5", i+1)
+		case p.Value == nil:
+			return nil, fmt.Errorf("point %d: the value cannot be empty", i+1)
+		case math.IsNaN(*p.Value) || math.IsInf(*p.Value, 0):
+			return nil, fmt.Errorf("point %d: the value must be a finite number", i+1)
+		case p.Time < 0:
+			return nil, fmt.Errorf("point %d: the time cannot be negative", i+1)
+		case p.Time > math.MaxInt64/int64(precisions[precision]):
+			return nil, fmt.Errorf("point %d: the time %d is out of range for precision %s", i+1, p.Time, precision)
+		}
+
+		for k, v := range p.Tags {
+			if strings.Compare(k, "") == 0 || strings.Compare(v, "") == 0 {
+				return nil, fmt.Errorf("point %d: the name and value of tags cannot be empty", i+1)
+			}
+			if reserved[k] {
+				return nil, fmt.Errorf("point %d: the tag {%s} is reserved", i+1, k)
+			}
+		}
+
+		var timestamp = now
+		if p.Time > 0 {
+			timestamp = time.Unix(0, p.Time*int64(precisions[precision]))
+		}
+		result = append(result, point{MetricPoint: p, timestamp: timestamp})
+	}
+
+	return result, nil
+}
+
+// Push 校验上报的指标值, 并分批写入 InfluxDB 或指标值表 engine_tbl_metric
+// 某一批写入失败时, 之前的批次已经写入, 返回已写入及失败的数量和错误
+func (m *metric) Push(ctx context.Context, condition *apiModel.MetricPushCondition, data []apiModel.MetricPoint) (*apiModel.MetricPushResult, error) {
+	points, err := check(data, condition.Precision, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var store = strings.ToLower(condition.Datasource)
+	if strings.Compare(store, "") == 0 {
+		store = storeMySQL
+		if influxInit.InfluxDBClient != nil || influxInit.FluxClient != nil {
+			store = storeInfluxDB
+		}
+	}
+
+	for start := 0; start < len(points); start += batchSize {
+		end := start + batchSize
+		if end > len(points) {
+			end = len(points)
+		}
+
+		switch store {
+		case storeInfluxDB:
+			err = writeInfluxDB(ctx, points[start:end])
+		case storeMySQL:
+			err = writeMySQL(points[start:end])
+		default:
+			return nil, errors.New("the datasource of metric must be one of influxdb, mysql")
+		}
+		if err != nil {
+			return &apiModel.MetricPushResult{Datasource: store, Written: start, Failed: len(points) - start}, fmt.Errorf("write metric points to %s error: %s", store, err.Error())
+		}
+	}
+
+	return &apiModel.MetricPushResult{Datasource: store, Written: len(points)}, nil
+}
+
+// 写入 InfluxDB: 指标名为 measurement, origin、type、category 及扩展标签为 tag, 指标值为 value 字段
+// 配置的 version 为 2 时写入 InfluxDB 2.x 的 bucket, 否则写入 InfluxDB 1.x 的 database/retentionPolicy
+func writeInfluxDB(ctx context.Context, points []point) error {
+	conf := config.Get()
+	if conf == nil || conf.InfluxDBOptions == nil {
+		return errors.New("influxdb is not configured")
+	}
+
+	var batch = make([]*client.Point, 0, len(points))
+	for _, p := range points {
+		var tags = make(map[string]string, len(p.Tags)+3)
+		for k, v := range p.Tags {
+			tags[k] = v
+		}
+		tags["origin"] = p.Origin
+		tags["type"] = p.Type
+		tags["category"] = strconv.Itoa(int(p.Category))
+
+		pt, err := client.NewPoint(p.Metric, tags, map[string]interface{}{"value": *p.Value}, p.timestamp)
+		if err != nil {
+			return err
+		}
+		batch = append(batch, pt)
+	}
+
+	if conf.InfluxDBOptions.Version == 2 {
+		return influxDto.Metric.WriteFlux(ctx, batch, conf.InfluxDBOptions.FluxBucket(), influxInit.FluxClient)
+	}
+
+	if influxInit.InfluxDBClient == nil {
+		return errors.New("influxdb does not initialize")
+	}
+	return influxDto.Metric.Write(batch, conf.InfluxDBOptions.Database, conf.InfluxDBOptions.RetentionPolicy, *influxInit.InfluxDBClient)
+}
+
+// 写入指标值表, 扩展标签以 json 格式存储在 extension 列中
+func writeMySQL(points []point) error {
+	var records = make([]dbModel.Metric, 0, len(points))
+	var now = time.Now()
+	for _, p := range points {
+		var extension = "{}"
+		if len(p.Tags) > 0 {
+			text, _ := json.Marshal(p.Tags)
+			extension = string(text)
+		}
+
+		records = append(records, dbModel.Metric{
+			MetricName: p.Metric,
+			Origin:     p.Origin,
+			Type:       p.Type,
+			Category:   int(p.Category),
+			Value:      *p.Value,
+			Time:       p.timestamp,
+			Creator:    creator,
+			Extension:  extension,
+			CreatedAt:  now,
+		})
+	}
+
+	return metricDto.MetricDto.Insert(records, batchSize)
+}
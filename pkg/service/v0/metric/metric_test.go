@@ -0,0 +1,136 @@
+package metric
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"owl-engine/pkg/model/apiModel"
+)
+
+func value(v float64) *float64 {
+	return &v
+}
+
+func TestParseLines(t *testing.T) {
+	var cases = []struct {
+		body      string
+		precision string
+		want      []apiModel.MetricPoint
+		err       string
+	}{
+		{
+			body: "cpu_usage,origin=web,type=host,category=5,host=10.0.0.1 value=0.5 1700000000",
+			want: []apiModel.MetricPoint{{Metric: "cpu_usage", Origin: "web", Type: "host", Category: 5, Value: value(0.5), Time: 1700000000,
+				Tags: map[string]string{"host": "10.0.0.1"}}},
+		},
+		{
+			// 指标名、标签中转义的空格、逗号及等号
+			body: `cpu\ usage,origin=web\,app,type=host,category=5,path=a\=b\ c value=1i`,
+			want: []apiModel.MetricPoint{{Metric: "cpu usage", Origin: "web,app", Type: "host", Category: 5, Value: value(1),
+				Tags: map[string]string{"path": "a=b c"}}},
+		},
+		{
+			// 空行及注释被忽略, 时间戳按精度换算
+			body:      "# comment\n\nmem,origin=db,type=mysql,category=4 value=2 1700000000123\n",
+			precision: "ms",
+			want:      []apiModel.MetricPoint{{Metric: "mem", Origin: "db", Type: "mysql", Category: 4, Value: value(2), Time: 1700000000123, Tags: map[string]string{}}},
+		},
+		{body: "cpu,origin=web,type=host,category=5", err: "missing fields"},
+		{body: "cpu,origin=web,type=host,category=5 value=1 17000x", err: "bad timestamp"},
+		{body: "cpu,origin=web,type=host,category=5 value=1 1700000000", precision: "m", err: "the precision"},
+		{body: "cpu,origin=web,type=host,category=x value=1", err: "line 1: the category {x} is not an integer"},
+		{body: "cpu,origin=web,type=host,category=5 usage=1", err: "only the field value is supported"},
+		{body: `cpu,origin=web,type=host,category=5 value="1"`, err: "must be a number"},
+		{body: "cpu,origin=web,type=host,category=5 value=1\ncpu,origin=web,type=host,category=x value=1", err: "line 2:"},
+		// json 与 line protocol 混合的请求体
+		{body: `[{"metric": "cpu", "value": 1}]` + "\ncpu,origin=web,type=host,category=5 value=1", err: "unable to parse"},
+		{body: `{"metric": "cpu", "origin": "web", "type": "host", "category": 5, "value": 1}`, err: "unable to parse"},
+	}
+
+	for _, c := range cases {
+		got, err := ParseLines([]byte(c.body), c.precision)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("ParseLines(%s) error = %v, want %s", c.body, err, c.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseLines(%s) error: %s", c.body, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("ParseLines(%s) = %+v, want %+v", c.body, got, c.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	var now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var base = func() apiModel.MetricPoint {
+		return apiModel.MetricPoint{Metric: "cpu", Origin: "web", Type: "host", Category: 5, Value: value(1)}
+	}
+
+	var cases = []struct {
+		name      string
+		point     func(p *apiModel.MetricPoint)
+		precision string
+		time      time.Time
+		err       string
+	}{
+		{name: "receive time", point: func(p *apiModel.MetricPoint) {}, time: now},
+		{name: "seconds", point: func(p *apiModel.MetricPoint) { p.Time = 1700000000 }, time: time.Unix(1700000000, 0)},
+		{name: "nanoseconds", point: func(p *apiModel.MetricPoint) { p.Time = 1700000000000000001 }, precision: "ns", time: time.Unix(1700000000, 1)},
+		{name: "empty metric", point: func(p *apiModel.MetricPoint) { p.Metric = " " }, err: "the metric cannot be empty"},
+		{name: "empty origin", point: func(p *apiModel.MetricPoint) { p.Origin = "" }, err: "the origin and type"},
+		{name: "bad category", point: func(p *apiModel.MetricPoint) { p.Category = 6 }, err: "the category"},
+		{name: "missing value", point: func(p *apiModel.MetricPoint) { p.Value = nil }, err: "the value cannot be empty"},
+		{name: "NaN value", point: func(p *apiModel.MetricPoint) { p.Value = value(math.NaN()) }, err: "finite number"},
+		{name: "infinite value", point: func(p *apiModel.MetricPoint) { p.Value = value(math.Inf(1)) }, err: "finite number"},
+		{name: "negative time", point: func(p *apiModel.MetricPoint) { p.Time = -1 }, err: "cannot be negative"},
+		{name: "overflowing time", point: func(p *apiModel.MetricPoint) { p.Time = math.MaxInt64 / 1000 }, err: "out of range"},
+		{name: "overflowing ms", point: func(p *apiModel.MetricPoint) { p.Time = math.MaxInt64/int64(time.Millisecond) + 1 }, precision: "ms", err: "out of range"},
+		{name: "max ms", point: func(p *apiModel.MetricPoint) { p.Time = math.MaxInt64 / int64(time.Millisecond) }, precision: "ms",
+			time: time.Unix(0, math.MaxInt64/int64(time.Millisecond)*int64(time.Millisecond))},
+		{name: "empty tag", point: func(p *apiModel.MetricPoint) { p.Tags = map[string]string{"host": ""} }, err: "tags cannot be empty"},
+		{name: "reserved tag", point: func(p *apiModel.MetricPoint) { p.Tags = map[string]string{"value": "x"} }, err: "is reserved"},
+		{name: "bad precision", point: func(p *apiModel.MetricPoint) {}, precision: "m", err: "the precision"},
+	}
+
+	for _, c := range cases {
+		var p = base()
+		c.point(&p)
+
+		got, err := check([]apiModel.MetricPoint{base(), p}, c.precision, now)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: error = %v, want %s", c.name, err, c.err)
+			} else if c.precision == "" && !strings.HasPrefix(err.Error(), "point 2:") {
+				t.Errorf("%s: error = %s, want the index of the point", c.name, err.Error())
+			}
+			continue
+		}
+		if err != nil || len(got) != 2 || !got[1].timestamp.Equal(c.time) {
+			t.Errorf("%s: check = %+v %v, want time %s", c.name, got, err, c.time)
+		}
+	}
+
+	if _, err := check(nil, "", now); err == nil {
+		t.Errorf("check with no points should fail")
+	}
+	if _, err := check(make([]apiModel.MetricPoint, maxPoints+1), "", now); err == nil || !strings.Contains(err.Error(), "at most") {
+		t.Errorf("check with too many points error = %v", err)
+	}
+}
+
+func TestPushDatasource(t *testing.T) {
+	var data = []apiModel.MetricPoint{{Metric: "cpu", Origin: "web", Type: "host", Category: 5, Value: value(1)}}
+	result, err := MetricSrv.Push(context.Background(), &apiModel.MetricPushCondition{Datasource: "prometheus"}, data)
+	if err == nil || result != nil {
+		t.Errorf("Push to prometheus = %+v %v, want an error without result", result, err)
+	}
+}
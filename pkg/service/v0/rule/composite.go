@@ -0,0 +1,265 @@
+package rule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	influxDto "owl-engine/pkg/dao/influxdb"
+	ruleDto "owl-engine/pkg/dao/mysql/rule"
+	"owl-engine/pkg/model/apiModel"
+	"owl-engine/pkg/model/dbModel"
+	"owl-engine/pkg/service/v0/calculate"
+	"owl-engine/pkg/xlogs"
+
+	"github.com/robfig/cron/v3"
+)
+
+type compositeRule struct{}
+
+var CompositeRuleSrv = new(compositeRule)
+
+// CheckRule 规则合法性校验
+func (c *compositeRule) CheckRule(data *apiModel.CompositeRule) (bool, error) {
+	if strings.Compare(data.Name, "") == 0 {
+		return false, errors.New("the rule name cannot be empty")
+	}
+
+	// 规则名称唯一
+	var condition = apiModel.CompositeRuleCondition{Name: data.Name, Page: 1, Size: 100}
+	if records, _, err := ruleDto.CompositeDto.SelectByCondition(&condition); err == nil {
+		for _, v := range *records {
+			if strings.Compare(v.Name, data.Name) == 0 && v.ID != data.Id {
+				return false, errors.New("rule already exists for rule name " + data.Name)
+			}
+		}
+	}
+
+	// 表达式及告警模板的校验
+	if err := calculate.CheckComposite(data); err != nil {
+		return false, err
+	}
+
+	// 被引用的规则必须存在
+	refs, _ := calculate.CompositeRefs(data.Express)
+	for kind, ids := range refs {
+		var count int64
+		var err error
+		switch kind {
+		case calculate.RefMath:
+			_, count, err = ruleDto.RuleDto.SelectByIds(ids)
+		case calculate.RefLogger:
+			_, count, err = new(dbModel.LoggerRule).SelectById(ids)
+		}
+		if err != nil {
+			return false, err
+		}
+		if int(count) != len(distinct(ids)) {
+			return false, fmt.Errorf("the %s rules referenced by express do not exist: %v", kind, ids)
+		}
+	}
+
+	// 匹配标签的校验: 不能为空, 且不能包含 ','
+	for _, label := range data.MatchOn {
+		if strings.TrimSpace(label) == "" || strings.Contains(label, ",") {
+			return false, errors.New("the parameter match_on is set incorrectly, label name cannot be empty or contain ','")
+		}
+	}
+
+	// 静默的校验: 1 --- yes; 2 --- no
+	switch data.Silent {
+	case 0:
+		data.Silent = 2
+	case 1, 2:
+	default:
+		return false, errors.New("whether to silence the referenced rules, 1 --- yes; 2 --- no")
+	}
+
+	// 静默的标签过滤条件的校验
+	if _, err := influxDto.Compile(data.SilenceFilters); err != nil {
+		return false, errors.New("silence_filters: " + err.Error())
+	}
+
+	// 告警接收人列表校验: 不能为空
+	if len(data.GroupId) == 0 && len(data.WebHooks) == 0 {
+		return false, errors.New("web_hooks: " + "at least one item in the alert recipient list cannot be empty")
+	}
+
+	// 关于 crontab 的表达式正则校验
+	if _, err := cron.ParseStandard(data.Crontab); err != nil {
+		return false, errors.New("cron express: " + err.Error())
+	}
+
+	return true, nil
+}
+
+// 去除重复的 ID
+func distinct(ids []int) []int {
+	var seen = make(map[int]bool, len(ids))
+	var result = make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// QueryRule 查询规则
+func (c *compositeRule) QueryRule(condition *apiModel.CompositeRuleCondition) (*[]apiModel.CompositeRule, int64, error) {
+	var result = make([]apiModel.CompositeRule, 0)
+
+	records, count, err := ruleDto.CompositeDto.SelectByCondition(condition)
+	if err != nil {
+		xlogs.Errorf("query composite rules from table %s error, %s", dbModel.CompositeRule{}.TableName(), err.Error())
+		return &result, 0, err
+	}
+
+	for _, v := range *records {
+		result = append(result, *calculate.CompositeRule(&v))
+	}
+
+	return &result, count, nil
+}
+
+// 接口参数转换为数据库记录
+func compositeRecord(data *apiModel.CompositeRule) dbModel.CompositeRule {
+	var filters string
+	if data.SilenceFilters != nil {
+		filterStr, _ := json.Marshal(data.SilenceFilters)
+		filters = string(filterStr)
+	}
+
+	return dbModel.CompositeRule{
+		ID:                data.Id,
+		Name:              data.Name,
+		Express:           data.Express,
+		MatchOn:           strings.Join(data.MatchOn, ","),
+		Silent:            data.Silent,
+		SilenceFilters:    filters,
+		Template:          data.Template,
+		Level:             data.Level,
+		Creator:           data.Creator,
+		Updater:           data.Updater,
+		ResponsiblePeople: data.ResponsiblePeople,
+		Crontab:           data.Crontab,
+		Switch:            data.Switch,
+		Inuse:             data.Inuse,
+		GroupIp:           strings.Replace(strings.Trim(fmt.Sprint(data.GroupId), "[]"), " ", ",", -1),
+		WebHooks:          strings.Join(data.WebHooks, ","),
+		Description:       data.Description,
+	}
+}
+
+// AddRule 添加规则
+func (c *compositeRule) AddRule(data *apiModel.CompositeRule) error {
+	data.Id = 0
+	if _, err := c.CheckRule(data); err != nil {
+		return err
+	}
+
+	var record = compositeRecord(data)
+	record.CreatedAt = time.Now()
+
+	if err := ruleDto.CompositeDto.Insert(&record); err != nil {
+		return err
+	}
+
+	data.Id = record.ID
+	var ch = make(map[string]*apiModel.CompositeRule)
+	ch["ADD"] = data
+	calculate.CompositeRuleCh <- ch
+
+	return nil
+}
+
+// UpdateRule 更新规则
+func (c *compositeRule) UpdateRule(data *apiModel.CompositeRule) error {
+	if data.Id == 0 {
+		return errors.New("the rule id should be a positive integer")
+	}
+
+	if _, err := c.CheckRule(data); err != nil {
+		return err
+	}
+
+	var record = compositeRecord(data)
+	record.UpdatedAt = time.Now()
+
+	err := ruleDto.CompositeDto.Save(&record)
+	if err == nil {
+		var ch = make(map[string]*apiModel.CompositeRule)
+		ch["UPDATE"] = data
+		calculate.CompositeRuleCh <- ch
+	}
+
+	return err
+}
+
+// DeleteRule 删除规则
+func (c *compositeRule) DeleteRule(updater string, ids []int) error {
+	// 查询记录, 获取需要删除的规则名称
+	records, _, err := ruleDto.CompositeDto.SelectByIds(ids)
+	if err != nil {
+		return err
+	}
+
+	err = ruleDto.CompositeDto.Delete(updater, ids)
+	if err == nil {
+		for _, v := range *records {
+			var ch = make(map[string]*apiModel.CompositeRule)
+			ch["DELETE"] = &apiModel.CompositeRule{
+				Id:   v.ID,
+				Name: v.Name,
+			}
+			calculate.CompositeRuleCh <- ch
+		}
+	}
+
+	return err
+}
+
+// DisableOrEnableForRule 禁用或开启规则
+func (c *compositeRule) DisableOrEnableForRule(id uint, status int8, updater string) (string, error) {
+	if id == 0 {
+		return "", errors.New("the rule id should be a positive integer")
+	}
+
+	if strings.Compare(updater, "") == 0 {
+		return "", errors.New("the updater value of the rule must be specified")
+	}
+
+	// 1 --- 开启; 2 --- 禁用
+	switch status {
+	case 1, 2:
+	default:
+		return "", errors.New("whether to enable, 1 --- on; 2 --- off")
+	}
+
+	var err error
+	err = ruleDto.CompositeDto.Update(&dbModel.CompositeRule{
+		ID:      id,
+		Switch:  status,
+		Updater: updater,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	records, _, err := ruleDto.CompositeDto.SelectByIds([]int{int(id)})
+	if err != nil {
+		return "", err
+	}
+
+	for _, v := range *records {
+		// 进行信号处理, 禁用的规则在同步时不再执行
+		var ch = make(map[string]*apiModel.CompositeRule)
+		ch["UPDATE"] = calculate.CompositeRule(&v)
+		calculate.CompositeRuleCh <- ch
+	}
+
+	return "ok", nil
+}
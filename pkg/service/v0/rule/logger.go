@@ -3,25 +3,22 @@ package rule
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net"
-	"net/http"
-	"net/url"
 	"owl-engine/pkg/xlogs"
 	"strconv"
 	"strings"
 	"time"
 
-	appConfig "owl-engine/pkg/config"
+	dsClient "owl-engine/pkg/client/datasource"
+	"owl-engine/pkg/lib/labels"
 	"owl-engine/pkg/model/apiModel"
 	"owl-engine/pkg/model/dbModel"
 	"owl-engine/pkg/service/v0/calculate"
+	datasourceSrv "owl-engine/pkg/service/v0/datasource"
 	"owl-engine/pkg/util"
 
-	"github.com/elastic/go-elasticsearch/v7"
 	"github.com/robfig/cron/v3"
 )
 
@@ -48,62 +45,41 @@ func (l *loggerRule) CheckRule(data *apiModel.LoggerRule) (bool, error) {
 		return false, errors.New("rule already exists for rule name " + data.Name)
 	}
 
-	// 关键字段值不能为空
-	if strings.Compare(data.MessageField, "") == 0 {
-		return false, errors.New("the message field cannot be empty")
-	}
-
 	// 关于 crontab 的表达式正则校验
 	if _, err := cron.ParseStandard(data.Crontab); err != nil {
 		return false, errors.New("cron express: " + err.Error())
 	}
 
-	// 关于es链接的验证
-	if strings.Compare(data.Source, "es") != 0 {
-		return false, errors.New("currently only supports es cluster to query data")
-	}
-
-	// 测试环境使用代理
-	conf := appConfig.Get()
-	esConfig := elasticsearch.Config{}
-	if conf.ServerOptions.EnableProxy && strings.Compare(conf.ServerOptions.Proxy, "") != 0 {
-		proxyUrl, _ := url.Parse(conf.ServerOptions.Proxy)
-		esConfig = elasticsearch.Config{
-			Addresses:  strings.Split(data.Address, ","),
-			Username:   data.Username,
-			Password:   data.Password,
-			MaxRetries: 3,
-			Transport: &http.Transport{
-				MaxIdleConnsPerHost:   10,
-				ResponseHeaderTimeout: 5 * time.Second,
-				DialContext: (&net.Dialer{
-					Timeout: 5 * time.Second,
-				}).DialContext,
-				Proxy:             http.ProxyURL(proxyUrl),
-				TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS11},
-				DisableKeepAlives: true, // 使用短链接进行请求, 注意: http 的 keepalive 和 tcp 的 keepalive 的区别
-			},
-		}
-	} else {
-		esConfig = elasticsearch.Config{
-			Addresses:  strings.Split(data.Address, ","),
-			Username:   data.Username,
-			Password:   data.Password,
-			MaxRetries: 3,
-			Transport: &http.Transport{
-				MaxIdleConnsPerHost:   10,
-				ResponseHeaderTimeout: 5 * time.Second,
-				DialContext: (&net.Dialer{
-					Timeout: 5 * time.Second,
-				}).DialContext,
-				TLSClientConfig:   &tls.Config{MinVersion: tls.VersionTLS11},
-				DisableKeepAlives: true, // 使用短链接进行请求, 注意: http 的 keepalive 和 tcp 的 keepalive 的区别
-			},
+	// 规则标签的校验
+	if err := labels.Validate(data.Labels); err != nil {
+		return false, errors.New("labels: " + err.Error())
+	}
+
+	switch data.Source {
+	case "es":
+		return l.checkES(data)
+	case "loki":
+		return l.checkLoki(data)
+	default:
+		return false, errors.New("currently only supports es and loki to query data")
+	}
+}
+
+// 关于 es 链接及查询语句的验证
+func (l *loggerRule) checkES(data *apiModel.LoggerRule) (bool, error) {
+	// 关键字段值不能为空
+	if strings.Compare(data.MessageField, "") == 0 {
+		return false, errors.New("the message field cannot be empty")
+	}
+
+	// 引用数据源时, 数据源必须为 elasticsearch
+	if data.DatasourceId > 0 {
+		if _, err := datasourceSrv.Resolve(data.DatasourceId, dsClient.TypeElasticsearch); err != nil {
+			return false, err
 		}
 	}
 
-	var err error
-	es, err := elasticsearch.NewClient(esConfig)
+	es, err := calculate.ESClient(data)
 	if err == nil {
 		// 将 sql string 转换为 map[string]interface
 		var query map[string]interface{}
@@ -126,7 +102,39 @@ func (l *loggerRule) CheckRule(data *apiModel.LoggerRule) (bool, error) {
 			return false, errors.New(fmt.Sprintf("query sql: %s error: %s", data.Sql, err.Error()))
 		}
 	} else {
-		return false, errors.New(fmt.Sprintf("creating the elasticsearch client error: %s", err.Error()))
+		return false, err
+	}
+
+	return true, nil
+}
+
+// 关于 loki 链接及 LogQL 的验证, 以统计命中条数的查询校验 LogQL 的语法
+func (l *loggerRule) checkLoki(data *apiModel.LoggerRule) (bool, error) {
+	if strings.Compare(strings.TrimSpace(data.Sql), "") == 0 {
+		return false, errors.New("the logql of loki cannot be empty")
+	}
+
+	window, _, err := calculate.LokiWindow(data.TimeWindow)
+	if err != nil {
+		return false, err
+	}
+	data.TimeWindow = window
+
+	// 引用数据源时, 数据源必须为 loki
+	if data.DatasourceId > 0 {
+		if _, err := datasourceSrv.Resolve(data.DatasourceId, dsClient.TypeLoki); err != nil {
+			return false, err
+		}
+	}
+
+	cli, err := calculate.LokiClient(data)
+	if err != nil {
+		return false, err
+	}
+
+	query := calculate.LokiCountQuery(data.Sql, window)
+	if _, err := cli.Query(context.Background(), query, time.Now(), 0); err != nil {
+		return false, errors.New(fmt.Sprintf("query logql: %s error: %s", query, err.Error()))
 	}
 
 	return true, nil
@@ -149,6 +157,9 @@ func (l *loggerRule) QueryRule(condition *apiModel.LoggerRuleCondition) (*[]apiM
 				}
 			}
 
+			var ruleLabels map[string]string
+			_ = json.Unmarshal([]byte(value.Labels), &ruleLabels)
+
 			result = append(result, apiModel.LoggerRule{
 				Id:                value.ID,
 				Name:              value.Name,
@@ -156,14 +167,17 @@ func (l *loggerRule) QueryRule(condition *apiModel.LoggerRuleCondition) (*[]apiM
 				Address:           value.Address,
 				Username:          value.Username,
 				Password:          value.Password,
+				DatasourceId:      value.DatasourceId,
 				Index:             value.Index,
 				MessageField:      value.MessageField,
 				Sql:               value.Sql,
+				TimeWindow:        value.TimeWindow,
 				Threshold:         value.Threshold,
 				Origin:            value.Origin,
 				BusinessType:      value.BusinessType,
 				Category:          value.Category,
 				Level:             value.Level,
+				Labels:            ruleLabels,
 				Creator:           value.Creator,
 				Updater:           value.Updater,
 				ResponsiblePeople: value.ResponsiblePeople,
@@ -178,7 +192,7 @@ func (l *loggerRule) QueryRule(condition *apiModel.LoggerRuleCondition) (*[]apiM
 		}
 	}
 
-	return &result, count, nil
+	return &result, count, err
 }
 
 // AddRule 添加规则
@@ -188,20 +202,24 @@ func (l *loggerRule) AddRule(data *apiModel.LoggerRule) error {
 		return err
 	}
 
+	ruleLabels, _ := json.Marshal(data.Labels)
 	rs := dbModel.LoggerRule{
 		Name:              data.Name,
 		Source:            data.Source,
 		Address:           data.Address,
 		Username:          data.Username,
 		Password:          data.Password,
+		DatasourceId:      data.DatasourceId,
 		Index:             data.Index,
 		MessageField:      data.MessageField,
 		Sql:               data.Sql,
+		TimeWindow:        data.TimeWindow,
 		Threshold:         data.Threshold,
 		Origin:            data.Origin,
 		BusinessType:      data.BusinessType,
 		Category:          data.Category,
 		Level:             data.Level,
+		Labels:            string(ruleLabels),
 		Creator:           data.Creator,
 		Updater:           data.Updater,
 		ResponsiblePeople: data.ResponsiblePeople,
@@ -214,6 +232,7 @@ func (l *loggerRule) AddRule(data *apiModel.LoggerRule) error {
 	}
 
 	if err := rs.Insert(); err == nil {
+		data.Id = rs.ID
 		// 填充信号量
 		ch := make(map[string]*apiModel.LoggerRule)
 		ch["ADD"] = data
@@ -233,6 +252,7 @@ func (l *loggerRule) UpdateRule(data *apiModel.LoggerRule) error {
 		}
 	}
 
+	ruleLabels, _ := json.Marshal(data.Labels)
 	rs := dbModel.LoggerRule{
 		ID:                data.Id,
 		Name:              data.Name,
@@ -240,14 +260,17 @@ func (l *loggerRule) UpdateRule(data *apiModel.LoggerRule) error {
 		Address:           data.Address,
 		Username:          data.Username,
 		Password:          data.Password,
+		DatasourceId:      data.DatasourceId,
 		Index:             data.Index,
 		MessageField:      data.MessageField,
 		Sql:               data.Sql,
+		TimeWindow:        data.TimeWindow,
 		Threshold:         data.Threshold,
 		Origin:            data.Origin,
 		BusinessType:      data.BusinessType,
 		Category:          data.Category,
 		Level:             data.Level,
+		Labels:            string(ruleLabels),
 		Creator:           data.Creator,
 		Updater:           data.Updater,
 		ResponsiblePeople: data.ResponsiblePeople,
@@ -340,37 +363,8 @@ func (l *loggerRule) DisableOrEnableForRule(id uint, status int8, updater string
 			// 进行信号处理
 			switch status {
 			case 1: // 开启
-				var groupIds = make([]int, 0)
-				for _, id := range strings.Split(v.GroupIp, ",") {
-					groupIds = append(groupIds, util.StringToInt(id))
-				}
-
 				ch := make(map[string]*apiModel.LoggerRule)
-				ch["ADD"] = &apiModel.LoggerRule{
-					Id:                v.ID,
-					Name:              v.Name,
-					Source:            v.Source,
-					Address:           v.Address,
-					Username:          v.Username,
-					Password:          v.Password,
-					Index:             v.Index,
-					MessageField:      v.MessageField,
-					Sql:               v.Sql,
-					Threshold:         v.Threshold,
-					Origin:            v.Origin,
-					BusinessType:      v.BusinessType,
-					Category:          v.Category,
-					Level:             v.Level,
-					Creator:           v.Creator,
-					Updater:           v.Updater,
-					ResponsiblePeople: v.ResponsiblePeople,
-					Crontab:           v.Crontab,
-					Switch:            v.Switch,
-					Inuse:             v.Inuse,
-					GroupId:           groupIds,
-					Description:       v.Description,
-					CreatedAt:         util.DateTimeToString(v.CreatedAt),
-				}
+				ch["ADD"] = calculate.LoggerRule(&v)
 
 				calculate.LoggerRuleCh <- ch
 			case 2: // 禁用
@@ -386,3 +380,20 @@ func (l *loggerRule) DisableOrEnableForRule(id uint, status int8, updater string
 
 	return "ok", err
 }
+
+// Evaluate 以真实的日志数据源立即计算一次已保存的日志规则, 不记录计算状态也不发送告警
+func (l *loggerRule) Evaluate(ctx context.Context, id int) (*apiModel.LoggerEvaluateResult, error) {
+	if id <= 0 {
+		return nil, errors.New("the rule id should be a positive integer")
+	}
+
+	records, count, err := new(dbModel.LoggerRule).SelectById([]int{id})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || len(*records) == 0 {
+		return nil, fmt.Errorf("the rule with id %d does not exist", id)
+	}
+
+	return calculate.EvaluateLogger(ctx, calculate.LoggerRule(&(*records)[0]))
+}
@@ -1,21 +1,25 @@
 package rule
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"reflect"
 	"regexp"
 	"strings"
 	"time"
 
+	dsClient "owl-engine/pkg/client/datasource"
+	influxDto "owl-engine/pkg/dao/influxdb"
 	ruleDto "owl-engine/pkg/dao/mysql/rule"
+	"owl-engine/pkg/lib/labels"
 	"owl-engine/pkg/model/apiModel"
 	"owl-engine/pkg/model/dbModel"
 	"owl-engine/pkg/service/v0/calculate"
+	datasourceSrv "owl-engine/pkg/service/v0/datasource"
 	"owl-engine/pkg/util"
+	"owl-engine/pkg/xlogs"
 
-	"github.com/Knetic/govaluate"
 	"github.com/robfig/cron/v3"
 )
 
@@ -25,29 +29,44 @@ var MathRuleSrv = new(mathRule)
 
 // CheckRule 规则合法性校验
 func (r *mathRule) CheckRule(data *apiModel.MathRule) (bool, error) {
-	// 查看数据库记录是否已经存在
-	var condition = apiModel.MathRuleCondition{
-		Id:                data.Id,
-		Name:              data.Name,
-		Creator:           data.Creator,
-		ResponsiblePeople: data.ResponsiblePeople,
-		Origin:            data.Origin,
-		Type:              data.Type,
-		Category:          data.Category,
-		Switch:            data.Switch,
-		Inuse:             data.Inuse,
-	}
-	if _, count, err := ruleDto.RuleDto.SelectByCondition(&condition); err == nil {
-		if count > 0 {
-			return false, errors.New("rule already exists for rule name " + data.Name)
+	// 旧版的扩展条件迁移为结构化的过滤条件, 无法解析时拒绝
+	if strings.Compare(data.ExtensionCondition, "") != 0 {
+		filters, err := influxDto.MigrateCondition(data.Filters, data.ExtensionCondition)
+		if err != nil {
+			return false, errors.New("extension_condition cannot be migrated to filters, please use filters instead: " + err.Error())
 		}
+		data.Filters = filters
+		data.ExtensionCondition = ""
+	}
+
+	// 标签过滤条件的校验
+	if _, err := influxDto.Compile(data.Filters); err != nil {
+		return false, errors.New("filters: " + err.Error())
+	}
+
+	// 规则标签的校验
+	if err := labels.Validate(data.Labels); err != nil {
+		return false, errors.New("labels: " + err.Error())
 	}
 
-	// 计算类型值校验
-	switch data.CalculateType {
-	case 1, 2, 3, 4, 5:
+	// 计算类型值校验: 只能为已注册的计算类型
+	aggregator, err := calculate.GetAggregator(data.CalculateType)
+	if err != nil {
+		return false, err
+	}
+
+	// 无数据处理策略的校验
+	switch strings.ToLower(data.NoData) {
+	case "", "alert", "keep", "ok":
 	default:
-		return false, errors.New("the parameter calculate_type is set incorrectly. example: 1 -- Max; 2 -- Min; 3 -- chainRatio; 4 -- TopN; 5 -- BottomN")
+		return false, errors.New("the parameter nodata is set incorrectly. example: alert, keep or ok")
+	}
+
+	// 规则时区的校验: 为空时使用服务的时区
+	if strings.Compare(data.Timezone, "") != 0 {
+		if _, err := util.LoadLocation(data.Timezone); err != nil {
+			return false, errors.New("the parameter timezone is set incorrectly, example: Asia/Shanghai")
+		}
 	}
 
 	// 持续时间的校验: 必须大于等于 1 的正整数
@@ -73,33 +92,16 @@ func (r *mathRule) CheckRule(data *apiModel.MathRule) (bool, error) {
 		return false, errors.New("the expression factor must be wrapped in [], example: [A] > 0")
 	}
 
-	// 计算 TopN 或 BottomN 计算类型, 只支持单因子
-	if data.CalculateType == 4 || data.CalculateType == 5 {
-		if len(metricList) != 1 {
-			return false, errors.New("the calculate_type 4 or 5 of TopN/BottomN rule types, it only supports single factor mode. example: [A] > 0")
+	// 分组标签的校验: 不能为空, 且不能为 time
+	for _, tag := range data.GroupBy {
+		if strings.TrimSpace(tag) == "" || strings.EqualFold(tag, "time") || strings.Contains(tag, ",") {
+			return false, errors.New("the parameter group_by is set incorrectly, tag name cannot be empty, time or contain ','")
 		}
 	}
 
-	params := make(map[string]interface{})
-	i := 0
-	for _, metric := range metricList {
-		params[metric[1]] = i
-	}
-
-	expr, err := govaluate.NewEvaluableExpression(data.Express)
-	if err != nil {
-		return false, errors.New("mathematical expression is incorrect, " + err.Error())
-	}
-
-	result, err := expr.Evaluate(params)
-	if result == nil || err != nil {
-		return false, errors.New("mathematical expression calculation is incorrect, " + err.Error())
-	}
-
-	// 对结果进行判定
-	vaReflect := reflect.TypeOf(result)
-	if strings.Compare(vaReflect.String(), "bool") != 0 {
-		return false, errors.New("incorrect regular expression, example: [A] > 0")
+	// 计算类型相关的校验, 包括表达式结果的类型
+	if err := aggregator.Validate(data); err != nil {
+		return false, err
 	}
 
 	// 关于时间窗口的校验
@@ -116,6 +118,33 @@ func (r *mathRule) CheckRule(data *apiModel.MathRule) (bool, error) {
 		}
 	}
 
+	// 引用数据源时, 规则的数据源为所引用数据源的类型
+	if data.DatasourceId > 0 {
+		datasourceType, err := datasourceSrv.Resolve(data.DatasourceId, dsClient.TypeInfluxDB, dsClient.TypePrometheus)
+		if err != nil {
+			return false, err
+		}
+		if strings.Compare(data.Datasource, "") != 0 && !strings.EqualFold(data.Datasource, datasourceType) {
+			return false, fmt.Errorf("the datasource %s does not match the type %s of datasource_id", data.Datasource, datasourceType)
+		}
+		data.Datasource = datasourceType
+	}
+
+	// 规则能否编译为执行计划: 与运行时使用同一份编译逻辑
+	if err := calculate.CheckPlan(data); err != nil {
+		return false, err
+	}
+
+	// 规则名称唯一, 更新时排除规则自身
+	var condition = apiModel.MathRuleCondition{Name: data.Name, Page: 1, Size: 100}
+	if records, _, err := ruleDto.RuleDto.SelectByCondition(&condition); err == nil {
+		for _, v := range *records {
+			if strings.Compare(v.Name, data.Name) == 0 && v.ID != data.Id {
+				return false, errors.New("rule already exists for rule name " + data.Name)
+			}
+		}
+	}
+
 	return true, nil
 }
 
@@ -135,6 +164,16 @@ func (r *mathRule) QueryRules(condition *apiModel.MathRuleCondition) (*[]apiMode
 					groupIds = append(groupIds, util.StringToInt(id))
 				}
 
+				// 标签过滤条件
+				var filters *apiModel.FilterGroup
+				_ = json.Unmarshal([]byte(v.Filters), &filters)
+				var baseline *apiModel.Baseline
+				_ = json.Unmarshal([]byte(v.Baseline), &baseline)
+				var levels []apiModel.LevelTier
+				_ = json.Unmarshal([]byte(v.Levels), &levels)
+				var ruleLabels map[string]string
+				_ = json.Unmarshal([]byte(v.Labels), &ruleLabels)
+
 				// 指标集
 				var metrics = make(map[string]string)
 				err := json.Unmarshal([]byte(v.MetricList), &metrics)
@@ -149,10 +188,26 @@ func (r *mathRule) QueryRules(condition *apiModel.MathRuleCondition) (*[]apiMode
 						Unit:               v.Unit,
 						TimeWindow:         window,
 						Duration:           v.Duration,
+						Interval:           v.Interval,
+						Fill:               v.Fill,
+						MatchCount:         v.MatchCount,
+						PointCount:         v.PointCount,
 						Origin:             v.Origin,
 						Type:               v.BusinessType,
 						Category:           v.Category,
 						ExtensionCondition: v.ExtensionCondition,
+						Filters:            filters,
+						GroupBy:            util.StringToStringSl(v.GroupBy),
+						NoData:             v.NoData,
+						AbsentFor:          v.AbsentFor,
+						Timezone:           v.Timezone,
+						Datasource:         v.Datasource,
+						DatasourceId:       v.DatasourceId,
+						Horizon:            v.Horizon,
+						ForecastMethod:     v.ForecastMethod,
+						Baseline:           baseline,
+						Levels:             levels,
+						Labels:             ruleLabels,
 						Level:              v.Level,
 						Creator:            v.Creator,
 						Updater:            v.Updater,
@@ -183,6 +238,10 @@ func (r *mathRule) AddRule(data *apiModel.MathRule) error {
 
 	window, _ := json.Marshal(data.TimeWindow)
 	metrics, _ := json.Marshal(data.MetricList)
+	filters, _ := json.Marshal(data.Filters)
+	baseline, _ := json.Marshal(data.Baseline)
+	levels, _ := json.Marshal(data.Levels)
+	ruleLabels, _ := json.Marshal(data.Labels)
 	var record = dbModel.Rule{
 		Name:               data.Name,
 		CalculateType:      data.CalculateType,
@@ -191,10 +250,26 @@ func (r *mathRule) AddRule(data *apiModel.MathRule) error {
 		Threshold:          data.Threshold,
 		TimeWindow:         string(window),
 		Duration:           data.Duration,
+		Interval:           data.Interval,
+		Fill:               data.Fill,
+		MatchCount:         data.MatchCount,
+		PointCount:         data.PointCount,
 		Origin:             data.Origin,
 		BusinessType:       data.Type,
 		Category:           data.Category,
 		ExtensionCondition: data.ExtensionCondition,
+		Filters:            string(filters),
+		GroupBy:            strings.Join(data.GroupBy, ","),
+		NoData:             data.NoData,
+		AbsentFor:          data.AbsentFor,
+		Timezone:           data.Timezone,
+		Datasource:         data.Datasource,
+		DatasourceId:       data.DatasourceId,
+		Horizon:            data.Horizon,
+		ForecastMethod:     data.ForecastMethod,
+		Baseline:           string(baseline),
+		Levels:             string(levels),
+		Labels:             string(ruleLabels),
 		Level:              data.Level,
 		Creator:            data.Creator,
 		Updater:            data.Updater,
@@ -209,6 +284,7 @@ func (r *mathRule) AddRule(data *apiModel.MathRule) error {
 	}
 
 	if err := ruleDto.RuleDto.Insert(&record); err == nil {
+		data.Id = record.ID
 		var ch = make(map[string]*apiModel.MathRule)
 		ch["ADD"] = data
 		calculate.MathSynchronizeRuleCh <- ch
@@ -222,13 +298,15 @@ func (r *mathRule) AddRule(data *apiModel.MathRule) error {
 func (r *mathRule) UpdateRule(data *apiModel.MathRule) error {
 	// 新规则校验
 	if _, err := r.CheckRule(data); err != nil {
-		if !strings.Contains(err.Error(), "rule already exists") {
-			return err
-		}
+		return err
 	}
 
 	window, _ := json.Marshal(data.TimeWindow)
 	metrics, _ := json.Marshal(data.MetricList)
+	filters, _ := json.Marshal(data.Filters)
+	baseline, _ := json.Marshal(data.Baseline)
+	levels, _ := json.Marshal(data.Levels)
+	ruleLabels, _ := json.Marshal(data.Labels)
 	var record = dbModel.Rule{
 		ID:                 data.Id,
 		Name:               data.Name,
@@ -239,10 +317,26 @@ func (r *mathRule) UpdateRule(data *apiModel.MathRule) error {
 		Unit:               data.Unit,
 		TimeWindow:         string(window),
 		Duration:           data.Duration,
+		Interval:           data.Interval,
+		Fill:               data.Fill,
+		MatchCount:         data.MatchCount,
+		PointCount:         data.PointCount,
 		Origin:             data.Origin,
 		BusinessType:       data.Type,
 		Category:           data.Category,
 		ExtensionCondition: data.ExtensionCondition,
+		Filters:            string(filters),
+		GroupBy:            strings.Join(data.GroupBy, ","),
+		NoData:             data.NoData,
+		AbsentFor:          data.AbsentFor,
+		Timezone:           data.Timezone,
+		Datasource:         data.Datasource,
+		DatasourceId:       data.DatasourceId,
+		Horizon:            data.Horizon,
+		ForecastMethod:     data.ForecastMethod,
+		Baseline:           string(baseline),
+		Levels:             string(levels),
+		Labels:             string(ruleLabels),
 		Level:              data.Level,
 		Creator:            data.Creator,
 		Updater:            data.Updater,
@@ -347,8 +441,18 @@ func (r *mathRule) DisableOrEnableForRule(id uint, status int8, updater string)
 					groupIds = append(groupIds, util.StringToInt(id))
 				}
 
+				var filters *apiModel.FilterGroup
+				_ = json.Unmarshal([]byte(v.Filters), &filters)
+				var baseline *apiModel.Baseline
+				_ = json.Unmarshal([]byte(v.Baseline), &baseline)
+				var levels []apiModel.LevelTier
+				_ = json.Unmarshal([]byte(v.Levels), &levels)
+				var ruleLabels map[string]string
+				_ = json.Unmarshal([]byte(v.Labels), &ruleLabels)
+
 				var ch = make(map[string]*apiModel.MathRule)
 				ch["ADD"] = &apiModel.MathRule{
+					Id:                 v.ID,
 					Name:               v.Name,
 					CalculateType:      v.CalculateType,
 					Express:            v.Express,
@@ -356,10 +460,26 @@ func (r *mathRule) DisableOrEnableForRule(id uint, status int8, updater string)
 					Threshold:          v.Threshold,
 					TimeWindow:         window,
 					Duration:           v.Duration,
+					Interval:           v.Interval,
+					Fill:               v.Fill,
+					MatchCount:         v.MatchCount,
+					PointCount:         v.PointCount,
 					Origin:             v.Origin,
 					Type:               v.BusinessType,
 					Category:           v.Category,
 					ExtensionCondition: v.ExtensionCondition,
+					Filters:            filters,
+					GroupBy:            util.StringToStringSl(v.GroupBy),
+					NoData:             v.NoData,
+					AbsentFor:          v.AbsentFor,
+					Timezone:           v.Timezone,
+					Datasource:         v.Datasource,
+					DatasourceId:       v.DatasourceId,
+					Horizon:            v.Horizon,
+					ForecastMethod:     v.ForecastMethod,
+					Baseline:           baseline,
+					Levels:             levels,
+					Labels:             ruleLabels,
 					Level:              v.Level,
 					Creator:            v.Creator,
 					Updater:            v.Updater,
@@ -387,3 +507,103 @@ func (r *mathRule) DisableOrEnableForRule(id uint, status int8, updater string)
 
 	return "ok", err
 }
+
+// CalculateTypes 已注册的计算类型
+func (r *mathRule) CalculateTypes() []apiModel.CalculateType {
+	return calculate.CalculateTypes()
+}
+
+// Backtest 以历史数据回测规则, 不保存规则也不发送告警
+func (r *mathRule) Backtest(ctx context.Context, request *apiModel.BacktestRequest) (*apiModel.BacktestResult, error) {
+	var data = &request.Rule
+	if err := compileFilters(data); err != nil {
+		return nil, err
+	}
+
+	return calculate.Backtest(ctx, data, request.Start, request.End)
+}
+
+// Evaluate 以真实的数据源立即计算一次已保存的规则, 不记录计算状态也不发送告警
+func (r *mathRule) Evaluate(ctx context.Context, id int) (*apiModel.EvaluateResult, error) {
+	if id <= 0 {
+		return nil, errors.New("the rule id should be a positive integer")
+	}
+
+	records, count, err := ruleDto.RuleDto.SelectByIds([]int{id})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 || len(*records) == 0 {
+		return nil, fmt.Errorf("the rule with id %d does not exist", id)
+	}
+
+	var data = calculate.MathRule(&(*records)[0])
+	if err := compileFilters(data); err != nil {
+		return nil, err
+	}
+
+	return calculate.Evaluate(ctx, data)
+}
+
+// 旧版的扩展条件迁移为结构化的过滤条件, 并校验过滤条件
+func compileFilters(data *apiModel.MathRule) error {
+	if strings.Compare(data.ExtensionCondition, "") != 0 {
+		filters, err := influxDto.MigrateCondition(data.Filters, data.ExtensionCondition)
+		if err != nil {
+			return errors.New("extension_condition cannot be migrated to filters, please use filters instead: " + err.Error())
+		}
+		data.Filters = filters
+		data.ExtensionCondition = ""
+	}
+
+	if _, err := influxDto.Compile(data.Filters); err != nil {
+		return errors.New("filters: " + err.Error())
+	}
+
+	return nil
+}
+
+// MigrateFilters 将未删除规则的旧版扩展条件迁移为结构化的过滤条件并回写数据库, 无法解析的规则保持不变并逐条记录
+func (r *mathRule) MigrateFilters(updater string) (*apiModel.MigrateFiltersResult, error) {
+	records, _, err := ruleDto.RuleDto.SelectByCondition(&apiModel.MathRuleCondition{Inuse: 2})
+	if err != nil {
+		return nil, err
+	}
+
+	var result = &apiModel.MigrateFiltersResult{Migrated: []string{}, Skipped: []apiModel.MigrateFiltersSkipped{}}
+	for i := range *records {
+		var record = &(*records)[i]
+		if strings.Compare(record.ExtensionCondition, "") == 0 {
+			continue
+		}
+
+		var filters *apiModel.FilterGroup
+		_ = json.Unmarshal([]byte(record.Filters), &filters)
+
+		filters, err := influxDto.MigrateCondition(filters, record.ExtensionCondition)
+		if err != nil {
+			xlogs.Errorf("rule [id = %d, name = %s] has incorrect extension condition {%s}, skip migrating it: %s", record.ID, record.Name, record.ExtensionCondition, err.Error())
+			result.Skipped = append(result.Skipped, apiModel.MigrateFiltersSkipped{
+				Id:                 record.ID,
+				Name:               record.Name,
+				ExtensionCondition: record.ExtensionCondition,
+				Error:              err.Error(),
+			})
+			continue
+		}
+
+		filterStr, _ := json.Marshal(filters)
+		record.Filters = string(filterStr)
+		record.ExtensionCondition = ""
+		record.Updater = updater
+		record.UpdatedAt = time.Now()
+		if err := ruleDto.RuleDto.Save(record); err != nil {
+			return result, fmt.Errorf("save migrated filters for rule [name = %s] error: %s", record.Name, err.Error())
+		}
+
+		xlogs.Infof("extension condition of rule [name = %s] has been migrated to filters: %s", record.Name, record.Filters)
+		result.Migrated = append(result.Migrated, record.Name)
+	}
+
+	return result, nil
+}
@@ -33,6 +33,10 @@ func SuccessJsonResp(c *gin.Context, statusCode, respMsg string, data interface{
 	jsonResp(c, http.StatusOK, constParam.StatusSuccess, statusCode, respMsg, data)
 }
 
+func ErrorJsonResp(c *gin.Context, statusCode, respMsg string, data interface{}) {
+	jsonResp(c, http.StatusBadRequest, constParam.StatusFail, statusCode, respMsg, data)
+}
+
 func resp(c *gin.Context, code int, status bool, statusCode, respMsg string) {
 	response := ResultResp{Status: status, StatusCode: statusCode, Message: respMsg}
 	c.JSON(code, response)
@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -42,6 +43,17 @@ func StringToIntSl(str string) (arrInt []int) {
 	return arrInt
 }
 
+// StringToStringSl 以 ',' 分隔字符串, 忽略空白项
+func StringToStringSl(str string) []string {
+	var result = make([]string, 0)
+	for _, v := range strings.Split(str, constParam.SymbolComma) {
+		if v = strings.TrimSpace(v); v != "" {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
 func DateToString(dt time.Time) string {
 	if dt.IsZero() {
 		return constParam.NULL
@@ -56,6 +68,28 @@ func DateTimeToString(dt time.Time) string {
 	return dt.Format(constParam.DateTimeFormat)
 }
 
+// 已加载的时区, 避免每次都读取时区数据库
+var locations sync.Map
+
+// LoadLocation 加载时区, 为空时使用默认时区
+func LoadLocation(name string) (*time.Location, error) {
+	if strings.Compare(name, "") == 0 {
+		name = constParam.DefaultTimezone
+	}
+
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+
+	return loc, nil
+}
+
 func DatetimeToWholeMinutes(dt time.Time) string {
 	if dt.IsZero() {
 		return constParam.NULL
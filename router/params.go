@@ -15,6 +15,10 @@ const (
 	updateRule          = "/rule/updateRule"          // 更新规则
 	addRule             = "/rule/addRule"             // 添加规则
 	enableOrDisableRule = "/rule/enableOrDisableRule" // 禁用或开启规则
+	calculateTypes      = "/rule/calculateTypes"      // 已注册的计算类型
+	backtest            = "/rule/backtest"            // 以历史数据回测规则
+	evaluate            = "/rule/evaluate/:id"        // 立即计算一次规则(试运行)
+	migrateFilters      = "/rule/migrateFilters"      // 旧版的扩展条件迁移为过滤条件
 
 	checkLoggerRule           = "/rule/logger/checkRule"           // 规则校验
 	queryLoggerRule           = "/rule/logger/queryRule"           // 查询规则
@@ -23,4 +27,27 @@ const (
 	updateLoggerRule          = "/rule/logger/updateRule"          // 更新规则
 	addLoggerRule             = "/rule/logger/addRule"             // 添加规则
 	enableOrDisableLoggerRule = "/rule/logger/enableOrDisableRule" // 禁用或开启规则
+	evaluateLoggerRule        = "/rule/logger/evaluate/:id"        // 立即计算一次规则(试运行)
+
+	checkCompositeRule           = "/rule/composite/checkRule"           // 规则校验
+	queryCompositeRule           = "/rule/composite/queryRule"           // 查询规则
+	batchDeleteCompositeRule     = "/rule/composite/batchDeleteRule"     // 批量删除规则
+	deleteCompositeRule          = "/rule/composite/deleteRule"          // 删除规则
+	updateCompositeRule          = "/rule/composite/updateRule"          // 更新规则
+	addCompositeRule             = "/rule/composite/addRule"             // 添加规则
+	enableOrDisableCompositeRule = "/rule/composite/enableOrDisableRule" // 禁用或开启规则
+
+	// 数据源
+	checkDatasource  = "/datasource/checkDatasource"  // 数据源校验及连通性检查
+	queryDatasource  = "/datasource/queryDatasource"  // 查询数据源
+	addDatasource    = "/datasource/addDatasource"    // 添加数据源
+	updateDatasource = "/datasource/updateDatasource" // 更新数据源
+	deleteDatasource = "/datasource/deleteDatasource" // 删除数据源, 被规则引用时不能删除
+	healthDatasource = "/datasource/health/:id"       // 已保存的数据源的健康检查
+
+	// 指标值上报
+	pushMetric = "/metric/push" // 上报指标值, 支持 json 及 InfluxDB line protocol
+
+	// 告警事件
+	queryAlert = "/alert/queryAlert" // 查询告警事件, 支持以告警标签过滤
 )
@@ -5,7 +5,10 @@ import (
 	"owl-engine/pkg/xlogs"
 
 	"owl-engine/pkg/api/common"
+	"owl-engine/pkg/api/v0/alert"
+	"owl-engine/pkg/api/v0/datasource"
 	"owl-engine/pkg/api/v0/healthy"
+	"owl-engine/pkg/api/v0/metric"
 
 	"owl-engine/pkg/api/v0/rule"
 	"owl-engine/router/middleware"
@@ -84,6 +87,10 @@ func InitRouter() *gin.Engine {
 		ruleGroup.DELETE(deleteRule, rule.Rule.DeleteRule)
 		ruleGroup.DELETE(batchDeleteRule, rule.Rule.BatchDeleteRule)
 		ruleGroup.POST(enableOrDisableRule, rule.Rule.EnableOrDisableRule)
+		ruleGroup.GET(calculateTypes, rule.Rule.CalculateTypes)
+		ruleGroup.POST(backtest, rule.Rule.Backtest)
+		ruleGroup.POST(evaluate, rule.Rule.Evaluate)
+		ruleGroup.POST(migrateFilters, rule.Rule.MigrateFilters)
 	}
 
 	// 日志处理规则
@@ -96,6 +103,42 @@ func InitRouter() *gin.Engine {
 		logGroup.DELETE(deleteLoggerRule, rule.LoggerRule.DeleteRule)
 		logGroup.DELETE(batchDeleteLoggerRule, rule.LoggerRule.BatchDeleteRule)
 		logGroup.POST(enableOrDisableLoggerRule, rule.LoggerRule.EnableOrDisableRule)
+		logGroup.POST(evaluateLoggerRule, rule.LoggerRule.Evaluate)
+	}
+
+	// 组合规则
+	compositeGroup := router.Group(srvGroupUri).Use(middleware.Auth())
+	{
+		compositeGroup.POST(checkCompositeRule, rule.CompositeRule.CheckRule)
+		compositeGroup.POST(addCompositeRule, rule.CompositeRule.AddRule)
+		compositeGroup.GET(queryCompositeRule, rule.CompositeRule.QueryRule)
+		compositeGroup.POST(updateCompositeRule, rule.CompositeRule.UpdateRule)
+		compositeGroup.DELETE(deleteCompositeRule, rule.CompositeRule.DeleteRule)
+		compositeGroup.DELETE(batchDeleteCompositeRule, rule.CompositeRule.BatchDeleteRule)
+		compositeGroup.POST(enableOrDisableCompositeRule, rule.CompositeRule.EnableOrDisableRule)
+	}
+
+	// 数据源
+	datasourceGroup := router.Group(srvGroupUri).Use(middleware.Auth())
+	{
+		datasourceGroup.POST(checkDatasource, datasource.Datasource.CheckDatasource)
+		datasourceGroup.POST(addDatasource, datasource.Datasource.AddDatasource)
+		datasourceGroup.GET(queryDatasource, datasource.Datasource.QueryDatasource)
+		datasourceGroup.POST(updateDatasource, datasource.Datasource.UpdateDatasource)
+		datasourceGroup.DELETE(deleteDatasource, datasource.Datasource.DeleteDatasource)
+		datasourceGroup.GET(healthDatasource, datasource.Datasource.Health)
+	}
+
+	// 指标值上报
+	metricGroup := router.Group(srvGroupUri).Use(middleware.Auth())
+	{
+		metricGroup.POST(pushMetric, metric.Metric.Push)
+	}
+
+	// 告警事件
+	alertGroup := router.Group(srvGroupUri).Use(middleware.Auth())
+	{
+		alertGroup.GET(queryAlert, alert.Alert.QueryAlert)
 	}
 
 	return router